@@ -0,0 +1,348 @@
+// Команда gmadmin — консольный доступ сотрудников к ручным корректировкам баланса.
+// Действия выполняются от имени сотрудника, указанного флагом -actor, и пишутся
+// в тот же журнал аудита, что и запросы к /api/admin. Сотрудник подтверждает себя паролем
+// (GMADMIN_PASSWORD или ввод с stdin) и, если включена 2FA, кодом -code. Порог подтверждения,
+// срок жизни баллов и лимиты попыток входа берутся из настроек, которые сервер записывает
+// в базу при старте.
+//
+//	gmadmin adjust -actor alice -login bob -amount 150.50 -reason "Goodwill" -ticket SUP-123
+//	gmadmin list -actor alice -status PENDING
+//	gmadmin approve -actor carol -id 42
+//	gmadmin reject -actor carol -id 42
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// cliIP записывается в журнал аудита и счётчик попыток вместо адреса клиента.
+const cliIP = "cli"
+
+const usage = `usage: gmadmin <command> [flags]
+
+commands:
+  adjust   credit (positive -amount) or debit (negative -amount) a user's balance
+  list     list balance adjustments
+  approve  approve a pending adjustment (admin only, not its author)
+  reject   reject a pending adjustment (admin only, not its author)
+
+common flags (also read from env):
+  -d           database URI (DATABASE_URI)
+  -migrations  path to migrations folder (MIGRATIONS_PATH)
+  -actor       login of the staff member performing the action
+  -code        two-factor code of the actor, if 2FA is enabled
+
+The actor's password is read from GMADMIN_PASSWORD or, if unset, from stdin.
+`
+
+// settings — настройки сервера, которые gmadmin обязан соблюдать.
+type settings struct {
+	approvalThreshold model.Money
+	expiryMonths      int
+	loginLimits       service.LoginLimitConfig
+}
+
+type options struct {
+	databaseURI    string
+	migrationsPath string
+	actor          string
+	code           string
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err := run(os.Args[1], os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "gmadmin:", err)
+		os.Exit(1)
+	}
+}
+
+func run(command string, args []string) error {
+	var opts options
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	fs.StringVar(&opts.databaseURI, "d", os.Getenv("DATABASE_URI"), "Database URI (env: DATABASE_URI)")
+	fs.StringVar(&opts.migrationsPath, "migrations", envOr("MIGRATIONS_PATH", "./migrations"), "Path to migrations folder (env: MIGRATIONS_PATH)")
+	fs.StringVar(&opts.actor, "actor", "", "Login of the staff member performing the action")
+	fs.StringVar(&opts.code, "code", "", "Two-factor code of the actor, if 2FA is enabled")
+
+	var (
+		login, amount, reason, ticket, status string
+		id                                    int64
+	)
+	switch command {
+	case "adjust":
+		fs.StringVar(&login, "login", "", "Login of the user whose balance is adjusted")
+		fs.StringVar(&amount, "amount", "", "Amount: positive to credit, negative to debit")
+		fs.StringVar(&reason, "reason", "", "Reason shown in the balance history")
+		fs.StringVar(&ticket, "ticket", "", "Support ticket reference")
+	case "list":
+		fs.StringVar(&login, "login", "", "Only adjustments of this user")
+		fs.StringVar(&status, "status", "", "PENDING, APPLIED or REJECTED")
+	case "approve", "reject":
+		fs.Int64Var(&id, "id", 0, "Adjustment id")
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	_ = fs.Parse(args)
+
+	if opts.databaseURI == "" {
+		return errors.New("database URI is required (use -d flag or DATABASE_URI env)")
+	}
+	if opts.actor == "" {
+		return errors.New("actor is required (use -actor flag)")
+	}
+
+	db, err := repository.NewDatabase(repository.DatabaseConfig{
+		DSN:            opts.databaseURI,
+		MigrationsPath: opts.migrationsPath,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	userRepo := repository.NewUserRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	uow := repository.NewUnitOfWork(db)
+
+	server, err := serverSettings(ctx, repository.NewSettingRepository(db))
+	if err != nil {
+		return err
+	}
+	actor, err := authenticate(ctx, db, userRepo, auditRepo, uow, server.loginLimits, opts)
+	if err != nil {
+		return err
+	}
+
+	adjustments := service.NewAdjustmentService(
+		repository.NewAdjustmentRepository(db),
+		userRepo,
+		ledgerRepo,
+		service.NewExpiryService(repository.NewAccrualLotRepository(db), userRepo, ledgerRepo,
+			repository.NewOutboxRepository(db), uow, service.PointsExpiryConfig{Months: server.expiryMonths}),
+		auditRepo,
+		uow,
+		server.approvalThreshold,
+	)
+
+	var userID *int64
+	if login != "" {
+		user, err := service.FindUserByLogin(ctx, userRepo, login)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return fmt.Errorf("user %q not found", login)
+		}
+		userID = &user.ID
+	}
+
+	switch command {
+	case "adjust":
+		if userID == nil {
+			return errors.New("login is required (use -login flag)")
+		}
+		sum, err := model.ParseMoney(amount)
+		if err != nil {
+			return err
+		}
+		return printJSON(adjustments.Create(ctx, actor, *userID, sum, reason, ticket))
+	case "list":
+		return printJSON(adjustments.List(ctx, actor, status, userID))
+	case "approve":
+		return printJSON(adjustments.Approve(ctx, actor, id))
+	default:
+		return printJSON(adjustments.Reject(ctx, actor, id))
+	}
+}
+
+// serverSettings читает порог подтверждения, срок жизни баллов и лимиты попыток входа,
+// записанные сервером. Без них gmadmin не работает: свои значения по умолчанию обошли бы
+// настройки сервера.
+func serverSettings(ctx context.Context, repo repository.SettingRepository) (settings, error) {
+	var server settings
+	value, err := requiredSetting(ctx, repo, model.SettingAdjustmentApprovalThreshold, "adjustment approval threshold")
+	if err != nil {
+		return settings{}, err
+	}
+	server.approvalThreshold, err = model.ParseMoney(value)
+	if err != nil || server.approvalThreshold < 0 {
+		return settings{}, fmt.Errorf("invalid adjustment approval threshold %q in settings", value)
+	}
+
+	value, err = requiredSetting(ctx, repo, model.SettingPointsExpiryMonths, "points expiry")
+	if err != nil {
+		return settings{}, err
+	}
+	server.expiryMonths, err = strconv.Atoi(value)
+	if err != nil || server.expiryMonths < 0 {
+		return settings{}, fmt.Errorf("invalid points expiry %q in settings", value)
+	}
+
+	value, err = requiredSetting(ctx, repo, model.SettingLoginMaxFailures, "login failure limit")
+	if err != nil {
+		return settings{}, err
+	}
+	server.loginLimits.MaxLoginFailures, err = strconv.Atoi(value)
+	if err != nil || server.loginLimits.MaxLoginFailures < 1 {
+		return settings{}, fmt.Errorf("invalid login failure limit %q in settings", value)
+	}
+
+	value, err = requiredSetting(ctx, repo, model.SettingLoginMaxIPFailures, "login failure limit per IP")
+	if err != nil {
+		return settings{}, err
+	}
+	server.loginLimits.MaxIPFailures, err = strconv.Atoi(value)
+	if err != nil || server.loginLimits.MaxIPFailures < 1 {
+		return settings{}, fmt.Errorf("invalid login failure limit per IP %q in settings", value)
+	}
+
+	value, err = requiredSetting(ctx, repo, model.SettingLoginLockout, "login lockout")
+	if err != nil {
+		return settings{}, err
+	}
+	server.loginLimits.LockoutDuration, err = time.ParseDuration(value)
+	if err != nil || server.loginLimits.LockoutDuration <= 0 {
+		return settings{}, fmt.Errorf("invalid login lockout %q in settings", value)
+	}
+	return server, nil
+}
+
+func requiredSetting(ctx context.Context, repo repository.SettingRepository, key, name string) (string, error) {
+	value, ok, err := repo.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%s is not configured, start the server first", name)
+	}
+	return value, nil
+}
+
+// authenticate проверяет пароль сотрудника, код 2FA и роль. Неудачные попытки идут
+// в тот же счётчик, что и вход через API.
+func authenticate(
+	ctx context.Context,
+	db *repository.Database,
+	userRepo repository.UserRepository,
+	auditRepo repository.AuditRepository,
+	uow repository.UnitOfWork,
+	loginLimits service.LoginLimitConfig,
+	opts options,
+) (model.AdminActor, error) {
+	password, err := readPassword()
+	if err != nil {
+		return model.AdminActor{}, err
+	}
+
+	login := service.NormalizeLogin(opts.actor)
+	limiter := service.NewLoginLimiter(repository.NewLoginAttemptRepository(db), auditRepo, uow, loginLimits)
+	if err := limiter.Check(ctx, login, cliIP); err != nil {
+		return model.AdminActor{}, err
+	}
+	staff, err := service.FindUserByLogin(ctx, userRepo, opts.actor)
+	if err != nil {
+		return model.AdminActor{}, err
+	}
+	var staffID *int64
+	if staff != nil {
+		staffID = &staff.ID
+	}
+	if staff == nil || bcrypt.CompareHashAndPassword([]byte(staff.PasswordHash), []byte(password)) != nil {
+		if err := limiter.RecordFailure(ctx, login, cliIP, staffID); err != nil {
+			return model.AdminActor{}, err
+		}
+		return model.AdminActor{}, service.ErrInvalidCredentials
+	}
+	if err := limiter.RecordSuccess(ctx, login); err != nil {
+		return model.AdminActor{}, err
+	}
+
+	twoFactor := service.NewTwoFactorService(repository.NewTwoFactorRepository(db), userRepo, auditRepo, uow, limiter)
+	enabled, err := twoFactor.Enabled(ctx, staff.ID)
+	if err != nil {
+		return model.AdminActor{}, err
+	}
+	if enabled {
+		if opts.code == "" {
+			return model.AdminActor{}, errors.New("two-factor code is required (use -code flag)")
+		}
+		if err := twoFactor.Verify(ctx, staff.ID, opts.code); err != nil {
+			return model.AdminActor{}, err
+		}
+	}
+
+	if staff.Role != model.RoleSupport && staff.Role != model.RoleAdmin {
+		return model.AdminActor{}, fmt.Errorf("actor %q is not a staff member", opts.actor)
+	}
+	return model.AdminActor{UserID: staff.ID, Role: staff.Role, IP: cliIP}, nil
+}
+
+// readPassword берёт пароль из GMADMIN_PASSWORD, а без него читает с терминала без эха
+// или, если stdin перенаправлен, первую строку ввода.
+func readPassword() (string, error) {
+	if password := os.Getenv("GMADMIN_PASSWORD"); password != "" {
+		return password, nil
+	}
+
+	var password string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		raw, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		password = string(raw)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return "", errors.New("password is required (use GMADMIN_PASSWORD env or stdin)")
+	}
+	return password, nil
+}
+
+func printJSON(v any, err error) error {
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"testing"
+	"time"
+)
+
+type mapSettings struct {
+	repository.SettingRepository
+
+	values map[string]string
+}
+
+func (s mapSettings) Get(_ context.Context, key string) (string, bool, error) {
+	value, ok := s.values[key]
+	return value, ok, nil
+}
+
+func publishedSettings() map[string]string {
+	return map[string]string{
+		model.SettingAdjustmentApprovalThreshold: "1000.00",
+		model.SettingPointsExpiryMonths:          "12",
+		model.SettingLoginMaxFailures:            "3",
+		model.SettingLoginMaxIPFailures:          "40",
+		model.SettingLoginLockout:                "30m0s",
+	}
+}
+
+func TestServerSettings(t *testing.T) {
+	server, err := serverSettings(context.Background(), mapSettings{values: publishedSettings()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.approvalThreshold != 100000 || server.expiryMonths != 12 {
+		t.Fatalf("threshold = %d, expiry = %d", server.approvalThreshold, server.expiryMonths)
+	}
+	limits := server.loginLimits
+	if limits.MaxLoginFailures != 3 || limits.MaxIPFailures != 40 || limits.LockoutDuration != 30*time.Minute {
+		t.Fatalf("login limits = %+v", limits)
+	}
+}
+
+func TestServerSettingsRejectsMissingAndInvalid(t *testing.T) {
+	for key := range publishedSettings() {
+		values := publishedSettings()
+		delete(values, key)
+		if _, err := serverSettings(context.Background(), mapSettings{values: values}); err == nil {
+			t.Errorf("missing %s: no error", key)
+		}
+
+		values = publishedSettings()
+		values[key] = "-1"
+		if _, err := serverSettings(context.Background(), mapSettings{values: values}); err == nil {
+			t.Errorf("invalid %s: no error", key)
+		}
+	}
+}
@@ -43,12 +43,36 @@ func runServer(application *app.App, cfg *app.Config) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go app.StartOrderProcessor(ctx, application.OrderService, application.Logger)
+	processorDone := make(chan struct{})
+	go func() {
+		defer close(processorDone)
+		app.StartOrderProcessor(ctx, application.OrderService, application.Logger)
+	}()
+	go app.StartLedgerReconciler(ctx, application.BalanceService, application.Logger)
+	go app.StartOrderEventListener(ctx, application.OrderEventService, application.Logger)
+	go app.StartWebhookDispatcher(ctx, application.WebhookService, application.Logger)
+	go app.StartSessionJanitor(ctx, application.AuthService, application.Logger)
+	go app.StartLoginAttemptJanitor(ctx, application.LoginLimiter, application.Logger)
+	go app.StartIdempotencyJanitor(ctx, application.IdempotencyService, application.Logger)
+	go app.StartHoldSweeper(ctx, application.WithdrawalService, application.Logger)
+	go app.StartWithdrawalCompleter(ctx, application.WithdrawalService, application.Logger)
+	go app.StartPointsExpirer(ctx, application.ExpiryService, application.Logger)
+	go app.StartTierRecalculator(ctx, application.TierService, application.Logger)
+	if cfg.JWTKeysDir != "" {
+		go app.StartJWTKeyReloader(ctx, application.JWTKeys, application.Logger)
+	}
+
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		app.StartEventRelay(ctx, application.EventRelay, application.Logger)
+	}()
 
 	application.Server = &http.Server{
 		Addr:    cfg.RunAddress,
 		Handler: application.Router,
 	}
+	application.Server.RegisterOnShutdown(application.StopStreams)
 
 	go func() {
 		application.Logger.Info("Starting HTTP server",
@@ -70,4 +94,7 @@ func runServer(application *app.App, cfg *app.Config) {
 		application.Logger.Error("Server shutdown error", zap.Error(err))
 	}
 	cancel()
+	<-processorDone
+	<-relayDone
+	application.CloseEvents()
 }
@@ -0,0 +1,94 @@
+// Package accrualtest — поддельная система расчёта для тестов опроса начислений.
+package accrualtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Response — один ответ поддельной системы. Если Body не nil, он отдаётся как JSON.
+type Response struct {
+	StatusCode int
+	RetryAfter string
+	Body       any
+}
+
+// Server отвечает на GET /api/orders/{number} ответами, поставленными в очередь через
+// Enqueue. Когда очередь заказа пуста, повторяется последний ответ, а для неизвестного
+// заказа — 204.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses map[string][]Response
+	last      map[string]Response
+	requests  map[string]int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		responses: make(map[string][]Response),
+		last:      make(map[string]Response),
+		requests:  make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *Server) Enqueue(number string, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[number] = append(s.responses[number], responses...)
+}
+
+// Requests возвращает число запросов по заказу.
+func (s *Server) Requests(number string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[number]
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	number, ok := strings.CutPrefix(r.URL.Path, "/api/orders/")
+	if !ok || r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests[number]++
+	resp, found := s.last[number]
+	if queue := s.responses[number]; len(queue) > 0 {
+		resp, found = queue[0], true
+		s.responses[number] = queue[1:]
+		s.last[number] = resp
+	}
+	s.mu.Unlock()
+
+	if !found {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if resp.RetryAfter != "" {
+		w.Header().Set("Retry-After", resp.RetryAfter)
+	}
+	if resp.Body == nil {
+		w.WriteHeader(resp.StatusCode)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	_ = json.NewEncoder(w).Encode(resp.Body)
+}
+
+// Status — ответ 200 со статусом расчёта и начислением в виде JSON-числа.
+func Status(number, status string, accrual float64) Response {
+	body := map[string]any{"order": number, "status": status}
+	if accrual != 0 {
+		body["accrual"] = accrual
+	}
+	return Response{StatusCode: http.StatusOK, Body: body}
+}
@@ -0,0 +1,157 @@
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+)
+
+const (
+	StatusRegistered = "REGISTERED"
+	StatusInvalid    = "INVALID"
+	StatusProcessing = "PROCESSING"
+	StatusProcessed  = "PROCESSED"
+)
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultRetryAfter = 60 * time.Second
+)
+
+// ErrNotRegistered возвращается, когда система расчёта ответила 204 — заказ ей неизвестен.
+var ErrNotRegistered = errors.New("order is not registered in accrual system")
+
+// ErrRateLimited возвращается при ответе 429 и при ожидании, которое не уложилось в контекст.
+type ErrRateLimited struct {
+	RetryAfter time.Duration
+}
+
+func (e *ErrRateLimited) Error() string {
+	return fmt.Sprintf("accrual system rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
+type AccrualResponse struct {
+	Order   string      `json:"order"`
+	Status  string      `json:"status"`
+	Accrual model.Money `json:"accrual,omitempty"`
+}
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu           sync.Mutex
+	blockedUntil time.Time
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// GetOrder запрашивает расчёт начисления по заказу. Пока действует пауза после 429,
+// все вызовы ждут её окончания.
+func (c *Client) GetOrder(ctx context.Context, number string) (*AccrualResponse, error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.baseURL+"/api/orders/"+url.PathEscape(number), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("accrual request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var result AccrualResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode accrual response: %w", err)
+		}
+		switch result.Status {
+		case StatusRegistered, StatusInvalid, StatusProcessing, StatusProcessed:
+		default:
+			return nil, fmt.Errorf("unknown accrual status %q", result.Status)
+		}
+		return &result, nil
+
+	case http.StatusNoContent:
+		return nil, ErrNotRegistered
+
+	case http.StatusTooManyRequests:
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+		c.block(retryAfter)
+		return nil, &ErrRateLimited{RetryAfter: retryAfter}
+
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+func (c *Client) wait(ctx context.Context) error {
+	c.mu.Lock()
+	until := c.blockedUntil
+	c.mu.Unlock()
+
+	delay := time.Until(until)
+	if delay <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(until) {
+		return &ErrRateLimited{RetryAfter: delay}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Client) block(d time.Duration) {
+	until := time.Now().Add(d)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until.After(c.blockedUntil) {
+		c.blockedUntil = until
+	}
+}
+
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
@@ -0,0 +1,139 @@
+package accrual_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/accrual"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/accrual/accrualtest"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClientStatuses(t *testing.T) {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+	client := accrual.NewClient(srv.URL)
+
+	tests := []struct {
+		number  string
+		status  string
+		accrual float64
+		want    model.Money
+	}{
+		{"1001", accrual.StatusRegistered, 0, 0},
+		{"1002", accrual.StatusProcessing, 0, 0},
+		{"1003", accrual.StatusInvalid, 0, 0},
+		{"1004", accrual.StatusProcessed, 729.98, 72998},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			srv.Enqueue(tt.number, accrualtest.Status(tt.number, tt.status, tt.accrual))
+
+			resp, err := client.GetOrder(context.Background(), tt.number)
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			if resp.Status != tt.status || resp.Accrual != tt.want {
+				t.Errorf("got %s %s, want %s %s", resp.Status, resp.Accrual, tt.status, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientUnknownStatus(t *testing.T) {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+	srv.Enqueue("1001", accrualtest.Status("1001", "DONE", 0))
+
+	if _, err := accrual.NewClient(srv.URL).GetOrder(context.Background(), "1001"); err == nil {
+		t.Fatal("expected error for unknown status")
+	}
+}
+
+func TestClientNotRegistered(t *testing.T) {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+
+	_, err := accrual.NewClient(srv.URL).GetOrder(context.Background(), "1001")
+	if !errors.Is(err, accrual.ErrNotRegistered) {
+		t.Fatalf("got %v, want ErrNotRegistered", err)
+	}
+}
+
+func TestClientServerErrorIsNotTerminal(t *testing.T) {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+	srv.Enqueue("1001", accrualtest.Response{StatusCode: http.StatusBadGateway})
+
+	_, err := accrual.NewClient(srv.URL).GetOrder(context.Background(), "1001")
+	var rateLimited *accrual.ErrRateLimited
+	if err == nil || errors.Is(err, accrual.ErrNotRegistered) || errors.As(err, &rateLimited) {
+		t.Fatalf("got %v, want a plain retryable error", err)
+	}
+}
+
+func TestClientRetryAfterThrottlesAllCalls(t *testing.T) {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+	srv.Enqueue("1001",
+		accrualtest.Response{StatusCode: http.StatusTooManyRequests, RetryAfter: "1"},
+		accrualtest.Status("1001", accrual.StatusProcessing, 0),
+	)
+	srv.Enqueue("1002", accrualtest.Status("1002", accrual.StatusProcessing, 0))
+	client := accrual.NewClient(srv.URL)
+
+	_, err := client.GetOrder(context.Background(), "1001")
+	var rateLimited *accrual.ErrRateLimited
+	if !errors.As(err, &rateLimited) {
+		t.Fatalf("got %v, want ErrRateLimited", err)
+	}
+	if rateLimited.RetryAfter != time.Second {
+		t.Errorf("RetryAfter = %s, want 1s", rateLimited.RetryAfter)
+	}
+
+	// Пауза общая: вызов по другому заказу, не готовый ждать, получает отказ без запроса.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetOrder(ctx, "1002"); !errors.As(err, &rateLimited) {
+		t.Fatalf("got %v, want ErrRateLimited while throttled", err)
+	}
+	if n := srv.Requests("1002"); n != 0 {
+		t.Fatalf("throttled call reached the server %d times", n)
+	}
+
+	// Вызов с запасом по времени дожидается конца паузы.
+	start := time.Now()
+	if _, err := client.GetOrder(context.Background(), "1002"); err != nil {
+		t.Fatalf("GetOrder after pause: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("call was not delayed by Retry-After: %s", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"empty", "", time.Minute, time.Minute},
+		{"seconds", "5", 5 * time.Second, 5 * time.Second},
+		{"zero", "0", 0, 0},
+		{"negative", "-1", time.Minute, time.Minute},
+		{"garbage", "soon", time.Minute, time.Minute},
+		{"http date", time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+		{"past date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := accrual.ParseRetryAfter(tt.value)
+			if got < tt.min || got > tt.max {
+				t.Errorf("ParseRetryAfter(%q) = %s, want [%s, %s]", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+package accrual
+
+var ParseRetryAfter = parseRetryAfter
@@ -3,50 +3,136 @@ package app
 import (
 	"context"
 	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/accrual"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/broker"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/controller"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/core"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/events"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/jwtkeys"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/middlewareinternal"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 )
 
 type App struct {
-	cfg          *Config
-	Router       *chi.Mux
-	db           *repository.Database
-	Logger       *zap.Logger
-	Server       *http.Server
-	OrderService core.OrderProcessor
+	cfg                *Config
+	Router             *chi.Mux
+	db                 *repository.Database
+	Logger             *zap.Logger
+	Server             *http.Server
+	AuthService        service.AuthService
+	TwoFactorService   service.TwoFactorService
+	LoginLimiter       service.LoginLimiter
+	OrderService       core.OrderProcessor
+	BalanceService     service.BalanceService
+	WithdrawalService  service.WithdrawalService
+	IdempotencyService service.IdempotencyService
+	ExpiryService      service.ExpiryService
+	TierService        service.TierService
+	OrderEventService  service.OrderEventService
+	WebhookService     service.WebhookService
+	EventRelay         service.EventRelay
+
+	JWTKeys        *jwtkeys.Manager
+	eventPublisher events.Publisher
+	accrualClient  *accrual.Client
+	streamsStop    chan struct{}
+	stopStreams    sync.Once
 }
 
 func New(cfg *Config) *App {
 	app := &App{
-		cfg:    cfg,
-		Router: chi.NewRouter(),
-		Logger: zap.L(),
+		cfg:           cfg,
+		Router:        chi.NewRouter(),
+		Logger:        zap.L(),
+		accrualClient: accrual.NewClient(cfg.AccrualSystemAddress),
+		streamsStop:   make(chan struct{}),
 	}
 
 	app.initDB()
+	app.publishSettings()
 
 	orderRepo := repository.NewOrderRepository(app.db)
 
 	userRepo := repository.NewUserRepository(app.db)
+	withdrawalRepo := repository.NewWithdrawalRepository(app.db)
+	ledgerRepo := repository.NewLedgerRepository(app.db)
+	outboxRepo := repository.NewOutboxRepository(app.db)
+	uow := repository.NewUnitOfWork(app.db)
+
+	jwtKeys, err := cfg.jwtKeys()
+	if err != nil {
+		app.Logger.Fatal("Failed to load JWT keys", zap.Error(err))
+	}
+	app.JWTKeys = jwtKeys
+
+	auditRepo := repository.NewAuditRepository(app.db)
+	loginLimiter := service.NewLoginLimiter(repository.NewLoginAttemptRepository(app.db), auditRepo, uow, cfg.loginLimits())
+	app.LoginLimiter = loginLimiter
+	passwordPolicy, err := service.NewPasswordPolicy(cfg.PasswordMinLength, cfg.BreachedPasswordsFile)
+	if err != nil {
+		app.Logger.Fatal("Failed to load password policy", zap.Error(err))
+	}
+	app.TwoFactorService = service.NewTwoFactorService(repository.NewTwoFactorRepository(app.db), userRepo, auditRepo, uow, loginLimiter)
+	app.AuthService = service.NewAuthService(userRepo, repository.NewSessionRepository(app.db), outboxRepo, uow,
+		loginLimiter, passwordPolicy, auditRepo, app.TwoFactorService, jwtKeys, cfg.auth())
+	app.WebhookService = service.NewWebhookService(repository.NewWebhookRepository(app.db), app.Logger)
+	app.ExpiryService = service.NewExpiryService(repository.NewAccrualLotRepository(app.db), userRepo, ledgerRepo, outboxRepo, uow, cfg.pointsExpiry())
+	if n, err := app.ExpiryService.ApplyOpeningExpiry(context.Background()); err != nil {
+		app.Logger.Fatal("Failed to apply points expiry to opening balances", zap.Error(err))
+	} else if n > 0 {
+		app.Logger.Info("Points expiry applied to opening balances", zap.Int64("lots", n))
+	}
+	app.TierService = service.NewTierService(repository.NewTierRepository(app.db), userRepo, outboxRepo, uow, cfg.loyaltyTiers())
+	app.OrderService = service.NewOrderService(orderRepo, app.accrualClient, userRepo, ledgerRepo, app.ExpiryService, app.TierService, app.WebhookService, outboxRepo, uow, cfg.orderProcessing(), app.Logger)
+	app.BalanceService = service.NewBalanceService(userRepo, orderRepo, withdrawalRepo, ledgerRepo, app.ExpiryService)
+	app.WithdrawalService = service.NewWithdrawalService(withdrawalRepo, repository.NewHoldRepository(app.db), userRepo, ledgerRepo, app.ExpiryService,
+		app.WebhookService, outboxRepo, auditRepo, uow, app.TwoFactorService, cfg.withdrawals())
+	app.IdempotencyService = service.NewIdempotencyService(repository.NewIdempotencyRepository(app.db))
+	app.OrderEventService = service.NewOrderEventService(repository.NewOrderEventRepository(app.db), broker.New())
 
-	app.OrderService = service.NewOrderService(orderRepo, cfg.AccrualSystemAddress, userRepo, app.Logger)
+	if cfg.EventsSink != "" {
+		publisher, err := events.NewPublisher(cfg.EventsSink)
+		if err != nil {
+			app.Logger.Fatal("Failed to create events publisher", zap.Error(err))
+		}
+		app.eventPublisher = publisher
+	} else {
+		app.Logger.Warn("No events sink configured: domain events are kept in the outbox unpublished and purged after retention",
+			zap.Duration("retention", cfg.OutboxRetention))
+	}
+	app.EventRelay = service.NewEventRelay(outboxRepo, uow, app.eventPublisher, cfg.OutboxRetention)
 
 	app.initRouter()
 	return app
 }
 
-func (a *App) Run(ctx context.Context) error {
-	a.initDB()
-	a.initRouter()
+// publishSettings записывает в базу настройки, которые должны совпадать у сервера и gmadmin.
+func (a *App) publishSettings() {
+	settings := map[string]string{
+		model.SettingAdjustmentApprovalThreshold: a.cfg.adjustmentApprovalThreshold.String(),
+		model.SettingPointsExpiryMonths:          strconv.Itoa(a.cfg.PointsExpiryMonths),
+		model.SettingLoginMaxFailures:            strconv.Itoa(a.cfg.LoginMaxFailures),
+		model.SettingLoginMaxIPFailures:          strconv.Itoa(a.cfg.LoginMaxIPFailures),
+		model.SettingLoginLockout:                a.cfg.LoginLockout.String(),
+	}
+	repo := repository.NewSettingRepository(a.db)
+	for key, value := range settings {
+		if err := repo.Set(context.Background(), key, value); err != nil {
+			a.Logger.Fatal("Failed to publish settings", zap.Error(err))
+		}
+	}
+}
 
+func (a *App) Run(ctx context.Context) error {
 	a.Server = &http.Server{
 		Addr:    a.cfg.RunAddress,
 		Handler: a.Router,
@@ -95,36 +181,124 @@ func (a *App) initRouter() {
 	userRepo := repository.NewUserRepository(a.db)
 	orderRepo := repository.NewOrderRepository(a.db)
 	withdrawalRepo := repository.NewWithdrawalRepository(a.db)
+	ledgerRepo := repository.NewLedgerRepository(a.db)
+	outboxRepo := repository.NewOutboxRepository(a.db)
+	uow := repository.NewUnitOfWork(a.db)
 
-	authService := service.NewAuthService(userRepo, a.cfg.JWTSecretKey)
-	orderService := service.NewOrderService(orderRepo, a.cfg.AccrualSystemAddress, userRepo, a.Logger)
-	balanceService := service.NewBalanceService(userRepo, orderRepo, withdrawalRepo)
-	withdrawalService := service.NewWithdrawalService(withdrawalRepo, userRepo)
+	authService := a.AuthService
+	// Обработчики и фоновый опрос работают с одним OrderService и его долгоживущим пулом.
+	orderService := a.OrderService
+	balanceService := a.BalanceService
+	auditRepo := repository.NewAuditRepository(a.db)
+	withdrawalService := a.WithdrawalService
+	apiKeyService := service.NewAPIKeyService(repository.NewAPIKeyRepository(a.db), userRepo)
+	adminService := service.NewAdminService(userRepo, orderRepo, withdrawalRepo, auditRepo, outboxRepo, uow,
+		a.TwoFactorService, authService)
+	adjustmentService := service.NewAdjustmentService(repository.NewAdjustmentRepository(a.db), userRepo, ledgerRepo, a.ExpiryService,
+		auditRepo, uow, a.cfg.adjustmentApprovalThreshold)
 
 	logger := a.Logger
 	// Controllers
 	authController := controller.NewAuthController(authService, logger)
 	orderController := controller.NewOrderController(orderService, logger)
+	orderStreamController := controller.NewOrderStreamController(a.OrderEventService, a.streamsStop, logger)
 	balanceController := controller.NewBalanceController(balanceService)
-	withdrawalController := controller.NewWithdrawalController(withdrawalService)
+	withdrawalController := controller.NewWithdrawalController(withdrawalService, a.IdempotencyService)
+	webhookController := controller.NewWebhookController(a.WebhookService, logger)
+	jwksController := controller.NewJWKSController(a.JWTKeys)
+	twoFactorController := controller.NewTwoFactorController(a.TwoFactorService, logger)
+	apiKeyController := controller.NewAPIKeyController(apiKeyService, logger)
+	adminController := controller.NewAdminController(adminService, logger)
+	adjustmentController := controller.NewAdjustmentController(adjustmentService, logger)
+	profileController := controller.NewProfileController(a.TierService, logger)
 
 	// Public routes
+	a.Router.Get("/.well-known/jwks.json", jwksController.Get)
 	a.Router.Post("/api/user/register", authController.Register)
 	a.Router.Post("/api/user/login", authController.Login)
+	a.Router.Post("/api/user/login/2fa", authController.LoginTwoFactor)
+	a.Router.Post("/api/user/token/refresh", authController.Refresh)
 
 	// Protected routes
 	a.Router.Group(func(r chi.Router) {
-		r.Use(middlewareinternal.JWTAuthMiddleware(authService))
+		r.Use(middlewareinternal.JWTAuthMiddleware(authService, apiKeyService))
+
+		// Доступны и по API-ключу с соответствующим правом
+		r.With(middlewareinternal.RequireScope(model.ScopeOrdersWrite)).Post("/api/user/orders", orderController.UploadOrder)
+		r.With(middlewareinternal.RequireScope(model.ScopeOrdersRead)).Get("/api/user/orders", orderController.GetOrders)
+		r.With(middlewareinternal.RequireScope(model.ScopeOrdersRead)).Get("/api/user/orders/stream", orderStreamController.Stream)
+		r.With(middlewareinternal.RequireScope(model.ScopeOrdersRead)).Get("/api/user/orders/{number}", orderController.GetOrder)
+		r.With(middlewareinternal.RequireScope(model.ScopeBalanceRead)).Get("/api/user/balance", balanceController.GetBalance)
+		r.With(middlewareinternal.RequireScope(model.ScopeBalanceRead)).Get("/api/user/balance/history", balanceController.GetHistory)
+		r.With(middlewareinternal.RequireScope(model.ScopeBalanceRead)).Get("/api/user/profile", profileController.Get)
+		r.With(middlewareinternal.RequireScope(model.ScopeWithdrawalsWrite)).Post("/api/user/balance/withdraw", withdrawalController.Withdraw)
+		r.With(middlewareinternal.RequireScope(model.ScopeWithdrawalsRead)).Get("/api/user/withdrawals", withdrawalController.GetWithdrawals)
+		r.With(middlewareinternal.RequireScope(model.ScopeWithdrawalsWrite)).Post("/api/user/balance/holds", withdrawalController.Hold)
+		r.With(middlewareinternal.RequireScope(model.ScopeBalanceRead)).Get("/api/user/balance/holds", withdrawalController.GetHolds)
+		r.With(middlewareinternal.RequireScope(model.ScopeWithdrawalsWrite)).Post("/api/user/balance/holds/{id}/capture", withdrawalController.Capture)
+		r.With(middlewareinternal.RequireScope(model.ScopeWithdrawalsWrite)).Post("/api/user/balance/holds/{id}/release", withdrawalController.Release)
+
+		// Управление аккаунтом — только из сессии
+		r.Group(func(r chi.Router) {
+			r.Use(middlewareinternal.RequireSession)
 
-		r.Post("/api/user/orders", orderController.UploadOrder)
-		r.Get("/api/user/orders", orderController.GetOrders)
-		r.Get("/api/user/balance", balanceController.GetBalance)
-		r.Post("/api/user/balance/withdraw", withdrawalController.Withdraw)
-		r.Get("/api/user/withdrawals", withdrawalController.GetWithdrawals)
+			r.Post("/api/user/logout", authController.Logout)
+			r.Post("/api/user/password", authController.ChangePassword)
+			r.Post("/api/user/2fa/setup", twoFactorController.Setup)
+			r.Post("/api/user/2fa/confirm", twoFactorController.Confirm)
+			r.Post("/api/user/2fa/disable", twoFactorController.Disable)
+			r.Post("/api/user/webhooks", webhookController.Create)
+			r.Get("/api/user/webhooks", webhookController.List)
+			r.Delete("/api/user/webhooks/{id}", webhookController.Delete)
+			r.Get("/api/user/webhooks/{id}/deliveries", webhookController.Deliveries)
+			r.Post("/api/user/api-keys", apiKeyController.Create)
+			r.Get("/api/user/api-keys", apiKeyController.List)
+			r.Delete("/api/user/api-keys/{id}", apiKeyController.Revoke)
+		})
+
+		// Партнёрские системы: API-ключ сотрудника с правом withdrawals:reverse
+		r.With(middlewareinternal.RequireAPIKeyScope(model.ScopeWithdrawalsReverse)).Post("/api/partner/withdrawals/{order}/complete", withdrawalController.Complete)
+		r.With(middlewareinternal.RequireAPIKeyScope(model.ScopeWithdrawalsReverse)).Post("/api/partner/withdrawals/{order}/reverse", withdrawalController.Reverse)
+
+		// Операторский доступ: поддержка читает и переопрашивает заказы, роли меняет только администратор
+		r.Group(func(r chi.Router) {
+			r.Use(middlewareinternal.RequireRole(model.RoleSupport, model.RoleAdmin))
+
+			r.Get("/api/admin/users", adminController.FindUser)
+			r.Get("/api/admin/users/{id}", adminController.GetUser)
+			r.With(middlewareinternal.RequireRole(model.RoleAdmin)).Put("/api/admin/users/{id}/role", adminController.SetRole)
+			r.Get("/api/admin/orders", adminController.SearchOrders)
+			r.Post("/api/admin/orders/{number}/repoll", adminController.RepollOrder)
+			r.Get("/api/admin/withdrawals", adminController.ListWithdrawals)
+			r.Post("/api/admin/withdrawals/{order}/complete", withdrawalController.Complete)
+			r.Post("/api/admin/withdrawals/{order}/reverse", withdrawalController.Reverse)
+			r.With(middlewareinternal.RequireRole(model.RoleAdmin)).Post("/api/admin/reversals/{id}/approve", withdrawalController.ApproveReversal)
+			r.With(middlewareinternal.RequireRole(model.RoleAdmin)).Post("/api/admin/reversals/{id}/reject", withdrawalController.RejectReversal)
+			r.Post("/api/admin/users/{id}/adjustments", adjustmentController.Create)
+			r.Get("/api/admin/adjustments", adjustmentController.List)
+			r.With(middlewareinternal.RequireRole(model.RoleAdmin)).Post("/api/admin/adjustments/{id}/approve", adjustmentController.Approve)
+			r.With(middlewareinternal.RequireRole(model.RoleAdmin)).Post("/api/admin/adjustments/{id}/reject", adjustmentController.Reject)
+		})
 	})
 }
 
+// StopStreams закрывает открытые SSE-соединения перед остановкой сервера.
+func (a *App) StopStreams() {
+	a.stopStreams.Do(func() { close(a.streamsStop) })
+}
+
+// CloseEvents закрывает публикатор доменных событий после остановки ретранслятора.
+func (a *App) CloseEvents() {
+	if a.eventPublisher == nil {
+		return
+	}
+	if err := a.eventPublisher.Close(); err != nil {
+		a.Logger.Warn("Failed to close events publisher", zap.Error(err))
+	}
+}
+
 func (a *App) shutdown() error {
+	a.StopStreams()
 	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
 	defer cancel()
 	return a.Server.Shutdown(ctx)
@@ -146,3 +320,303 @@ func StartOrderProcessor(ctx context.Context, processor core.OrderProcessor, log
 		}
 	}
 }
+
+// StartLedgerReconciler периодически сверяет балансы пользователей с журналом проводок
+// и пишет в лог все расхождения.
+func StartLedgerReconciler(ctx context.Context, balances service.BalanceService, logger *zap.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		mismatches, err := balances.Reconcile(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("Ledger reconciliation failed", zap.Error(err))
+		}
+		for _, m := range mismatches {
+			logger.Error("Balance does not match ledger",
+				zap.Int64("user_id", m.UserID),
+				zap.Stringer("balance", m.Balance),
+				zap.Stringer("ledger_balance", m.LedgerBalance))
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Ledger reconciliation stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// StartOrderEventListener пересылает события заказов из Postgres в подписчиков SSE,
+// перезапуская подписку при ошибках.
+func StartOrderEventListener(ctx context.Context, events service.OrderEventService, logger *zap.Logger) {
+	for {
+		if err := events.Run(ctx); err != nil {
+			logger.Error("Order event listener failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Order event listener stopped")
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// StartWebhookDispatcher каждые несколько секунд отправляет подошедшие сообщения webhook-outbox.
+func StartWebhookDispatcher(ctx context.Context, webhooks service.WebhookService, logger *zap.Logger) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+			if err := webhooks.Dispatch(ctx); err != nil && ctx.Err() == nil {
+				logger.Error("Webhook dispatch failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// StartEventRelay переносит доменные события из outbox в публикатор. Пока outbox
+// не опустел, пачки идут одна за другой, затем ретранслятор ждёт следующего тика.
+// Раз в час опубликованные события старше срока хранения удаляются.
+func StartEventRelay(ctx context.Context, relay service.EventRelay, logger *zap.Logger) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	purge := time.NewTicker(time.Hour)
+	defer purge.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Event relay stopped")
+			return
+		case <-purge.C:
+			deleted, err := relay.Purge(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Error("Failed to purge published events", zap.Error(err))
+				}
+			} else if deleted > 0 {
+				logger.Info("Published events purged", zap.Int64("count", deleted))
+			}
+			continue
+		case <-ticker.C:
+		}
+
+		for ctx.Err() == nil {
+			n, err := relay.Relay(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Error("Event relay failed", zap.Error(err))
+				}
+				break
+			}
+			if n == 0 {
+				break
+			}
+		}
+	}
+}
+
+// StartSessionJanitor раз в час удаляет давно истёкшие сессии.
+func StartSessionJanitor(ctx context.Context, auth service.AuthService, logger *zap.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Session janitor stopped")
+			return
+		case <-ticker.C:
+			deleted, err := auth.PurgeExpiredSessions(ctx)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("Failed to purge expired sessions", zap.Error(err))
+				continue
+			}
+			if deleted > 0 {
+				logger.Info("Expired sessions purged", zap.Int64("count", deleted))
+			}
+		}
+	}
+}
+
+// StartLoginAttemptJanitor раз в час удаляет счётчики неудачных входов, которые
+// истекли и ничего уже не блокируют.
+func StartLoginAttemptJanitor(ctx context.Context, limiter service.LoginLimiter, logger *zap.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Login attempt janitor stopped")
+			return
+		case <-ticker.C:
+			deleted, err := limiter.Purge(ctx)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("Failed to purge stale login attempts", zap.Error(err))
+				continue
+			}
+			if deleted > 0 {
+				logger.Info("Stale login attempts purged", zap.Int64("count", deleted))
+			}
+		}
+	}
+}
+
+// StartIdempotencyJanitor раз в час удаляет ключи идемпотентности, срок которых истёк.
+func StartIdempotencyJanitor(ctx context.Context, idempotency service.IdempotencyService, logger *zap.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Idempotency janitor stopped")
+			return
+		case <-ticker.C:
+			deleted, err := idempotency.PurgeExpired(ctx)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("Failed to purge expired idempotency keys", zap.Error(err))
+				continue
+			}
+			if deleted > 0 {
+				logger.Info("Expired idempotency keys purged", zap.Int64("count", deleted))
+			}
+		}
+	}
+}
+
+// StartWithdrawalCompleter раз в минуту подтверждает списания, по которым партнёр
+// не ответил за -withdrawal-auto-complete.
+func StartWithdrawalCompleter(ctx context.Context, withdrawals service.WithdrawalService, logger *zap.Logger) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Withdrawal completer stopped")
+			return
+		case <-ticker.C:
+			for {
+				completed, err := withdrawals.CompleteOverdue(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						logger.Error("Failed to complete overdue withdrawals", zap.Error(err))
+					}
+					break
+				}
+				if completed == 0 {
+					break
+				}
+				logger.Info("Overdue withdrawals completed", zap.Int("count", completed))
+			}
+		}
+	}
+}
+
+// StartHoldSweeper раз в минуту снимает просроченные резервы баллов.
+func StartHoldSweeper(ctx context.Context, withdrawals service.WithdrawalService, logger *zap.Logger) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Hold sweeper stopped")
+			return
+		case <-ticker.C:
+			for {
+				released, err := withdrawals.ReleaseExpiredHolds(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						logger.Error("Failed to release expired holds", zap.Error(err))
+					}
+					break
+				}
+				if released == 0 {
+					break
+				}
+				logger.Info("Expired holds released", zap.Int("count", released))
+			}
+		}
+	}
+}
+
+// StartPointsExpirer раз в час списывает сгоревшие баллы.
+func StartPointsExpirer(ctx context.Context, expiry service.ExpiryService, logger *zap.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Points expirer stopped")
+			return
+		case <-ticker.C:
+			expired, err := expiry.ExpireDue(ctx)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("Failed to expire points", zap.Error(err))
+			}
+			if expired > 0 {
+				logger.Info("Points expired", zap.Int("users", expired))
+			}
+		}
+	}
+}
+
+// StartTierRecalculator пересчитывает уровни лояльности каждую ночь в 03:00 по времени сервера.
+func StartTierRecalculator(ctx context.Context, tiers service.TierService, logger *zap.Logger) {
+	for {
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), 3, 0, 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("Tier recalculator stopped")
+			return
+		case <-timer.C:
+			changed, err := tiers.Recalculate(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Error("Failed to recalculate loyalty tiers", zap.Error(err))
+				}
+			} else {
+				logger.Info("Loyalty tiers recalculated", zap.Int("changed", changed))
+			}
+		}
+	}
+}
+
+// StartJWTKeyReloader раз в минуту перечитывает каталог ключей, чтобы ротация
+// не требовала перезапуска.
+func StartJWTKeyReloader(ctx context.Context, keys *jwtkeys.Manager, logger *zap.Logger) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("JWT key reloader stopped")
+			return
+		case <-ticker.C:
+			if err := keys.Reload(); err != nil {
+				logger.Error("Failed to reload JWT keys, keeping previous ones", zap.Error(err))
+			}
+		}
+	}
+}
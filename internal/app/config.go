@@ -2,17 +2,67 @@ package app
 
 import (
 	"flag"
+	"fmt"
 	"net/url"
 	"os"
+	"strconv"
+	"time"
+
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/jwtkeys"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Config struct {
-	RunAddress           string
-	DatabaseURI          string
-	AccrualSystemAddress string
-	LogLevel             string
-	JWTSecretKey         string
-	MigrationsPath       string
+	RunAddress            string
+	DatabaseURI           string
+	AccrualSystemAddress  string
+	LogLevel              string
+	JWTSecretKey          string
+	JWTKeysDir            string
+	JWTSigningKeyID       string
+	MigrationsPath        string
+	AccrualWorkers        int
+	AccrualQueueSize      int
+	AccrualPageSize       int
+	AccrualLeaseTTL       time.Duration
+	InstanceID            string
+	EventsSink            string
+	OutboxRetention       time.Duration
+	AccessTokenTTL        time.Duration
+	RefreshTokenTTL       time.Duration
+	LoginMaxFailures      int
+	LoginMaxIPFailures    int
+	LoginLockout          time.Duration
+	PasswordMinLength     int
+	BreachedPasswordsFile string
+	BcryptCost            int
+	// WithdrawalTwoFactorThreshold — сумма, выше которой списание требует кода 2FA; "0" — без 2FA.
+	WithdrawalTwoFactorThreshold string
+	// AdjustmentApprovalThreshold — сумма ручной корректировки, выше которой нужно
+	// подтверждение второго администратора; "0" — подтверждение нужно для любой суммы.
+	AdjustmentApprovalThreshold string
+	// ReversalApprovalThreshold — сумма возврата списания, выше которой нужно подтверждение
+	// второго администратора; "0" — подтверждение нужно для любой суммы.
+	ReversalApprovalThreshold string
+	// HoldTTL — срок резерва баллов, если клиент не указал свой.
+	HoldTTL time.Duration
+	// WithdrawalAutoComplete — через сколько списание подтверждается, если партнёр не ответил.
+	WithdrawalAutoComplete time.Duration
+	// PointsExpiryMonths — срок жизни начисленных баллов в месяцах; 0 — баллы не сгорают.
+	PointsExpiryMonths   int
+	PointsExpiringWindow time.Duration
+	// Tiers — уровни лояльности вида "SILVER:1000:5,GOLD:5000:10" (имя, порог, надбавка в %);
+	// порог считается по TierBasis за скользящее окно TierWindow. Пусто — уровней нет.
+	Tiers      string
+	TierBasis  string
+	TierWindow time.Duration
+
+	withdrawalTwoFactorThreshold model.Money
+	adjustmentApprovalThreshold  model.Money
+	reversalApprovalThreshold    model.Money
+	tiers                        []model.Tier
 }
 
 func NewConfigFromFlags() *Config {
@@ -23,7 +73,34 @@ func NewConfigFromFlags() *Config {
 	flag.StringVar(&cfg.AccrualSystemAddress, "r", "", "Accrual system address (env: ACCRUAL_SYSTEM_ADDRESS)")
 	flag.StringVar(&cfg.LogLevel, "l", "debug", "Log level (debug|info|warn|error) (env: LOG_LEVEL)")
 	flag.StringVar(&cfg.JWTSecretKey, "jwt-secret", "", "JWT secret key (env: JWT_SECRET_KEY)")
+	flag.StringVar(&cfg.JWTKeysDir, "jwt-keys-dir", "", "Directory with RS256/EdDSA PEM keys, replaces -jwt-secret (env: JWT_KEYS_DIR)")
+	flag.StringVar(&cfg.JWTSigningKeyID, "jwt-signing-kid", "", "Key ID used to sign new tokens, defaults to the greatest kid (env: JWT_SIGNING_KID)")
 	flag.StringVar(&cfg.MigrationsPath, "migrations", "./migrations", "Path to migrations folder (env:MIGRATIONS_PATH)")
+	flag.IntVar(&cfg.AccrualWorkers, "accrual-workers", 8, "Number of concurrent accrual pollers (env: ACCRUAL_WORKERS)")
+	flag.IntVar(&cfg.AccrualQueueSize, "accrual-queue", 100, "Accrual polling queue depth (env: ACCRUAL_QUEUE_SIZE)")
+	flag.IntVar(&cfg.AccrualPageSize, "accrual-page-size", 100, "Orders claimed per lease query (env: ACCRUAL_PAGE_SIZE)")
+	flag.DurationVar(&cfg.AccrualLeaseTTL, "accrual-lease-ttl", time.Minute, "How long an instance holds claimed orders (env: ACCRUAL_LEASE_TTL)")
+	flag.StringVar(&cfg.InstanceID, "instance-id", defaultInstanceID(), "Unique instance name used as order lease owner (env: INSTANCE_ID)")
+	flag.StringVar(&cfg.EventsSink, "events-sink", "", "Domain events sink: stdout or file:<path>, empty keeps events in the outbox unpublished until -outbox-retention (env: EVENTS_SINK)")
+	flag.DurationVar(&cfg.OutboxRetention, "outbox-retention", 7*24*time.Hour, "How long published domain events (or all of them without -events-sink) stay in the outbox (env: OUTBOX_RETENTION)")
+	flag.DurationVar(&cfg.AccessTokenTTL, "access-token-ttl", 15*time.Minute, "Access token lifetime (env: ACCESS_TOKEN_TTL)")
+	flag.DurationVar(&cfg.RefreshTokenTTL, "refresh-token-ttl", 30*24*time.Hour, "Refresh token lifetime (env: REFRESH_TOKEN_TTL)")
+	flag.IntVar(&cfg.LoginMaxFailures, "login-max-failures", 5, "Failed logins per account before lockout (env: LOGIN_MAX_FAILURES)")
+	flag.IntVar(&cfg.LoginMaxIPFailures, "login-max-ip-failures", 50, "Failed logins per client IP before lockout (env: LOGIN_MAX_IP_FAILURES)")
+	flag.DurationVar(&cfg.LoginLockout, "login-lockout", 15*time.Minute, "Login lockout duration (env: LOGIN_LOCKOUT)")
+	flag.IntVar(&cfg.PasswordMinLength, "password-min-length", 8, "Minimum password length for new passwords (env: PASSWORD_MIN_LENGTH)")
+	flag.StringVar(&cfg.BreachedPasswordsFile, "breached-passwords", "", "File with breached passwords, one per line (env: BREACHED_PASSWORDS_FILE)")
+	flag.IntVar(&cfg.BcryptCost, "bcrypt-cost", bcrypt.DefaultCost, "bcrypt cost for password hashes (env: BCRYPT_COST)")
+	flag.StringVar(&cfg.WithdrawalTwoFactorThreshold, "withdrawal-2fa-threshold", "0", "Withdrawals above this sum require a 2FA code, 0 disables (env: WITHDRAWAL_2FA_THRESHOLD)")
+	flag.StringVar(&cfg.AdjustmentApprovalThreshold, "adjustment-approval-threshold", "1000", "Balance adjustments above this sum need a second admin's approval, 0 requires it for any sum (env: ADJUSTMENT_APPROVAL_THRESHOLD)")
+	flag.StringVar(&cfg.ReversalApprovalThreshold, "reversal-approval-threshold", "1000", "Withdrawal reversals above this sum need a second admin's approval, 0 requires it for any sum (env: REVERSAL_APPROVAL_THRESHOLD)")
+	flag.DurationVar(&cfg.HoldTTL, "hold-ttl", 15*time.Minute, "Default lifetime of a balance hold, 1m to 24h (env: HOLD_TTL)")
+	flag.DurationVar(&cfg.WithdrawalAutoComplete, "withdrawal-auto-complete", 72*time.Hour, "Pending withdrawals not confirmed by the partner are completed after this delay (env: WITHDRAWAL_AUTO_COMPLETE)")
+	flag.IntVar(&cfg.PointsExpiryMonths, "points-expiry-months", 0, "Months after crediting when points expire, 0 disables (env: POINTS_EXPIRY_MONTHS)")
+	flag.DurationVar(&cfg.PointsExpiringWindow, "points-expiring-window", 30*24*time.Hour, "Horizon of the expiring_soon balance field (env: POINTS_EXPIRING_WINDOW)")
+	flag.StringVar(&cfg.Tiers, "tiers", "", "Loyalty tiers as NAME:THRESHOLD:BONUS_PERCENT, comma-separated, e.g. SILVER:1000:5,GOLD:5000:10; empty disables (env: TIERS)")
+	flag.StringVar(&cfg.TierBasis, "tier-basis", model.TierBasisAccrual, "Tier threshold basis: accrual or orders (env: TIER_BASIS)")
+	flag.DurationVar(&cfg.TierWindow, "tier-window", 365*24*time.Hour, "Rolling window for tier calculation (env: TIER_WINDOW)")
 	flag.Parse()
 
 	cfg.applyEnvVars()
@@ -42,15 +119,173 @@ func (c *Config) applyEnvVars() {
 	if envAccrual := os.Getenv("ACCRUAL_SYSTEM_ADDRESS"); envAccrual != "" {
 		c.AccrualSystemAddress = envAccrual
 	}
+	if envSecret := os.Getenv("JWT_SECRET_KEY"); envSecret != "" {
+		c.JWTSecretKey = envSecret
+	}
+	if envKeysDir := os.Getenv("JWT_KEYS_DIR"); envKeysDir != "" {
+		c.JWTKeysDir = envKeysDir
+	}
+	if envSigningKID := os.Getenv("JWT_SIGNING_KID"); envSigningKID != "" {
+		c.JWTSigningKeyID = envSigningKID
+	}
 	if envLogLevel := os.Getenv("LOG_LEVEL"); envLogLevel != "" {
 		c.LogLevel = envLogLevel
 	}
+	if envWorkers, err := strconv.Atoi(os.Getenv("ACCRUAL_WORKERS")); err == nil {
+		c.AccrualWorkers = envWorkers
+	}
+	if envQueue, err := strconv.Atoi(os.Getenv("ACCRUAL_QUEUE_SIZE")); err == nil {
+		c.AccrualQueueSize = envQueue
+	}
+	if envPageSize, err := strconv.Atoi(os.Getenv("ACCRUAL_PAGE_SIZE")); err == nil {
+		c.AccrualPageSize = envPageSize
+	}
+	if envLeaseTTL, err := time.ParseDuration(os.Getenv("ACCRUAL_LEASE_TTL")); err == nil {
+		c.AccrualLeaseTTL = envLeaseTTL
+	}
+	if envInstanceID := os.Getenv("INSTANCE_ID"); envInstanceID != "" {
+		c.InstanceID = envInstanceID
+	}
+	if envEventsSink := os.Getenv("EVENTS_SINK"); envEventsSink != "" {
+		c.EventsSink = envEventsSink
+	}
+	if envOutboxRetention, err := time.ParseDuration(os.Getenv("OUTBOX_RETENTION")); err == nil {
+		c.OutboxRetention = envOutboxRetention
+	}
+	if envAccessTTL, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL")); err == nil {
+		c.AccessTokenTTL = envAccessTTL
+	}
+	if envRefreshTTL, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL")); err == nil {
+		c.RefreshTokenTTL = envRefreshTTL
+	}
+	if envMaxFailures, err := strconv.Atoi(os.Getenv("LOGIN_MAX_FAILURES")); err == nil {
+		c.LoginMaxFailures = envMaxFailures
+	}
+	if envMaxIPFailures, err := strconv.Atoi(os.Getenv("LOGIN_MAX_IP_FAILURES")); err == nil {
+		c.LoginMaxIPFailures = envMaxIPFailures
+	}
+	if envLockout, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT")); err == nil {
+		c.LoginLockout = envLockout
+	}
+	if envMinLength, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil {
+		c.PasswordMinLength = envMinLength
+	}
+	if envBreached := os.Getenv("BREACHED_PASSWORDS_FILE"); envBreached != "" {
+		c.BreachedPasswordsFile = envBreached
+	}
+	if envCost, err := strconv.Atoi(os.Getenv("BCRYPT_COST")); err == nil {
+		c.BcryptCost = envCost
+	}
+	if envThreshold := os.Getenv("WITHDRAWAL_2FA_THRESHOLD"); envThreshold != "" {
+		c.WithdrawalTwoFactorThreshold = envThreshold
+	}
+	if envThreshold := os.Getenv("ADJUSTMENT_APPROVAL_THRESHOLD"); envThreshold != "" {
+		c.AdjustmentApprovalThreshold = envThreshold
+	}
+	if envThreshold := os.Getenv("REVERSAL_APPROVAL_THRESHOLD"); envThreshold != "" {
+		c.ReversalApprovalThreshold = envThreshold
+	}
+	if envHoldTTL, err := time.ParseDuration(os.Getenv("HOLD_TTL")); err == nil {
+		c.HoldTTL = envHoldTTL
+	}
+	if envAutoComplete, err := time.ParseDuration(os.Getenv("WITHDRAWAL_AUTO_COMPLETE")); err == nil {
+		c.WithdrawalAutoComplete = envAutoComplete
+	}
+	if envExpiryMonths, err := strconv.Atoi(os.Getenv("POINTS_EXPIRY_MONTHS")); err == nil {
+		c.PointsExpiryMonths = envExpiryMonths
+	}
+	if envExpiringWindow, err := time.ParseDuration(os.Getenv("POINTS_EXPIRING_WINDOW")); err == nil {
+		c.PointsExpiringWindow = envExpiringWindow
+	}
+	if envTiers, ok := os.LookupEnv("TIERS"); ok {
+		c.Tiers = envTiers
+	}
+	if envTierBasis := os.Getenv("TIER_BASIS"); envTierBasis != "" {
+		c.TierBasis = envTierBasis
+	}
+	if envTierWindow, err := time.ParseDuration(os.Getenv("TIER_WINDOW")); err == nil {
+		c.TierWindow = envTierWindow
+	}
 }
 
 func (c *Config) validate() {
 	if c.DatabaseURI == "" {
 		panic("Database URI is required (use -d flag or DATABASE_URI env)")
 	}
+	if c.JWTKeysDir == "" && len(c.JWTSecretKey) < jwtkeys.MinSecretLength {
+		panic(fmt.Sprintf("JWT secret must be at least %d bytes (use -jwt-secret flag or JWT_SECRET_KEY env), or set -jwt-keys-dir", jwtkeys.MinSecretLength))
+	}
+	if c.AccrualWorkers < 1 {
+		panic("Accrual workers must be positive (use -accrual-workers flag or ACCRUAL_WORKERS env)")
+	}
+	if c.AccrualQueueSize < 0 {
+		panic("Accrual queue size must not be negative (use -accrual-queue flag or ACCRUAL_QUEUE_SIZE env)")
+	}
+	if c.AccrualPageSize < 1 {
+		panic("Accrual page size must be positive (use -accrual-page-size flag or ACCRUAL_PAGE_SIZE env)")
+	}
+	if c.AccrualLeaseTTL < 3*time.Second {
+		panic("Accrual lease TTL must be at least 3s (use -accrual-lease-ttl flag or ACCRUAL_LEASE_TTL env)")
+	}
+	if c.InstanceID == "" {
+		panic("Instance ID is required (use -instance-id flag or INSTANCE_ID env)")
+	}
+	if c.OutboxRetention <= 0 {
+		panic("Outbox retention must be positive (use -outbox-retention flag or OUTBOX_RETENTION env)")
+	}
+	if c.AccessTokenTTL <= 0 {
+		panic("Access token TTL must be positive (use -access-token-ttl flag or ACCESS_TOKEN_TTL env)")
+	}
+	if c.RefreshTokenTTL <= c.AccessTokenTTL {
+		panic("Refresh token TTL must be longer than access token TTL (use -refresh-token-ttl flag or REFRESH_TOKEN_TTL env)")
+	}
+	if c.LoginMaxFailures < 1 || c.LoginMaxIPFailures < 1 {
+		panic("Login failure limits must be positive (use -login-max-failures/-login-max-ip-failures flags or LOGIN_MAX_FAILURES/LOGIN_MAX_IP_FAILURES env)")
+	}
+	if c.PasswordMinLength < 1 {
+		panic("Password min length must be positive (use -password-min-length flag or PASSWORD_MIN_LENGTH env)")
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		panic(fmt.Sprintf("bcrypt cost must be between %d and %d (use -bcrypt-cost flag or BCRYPT_COST env)", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+	threshold, err := model.ParseMoney(c.WithdrawalTwoFactorThreshold)
+	if err != nil || threshold < 0 {
+		panic("Withdrawal 2FA threshold must be a non-negative amount (use -withdrawal-2fa-threshold flag or WITHDRAWAL_2FA_THRESHOLD env)")
+	}
+	c.withdrawalTwoFactorThreshold = threshold
+	threshold, err = model.ParseMoney(c.AdjustmentApprovalThreshold)
+	if err != nil || threshold < 0 {
+		panic("Adjustment approval threshold must be a non-negative amount (use -adjustment-approval-threshold flag or ADJUSTMENT_APPROVAL_THRESHOLD env)")
+	}
+	c.adjustmentApprovalThreshold = threshold
+	threshold, err = model.ParseMoney(c.ReversalApprovalThreshold)
+	if err != nil || threshold < 0 {
+		panic("Reversal approval threshold must be a non-negative amount (use -reversal-approval-threshold flag or REVERSAL_APPROVAL_THRESHOLD env)")
+	}
+	c.reversalApprovalThreshold = threshold
+	if c.LoginLockout <= 0 {
+		panic("Login lockout must be positive (use -login-lockout flag or LOGIN_LOCKOUT env)")
+	}
+	if c.HoldTTL < time.Minute || c.HoldTTL > 24*time.Hour {
+		panic("Hold TTL must be between 1m and 24h (use -hold-ttl flag or HOLD_TTL env)")
+	}
+	if c.WithdrawalAutoComplete <= 0 {
+		panic("Withdrawal auto-complete delay must be positive (use -withdrawal-auto-complete flag or WITHDRAWAL_AUTO_COMPLETE env)")
+	}
+	if c.PointsExpiryMonths < 0 {
+		panic("Points expiry must not be negative (use -points-expiry-months flag or POINTS_EXPIRY_MONTHS env)")
+	}
+	if c.PointsExpiringWindow <= 0 {
+		panic("Points expiring window must be positive (use -points-expiring-window flag or POINTS_EXPIRING_WINDOW env)")
+	}
+	tiers, err := service.ParseTiers(c.Tiers, c.TierBasis)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid loyalty tiers: %v (use -tiers/-tier-basis flags or TIERS/TIER_BASIS env)", err))
+	}
+	c.tiers = tiers
+	if c.TierWindow <= 0 {
+		panic("Tier window must be positive (use -tier-window flag or TIER_WINDOW env)")
+	}
 
 }
 
@@ -67,3 +302,69 @@ func (c *Config) MaskDBPassword() string {
 	}
 	return u.String()
 }
+
+func (c *Config) withdrawals() service.WithdrawalConfig {
+	return service.WithdrawalConfig{
+		TwoFactorThreshold:        c.withdrawalTwoFactorThreshold,
+		ReversalApprovalThreshold: c.reversalApprovalThreshold,
+		HoldTTL:                   c.HoldTTL,
+		AutoComplete:              c.WithdrawalAutoComplete,
+	}
+}
+
+func (c *Config) orderProcessing() service.OrderProcessingConfig {
+	return service.OrderProcessingConfig{
+		Workers:    c.AccrualWorkers,
+		QueueSize:  c.AccrualQueueSize,
+		PageSize:   c.AccrualPageSize,
+		InstanceID: c.InstanceID,
+		LeaseTTL:   c.AccrualLeaseTTL,
+	}
+}
+
+func (c *Config) pointsExpiry() service.PointsExpiryConfig {
+	return service.PointsExpiryConfig{
+		Months: c.PointsExpiryMonths,
+		Window: c.PointsExpiringWindow,
+	}
+}
+
+func (c *Config) loyaltyTiers() service.TierConfig {
+	return service.TierConfig{
+		Basis:  c.TierBasis,
+		Window: c.TierWindow,
+		Tiers:  c.tiers,
+	}
+}
+
+func (c *Config) auth() service.AuthConfig {
+	return service.AuthConfig{
+		AccessTokenTTL:  c.AccessTokenTTL,
+		RefreshTokenTTL: c.RefreshTokenTTL,
+		BcryptCost:      c.BcryptCost,
+	}
+}
+
+func (c *Config) loginLimits() service.LoginLimitConfig {
+	return service.LoginLimitConfig{
+		MaxLoginFailures: c.LoginMaxFailures,
+		MaxIPFailures:    c.LoginMaxIPFailures,
+		LockoutDuration:  c.LoginLockout,
+	}
+}
+
+// jwtKeys загружает ключи подписи из каталога, а без него использует HS256-секрет.
+func (c *Config) jwtKeys() (*jwtkeys.Manager, error) {
+	if c.JWTKeysDir != "" {
+		return jwtkeys.NewDirManager(c.JWTKeysDir, c.JWTSigningKeyID)
+	}
+	return jwtkeys.NewHMACManager(c.JWTSecretKey)
+}
+
+func defaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "gophermart"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
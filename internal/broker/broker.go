@@ -0,0 +1,69 @@
+package broker
+
+import (
+	"sync"
+
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+)
+
+const subscriberBuffer = 64
+
+// Broker раздаёт события заказов подписчикам внутри процесса, по пользователю.
+// Если подписчик не успевает читать и его буфер переполнен, канал закрывается:
+// клиент переподключится и дочитает пропущенное по Last-Event-ID.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[int64]map[chan *model.OrderEvent]struct{}
+}
+
+func New() *Broker {
+	return &Broker{subs: make(map[int64]map[chan *model.OrderEvent]struct{})}
+}
+
+func (b *Broker) Subscribe(userID int64) (<-chan *model.OrderEvent, func()) {
+	ch := make(chan *model.OrderEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[chan *model.OrderEvent]struct{})
+	}
+	b.subs[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.remove(userID, ch)
+		})
+	}
+}
+
+func (b *Broker) Publish(event *model.OrderEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			b.remove(event.UserID, ch)
+		}
+	}
+}
+
+func (b *Broker) remove(userID int64, ch chan *model.OrderEvent) {
+	subs, ok := b.subs[userID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(b.subs, userID)
+	}
+}
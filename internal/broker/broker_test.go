@@ -0,0 +1,67 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+)
+
+func TestPublishReachesOnlyOwnSubscribers(t *testing.T) {
+	b := New()
+	mine, unsubscribeMine := b.Subscribe(1)
+	defer unsubscribeMine()
+	other, unsubscribeOther := b.Subscribe(2)
+	defer unsubscribeOther()
+
+	b.Publish(&model.OrderEvent{ID: 10, UserID: 1})
+
+	select {
+	case event := <-mine:
+		if event.ID != 10 {
+			t.Errorf("got event %d, want 10", event.ID)
+		}
+	default:
+		t.Fatal("subscriber did not receive its event")
+	}
+	select {
+	case event := <-other:
+		t.Errorf("other user received event %d", event.ID)
+	default:
+	}
+}
+
+func TestSlowSubscriberIsDisconnected(t *testing.T) {
+	b := New()
+	slow, unsubscribe := b.Subscribe(1)
+	defer unsubscribe()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(&model.OrderEvent{ID: int64(i + 1), UserID: 1})
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("received %d events before close, want %d", received, subscriberBuffer)
+	}
+
+	// Отключённый подписчик больше ничего не получает, и публикация не паникует.
+	b.Publish(&model.OrderEvent{ID: 1000, UserID: 1})
+}
+
+func TestUnsubscribeIsIdempotent(t *testing.T) {
+	b := New()
+	ch, unsubscribe := b.Subscribe(1)
+	unsubscribe()
+	unsubscribe()
+
+	if _, ok := <-ch; ok {
+		t.Error("channel is open after unsubscribe")
+	}
+	if len(b.subs) != 0 {
+		t.Errorf("subscribers left: %d", len(b.subs))
+	}
+	b.Publish(&model.OrderEvent{ID: 1, UserID: 1})
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type AdjustmentController struct {
+	adjustmentService service.AdjustmentService
+	logger            *zap.Logger
+}
+
+func NewAdjustmentController(adjustmentService service.AdjustmentService, logger *zap.Logger) *AdjustmentController {
+	return &AdjustmentController{
+		adjustmentService: adjustmentService,
+		logger:            logger,
+	}
+}
+
+// Create зачисляет или списывает баллы: POST /api/admin/users/{id}/adjustments.
+// Отвечает 201, если корректировка проведена сразу, и 202, если она ждёт подтверждения.
+func (c *AdjustmentController) Create(w http.ResponseWriter, r *http.Request) {
+	actor, ok := adminActor(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Amount model.Money `json:"amount"`
+		Reason string      `json:"reason"`
+		Ticket string      `json:"ticket"`
+	}
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	adjustment, err := c.adjustmentService.Create(r.Context(), actor, userID, request.Amount, request.Reason, request.Ticket)
+	if err != nil {
+		c.writeError(w, err)
+		return
+	}
+
+	c.logger.Info("Balance adjustment created",
+		zap.Int64("actor_id", actor.UserID),
+		zap.Int64("user_id", userID),
+		zap.Int64("adjustment_id", adjustment.ID),
+		zap.Stringer("amount", adjustment.Amount),
+		zap.String("status", adjustment.Status))
+
+	if adjustment.Status == model.AdjustmentPending {
+		render.Status(r, http.StatusAccepted)
+	} else {
+		render.Status(r, http.StatusCreated)
+	}
+	render.JSON(w, r, adjustment)
+}
+
+func (c *AdjustmentController) List(w http.ResponseWriter, r *http.Request) {
+	actor, ok := adminActor(w, r)
+	if !ok {
+		return
+	}
+	userID, err := parseUserIDParam(r)
+	if err != nil {
+		http.Error(w, "Invalid user_id", http.StatusBadRequest)
+		return
+	}
+
+	adjustments, err := c.adjustmentService.List(r.Context(), actor, r.URL.Query().Get("status"), userID)
+	if err != nil {
+		c.writeError(w, err)
+		return
+	}
+	if len(adjustments) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	render.JSON(w, r, adjustments)
+}
+
+func (c *AdjustmentController) Approve(w http.ResponseWriter, r *http.Request) {
+	c.review(w, r, c.adjustmentService.Approve)
+}
+
+func (c *AdjustmentController) Reject(w http.ResponseWriter, r *http.Request) {
+	c.review(w, r, c.adjustmentService.Reject)
+}
+
+func (c *AdjustmentController) review(w http.ResponseWriter, r *http.Request,
+	decide func(ctx context.Context, actor model.AdminActor, id int64) (*model.BalanceAdjustment, error)) {
+	actor, ok := adminActor(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid adjustment id", http.StatusBadRequest)
+		return
+	}
+
+	adjustment, err := decide(r.Context(), actor, id)
+	if err != nil {
+		c.writeError(w, err)
+		return
+	}
+
+	c.logger.Info("Balance adjustment reviewed",
+		zap.Int64("actor_id", actor.UserID),
+		zap.Int64("adjustment_id", adjustment.ID),
+		zap.String("status", adjustment.Status))
+	render.JSON(w, r, adjustment)
+}
+
+func (c *AdjustmentController) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrAdjustmentNotFound):
+		http.Error(w, "Adjustment not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrAdjustmentForbidden), errors.Is(err, service.ErrAdjustmentSelfApproval):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrAdjustmentNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrAdjustmentInsufficientFunds):
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+	case errors.Is(err, service.ErrAdjustmentInvalidAmount),
+		errors.Is(err, service.ErrAdjustmentReasonRequired),
+		errors.Is(err, service.ErrAdjustmentTicketRequired):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, service.ErrAdjustmentInvalidStatus):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		c.logger.Error("Balance adjustment failed", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
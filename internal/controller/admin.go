@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/middlewareinternal"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/types"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type AdminController struct {
+	adminService service.AdminService
+	logger       *zap.Logger
+}
+
+func NewAdminController(adminService service.AdminService, logger *zap.Logger) *AdminController {
+	return &AdminController{
+		adminService: adminService,
+		logger:       logger,
+	}
+}
+
+// FindUser ищет пользователя по логину: GET /api/admin/users?login=...
+func (c *AdminController) FindUser(w http.ResponseWriter, r *http.Request) {
+	actor, ok := adminActor(w, r)
+	if !ok {
+		return
+	}
+	login := r.URL.Query().Get("login")
+	if login == "" {
+		http.Error(w, "login is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := c.adminService.FindUser(r.Context(), actor, login)
+	c.writeUser(w, r, user, err)
+}
+
+func (c *AdminController) GetUser(w http.ResponseWriter, r *http.Request) {
+	actor, ok := adminActor(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	user, err := c.adminService.GetUser(r.Context(), actor, userID)
+	c.writeUser(w, r, user, err)
+}
+
+func (c *AdminController) writeUser(w http.ResponseWriter, r *http.Request, user *model.AdminUser, err error) {
+	switch {
+	case err == nil:
+		render.JSON(w, r, user)
+	case errors.Is(err, service.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	default:
+		c.logger.Error("Failed to get user for admin", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (c *AdminController) SetRole(w http.ResponseWriter, r *http.Request) {
+	actor, ok := adminActor(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Role string `json:"role"`
+	}
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	err = c.adminService.SetRole(r.Context(), actor, userID, request.Role)
+	switch {
+	case err == nil:
+		c.logger.Info("User role changed",
+			zap.Int64("actor_id", actor.UserID),
+			zap.Int64("user_id", userID),
+			zap.String("role", request.Role))
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, service.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrOwnRoleChange):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		c.logger.Error("Failed to change user role", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// SearchOrders — заказы всех пользователей: GET /api/admin/orders?user_id=&number=
+// и те же параметры постраничной выборки, что у /api/user/orders.
+func (c *AdminController) SearchOrders(w http.ResponseWriter, r *http.Request) {
+	actor, ok := adminActor(w, r)
+	if !ok {
+		return
+	}
+	filter, err := parseListFilter(r, orderStatuses)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, err := parseUserIDParam(r)
+	if err != nil {
+		http.Error(w, "Invalid user_id", http.StatusBadRequest)
+		return
+	}
+	search := model.OrderSearch{UserID: userID, Number: r.URL.Query().Get("number")}
+
+	page, err := c.adminService.SearchOrders(r.Context(), actor, search, filter)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrInvalidCursor):
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		case errors.Is(err, service.ErrInvalidOrderNumberPart):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			c.logger.Error("Failed to search orders", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setNextPageHeaders(w, r, filter.Limit, page.Next)
+	if len(page.Items) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	render.JSON(w, r, page.Items)
+}
+
+func (c *AdminController) RepollOrder(w http.ResponseWriter, r *http.Request) {
+	actor, ok := adminActor(w, r)
+	if !ok {
+		return
+	}
+	number := chi.URLParam(r, "number")
+
+	order, err := c.adminService.RepollOrder(r.Context(), actor, number)
+	switch {
+	case err == nil:
+		c.logger.Info("Order queued for repoll",
+			zap.Int64("actor_id", actor.UserID),
+			zap.String("order", number))
+		render.Status(r, http.StatusAccepted)
+		render.JSON(w, r, order)
+	case errors.Is(err, service.ErrOrderNotFound):
+		http.Error(w, "Order not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrOrderAlreadyProcessed):
+		http.Error(w, "Order already processed", http.StatusConflict)
+	default:
+		c.logger.Error("Failed to repoll order", zap.String("order", number), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (c *AdminController) ListWithdrawals(w http.ResponseWriter, r *http.Request) {
+	actor, ok := adminActor(w, r)
+	if !ok {
+		return
+	}
+	filter, err := parseListFilter(r, withdrawalStatuses)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, err := parseUserIDParam(r)
+	if err != nil {
+		http.Error(w, "Invalid user_id", http.StatusBadRequest)
+		return
+	}
+
+	page, err := c.adminService.ListWithdrawals(r.Context(), actor, userID, filter)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		c.logger.Error("Failed to list withdrawals", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	setNextPageHeaders(w, r, filter.Limit, page.Next)
+	if len(page.Items) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	render.JSON(w, r, page.Items)
+}
+
+func adminActor(w http.ResponseWriter, r *http.Request) (model.AdminActor, bool) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return model.AdminActor{}, false
+	}
+	role, _ := r.Context().Value(types.RoleKey).(string)
+	return model.AdminActor{UserID: userID, Role: role, IP: clientIP(r)}, true
+}
+
+func parseUserIDParam(r *http.Request) (*int64, error) {
+	v := r.URL.Query().Get("user_id")
+	if v == "" {
+		return nil, nil
+	}
+	userID, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &userID, nil
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/middlewareinternal"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type APIKeyController struct {
+	apiKeyService service.APIKeyService
+	logger        *zap.Logger
+}
+
+func NewAPIKeyController(apiKeyService service.APIKeyService, logger *zap.Logger) *APIKeyController {
+	return &APIKeyController{
+		apiKeyService: apiKeyService,
+		logger:        logger,
+	}
+}
+
+// Create выпускает ключ. Сам ключ возвращается только в этом ответе.
+func (c *APIKeyController) Create(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	key, err := c.apiKeyService.Create(r.Context(), userID, request.Name, request.Scopes)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAPIKeyInvalidName), errors.Is(err, service.ErrAPIKeyInvalidScopes):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, service.ErrAPIKeyStaffScope):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, service.ErrAPIKeyLimitReached):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			c.logger.Error("Failed to create API key", zap.Int64("user_id", userID), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.logger.Info("API key created",
+		zap.Int64("user_id", userID),
+		zap.Int64("api_key_id", key.ID),
+		zap.Strings("scopes", key.Scopes))
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, key)
+}
+
+func (c *APIKeyController) List(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := c.apiKeyService.List(r.Context(), userID)
+	if err != nil {
+		c.logger.Error("Failed to list API keys", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	render.JSON(w, r, keys)
+}
+
+func (c *APIKeyController) Revoke(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid API key id", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.apiKeyService.Revoke(r.Context(), userID, id); err != nil {
+		if errors.Is(err, service.ErrAPIKeyNotFound) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		c.logger.Error("Failed to revoke API key", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	c.logger.Info("API key revoked", zap.Int64("user_id", userID), zap.Int64("api_key_id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,14 +1,27 @@
 package controller
 
 import (
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/middlewareinternal"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/render"
 	"go.uber.org/zap"
 )
 
+const (
+	accessTokenCookie  = "jwt"
+	refreshTokenCookie = "refresh_token"
+	// Refresh-токен нужен только эндпоинтам /api/user/token/refresh и /api/user/logout.
+	refreshTokenCookiePath = "/api/user"
+)
+
 type AuthController struct {
 	authService service.AuthService
 	logger      *zap.Logger
@@ -33,15 +46,17 @@ func (c *AuthController) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, token, err := c.authService.Register(r.Context(), request.Login, request.Password)
+	user, tokens, err := c.authService.Register(r.Context(), request.Login, request.Password)
 	if err != nil {
 		c.logger.Warn("Registration failed",
 			zap.String("login", request.Login),
 			zap.Error(err))
 
-		switch err {
-		case service.ErrUserAlreadyExists:
+		switch {
+		case errors.Is(err, service.ErrUserAlreadyExists):
 			http.Error(w, "Login already exists", http.StatusConflict)
+		case errors.Is(err, service.ErrInvalidLogin), errors.Is(err, service.ErrWeakPassword):
+			http.Error(w, err.Error(), http.StatusBadRequest)
 		default:
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
@@ -52,14 +67,7 @@ func (c *AuthController) Register(w http.ResponseWriter, r *http.Request) {
 		zap.Int64("user_id", user.ID),
 		zap.String("login", user.Login))
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "jwt",
-		Value:    token,
-		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-	})
-	w.WriteHeader(http.StatusOK)
+	writeTokens(w, r, tokens)
 }
 
 func (c *AuthController) Login(w http.ResponseWriter, r *http.Request) {
@@ -74,14 +82,27 @@ func (c *AuthController) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, token, err := c.authService.Login(r.Context(), request.Login, request.Password)
+	ip := clientIP(r)
+	user, tokens, err := c.authService.Login(r.Context(), request.Login, request.Password, ip)
 	if err != nil {
-		c.logger.Warn("Login failed",
-			zap.String("login", request.Login),
-			zap.Error(err))
+		if !errors.As(err, new(*service.ErrSecondFactorRequired)) {
+			c.logger.Warn("Login failed",
+				zap.String("login", request.Login),
+				zap.String("ip", ip),
+				zap.Error(err))
+		}
 
-		switch err {
-		case service.ErrInvalidCredentials:
+		var locked *service.ErrLoginLocked
+		var secondFactor *service.ErrSecondFactorRequired
+		switch {
+		case errors.As(err, &secondFactor):
+			// Пароль верный, но нужен код 2FA: токены выдаст /api/user/login/2fa.
+			render.Status(r, http.StatusAccepted)
+			render.JSON(w, r, secondFactor.Challenge)
+		case errors.As(err, &locked):
+			writeRetryAfter(w, locked.RetryAfter)
+			http.Error(w, "Too many failed login attempts", http.StatusTooManyRequests)
+		case errors.Is(err, service.ErrInvalidCredentials):
 			http.Error(w, "Invalid login or password", http.StatusUnauthorized)
 		default:
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -93,12 +114,243 @@ func (c *AuthController) Login(w http.ResponseWriter, r *http.Request) {
 		zap.Int64("user_id", user.ID),
 		zap.String("login", user.Login))
 
+	writeTokens(w, r, tokens)
+}
+
+// LoginTwoFactor обменивает challenge-токен из Login и код 2FA на токены.
+func (c *AuthController) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIP(r)
+	user, tokens, err := c.authService.CompleteLogin(r.Context(), request.ChallengeToken, request.Code, ip)
+	if err != nil {
+		c.logger.Warn("Two-factor login failed", zap.String("ip", ip), zap.Error(err))
+
+		var locked *service.ErrLoginLocked
+		var codeLocked *service.ErrTwoFactorLocked
+		switch {
+		case errors.As(err, &locked):
+			writeRetryAfter(w, locked.RetryAfter)
+			http.Error(w, "Too many failed login attempts", http.StatusTooManyRequests)
+		case errors.As(err, &codeLocked):
+			writeRetryAfter(w, codeLocked.RetryAfter)
+			http.Error(w, "Too many failed two-factor attempts", http.StatusTooManyRequests)
+		case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrTwoFactorNotEnabled):
+			http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		case errors.Is(err, service.ErrInvalidTwoFactorCode):
+			http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.logger.Info("User logged in with two-factor code",
+		zap.Int64("user_id", user.ID),
+		zap.String("login", user.Login))
+
+	writeTokens(w, r, tokens)
+}
+
+// Refresh принимает refresh-токен из тела {"refresh_token": "..."} или из cookie
+// и выдаёт новую пару токенов.
+func (c *AuthController) Refresh(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := refreshTokenFromRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if refreshToken == "" {
+		http.Error(w, "Refresh token is required", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := c.authService.Refresh(r.Context(), refreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRefreshTokenReused):
+			c.logger.Warn("Refresh token reuse detected", zap.Error(err))
+			clearTokens(w)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		case errors.Is(err, service.ErrInvalidRefreshToken), errors.Is(err, service.ErrRefreshTokenExpired):
+			clearTokens(w)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		default:
+			c.logger.Error("Token refresh failed", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeTokens(w, r, tokens)
+}
+
+// refreshTokenFromRequest берёт refresh-токен из тела {"refresh_token": "..."} или из cookie.
+func refreshTokenFromRequest(r *http.Request) (string, error) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if r.ContentLength != 0 {
+		if err := render.DecodeJSON(r.Body, &request); err != nil {
+			return "", err
+		}
+	}
+	if request.RefreshToken == "" {
+		if cookie, err := r.Cookie(refreshTokenCookie); err == nil {
+			request.RefreshToken = cookie.Value
+		}
+	}
+	return request.RefreshToken, nil
+}
+
+// Logout завершает текущую сессию, а с ?all=true — все сессии пользователя.
+// Для текущей сессии нужен её refresh-токен: одного access-токена мало.
+func (c *AuthController) Logout(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sessionID, err := middlewareinternal.GetSessionIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	all := false
+	if value := r.URL.Query().Get("all"); value != "" {
+		all, err = strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "Invalid all parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if all {
+		err = c.authService.LogoutAll(r.Context(), userID)
+	} else {
+		var refreshToken string
+		refreshToken, err = refreshTokenFromRequest(r)
+		if err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		if refreshToken == "" {
+			http.Error(w, "Refresh token is required", http.StatusUnauthorized)
+			return
+		}
+		err = c.authService.Logout(r.Context(), sessionID, refreshToken)
+	}
+	if errors.Is(err, service.ErrInvalidRefreshToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		c.logger.Error("Logout failed", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	c.logger.Info("User logged out",
+		zap.Int64("user_id", userID),
+		zap.Bool("all_sessions", all))
+
+	clearTokens(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword меняет пароль текущего пользователя. Остальные его сессии завершаются.
+func (c *AuthController) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sessionID, err := middlewareinternal.GetSessionIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	err = c.authService.ChangePassword(r.Context(), userID, sessionID,
+		request.CurrentPassword, request.NewPassword, clientIP(r))
+	if err != nil {
+		var locked *service.ErrLoginLocked
+		switch {
+		case errors.As(err, &locked):
+			writeRetryAfter(w, locked.RetryAfter)
+			http.Error(w, "Too many failed attempts", http.StatusTooManyRequests)
+		case errors.Is(err, service.ErrWrongPassword):
+			http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		case errors.Is(err, service.ErrWeakPassword), errors.Is(err, service.ErrSamePassword):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			c.logger.Error("Password change failed", zap.Int64("user_id", userID), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.logger.Info("Password changed", zap.Int64("user_id", userID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeRetryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+func writeTokens(w http.ResponseWriter, r *http.Request, tokens *model.TokenPair) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     "jwt",
-		Value:    token,
+		Name:     accessTokenCookie,
+		Value:    tokens.AccessToken,
 		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  tokens.AccessExpiresAt,
+		HttpOnly: true,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    tokens.RefreshToken,
+		Path:     refreshTokenCookiePath,
+		Expires:  tokens.RefreshExpiresAt,
 		HttpOnly: true,
 	})
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	render.JSON(w, r, tokens)
+}
+
+func clearTokens(w http.ResponseWriter) {
+	for _, cookie := range []*http.Cookie{
+		{Name: accessTokenCookie, Path: "/"},
+		{Name: refreshTokenCookie, Path: refreshTokenCookiePath},
+	} {
+		cookie.Expires = time.Unix(0, 0)
+		cookie.MaxAge = -1
+		cookie.HttpOnly = true
+		http.SetCookie(w, cookie)
+	}
+}
+
+// clientIP возвращает адрес клиента. RemoteAddr уже подменён middleware.RealIP
+// по X-Real-IP / X-Forwarded-For, если они есть.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
 }
@@ -1,6 +1,9 @@
 package controller
 
 import (
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/middlewareinternal"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/types"
 	"net/http"
@@ -27,3 +30,38 @@ func (c *BalanceController) GetBalance(w http.ResponseWriter, r *http.Request) {
 
 	render.JSON(w, r, balance)
 }
+
+func (c *BalanceController) GetHistory(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := parseListFilter(r, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.Limit == 0 {
+		filter.Limit = historyPageLimit
+	}
+
+	page, err := c.balanceService.GetHistory(r.Context(), userID, filter)
+	if errors.Is(err, model.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	setNextPageHeaders(w, r, filter.Limit, page.Next)
+	if len(page.Items) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	render.JSON(w, r, page.Items)
+}
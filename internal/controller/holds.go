@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/types"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+// Hold резервирует баллы под заказ: POST /api/user/balance/holds
+// {"order": "...", "sum": 100, "ttl": 600}; ttl в секундах, без него — срок по умолчанию.
+func (c *WithdrawalController) Hold(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(types.UserIDKey).(int64)
+
+	var request struct {
+		Order string      `json:"order"`
+		Sum   model.Money `json:"sum"`
+		TTL   int64       `json:"ttl"`
+	}
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	hold, err := c.withdrawalService.Hold(r.Context(), userID, request.Order, request.Sum,
+		time.Duration(request.TTL)*time.Second, r.Header.Get(twoFactorCodeHeader))
+	if err != nil {
+		writeHoldError(w, err)
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, hold)
+}
+
+func (c *WithdrawalController) GetHolds(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(types.UserIDKey).(int64)
+
+	holds, err := c.withdrawalService.GetHolds(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(holds) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	render.JSON(w, r, holds)
+}
+
+// Capture списывает зарезервированные баллы: POST /api/user/balance/holds/{id}/capture
+// {"sum": 80}; без тела или без sum списывается вся сумма резерва.
+func (c *WithdrawalController) Capture(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(types.UserIDKey).(int64)
+	holdID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid hold id", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Sum model.Money `json:"sum"`
+	}
+	if r.ContentLength != 0 {
+		if err := render.DecodeJSON(r.Body, &request); err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	withdrawal, err := c.withdrawalService.Capture(r.Context(), userID, holdID, request.Sum)
+	if err != nil {
+		writeHoldError(w, err)
+		return
+	}
+	render.JSON(w, r, withdrawal)
+}
+
+func (c *WithdrawalController) Release(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(types.UserIDKey).(int64)
+	holdID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid hold id", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.withdrawalService.Release(r.Context(), userID, holdID); err != nil {
+		writeHoldError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeHoldError(w http.ResponseWriter, err error) {
+	var locked *service.ErrTwoFactorLocked
+	switch {
+	case errors.As(err, &locked):
+		writeRetryAfter(w, locked.RetryAfter)
+		http.Error(w, "Too many failed two-factor attempts", http.StatusTooManyRequests)
+	case errors.Is(err, service.ErrHoldNotFound):
+		http.Error(w, "Hold not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrHoldNotActive), errors.Is(err, service.ErrHoldExpired):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrHoldOrderExists), errors.Is(err, service.ErrWithdrawalOrderAlreadyUsed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrWithdrawalInsufficientFunds):
+		http.Error(w, "Insufficient funds", http.StatusPaymentRequired)
+	case errors.Is(err, service.ErrWithdrawalInvalidOrderNumber):
+		http.Error(w, "Invalid order number", http.StatusUnprocessableEntity)
+	case errors.Is(err, service.ErrWithdrawalInvalidSum),
+		errors.Is(err, service.ErrHoldInvalidTTL),
+		errors.Is(err, service.ErrHoldCaptureTooLarge):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, service.ErrWithdrawalTwoFactorRequired):
+		http.Error(w, "Two-factor code required (enable 2FA and send "+twoFactorCodeHeader+")", http.StatusForbidden)
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		http.Error(w, "Invalid two-factor code", http.StatusForbidden)
+	default:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
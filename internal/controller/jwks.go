@@ -0,0 +1,22 @@
+package controller
+
+import (
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/jwtkeys"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type JWKSController struct {
+	keys *jwtkeys.Manager
+}
+
+func NewJWKSController(keys *jwtkeys.Manager) *JWKSController {
+	return &JWKSController{keys: keys}
+}
+
+// Get отдаёт публичные ключи проверки access-токенов для других сервисов.
+func (c *JWKSController) Get(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	render.JSON(w, r, c.keys.JWKS())
+}
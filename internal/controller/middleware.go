@@ -16,13 +16,14 @@ func AuthMiddleware(authService service.AuthService) func(http.Handler) http.Han
 				return
 			}
 
-			userID, err := authService.ValidateToken(cookie.Value)
+			claims, err := authService.ValidateToken(r.Context(), cookie.Value)
 			if err != nil {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), types.UserIDKey, userID)
+			ctx := context.WithValue(r.Context(), types.UserIDKey, claims.UserID)
+			ctx = context.WithValue(ctx, types.SessionIDKey, claims.SessionID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/middlewareinternal"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const streamHeartbeatInterval = 15 * time.Second
+
+type OrderStreamController struct {
+	eventService service.OrderEventService
+	shutdown     <-chan struct{}
+	logger       *zap.Logger
+}
+
+// NewOrderStreamController создаёт контроллер потока событий. Закрытие shutdown
+// завершает все открытые потоки, иначе они не дают серверу остановиться.
+func NewOrderStreamController(
+	eventService service.OrderEventService,
+	shutdown <-chan struct{},
+	logger *zap.Logger,
+) *OrderStreamController {
+	return &OrderStreamController{
+		eventService: eventService,
+		shutdown:     shutdown,
+		logger:       logger,
+	}
+}
+
+// Stream отдаёт изменения заказов пользователя как Server-Sent Events.
+// Клиент, переподключаясь с Last-Event-ID, сначала получает пропущенные события из истории.
+// id событий растут в порядке коммита, поэтому события с id не больше Last-Event-ID
+// и уже отправленные повторно не отдаются.
+func (c *OrderStreamController) Stream(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var lastEventID int64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		lastEventID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || lastEventID < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+
+	// Подписываемся до чтения истории, чтобы не потерять события между ними;
+	// живые события с id не больше последнего отправленного — дубликаты истории.
+	events, unsubscribe := c.eventService.Subscribe(userID)
+	defer unsubscribe()
+
+	var missed []*model.OrderEvent
+	if lastEventID > 0 {
+		missed, err = c.eventService.EventsSince(r.Context(), userID, lastEventID)
+		if err != nil {
+			c.logger.Error("Failed to load missed order events",
+				zap.Int64("user_id", userID),
+				zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sent := lastEventID
+	for len(missed) > 0 {
+		for _, event := range missed {
+			if err := writeOrderEvent(w, event); err != nil {
+				return
+			}
+			sent = event.ID
+		}
+		if len(missed) < service.MaxReplayEvents {
+			break
+		}
+		// Пропущено больше одной порции: дочитываем, пока история не кончится.
+		missed, err = c.eventService.EventsSince(r.Context(), userID, sent)
+		if err != nil {
+			c.logger.Error("Failed to load missed order events",
+				zap.Int64("user_id", userID),
+				zap.Error(err))
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		c.logger.Warn("Streaming is not supported by response writer", zap.Error(err))
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c.shutdown:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				// Подписчик отстал и отключён брокером — клиент переподключится с Last-Event-ID.
+				return
+			}
+			if event.ID <= sent {
+				continue
+			}
+			if err := writeOrderEvent(w, event); err != nil {
+				return
+			}
+			sent = event.ID
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeOrderEvent(w http.ResponseWriter, event *model.OrderEvent) error {
+	data, err := json.Marshal(struct {
+		Number    string      `json:"number"`
+		Status    string      `json:"status"`
+		Accrual   model.Money `json:"accrual,omitempty"`
+		ChangedAt time.Time   `json:"changed_at"`
+	}{event.Number, event.Status, event.Accrual, event.ChangedAt})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: order\ndata: %s\n\n", event.ID, data)
+	return err
+}
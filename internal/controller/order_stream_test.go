@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/types"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// fakeEventService отдаёт историю из памяти, а живые события — из заранее
+// заполненного и закрытого канала: поток завершится, дочитав его.
+type fakeEventService struct {
+	service.OrderEventService
+	history []*model.OrderEvent
+	live    []*model.OrderEvent
+}
+
+func (f *fakeEventService) Subscribe(int64) (<-chan *model.OrderEvent, func()) {
+	ch := make(chan *model.OrderEvent, len(f.live))
+	for _, event := range f.live {
+		ch <- event
+	}
+	close(ch)
+	return ch, func() {}
+}
+
+func (f *fakeEventService) EventsSince(_ context.Context, _, lastEventID int64) ([]*model.OrderEvent, error) {
+	var events []*model.OrderEvent
+	for _, event := range f.history {
+		if event.ID > lastEventID && len(events) < service.MaxReplayEvents {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+var streamIDPattern = regexp.MustCompile(`(?m)^id: (\d+)$`)
+
+func streamIDs(t *testing.T, events *fakeEventService, lastEventID string) []int64 {
+	t.Helper()
+	c := NewOrderStreamController(events, make(chan struct{}), zap.NewNop())
+
+	r := httptest.NewRequest("GET", "/api/user/orders/stream", nil)
+	r = r.WithContext(context.WithValue(r.Context(), types.UserIDKey, int64(1)))
+	if lastEventID != "" {
+		r.Header.Set("Last-Event-ID", lastEventID)
+	}
+	w := httptest.NewRecorder()
+	c.Stream(w, r)
+
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var ids []int64
+	for _, m := range streamIDPattern.FindAllStringSubmatch(w.Body.String(), -1) {
+		id, _ := strconv.ParseInt(m[1], 10, 64)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func orderEvents(ids ...int64) []*model.OrderEvent {
+	events := make([]*model.OrderEvent, 0, len(ids))
+	for _, id := range ids {
+		events = append(events, &model.OrderEvent{ID: id, UserID: 1, Number: "12345678903", Status: "PROCESSED"})
+	}
+	return events
+}
+
+func TestStreamReplaysOnlyAfterLastEventID(t *testing.T) {
+	events := &fakeEventService{
+		history: orderEvents(3, 4, 5, 6),
+		// 5 и 6 пришли и из истории, и из подписки; 4 клиент уже подтвердил.
+		live: orderEvents(4, 5, 6, 7),
+	}
+
+	got := streamIDs(t, events, "4")
+	if want := []int64{5, 6, 7}; !slices.Equal(got, want) {
+		t.Errorf("stream ids = %v, want %v", got, want)
+	}
+}
+
+func TestStreamWithoutLastEventIDSendsOnlyLive(t *testing.T) {
+	events := &fakeEventService{history: orderEvents(1, 2), live: orderEvents(3, 3, 4)}
+
+	got := streamIDs(t, events, "")
+	if want := []int64{3, 4}; !slices.Equal(got, want) {
+		t.Errorf("stream ids = %v, want %v", got, want)
+	}
+}
+
+func TestStreamReplaysMoreThanOneBatch(t *testing.T) {
+	total := service.MaxReplayEvents + 10
+	ids := make([]int64, total)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+	}
+	events := &fakeEventService{history: orderEvents(ids...)}
+
+	got := streamIDs(t, events, "1")
+	if len(got) != total-1 || got[0] != 2 || got[len(got)-1] != int64(total) {
+		t.Errorf("replayed %d events from %v to %v, want 2..%d", len(got), got[0], got[len(got)-1], total)
+	}
+}
+
+func TestStreamRejectsBadLastEventID(t *testing.T) {
+	c := NewOrderStreamController(&fakeEventService{}, make(chan struct{}), zap.NewNop())
+	r := httptest.NewRequest("GET", "/api/user/orders/stream", nil)
+	r = r.WithContext(context.WithValue(r.Context(), types.UserIDKey, int64(1)))
+	r.Header.Set("Last-Event-ID", "abc")
+	w := httptest.NewRecorder()
+
+	c.Stream(w, r)
+
+	if w.Code != 400 {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
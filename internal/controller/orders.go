@@ -9,6 +9,7 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 )
 
@@ -87,7 +88,13 @@ func (c *OrderController) GetOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orders, err := c.orderService.GetOrders(r.Context(), userID)
+	filter, err := parseListFilter(r, orderStatuses)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := c.orderService.GetOrders(r.Context(), userID, filter)
 	if err != nil {
 		c.logger.Error("Failed to get orders",
 			zap.Int64("user_id", userID),
@@ -96,10 +103,40 @@ func (c *OrderController) GetOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(orders) == 0 {
+	setNextPageHeaders(w, r, filter.Limit, page.Next)
+	if len(page.Items) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	render.JSON(w, r, orders)
+	render.JSON(w, r, page.Items)
+}
+
+func (c *OrderController) GetOrder(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		c.logger.Error("Failed to get user ID", zap.Error(err))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	orderNumber := chi.URLParam(r, "number")
+	details, err := c.orderService.GetOrder(r.Context(), userID, orderNumber)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrOrderNotFound):
+			http.Error(w, "Order not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrOrderAccessDenied):
+			http.Error(w, "Order belongs to another user", http.StatusForbidden)
+		default:
+			c.logger.Error("Failed to get order",
+				zap.Int64("user_id", userID),
+				zap.String("order", orderNumber),
+				zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	render.JSON(w, r, details)
 }
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxPageLimit = 1000
+	// historyPageLimit — размер страницы истории баланса, если limit не задан:
+	// проводок у пользователя много, и весь список за раз не отдаём.
+	historyPageLimit = 100
+)
+
+var orderStatuses = []string{"NEW", "PROCESSING", "INVALID", "PROCESSED"}
+
+var withdrawalStatuses = []string{model.WithdrawalPending, model.WithdrawalCompleted, model.WithdrawalReversed}
+
+// parseListFilter читает параметры limit, after, status, from, to и sort.
+// Без параметров возвращает нулевой фильтр — полный список от новых к старым.
+// allowedStatuses == nil означает, что фильтр по статусу для списка не поддерживается.
+func parseListFilter(r *http.Request, allowedStatuses []string) (model.ListFilter, error) {
+	var filter model.ListFilter
+	q := r.URL.Query()
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if v := q.Get("after"); v != "" {
+		if filter.Limit == 0 {
+			return filter, errors.New("after requires limit")
+		}
+		cursor, err := model.DecodeCursor(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.After = cursor
+	}
+
+	if v := q.Get("status"); v != "" {
+		if allowedStatuses == nil {
+			return filter, errors.New("status filter is not supported")
+		}
+		for _, status := range strings.Split(v, ",") {
+			status = strings.ToUpper(strings.TrimSpace(status))
+			if !slices.Contains(allowedStatuses, status) {
+				return filter, fmt.Errorf("unknown status %q", status)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(q, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeParam(q, "to"); err != nil {
+		return filter, err
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, errors.New("from must be before to")
+	}
+
+	switch strings.ToLower(q.Get("sort")) {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return filter, errors.New("sort must be asc or desc")
+	}
+
+	return filter, nil
+}
+
+func parseTimeParam(q url.Values, name string) (time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC3339 timestamp", name)
+	}
+	return t, nil
+}
+
+// setNextPageHeaders сообщает курсор следующей страницы в X-Next-Cursor и в Link (rel="next").
+// limit попадает в ссылку явно, потому что after без limit не принимается.
+func setNextPageHeaders(w http.ResponseWriter, r *http.Request, limit int, next *model.Cursor) {
+	if next == nil {
+		return
+	}
+
+	cursor := next.Encode()
+	q := r.URL.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("after", cursor)
+	nextURL := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+
+	w.Header().Set("X-Next-Cursor", cursor)
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, nextURL.String()))
+}
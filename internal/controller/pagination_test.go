@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseListFilter(t *testing.T) {
+	cursor := model.Cursor{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Key: "7"}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		query    string
+		statuses []string
+		want     model.ListFilter
+		wantErr  string
+	}{
+		{name: "empty", query: ""},
+		{name: "limit min", query: "limit=1", want: model.ListFilter{Limit: 1}},
+		{name: "limit max", query: "limit=1000", want: model.ListFilter{Limit: maxPageLimit}},
+		{name: "limit zero", query: "limit=0", wantErr: "limit must be between"},
+		{name: "limit too large", query: "limit=1001", wantErr: "limit must be between"},
+		{name: "limit negative", query: "limit=-5", wantErr: "limit must be between"},
+		{name: "limit not a number", query: "limit=ten", wantErr: "limit must be between"},
+		{
+			name:  "after with limit",
+			query: "limit=10&after=" + cursor.Encode(),
+			want:  model.ListFilter{Limit: 10, After: &cursor},
+		},
+		{name: "after without limit", query: "after=" + cursor.Encode(), wantErr: "after requires limit"},
+		{name: "bad cursor", query: "limit=10&after=garbage", wantErr: model.ErrInvalidCursor.Error()},
+		{
+			name:     "statuses",
+			query:    "status=new,%20processed",
+			statuses: orderStatuses,
+			want:     model.ListFilter{Statuses: []string{"NEW", "PROCESSED"}},
+		},
+		{name: "unknown status", query: "status=LOST", statuses: orderStatuses, wantErr: `unknown status "LOST"`},
+		{
+			name:     "withdrawal statuses",
+			query:    "status=pending,REVERSED",
+			statuses: withdrawalStatuses,
+			want:     model.ListFilter{Statuses: []string{model.WithdrawalPending, model.WithdrawalReversed}},
+		},
+		{name: "order status for withdrawals", query: "status=PROCESSED", statuses: withdrawalStatuses, wantErr: `unknown status "PROCESSED"`},
+		{name: "status unsupported", query: "status=NEW", wantErr: "status filter is not supported"},
+		{
+			name:  "period",
+			query: "from=" + url.QueryEscape(from.Format(time.RFC3339)) + "&to=" + url.QueryEscape(to.Format(time.RFC3339)),
+			want:  model.ListFilter{From: from, To: to},
+		},
+		{name: "bad from", query: "from=2024-01-01", wantErr: "from must be an RFC3339 timestamp"},
+		{name: "bad to", query: "to=tomorrow", wantErr: "to must be an RFC3339 timestamp"},
+		{
+			name:    "from equals to",
+			query:   "from=" + url.QueryEscape(from.Format(time.RFC3339)) + "&to=" + url.QueryEscape(from.Format(time.RFC3339)),
+			wantErr: "from must be before to",
+		},
+		{
+			name:    "from after to",
+			query:   "from=" + url.QueryEscape(to.Format(time.RFC3339)) + "&to=" + url.QueryEscape(from.Format(time.RFC3339)),
+			wantErr: "from must be before to",
+		},
+		{name: "sort asc", query: "sort=asc", want: model.ListFilter{Ascending: true}},
+		{name: "sort ASC", query: "sort=ASC", want: model.ListFilter{Ascending: true}},
+		{name: "sort desc", query: "sort=desc"},
+		{name: "sort unknown", query: "sort=newest", wantErr: "sort must be asc or desc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/user/orders?"+tt.query, nil)
+			got, err := parseListFilter(r, tt.statuses)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseListFilter(%q) error = %v, want %q", tt.query, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseListFilter(%q) error = %v", tt.query, err)
+			}
+			if !equalFilters(got, tt.want) {
+				t.Errorf("parseListFilter(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func equalFilters(a, b model.ListFilter) bool {
+	if (a.After == nil) != (b.After == nil) {
+		return false
+	}
+	if a.After != nil && (!a.After.Time.Equal(b.After.Time) || a.After.Key != b.After.Key) {
+		return false
+	}
+	return a.Limit == b.Limit &&
+		slices.Equal(a.Statuses, b.Statuses) &&
+		a.From.Equal(b.From) &&
+		a.To.Equal(b.To) &&
+		a.Ascending == b.Ascending
+}
+
+func TestSetNextPageHeaders(t *testing.T) {
+	next := &model.Cursor{Time: time.Unix(1700000000, 0), Key: "9"}
+	r := httptest.NewRequest("GET", "/api/user/balance/history?sort=asc", nil)
+	w := httptest.NewRecorder()
+
+	setNextPageHeaders(w, r, 100, next)
+
+	if got := w.Header().Get("X-Next-Cursor"); got != next.Encode() {
+		t.Errorf("X-Next-Cursor = %q, want %q", got, next.Encode())
+	}
+	link := w.Header().Get("Link")
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start != 0 || end < 0 || !strings.HasSuffix(link, `rel="next"`) {
+		t.Fatalf("Link = %q, want <url>; rel=\"next\"", link)
+	}
+	u, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		t.Fatalf("parse link: %v", err)
+	}
+	q := u.Query()
+	if u.Path != "/api/user/balance/history" || q.Get("limit") != "100" || q.Get("after") != next.Encode() || q.Get("sort") != "asc" {
+		t.Errorf("next link = %s, want same path and sort with limit and after", u)
+	}
+
+	// Ссылка на следующую страницу сама проходит разбор.
+	if _, err := parseListFilter(httptest.NewRequest("GET", u.String(), nil), nil); err != nil {
+		t.Errorf("next link does not parse: %v", err)
+	}
+
+	empty := httptest.NewRecorder()
+	setNextPageHeaders(empty, r, 100, nil)
+	if empty.Header().Get("Link") != "" || empty.Header().Get("X-Next-Cursor") != "" {
+		t.Error("headers set for the last page")
+	}
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/middlewareinternal"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type ProfileController struct {
+	tierService service.TierService
+	logger      *zap.Logger
+}
+
+func NewProfileController(tierService service.TierService, logger *zap.Logger) *ProfileController {
+	return &ProfileController{
+		tierService: tierService,
+		logger:      logger,
+	}
+}
+
+// Get возвращает профиль с уровнем лояльности и прогрессом к следующему: GET /api/user/profile.
+func (c *ProfileController) Get(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := c.tierService.Profile(r.Context(), userID)
+	if errors.Is(err, service.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.logger.Error("Failed to get profile", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, profile)
+}
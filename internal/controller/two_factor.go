@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/middlewareinternal"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type TwoFactorController struct {
+	twoFactorService service.TwoFactorService
+	logger           *zap.Logger
+}
+
+func NewTwoFactorController(twoFactorService service.TwoFactorService, logger *zap.Logger) *TwoFactorController {
+	return &TwoFactorController{
+		twoFactorService: twoFactorService,
+		logger:           logger,
+	}
+}
+
+// Setup выдаёт секрет и otpauth-ссылку. 2FA включится после Confirm.
+func (c *TwoFactorController) Setup(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	setup, err := c.twoFactorService.Setup(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTwoFactorAlreadyEnabled):
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		default:
+			c.logger.Error("Failed to start 2FA setup", zap.Int64("user_id", userID), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	render.JSON(w, r, setup)
+}
+
+// Confirm включает 2FA и возвращает коды восстановления — единственный раз.
+func (c *TwoFactorController) Confirm(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := c.twoFactorService.Confirm(r.Context(), userID, request.Code)
+	if err != nil {
+		var locked *service.ErrTwoFactorLocked
+		switch {
+		case errors.As(err, &locked):
+			writeRetryAfter(w, locked.RetryAfter)
+			http.Error(w, "Too many failed two-factor attempts", http.StatusTooManyRequests)
+		case errors.Is(err, service.ErrTwoFactorAlreadyEnabled):
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		case errors.Is(err, service.ErrTwoFactorNotSetUp):
+			http.Error(w, "Call /api/user/2fa/setup first", http.StatusConflict)
+		case errors.Is(err, service.ErrInvalidTwoFactorCode):
+			http.Error(w, "Invalid two-factor code", http.StatusUnprocessableEntity)
+		default:
+			c.logger.Error("Failed to confirm 2FA", zap.Int64("user_id", userID), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.logger.Info("Two-factor authentication enabled", zap.Int64("user_id", userID))
+	render.JSON(w, r, map[string][]string{"recovery_codes": codes})
+}
+
+func (c *TwoFactorController) Disable(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	err = c.twoFactorService.Disable(r.Context(), userID, request.Password, request.Code)
+	if err != nil {
+		var locked *service.ErrTwoFactorLocked
+		switch {
+		case errors.As(err, &locked):
+			writeRetryAfter(w, locked.RetryAfter)
+			http.Error(w, "Too many failed two-factor attempts", http.StatusTooManyRequests)
+		case errors.Is(err, service.ErrTwoFactorNotEnabled):
+			http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		case errors.Is(err, service.ErrWrongPassword), errors.Is(err, service.ErrInvalidTwoFactorCode):
+			http.Error(w, "Invalid password or two-factor code", http.StatusForbidden)
+		default:
+			c.logger.Error("Failed to disable 2FA", zap.Int64("user_id", userID), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.logger.Info("Two-factor authentication disabled", zap.Int64("user_id", userID))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/middlewareinternal"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type WebhookController struct {
+	webhookService service.WebhookService
+	logger         *zap.Logger
+}
+
+func NewWebhookController(webhookService service.WebhookService, logger *zap.Logger) *WebhookController {
+	return &WebhookController{
+		webhookService: webhookService,
+		logger:         logger,
+	}
+}
+
+// Create регистрирует подписку. Секрет для проверки подписи возвращается только в этом ответе.
+func (c *WebhookController) Create(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := c.webhookService.Register(r.Context(), userID, request.URL, request.Events)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrWebhookInvalidURL), errors.Is(err, service.ErrWebhookInvalidEvents),
+			errors.Is(err, service.ErrWebhookForbiddenHost):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			c.logger.Error("Failed to register webhook", zap.Int64("user_id", userID), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, webhook)
+}
+
+func (c *WebhookController) List(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	webhooks, err := c.webhookService.List(r.Context(), userID)
+	if err != nil {
+		c.logger.Error("Failed to list webhooks", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if len(webhooks) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	render.JSON(w, r, webhooks)
+}
+
+func (c *WebhookController) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	if err := c.webhookService.Delete(r.Context(), userID, id); err != nil {
+		switch {
+		case errors.Is(err, service.ErrWebhookNotFound):
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		default:
+			c.logger.Error("Failed to delete webhook", zap.Int64("user_id", userID), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *WebhookController) Deliveries(w http.ResponseWriter, r *http.Request) {
+	userID, err := middlewareinternal.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	deliveries, err := c.webhookService.Deliveries(r.Context(), userID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrWebhookNotFound):
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		default:
+			c.logger.Error("Failed to get webhook deliveries", zap.Int64("user_id", userID), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if len(deliveries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	render.JSON(w, r, deliveries)
+}
@@ -1,63 +1,264 @@
 package controller
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/service"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/types"
+	"io"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 )
 
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	maxIdempotencyKeyLength = 255
+	twoFactorCodeHeader     = "X-2FA-Code"
+)
+
 type WithdrawalController struct {
-	withdrawalService service.WithdrawalService
+	withdrawalService  service.WithdrawalService
+	idempotencyService service.IdempotencyService
 }
 
-func NewWithdrawalController(withdrawalService service.WithdrawalService) *WithdrawalController {
-	return &WithdrawalController{withdrawalService: withdrawalService}
+func NewWithdrawalController(
+	withdrawalService service.WithdrawalService,
+	idempotencyService service.IdempotencyService,
+) *WithdrawalController {
+	return &WithdrawalController{
+		withdrawalService:  withdrawalService,
+		idempotencyService: idempotencyService,
+	}
 }
 
+// Withdraw списывает баллы. Если передан заголовок Idempotency-Key, повтор запроса
+// с тем же ключом и телом возвращает сохранённый ответ, не списывая баллы повторно.
 func (c *WithdrawalController) Withdraw(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(types.UserIDKey).(int64)
 
-	var request struct {
-		Order string  `json:"order"`
-		Sum   float64 `json:"sum"`
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
 	}
 
-	if err := render.DecodeJSON(r.Body, &request); err != nil {
-		http.Error(w, "Invalid request format", http.StatusBadRequest)
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		status, message := c.withdraw(w, r, userID, body)
+		writeStatus(w, status, message)
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		http.Error(w, "Idempotency key is too long", http.StatusBadRequest)
 		return
 	}
 
-	err := c.withdrawalService.Withdraw(r.Context(), userID, request.Order, request.Sum)
-	if err != nil {
-		switch err {
-		case service.ErrWithdrawalInsufficientFunds:
-			http.Error(w, "Insufficient funds", http.StatusPaymentRequired)
-		case service.ErrInvalidOrderNumber:
-			http.Error(w, "Invalid order number", http.StatusUnprocessableEntity)
-		default:
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-		}
+	hash := sha256.Sum256(body)
+	requestHash := hex.EncodeToString(hash[:])
+
+	record, err := c.idempotencyService.Begin(r.Context(), userID, key, requestHash)
+	switch {
+	case errors.Is(err, service.ErrIdempotencyKeyReused):
+		http.Error(w, "Idempotency key was used with a different request", http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, service.ErrIdempotencyKeyInProgress):
+		http.Error(w, "Request with this idempotency key is in progress", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	case record.Completed():
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeStatus(w, record.StatusCode, string(record.ResponseBody))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	status, message := c.withdraw(w, r, userID, body)
+
+	// Ответы 5xx и отказы из-за кода 2FA не сохраняем: ключ освобождается, и клиент
+	// может повторить запрос (например, уже с кодом). Перебор кодов через новые попытки
+	// останавливает счётчик 2FA — после лимита ответ 429.
+	if status >= http.StatusInternalServerError || status == http.StatusForbidden || status == http.StatusTooManyRequests {
+		_ = c.idempotencyService.Abort(r.Context(), record)
+	} else if err := c.idempotencyService.Complete(r.Context(), record, status, []byte(message)); err != nil {
+		_ = c.idempotencyService.Abort(r.Context(), record)
+	}
+
+	writeStatus(w, status, message)
+}
+
+// withdraw выполняет списание и возвращает статус и текст ответа; заголовки (Retry-After)
+// пишет в w сразу.
+func (c *WithdrawalController) withdraw(w http.ResponseWriter, r *http.Request, userID int64, body []byte) (int, string) {
+	var request struct {
+		Order string      `json:"order"`
+		Sum   model.Money `json:"sum"`
+	}
+
+	if err := render.DecodeJSON(bytes.NewReader(body), &request); err != nil {
+		return http.StatusBadRequest, "Invalid request format"
+	}
+
+	err := c.withdrawalService.Withdraw(r.Context(), userID, request.Order, request.Sum, r.Header.Get(twoFactorCodeHeader))
+	var locked *service.ErrTwoFactorLocked
+	switch {
+	case errors.As(err, &locked):
+		writeRetryAfter(w, locked.RetryAfter)
+		return http.StatusTooManyRequests, "Too many failed two-factor attempts"
+	case err == nil:
+		return http.StatusOK, ""
+	case errors.Is(err, service.ErrWithdrawalInsufficientFunds):
+		return http.StatusPaymentRequired, "Insufficient funds"
+	case errors.Is(err, service.ErrWithdrawalInvalidOrderNumber):
+		return http.StatusUnprocessableEntity, "Invalid order number"
+	case errors.Is(err, service.ErrWithdrawalInvalidSum):
+		return http.StatusUnprocessableEntity, "Invalid withdrawal sum"
+	case errors.Is(err, service.ErrWithdrawalOrderAlreadyUsed):
+		return http.StatusConflict, "Order number already used for withdrawal"
+	case errors.Is(err, service.ErrHoldOrderExists):
+		return http.StatusConflict, "Order number has an active hold"
+	case errors.Is(err, service.ErrWithdrawalTwoFactorRequired):
+		return http.StatusForbidden, "Two-factor code required (enable 2FA and send " + twoFactorCodeHeader + ")"
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		return http.StatusForbidden, "Invalid two-factor code"
+	default:
+		return http.StatusInternalServerError, "Internal server error"
+	}
 }
 
 func (c *WithdrawalController) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(types.UserIDKey).(int64)
 
-	withdrawals, err := c.withdrawalService.GetWithdrawals(r.Context(), userID)
+	filter, err := parseListFilter(r, withdrawalStatuses)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := c.withdrawalService.GetWithdrawals(r.Context(), userID, filter)
 	if err != nil {
+		if errors.Is(err, model.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	if len(withdrawals) == 0 {
+	setNextPageHeaders(w, r, filter.Limit, page.Next)
+	if len(page.Items) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	render.JSON(w, r, withdrawals)
+	render.JSON(w, r, page.Items)
+}
+
+func writeStatus(w http.ResponseWriter, status int, message string) {
+	if message == "" {
+		w.WriteHeader(status)
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// Complete подтверждает списание: POST /api/admin/withdrawals/{order}/complete
+// или POST /api/partner/withdrawals/{order}/complete с API-ключом партнёра.
+func (c *WithdrawalController) Complete(w http.ResponseWriter, r *http.Request) {
+	actor, ok := adminActor(w, r)
+	if !ok {
+		return
+	}
+
+	withdrawal, err := c.withdrawalService.Complete(r.Context(), actor, chi.URLParam(r, "order"))
+	if err != nil {
+		writeWithdrawalReviewError(w, err)
+		return
+	}
+	render.JSON(w, r, withdrawal)
+}
+
+// Reverse возвращает баллы по списанию полностью или частично:
+// POST /api/admin/withdrawals/{order}/reverse {"sum": 100, "reason": "..."}; без sum — весь остаток.
+// Возврат больше порога подтверждения ждёт другого администратора, и ответ — 202.
+func (c *WithdrawalController) Reverse(w http.ResponseWriter, r *http.Request) {
+	actor, ok := adminActor(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Sum    model.Money `json:"sum"`
+		Reason string      `json:"reason"`
+	}
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	reversal, err := c.withdrawalService.Reverse(r.Context(), actor, chi.URLParam(r, "order"), request.Sum, request.Reason)
+	if err != nil {
+		writeWithdrawalReviewError(w, err)
+		return
+	}
+	if reversal.Status == model.ReversalPending {
+		render.Status(r, http.StatusAccepted)
+	}
+	render.JSON(w, r, reversal)
+}
+
+// ApproveReversal проводит ожидающий возврат: POST /api/admin/reversals/{id}/approve.
+func (c *WithdrawalController) ApproveReversal(w http.ResponseWriter, r *http.Request) {
+	c.reviewReversal(w, r, c.withdrawalService.ApproveReversal)
+}
+
+func (c *WithdrawalController) RejectReversal(w http.ResponseWriter, r *http.Request) {
+	c.reviewReversal(w, r, c.withdrawalService.RejectReversal)
+}
+
+func (c *WithdrawalController) reviewReversal(w http.ResponseWriter, r *http.Request,
+	decide func(ctx context.Context, actor model.AdminActor, id int64) (*model.WithdrawalReversal, error)) {
+	actor, ok := adminActor(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid reversal id", http.StatusBadRequest)
+		return
+	}
+
+	reversal, err := decide(r.Context(), actor, id)
+	if err != nil {
+		writeWithdrawalReviewError(w, err)
+		return
+	}
+	render.JSON(w, r, reversal)
+}
+
+func writeWithdrawalReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrWithdrawalForbidden), errors.Is(err, service.ErrReversalSelfApproval):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrWithdrawalNotFound):
+		http.Error(w, "Withdrawal not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrReversalNotFound):
+		http.Error(w, "Reversal not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrWithdrawalNotPending), errors.Is(err, service.ErrWithdrawalAlreadyReversed),
+		errors.Is(err, service.ErrReversalNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrWithdrawalInvalidSum),
+		errors.Is(err, service.ErrWithdrawalReversalTooLarge),
+		errors.Is(err, service.ErrWithdrawalReasonRequired):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
 }
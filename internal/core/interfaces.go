@@ -2,19 +2,30 @@ package core
 
 import (
 	"context"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/accrual"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
 )
 
 type (
 	Authenticator interface {
-		Register(ctx context.Context, login, password string) (*model.User, string, error)
-		Login(ctx context.Context, login, password string) (*model.User, string, error)
-		ValidateToken(tokenString string) (int64, error)
+		Register(ctx context.Context, login, password string) (*model.User, *model.TokenPair, error)
+		Login(ctx context.Context, login, password, ip string) (*model.User, *model.TokenPair, error)
+		CompleteLogin(ctx context.Context, challengeToken, code, ip string) (*model.User, *model.TokenPair, error)
+		Refresh(ctx context.Context, refreshToken string) (*model.TokenPair, error)
+		Logout(ctx context.Context, sessionID string) error
+		LogoutAll(ctx context.Context, userID int64) error
+		ChangePassword(ctx context.Context, userID int64, sessionID, currentPassword, newPassword, ip string) error
+		ValidateToken(ctx context.Context, tokenString string) (*model.TokenClaims, error)
 	}
 
 	OrderProcessor interface {
 		UploadOrder(ctx context.Context, userID int64, orderNumber string) error
-		GetOrders(ctx context.Context, userID int64) ([]*model.Order, error)
+		GetOrder(ctx context.Context, userID int64, orderNumber string) (*model.OrderDetails, error)
+		GetOrders(ctx context.Context, userID int64, filter model.ListFilter) (*model.Page[*model.Order], error)
 		ProcessOrders(ctx context.Context) error
 	}
+
+	AccrualClient interface {
+		GetOrder(ctx context.Context, number string) (*accrual.AccrualResponse, error)
+	}
 )
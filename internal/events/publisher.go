@@ -0,0 +1,95 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+)
+
+// Publisher доставляет доменные события потребителям. Publish либо принимает всю пачку,
+// либо возвращает ошибку — тогда пачка будет отправлена повторно, так что потребители
+// должны быть готовы к дубликатам (их можно отсечь по ID).
+type Publisher interface {
+	Publish(ctx context.Context, events []*model.DomainEvent) error
+	Close() error
+}
+
+// NewPublisher создаёт публикатор по описанию sink: "stdout" или "file:<путь>".
+func NewPublisher(sink string) (Publisher, error) {
+	switch {
+	case sink == "stdout":
+		return NewStdoutPublisher(), nil
+	case strings.HasPrefix(sink, "file:"):
+		return NewFilePublisher(strings.TrimPrefix(sink, "file:"))
+	default:
+		return nil, fmt.Errorf("unknown events sink %q (want stdout or file:<path>)", sink)
+	}
+}
+
+type writerPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutPublisher пишет события в stdout по одному JSON на строку — для локальной отладки.
+func NewStdoutPublisher() Publisher {
+	return &writerPublisher{w: os.Stdout}
+}
+
+func (p *writerPublisher) Publish(_ context.Context, events []*model.DomainEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return writeJSONL(p.w, events)
+}
+
+func (p *writerPublisher) Close() error {
+	return nil
+}
+
+type filePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFilePublisher дописывает события в JSONL-файл и сбрасывает его на диск после каждой пачки.
+func NewFilePublisher(path string) (Publisher, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open events file: %w", err)
+	}
+	return &filePublisher{file: file}, nil
+}
+
+func (p *filePublisher) Publish(_ context.Context, events []*model.DomainEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := writeJSONL(p.file, events); err != nil {
+		return err
+	}
+	return p.file.Sync()
+}
+
+func (p *filePublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.file.Close()
+}
+
+func writeJSONL(w io.Writer, events []*model.DomainEvent) error {
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("failed to encode event %d: %w", event.ID, err)
+		}
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+)
+
+func testEvents(ids ...int64) []*model.DomainEvent {
+	events := make([]*model.DomainEvent, 0, len(ids))
+	for _, id := range ids {
+		events = append(events, &model.DomainEvent{
+			ID:      id,
+			Type:    model.EventOrderUploaded,
+			Payload: json.RawMessage(`{"number":"12345678903"}`),
+		})
+	}
+	return events
+}
+
+func readIDs(t *testing.T, data []byte) []int64 {
+	t.Helper()
+	var ids []int64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var event model.DomainEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("line %q is not an event: %v", scanner.Text(), err)
+		}
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestWriterPublisherWritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	p := &writerPublisher{w: &buf}
+
+	if err := p.Publish(context.Background(), testEvents(1, 2)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	ids := readIDs(t, buf.Bytes())
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("written ids = %v, want [1 2]", ids)
+	}
+}
+
+func TestFilePublisherAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	for _, batch := range [][]int64{{1, 2}, {3}} {
+		p, err := NewPublisher("file:" + path)
+		if err != nil {
+			t.Fatalf("new publisher: %v", err)
+		}
+		if err := p.Publish(context.Background(), testEvents(batch...)); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		if err := p.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	ids := readIDs(t, data)
+	if len(ids) != 3 || ids[2] != 3 {
+		t.Errorf("file ids = %v, want [1 2 3] across reopenings", ids)
+	}
+}
+
+func TestNewPublisherSinks(t *testing.T) {
+	if p, err := NewPublisher("stdout"); err != nil || p == nil {
+		t.Errorf("stdout sink: %v", err)
+	}
+	for _, sink := range []string{"", "kafka://broker", "file:" + filepath.Join(t.TempDir(), "missing", "events.jsonl")} {
+		if _, err := NewPublisher(sink); err == nil {
+			t.Errorf("NewPublisher(%q) succeeded, want error", sink)
+		}
+	}
+}
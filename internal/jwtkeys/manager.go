@@ -0,0 +1,315 @@
+// Package jwtkeys загружает ключи подписи JWT и отдаёт их публичную часть в формате JWKS.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// MinSecretLength — минимальная длина HMAC-секрета в байтах (256 бит для HS256).
+	MinSecretLength = 32
+	minRSABits      = 2048
+
+	hmacKeyID = "hs256"
+
+	privateKeySuffix = ".pem"
+	publicKeySuffix  = ".pub.pem"
+)
+
+var (
+	ErrWeakSecret        = errors.New("jwt secret is empty or too weak")
+	ErrNoSigningKey      = errors.New("no jwt signing key")
+	ErrUnknownKey        = errors.New("unknown jwt key id")
+	ErrAlgorithmMismatch = errors.New("jwt algorithm does not match key")
+)
+
+// Key — ключ с идентификатором kid. У ключей, оставленных только для проверки
+// (выведенных из ротации), приватной части нет.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	private   crypto.PrivateKey
+	verifying any
+}
+
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// Manager хранит ключ, которым подписываются новые токены, и все ключи, которыми
+// ещё можно проверять выданные ранее.
+type Manager struct {
+	dir        string
+	signingKID string
+
+	mu      sync.RWMutex
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewHMACManager подписывает токены общим секретом HS256. Пустой или короткий секрет
+// отвергается.
+func NewHMACManager(secret string) (*Manager, error) {
+	if err := checkSecret(secret); err != nil {
+		return nil, err
+	}
+	key := &Key{
+		ID:        hmacKeyID,
+		Method:    jwt.SigningMethodHS256,
+		private:   []byte(secret),
+		verifying: []byte(secret),
+	}
+	return &Manager{
+		signing: key,
+		keys:    map[string]*Key{key.ID: key},
+	}, nil
+}
+
+// NewDirManager загружает ключи из каталога. Каждый файл — один ключ, kid — имя файла
+// без расширения:
+//   - <kid>.pem — приватный ключ PKCS#8 (RSA от 2048 бит или Ed25519), подписывает и проверяет;
+//   - <kid>.pub.pem — публичный ключ PKIX, только проверяет.
+//
+// Подписывает ключ signingKID, а если он не задан — приватный ключ с наибольшим kid,
+// поэтому удобно называть ключи по дате выпуска (2026-10-01.pem).
+func NewDirManager(dir, signingKID string) (*Manager, error) {
+	m := &Manager{dir: dir, signingKID: signingKID}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload перечитывает каталог ключей. При ошибке остаются прежние ключи.
+func (m *Manager) Reload() error {
+	if m.dir == "" {
+		return nil
+	}
+
+	keys, err := loadDir(m.dir)
+	if err != nil {
+		return err
+	}
+
+	signing, err := pickSigningKey(keys, m.signingKID)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.signing = signing
+	m.mu.Unlock()
+	return nil
+}
+
+// Sign подписывает claims текущим ключом и проставляет kid в заголовок.
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	key := m.signing
+	m.mu.RUnlock()
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// Keyfunc находит ключ проверки по kid из заголовка токена и сверяет алгоритм.
+func (m *Manager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	m.mu.RLock()
+	key, ok := m.keys[kid]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrAlgorithmMismatch
+	}
+	return key.verifying, nil
+}
+
+// JWKS возвращает публичные ключи проверки. Симметричные ключи не публикуются.
+func (m *Manager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range m.keys {
+		if jwk, ok := toJWK(key); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
+
+func checkSecret(secret string) error {
+	if len(secret) < MinSecretLength {
+		return fmt.Errorf("%w: need at least %d bytes", ErrWeakSecret, MinSecretLength)
+	}
+	distinct := make(map[rune]struct{})
+	for _, r := range secret {
+		distinct[r] = struct{}{}
+	}
+	// Отсекает заглушки вроде "aaaa…" и "secretsecret…".
+	if len(distinct) < 8 {
+		return fmt.Errorf("%w: too few distinct characters", ErrWeakSecret)
+	}
+	return nil
+}
+
+func loadDir(dir string) (map[string]*Key, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwt keys dir: %w", err)
+	}
+
+	keys := make(map[string]*Key)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, privateKeySuffix) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jwt key %s: %w", name, err)
+		}
+
+		var key *Key
+		if kid, ok := strings.CutSuffix(name, publicKeySuffix); ok {
+			key, err = parsePublicKey(kid, data)
+		} else {
+			key, err = parsePrivateKey(strings.TrimSuffix(name, privateKeySuffix), data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", name, err)
+		}
+		if existing, ok := keys[key.ID]; ok && existing.CanSign() {
+			// Для kid есть и приватный, и публичный файл — достаточно приватного.
+			continue
+		}
+		keys[key.ID] = key
+	}
+	return keys, nil
+}
+
+func pickSigningKey(keys map[string]*Key, signingKID string) (*Key, error) {
+	if signingKID != "" {
+		key, ok := keys[signingKID]
+		if !ok || !key.CanSign() {
+			return nil, fmt.Errorf("%w: private key %q not found", ErrNoSigningKey, signingKID)
+		}
+		return key, nil
+	}
+
+	var signing *Key
+	for _, key := range keys {
+		if key.CanSign() && (signing == nil || key.ID > signing.ID) {
+			signing = key
+		}
+	}
+	if signing == nil {
+		return nil, ErrNoSigningKey
+	}
+	return signing, nil
+}
+
+func parsePrivateKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#8 private key: %w", err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key is %d bits, need at least %d", k.N.BitLen(), minRSABits)
+		}
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, private: k, verifying: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, private: k, verifying: k.Public()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+}
+
+func parsePublicKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key is %d bits, need at least %d", k.N.BitLen(), minRSABits)
+		}
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, verifying: k}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, verifying: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", parsed)
+	}
+}
+
+// JWK — публичный ключ в формате RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func toJWK(key *Key) (JWK, bool) {
+	jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+	switch k := key.verifying.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
@@ -0,0 +1,300 @@
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testSecret = "k3Y-for-tests_0123456789abcdefXYZ"
+
+func writePrivateKey(t *testing.T, dir, kid string, key crypto.PrivateKey) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal private key: %v", err)
+	}
+	writePEM(t, filepath.Join(dir, kid+privateKeySuffix), "PRIVATE KEY", der)
+}
+
+func writePublicKey(t *testing.T, dir, kid string, key crypto.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	return writePEM(t, filepath.Join(dir, kid+publicKeySuffix), "PUBLIC KEY", der)
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) []byte {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	return data
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, minRSABits)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	return key
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	return key
+}
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{Subject: "1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+}
+
+func kidOf(t *testing.T, m *Manager, signed string) string {
+	t.Helper()
+	token, err := jwt.Parse(signed, m.Keyfunc)
+	if err != nil {
+		t.Fatalf("parse own token: %v", err)
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+func TestWeakSecretsRejected(t *testing.T) {
+	for _, secret := range []string{
+		"",
+		"short-secret",
+		strings.Repeat("a", 64),
+		strings.Repeat("secret", 8),
+	} {
+		if _, err := NewHMACManager(secret); !errors.Is(err, ErrWeakSecret) {
+			t.Errorf("NewHMACManager(%q) error = %v, want ErrWeakSecret", secret, err)
+		}
+	}
+	if _, err := NewHMACManager(testSecret); err != nil {
+		t.Errorf("NewHMACManager(strong) error = %v", err)
+	}
+}
+
+func TestHMACManagerSignsAndVerifies(t *testing.T) {
+	m, err := NewHMACManager(testSecret)
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	signed, err := m.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if kid := kidOf(t, m, signed); kid != hmacKeyID {
+		t.Errorf("kid = %q, want %q", kid, hmacKeyID)
+	}
+	if keys := m.JWKS().Keys; len(keys) != 0 {
+		t.Errorf("JWKS publishes %d keys for a shared secret, want none", len(keys))
+	}
+}
+
+func TestDirManagerPicksNewestPrivateKey(t *testing.T) {
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "2026-01-01", newEd25519Key(t))
+	writePrivateKey(t, dir, "2026-06-01", newEd25519Key(t))
+	// Публичный ключ с бо́льшим kid подписывать не может и не выбирается.
+	writePublicKey(t, dir, "2027-01-01", newEd25519Key(t).Public())
+	if err := os.WriteFile(filepath.Join(dir, "README.txt"), []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("write readme: %v", err)
+	}
+
+	m, err := NewDirManager(dir, "")
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	signed, err := m.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if kid := kidOf(t, m, signed); kid != "2026-06-01" {
+		t.Errorf("signing kid = %q, want the newest private key 2026-06-01", kid)
+	}
+
+	explicit, err := NewDirManager(dir, "2026-01-01")
+	if err != nil {
+		t.Fatalf("new manager with kid: %v", err)
+	}
+	signed, err = explicit.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if kid := kidOf(t, explicit, signed); kid != "2026-01-01" {
+		t.Errorf("signing kid = %q, want configured 2026-01-01", kid)
+	}
+
+	if _, err := NewDirManager(dir, "2027-01-01"); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("signing with a public-only kid: err = %v, want ErrNoSigningKey", err)
+	}
+}
+
+func TestDirManagerVerifiesRetiredPublicKey(t *testing.T) {
+	dir := t.TempDir()
+	old := newEd25519Key(t)
+	writePrivateKey(t, dir, "old", old)
+	oldManager, err := NewDirManager(dir, "")
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	signed, err := oldManager.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	// Ротация: приватная часть старого ключа убрана, публичная оставлена для проверки.
+	if err := os.Remove(filepath.Join(dir, "old"+privateKeySuffix)); err != nil {
+		t.Fatalf("remove old key: %v", err)
+	}
+	writePublicKey(t, dir, "old", old.Public())
+	writePrivateKey(t, dir, "new", newEd25519Key(t))
+
+	m, err := NewDirManager(dir, "")
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if _, err := jwt.Parse(signed, m.Keyfunc); err != nil {
+		t.Errorf("token signed by retired key rejected: %v", err)
+	}
+}
+
+func TestDirManagerRejectsBadKeys(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		write func(t *testing.T, dir string)
+	}{
+		{"empty dir", func(*testing.T, string) {}},
+		{"short RSA key", func(t *testing.T, dir string) { writePrivateKey(t, dir, "small", small) }},
+		{"not PEM", func(t *testing.T, dir string) {
+			if err := os.WriteFile(filepath.Join(dir, "junk.pem"), []byte("junk"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.write(t, dir)
+			if _, err := NewDirManager(dir, ""); err == nil {
+				t.Error("NewDirManager succeeded, want error")
+			}
+		})
+	}
+}
+
+// TestHS256RejectedForAsymmetricKeys: классическая подмена алгоритма — токен HS256,
+// подписанный публичным ключом как секретом, с kid асимметричного ключа.
+func TestHS256RejectedForAsymmetricKeys(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := newRSAKey(t)
+	edKey := newEd25519Key(t)
+	writePrivateKey(t, dir, "rsa", rsaKey)
+	writePrivateKey(t, dir, "ed", edKey)
+	rsaPublic := writePublicKey(t, t.TempDir(), "rsa", rsaKey.Public())
+	edPublic := writePublicKey(t, t.TempDir(), "ed", edKey.Public())
+
+	m, err := NewDirManager(dir, "rsa")
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+
+	for kid, secret := range map[string][]byte{"rsa": rsaPublic, "ed": edPublic} {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+		token.Header["kid"] = kid
+		forged, err := token.SignedString(secret)
+		if err != nil {
+			t.Fatalf("sign forged token: %v", err)
+		}
+		if _, err := jwt.Parse(forged, m.Keyfunc); !errors.Is(err, ErrAlgorithmMismatch) {
+			t.Errorf("HS256 token for kid %q: err = %v, want ErrAlgorithmMismatch", kid, err)
+		}
+	}
+
+	// RS256 вместо EdDSA для kid ed тоже отвергается.
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims())
+	token.Header["kid"] = "ed"
+	forged, err := token.SignedString(rsaKey)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := jwt.Parse(forged, m.Keyfunc); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Errorf("RS256 token for Ed25519 kid: err = %v, want ErrAlgorithmMismatch", err)
+	}
+}
+
+func TestUnknownKidRejected(t *testing.T) {
+	m, err := NewHMACManager(testSecret)
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+
+	for _, header := range []map[string]any{{"kid": "other"}, {}} {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+		for k, v := range header {
+			token.Header[k] = v
+		}
+		signed, err := token.SignedString([]byte(testSecret))
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		if _, err := jwt.Parse(signed, m.Keyfunc); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("token with header %v: err = %v, want ErrUnknownKey", header, err)
+		}
+	}
+}
+
+func TestJWKSPublishesPublicKeys(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := newRSAKey(t)
+	edKey := newEd25519Key(t)
+	writePrivateKey(t, dir, "b-rsa", rsaKey)
+	writePublicKey(t, dir, "a-ed", edKey.Public())
+
+	m, err := NewDirManager(dir, "")
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+
+	keys := m.JWKS().Keys
+	if len(keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", len(keys))
+	}
+	ed, rs := keys[0], keys[1]
+	if ed.KeyID != "a-ed" || ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.Algorithm != "EdDSA" || ed.X == "" {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+	if rs.KeyID != "b-rsa" || rs.KeyType != "RSA" || rs.Algorithm != "RS256" || rs.E != "AQAB" || rs.N == "" {
+		t.Errorf("RSA JWK = %+v", rs)
+	}
+	for _, k := range keys {
+		if k.Use != "sig" {
+			t.Errorf("JWK %s use = %q, want sig", k.KeyID, k.Use)
+		}
+	}
+}
@@ -8,12 +8,40 @@ import (
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/util/logger"
 	"go.uber.org/zap"
 	"net/http"
+	"slices"
 	"strings"
 )
 
-func JWTAuthMiddleware(authService service.AuthService) func(http.Handler) http.Handler {
+const apiKeyHeader = "X-API-Key"
+
+// JWTAuthMiddleware пускает запросы с access-токеном (cookie jwt или Bearer) либо
+// с API-ключом в заголовке X-API-Key. Права API-ключа проверяет RequireScope; роль
+// для API-ключа — текущая роль его владельца.
+func JWTAuthMiddleware(authService service.AuthService, apiKeys service.APIKeyService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := r.Header.Get(apiKeyHeader); key != "" {
+				apiKey, err := apiKeys.Authenticate(r.Context(), key)
+				if err != nil {
+					logger.Log.Warn("Invalid API key",
+						zap.String("path", r.URL.Path),
+						zap.Error(err))
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), types.UserIDKey, apiKey.UserID)
+				ctx = context.WithValue(ctx, types.ScopesKey, apiKey.Scopes)
+				ctx = context.WithValue(ctx, types.RoleKey, apiKey.OwnerRole)
+				logger.Log.Debug("User authenticated with API key",
+					zap.Int64("user_id", apiKey.UserID),
+					zap.Int64("api_key_id", apiKey.ID),
+					zap.String("path", r.URL.Path))
+
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			tokenString, err := extractToken(r)
 			if err != nil {
 				logger.Log.Debug("Failed to extract token",
@@ -23,7 +51,7 @@ func JWTAuthMiddleware(authService service.AuthService) func(http.Handler) http.
 				return
 			}
 
-			userID, err := authService.ValidateToken(tokenString)
+			claims, err := authService.ValidateToken(r.Context(), tokenString)
 			if err != nil {
 				logger.Log.Warn("Invalid token",
 					zap.String("path", r.URL.Path),
@@ -32,9 +60,12 @@ func JWTAuthMiddleware(authService service.AuthService) func(http.Handler) http.
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), types.UserIDKey, userID)
+			ctx := context.WithValue(r.Context(), types.UserIDKey, claims.UserID)
+			ctx = context.WithValue(ctx, types.SessionIDKey, claims.SessionID)
+			ctx = context.WithValue(ctx, types.RoleKey, claims.Role)
 			logger.Log.Debug("User authenticated",
-				zap.Int64("user_id", userID),
+				zap.Int64("user_id", claims.UserID),
+				zap.String("role", claims.Role),
 				zap.String("path", r.URL.Path))
 
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -42,6 +73,66 @@ func JWTAuthMiddleware(authService service.AuthService) func(http.Handler) http.
 	}
 }
 
+// RequireScope пропускает запросы сессии и запросы API-ключа с нужным правом.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, isAPIKey := r.Context().Value(types.ScopesKey).([]string)
+			if isAPIKey && !slices.Contains(scopes, scope) {
+				http.Error(w, "API key lacks scope "+scope, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAPIKeyScope пропускает только запросы API-ключа с нужным правом: так
+// обращаются партнёрские системы. Сессии идут через /api/admin.
+func RequireAPIKeyScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, isAPIKey := r.Context().Value(types.ScopesKey).([]string)
+			if !isAPIKey || !slices.Contains(scopes, scope) {
+				http.Error(w, "API key with scope "+scope+" required", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession закрывает для API-ключей управление аккаунтом: пароль, 2FA,
+// сессии, вебхуки и сами ключи.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, isAPIKey := r.Context().Value(types.ScopesKey).([]string); isAPIKey {
+			http.Error(w, "Not available for API keys", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole пропускает запросы сессии, роль которой входит в roles. Роль берётся
+// из access-токена, поэтому ставится после JWTAuthMiddleware; API-ключам недоступно.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, isAPIKey := r.Context().Value(types.ScopesKey).([]string)
+			role, ok := r.Context().Value(types.RoleKey).(string)
+			if isAPIKey || !ok || !slices.Contains(roles, role) {
+				logger.Log.Warn("Access denied by role",
+					zap.String("path", r.URL.Path),
+					zap.String("role", role))
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func extractToken(r *http.Request) (string, error) {
 	cookie, err := r.Cookie("jwt")
 	if err == nil && cookie.Value != "" {
@@ -68,3 +159,11 @@ func GetUserIDFromContext(ctx context.Context) (int64, error) {
 	}
 	return userID, nil
 }
+
+func GetSessionIDFromContext(ctx context.Context) (string, error) {
+	sessionID, ok := ctx.Value(types.SessionIDKey).(string)
+	if !ok || sessionID == "" {
+		return "", fmt.Errorf("session ID not found in context")
+	}
+	return sessionID, nil
+}
@@ -0,0 +1,112 @@
+package middlewareinternal
+
+import (
+	"context"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/types"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/util/logger"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = zap.NewNop()
+	m.Run()
+}
+
+type principal struct {
+	role   string
+	scopes []string // nil — сессия, иначе API-ключ
+}
+
+func serveAs(mw func(http.Handler) http.Handler, p principal) int {
+	ctx := context.WithValue(context.Background(), types.UserIDKey, int64(1))
+	if p.role != "" {
+		ctx = context.WithValue(ctx, types.RoleKey, p.role)
+	}
+	if p.scopes != nil {
+		ctx = context.WithValue(ctx, types.ScopesKey, p.scopes)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	rec := httptest.NewRecorder()
+	mw(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	return rec.Code
+}
+
+func TestRequireScope(t *testing.T) {
+	mw := RequireScope(model.ScopeOrdersRead)
+	tests := []struct {
+		name string
+		p    principal
+		want int
+	}{
+		{"session", principal{role: model.RoleUser}, http.StatusNoContent},
+		{"key with scope", principal{role: model.RoleUser, scopes: []string{model.ScopeOrdersRead}}, http.StatusNoContent},
+		{"key without scope", principal{role: model.RoleUser, scopes: []string{model.ScopeBalanceRead}}, http.StatusForbidden},
+		{"key with no scopes", principal{role: model.RoleUser, scopes: []string{}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveAs(mw, tt.p); got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireAPIKeyScope(t *testing.T) {
+	mw := RequireAPIKeyScope(model.ScopeWithdrawalsReverse)
+	tests := []struct {
+		name string
+		p    principal
+		want int
+	}{
+		{"admin session", principal{role: model.RoleAdmin}, http.StatusForbidden},
+		{"key with scope", principal{role: model.RoleSupport, scopes: []string{model.ScopeWithdrawalsReverse}}, http.StatusNoContent},
+		{"key without scope", principal{role: model.RoleSupport, scopes: []string{model.ScopeWithdrawalsRead}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveAs(mw, tt.p); got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	if got := serveAs(RequireSession, principal{role: model.RoleUser}); got != http.StatusNoContent {
+		t.Fatalf("session: status = %d, want %d", got, http.StatusNoContent)
+	}
+	if got := serveAs(RequireSession, principal{role: model.RoleUser, scopes: []string{model.ScopeOrdersRead}}); got != http.StatusForbidden {
+		t.Fatalf("api key: status = %d, want %d", got, http.StatusForbidden)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	mw := RequireRole(model.RoleSupport, model.RoleAdmin)
+	tests := []struct {
+		name string
+		p    principal
+		want int
+	}{
+		{"admin session", principal{role: model.RoleAdmin}, http.StatusNoContent},
+		{"support session", principal{role: model.RoleSupport}, http.StatusNoContent},
+		{"user session", principal{role: model.RoleUser}, http.StatusForbidden},
+		{"no role", principal{}, http.StatusForbidden},
+		// Роль владельца ключа не даёт доступа к /api/admin.
+		{"admin api key", principal{role: model.RoleAdmin, scopes: []string{model.ScopeWithdrawalsReverse}}, http.StatusForbidden},
+		{"admin api key without scopes", principal{role: model.RoleAdmin, scopes: []string{}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveAs(mw, tt.p); got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
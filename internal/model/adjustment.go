@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+const (
+	AdjustmentPending  = "PENDING"
+	AdjustmentApplied  = "APPLIED"
+	AdjustmentRejected = "REJECTED"
+)
+
+var AdjustmentStatuses = []string{AdjustmentPending, AdjustmentApplied, AdjustmentRejected}
+
+// BalanceAdjustment — ручное зачисление (Amount > 0) или списание (Amount < 0), сделанное
+// сотрудником. Суммы выше порога ждут подтверждения другого администратора в статусе PENDING.
+type BalanceAdjustment struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Amount     Money      `json:"amount"`
+	Reason     string     `json:"reason"`
+	Ticket     string     `json:"ticket"`
+	Status     string     `json:"status"`
+	CreatedBy  int64      `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReviewedBy *int64     `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	AppliedAt  *time.Time `json:"applied_at,omitempty"`
+}
@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// AdminActor — сотрудник, выполняющий действие через /api/admin. Попадает в журнал аудита.
+type AdminActor struct {
+	UserID int64
+	Role   string
+	IP     string
+}
+
+// AdminUser — сведения о пользователе для поддержки, без хеша пароля.
+type AdminUser struct {
+	ID               int64     `json:"id"`
+	Login            string    `json:"login"`
+	Role             string    `json:"role"`
+	CreatedAt        time.Time `json:"created_at"`
+	Balance          Money     `json:"balance"`
+	Withdrawn        Money     `json:"withdrawn"`
+	Held             Money     `json:"held"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+}
+
+// OrderSearch — условия поиска заказов по всем пользователям. Пустые поля не ограничивают
+// выборку; Number — префикс номера.
+type OrderSearch struct {
+	UserID *int64
+	Number string
+}
+
+// AdminOrder — заказ вместе с владельцем: в пользовательском API UserID не отдаётся.
+type AdminOrder struct {
+	*Order
+	UserID int64 `json:"user_id"`
+}
+
+type AdminWithdrawal struct {
+	*Withdrawal
+	UserID int64 `json:"user_id"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+const (
+	ScopeOrdersRead       = "orders:read"
+	ScopeOrdersWrite      = "orders:write"
+	ScopeBalanceRead      = "balance:read"
+	ScopeWithdrawalsRead  = "withdrawals:read"
+	ScopeWithdrawalsWrite = "withdrawals:write"
+	// ScopeWithdrawalsReverse — доступ партнёрской системы к подтверждению и возврату
+	// списаний любых пользователей.
+	ScopeWithdrawalsReverse = "withdrawals:reverse"
+)
+
+var APIKeyScopes = []string{
+	ScopeOrdersRead,
+	ScopeOrdersWrite,
+	ScopeBalanceRead,
+	ScopeWithdrawalsRead,
+	ScopeWithdrawalsWrite,
+	ScopeWithdrawalsReverse,
+}
+
+// StaffAPIKeyScopes может выдать себе только сотрудник поддержки или администратор.
+var StaffAPIKeyScopes = []string{ScopeWithdrawalsReverse}
+
+// APIKey — именованный ключ доступа к API с ограниченным набором прав.
+// Сам ключ (Key) возвращается только при создании, в базе хранится его хеш.
+type APIKey struct {
+	ID      int64  `json:"id"`
+	UserID  int64  `json:"-"`
+	Name    string `json:"name"`
+	Prefix  string `json:"prefix"`
+	Key     string `json:"key,omitempty"`
+	KeyHash string `json:"-"`
+	// OwnerRole — текущая роль владельца ключа, читается при каждой аутентификации.
+	OwnerRole  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
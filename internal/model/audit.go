@@ -0,0 +1,40 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditLoginLockout      = "login.lockout"
+	AuditPasswordChanged   = "password.changed"
+	AuditTwoFactorEnabled  = "2fa.enabled"
+	AuditTwoFactorDisabled = "2fa.disabled"
+	AuditRecoveryCodeUsed  = "2fa.recovery_code_used"
+
+	AuditAdminUserViewed      = "admin.user.viewed"
+	AuditAdminOrdersSearched  = "admin.orders.searched"
+	AuditAdminOrderRepolled   = "admin.order.repolled"
+	AuditAdminWithdrawalsRead = "admin.withdrawals.listed"
+	AuditAdminRoleChanged     = "admin.user.role_changed"
+
+	AuditAdjustmentRequested = "admin.adjustment.requested"
+	AuditAdjustmentApplied   = "admin.adjustment.applied"
+	AuditAdjustmentRejected  = "admin.adjustment.rejected"
+
+	AuditWithdrawalCompleted = "admin.withdrawal.completed"
+	AuditWithdrawalReversed  = "admin.withdrawal.reversed"
+	AuditReversalRequested   = "admin.withdrawal.reversal_requested"
+	AuditReversalRejected    = "admin.withdrawal.reversal_rejected"
+)
+
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Action    string          `json:"action"`
+	UserID    *int64          `json:"user_id,omitempty"`
+	ActorID   *int64          `json:"actor_id,omitempty"`
+	Login     string          `json:"login,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
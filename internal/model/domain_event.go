@@ -0,0 +1,84 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventOrderUploaded      = "OrderUploaded"
+	EventOrderStatusChanged = "OrderStatusChanged"
+	EventAccrualCredited    = "AccrualCredited"
+	EventWithdrawalCreated  = "WithdrawalCreated"
+	EventWithdrawalReversed = "WithdrawalReversed"
+	EventUserRegistered     = "UserRegistered"
+	EventPointsExpired      = "PointsExpired"
+	EventTierChanged        = "TierChanged"
+)
+
+const (
+	AggregateOrder      = "order"
+	AggregateWithdrawal = "withdrawal"
+	AggregateUser       = "user"
+	// AggregateWebhook — строки outbox с доставками вебхуков.
+	AggregateWebhook = "webhook"
+)
+
+// DomainEvent — запись outbox: факт, произошедший в системе, для внешних потребителей.
+type DomainEvent struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	UserID        int64           `json:"user_id,omitempty"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+type OrderUploadedPayload struct {
+	Number     string    `json:"number"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type OrderStatusChangedPayload struct {
+	Number         string `json:"number"`
+	PreviousStatus string `json:"previous_status"`
+	Status         string `json:"status"`
+}
+
+type AccrualCreditedPayload struct {
+	Number  string `json:"number"`
+	Accrual Money  `json:"accrual"`
+	Bonus   Money  `json:"bonus,omitempty"`
+}
+
+type WithdrawalCreatedPayload struct {
+	Order       string    `json:"order"`
+	Sum         Money     `json:"sum"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+type WithdrawalReversedPayload struct {
+	Order       string `json:"order"`
+	Sum         Money  `json:"sum"`
+	ReversedSum Money  `json:"reversed_sum"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason"`
+}
+
+type PointsExpiredPayload struct {
+	Sum       Money     `json:"sum"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+type TierChangedPayload struct {
+	PreviousTier string `json:"previous_tier"`
+	Tier         string `json:"tier"`
+	Accrued      Money  `json:"accrued"`
+	Orders       int    `json:"orders"`
+}
+
+type UserRegisteredPayload struct {
+	Login     string    `json:"login"`
+	CreatedAt time.Time `json:"created_at"`
+}
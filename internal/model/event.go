@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// OrderEvent — изменение статуса или начисления по заказу. ID — номер коммита записи
+// в истории статусов (commit_seq); события идут по возрастанию ID, и по нему поток возобновляется.
+type OrderEvent struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Number    string    `json:"number"`
+	Status    string    `json:"status"`
+	Accrual   Money     `json:"accrual,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+}
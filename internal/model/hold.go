@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+const (
+	HoldActive   = "ACTIVE"
+	HoldCaptured = "CAPTURED"
+	HoldReleased = "RELEASED"
+	HoldExpired  = "EXPIRED"
+)
+
+// Hold — резерв баллов под заказ на время оплаты. Зарезервированная сумма остаётся
+// в балансе, но недоступна для списаний, пока резерв не списан (capture) или не снят.
+type Hold struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"-"`
+	Order        string     `json:"order"`
+	Amount       Money      `json:"sum"`
+	Status       string     `json:"status"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty"`
+	WithdrawalID *int64     `json:"-"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// IdempotencyRecord — сохранённый результат запроса с заголовком Idempotency-Key.
+// Пока запрос выполняется, StatusCode равен нулю.
+type IdempotencyRecord struct {
+	UserID       int64
+	Key          string
+	RequestHash  string
+	StatusCode   int
+	ResponseBody []byte
+	CreatedAt    time.Time
+}
+
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+const (
+	LedgerKindAccrual    = "ACCRUAL"
+	LedgerKindWithdrawal = "WITHDRAWAL"
+	LedgerKindReversal   = "REVERSAL"
+	LedgerKindAdjustment = "ADJUSTMENT"
+	LedgerKindExpiry     = "EXPIRY"
+	LedgerKindBonus      = "BONUS"
+)
+
+// Счета журнала. Баланс пользователя — сумма проводок по счёту LedgerAccountUser,
+// остальные счета системные и служат второй стороной каждой операции.
+const (
+	LedgerAccountUser       = "user"
+	LedgerAccountAccrual    = "accrual"
+	LedgerAccountRedemption = "redemption"
+	LedgerAccountAdjustment = "adjustment"
+	LedgerAccountExpiry     = "expiry"
+	LedgerAccountBonus      = "bonus"
+)
+
+type LedgerEntry struct {
+	ID            int64     `json:"id"`
+	TransactionID int64     `json:"-"`
+	Account       string    `json:"-"`
+	UserID        int64     `json:"-"`
+	Amount        Money     `json:"amount"`
+	Kind          string    `json:"kind"`
+	OrderNumber   string    `json:"order,omitempty"`
+	WithdrawalID  int64     `json:"withdrawal_id,omitempty"`
+	Description   string    `json:"description,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// LedgerPosting — одна операция с балансом пользователя. Amount положителен для
+// зачисления и отрицателен для списания; противоположная проводка пишется на CounterAccount.
+type LedgerPosting struct {
+	UserID         int64
+	Amount         Money
+	Kind           string
+	CounterAccount string
+	OrderNumber    string
+	WithdrawalID   int64
+	Description    string
+}
+
+type BalanceMismatch struct {
+	UserID        int64
+	Balance       Money
+	LedgerBalance Money
+}
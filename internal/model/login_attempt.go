@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+const (
+	LoginScopeLogin = "login"
+	LoginScopeIP    = "ip"
+	// LoginScopeTwoFactor — неудачные коды 2FA пользователя; ключ — его id.
+	LoginScopeTwoFactor = "2fa"
+)
+
+// LoginAttempt — счётчик неудачных входов по логину, по IP-адресу клиента или кодов 2FA.
+type LoginAttempt struct {
+	Scope        string
+	Key          string
+	Failures     int
+	LastFailedAt *time.Time
+	LockedUntil  *time.Time
+}
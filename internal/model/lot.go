@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// LotKindOpening — остаток баланса, перенесённый при введении лотов.
+const LotKindOpening = "OPENING"
+
+// AccrualLot — одно зачисление баллов. Remaining уменьшается при списаниях (FIFO)
+// и при сгорании; Kind совпадает с видом проводки журнала, которой лот был зачислен.
+type AccrualLot struct {
+	ID          int64
+	UserID      int64
+	Kind        string
+	OrderNumber string
+	Amount      Money
+	Remaining   Money
+	Expired     Money
+	CreatedAt   time.Time
+	ExpiresAt   *time.Time
+}
+
+// LotConsumption — часть лота, израсходованная списанием; Restored — сколько из неё
+// уже возвращено.
+type LotConsumption struct {
+	ID           int64
+	LotID        int64
+	WithdrawalID int64
+	Amount       Money
+	Restored     Money
+}
+
+// ExpiringPoints — баллы, которые сгорят в указанный момент.
+type ExpiringPoints struct {
+	Sum       Money     `json:"sum"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
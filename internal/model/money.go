@@ -0,0 +1,159 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money — сумма баллов с точностью до сотых, хранится целым числом сотых долей.
+//
+// Правила округления: всё, что точнее сотых, округляется до сотых половиной от нуля
+// (0.005 → 0.01, -0.005 → -0.01, 0.0049 → 0). В JSON сумма пишется числом без
+// лишних нулей: 500, 729.9, 729.98.
+type Money int64
+
+// MaxMoneyDigits — число цифр целой части, которое помещается в NUMERIC(18,2).
+const MaxMoneyDigits = 16
+
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * 100))
+}
+
+// ParseMoney разбирает десятичную запись суммы без потери точности.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+
+	negative := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	if len(intPart) > MaxMoneyDigits {
+		return 0, fmt.Errorf("%w: %q is too large", ErrInvalidMoney, s)
+	}
+
+	var units int64
+	if intPart != "" {
+		v, err := strconv.ParseInt(intPart, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+		}
+		units = v * 100
+	}
+
+	fracPart += "000"
+	cents, _ := strconv.ParseInt(fracPart[:2], 10, 64)
+	units += cents
+	if fracPart[2] >= '5' {
+		units++
+	}
+
+	if negative {
+		units = -units
+	}
+	return Money(units), nil
+}
+
+func (m Money) String() string {
+	units := int64(m)
+	sign := ""
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+
+	whole, cents := units/100, units%100
+	if cents == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	return strings.TrimRight(fmt.Sprintf("%s%d.%02d", sign, whole, cents), "0")
+}
+
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON принимает только число: сумма в кавычках — ошибка клиента, а не формат.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		return fmt.Errorf("%w: %s is a string, not a number", ErrInvalidMoney, s)
+	}
+
+	v, err := ParseMoney(s)
+	if err != nil {
+		// Экспоненциальная запись (1e3) допустима в JSON, но не в ParseMoney.
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil || math.IsInf(f, 0) || math.IsNaN(f) || math.Abs(f) >= math.Pow10(MaxMoneyDigits) {
+			return err
+		}
+		v = MoneyFromFloat(f)
+	}
+	*m = v
+	return nil
+}
+
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	case int64:
+		*m = Money(v * 100)
+	case float64:
+		*m = MoneyFromFloat(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{"729.98", 72998, false},
+		{"500", 50000, false},
+		{"0.1", 10, false},
+		{".5", 50, false},
+		{"7.", 700, false},
+		{"+1.25", 125, false},
+		{" 3.5 ", 350, false},
+		{"0.005", 1, false},
+		{"0.0049", 0, false},
+		{"0.015", 2, false},
+		{"1.995", 200, false},
+		{"-0.005", -1, false},
+		{"-729.98", -72998, false},
+		{"-0.0049", 0, false},
+		{"9999999999999999.99", 999999999999999999, false},
+		{"10000000000000000", 0, true},
+		{"", 0, true},
+		{".", 0, true},
+		{"-", 0, true},
+		{"1,5", 0, true},
+		{"1.2.3", 0, true},
+		{"abc", 0, true},
+		{"1e3", 0, true},
+		{"--1", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMoney(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidMoney) {
+					t.Fatalf("ParseMoney(%q) error = %v, want ErrInvalidMoney", tt.in, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	a, _ := ParseMoney("729.98")
+	b, _ := ParseMoney("500")
+	if got := (a + b).String(); got != "1229.98" {
+		t.Errorf("729.98 + 500 = %s, want 1229.98", got)
+	}
+	if got := (b - a).String(); got != "-229.98" {
+		t.Errorf("500 - 729.98 = %s, want -229.98", got)
+	}
+}
+
+func TestMoneyFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Money
+	}{
+		{729.98, 72998},
+		{0.1 + 0.2, 30},
+		{0.005, 1},
+		{-0.005, -1},
+		{-729.98, -72998},
+		{0.0049, 0},
+	}
+	for _, tt := range tests {
+		if got := MoneyFromFloat(tt.in); got != tt.want {
+			t.Errorf("MoneyFromFloat(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyMarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0"},
+		{50000, "500"},
+		{72990, "729.9"},
+		{72998, "729.98"},
+		{122998, "1229.98"},
+		{1, "0.01"},
+		{-1, "-0.01"},
+		{-72998, "-729.98"},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(tt.in)
+		if err != nil {
+			t.Fatalf("Marshal(%d) error = %v", tt.in, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Marshal(%d) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{"729.98", 72998, false},
+		{"500", 50000, false},
+		{"0.005", 1, false},
+		{"-0.005", -1, false},
+		{"-729.98", -72998, false},
+		{"1e3", 100000, false},
+		{"1.5e-2", 2, false},
+		{"null", 0, false},
+		{`"729.98"`, 0, true},
+		{`"500"`, 0, true},
+		{`""`, 0, true},
+		{"1e20", 0, true},
+		{"true", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var got Money
+			err := json.Unmarshal([]byte(tt.in), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Unmarshal(%s) = %d, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s) error = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyRoundTrip(t *testing.T) {
+	for _, m := range []Money{0, 1, 10, 99, 100, 72998, -1, -72998, 999999999999999999} {
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal(%d) error = %v", m, err)
+		}
+		var got Money
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal(%s) error = %v", data, err)
+		}
+		if got != m {
+			t.Errorf("round trip %d -> %s -> %d", m, data, got)
+		}
+	}
+}
@@ -6,6 +6,18 @@ type Order struct {
 	Number     string    `json:"number"`
 	UserID     int64     `json:"-"`
 	Status     string    `json:"status"`
-	Accrual    float64   `json:"accrual,omitempty"`
+	Accrual    Money     `json:"accrual,omitempty"`
 	UploadedAt time.Time `json:"uploaded_at"`
 }
+
+type OrderStatusChange struct {
+	Status    string    `json:"status"`
+	Accrual   Money     `json:"accrual,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+type OrderDetails struct {
+	*Order
+	LastPolledAt *time.Time          `json:"last_polled_at,omitempty"`
+	History      []OrderStatusChange `json:"history"`
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor указывает на последний элемент страницы: время сортировки и ключ,
+// который разрешает совпадения по времени.
+type Cursor struct {
+	Time time.Time
+	Key  string
+}
+
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.Time.UnixNano(), 10) + "|" + c.Key
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, key, ok := strings.Cut(string(raw), "|")
+	if !ok || key == "" {
+		return nil, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{Time: time.Unix(0, n), Key: key}, nil
+}
+
+// ListFilter — параметры выборки списка. Нулевое значение означает весь список
+// от новых к старым, как требует спецификация.
+type ListFilter struct {
+	Limit     int
+	After     *Cursor
+	Statuses  []string
+	From      time.Time
+	To        time.Time
+	Ascending bool
+}
+
+type Page[T any] struct {
+	Items []T
+	Next  *Cursor
+}
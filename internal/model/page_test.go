@@ -0,0 +1,50 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []Cursor{
+		{Time: time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.UTC), Key: "42"},
+		{Time: time.Unix(0, 0), Key: "12345678903"},
+		{Time: time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC), Key: "a|b"},
+	}
+	for _, c := range tests {
+		t.Run(c.Key, func(t *testing.T) {
+			got, err := DecodeCursor(c.Encode())
+			if err != nil {
+				t.Fatalf("DecodeCursor(Encode(%+v)) error = %v", c, err)
+			}
+			if !got.Time.Equal(c.Time) || got.Key != c.Key {
+				t.Errorf("round trip = %+v, want %+v", got, c)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejectsMalformed(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"empty", ""},
+		{"not base64", "!!!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("1|42"))},
+		{"no separator", encode("1700000000")},
+		{"empty key", encode("1700000000|")},
+		{"non-numeric time", encode("yesterday|42")},
+		{"time overflow", encode("99999999999999999999|42")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeCursor(tt.in); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("DecodeCursor(%q) error = %v, want ErrInvalidCursor", tt.in, err)
+			}
+		})
+	}
+}
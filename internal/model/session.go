@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// Session — серверная сессия входа. Refresh-токен хранится только в виде хеша
+// и заменяется при каждом обновлении.
+type Session struct {
+	ID               string
+	UserID           int64
+	RefreshTokenHash string
+	CreatedAt        time.Time
+	LastUsedAt       time.Time
+	ExpiresAt        time.Time
+	RevokedAt        *time.Time
+}
+
+// TokenPair — выданные клиенту access- и refresh-токены.
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// TokenClaims — проверенное содержимое access-токена.
+type TokenClaims struct {
+	UserID    int64
+	SessionID string
+	Role      string
+	TokenID   string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,10 @@
+package model
+
+// Ключи настроек, которые сервер публикует в таблице settings.
+const (
+	SettingAdjustmentApprovalThreshold = "adjustment_approval_threshold"
+	SettingPointsExpiryMonths          = "points_expiry_months"
+	SettingLoginMaxFailures            = "login_max_failures"
+	SettingLoginMaxIPFailures          = "login_max_ip_failures"
+	SettingLoginLockout                = "login_lockout"
+)
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// TierBronze — базовый уровень без надбавки, его имеют все пользователи,
+// не достигшие порога следующего уровня.
+const TierBronze = "BRONZE"
+
+// Основание для расчёта уровня: сумма начислений или число начисленных заказов за окно.
+const (
+	TierBasisAccrual = "accrual"
+	TierBasisOrders  = "orders"
+)
+
+// Tier — уровень лояльности. Threshold — минимальная сумма начислений в копейках
+// или число заказов, в зависимости от основания расчёта.
+type Tier struct {
+	Name         string
+	Threshold    int64
+	BonusPercent int
+}
+
+// TierStats — начисления пользователя за окно расчёта уровня.
+type TierStats struct {
+	UserID  int64
+	Tier    string
+	Accrued Money
+	Orders  int
+}
+
+type Profile struct {
+	Login     string      `json:"login"`
+	Role      string      `json:"role"`
+	CreatedAt time.Time   `json:"created_at"`
+	Tier      *TierStatus `json:"tier"`
+}
+
+// TierStatus — текущий уровень и прогресс к следующему.
+type TierStatus struct {
+	Name         string      `json:"name"`
+	BonusPercent int         `json:"bonus_percent"`
+	Basis        string      `json:"basis"`
+	WindowStart  time.Time   `json:"window_start"`
+	Accrued      Money       `json:"accrued"`
+	Orders       int         `json:"orders"`
+	Next         *TierTarget `json:"next,omitempty"`
+}
+
+// TierTarget — следующий уровень и порог в единицах основания расчёта.
+type TierTarget struct {
+	Name         string `json:"name"`
+	BonusPercent int    `json:"bonus_percent"`
+	Accrued      Money  `json:"accrued,omitempty"`
+	Orders       int    `json:"orders,omitempty"`
+}
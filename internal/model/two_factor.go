@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// TOTP — секрет двухфакторной аутентификации пользователя. Пока ConfirmedAt пуст,
+// настройка не завершена и при входе код не требуется.
+type TOTP struct {
+	UserID       int64
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+func (t *TOTP) Enabled() bool {
+	return t != nil && t.ConfirmedAt != nil
+}
+
+// TOTPSetup — данные для добавления аккаунта в приложение-аутентификатор.
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// LoginChallenge выдаётся вместо токенов, если у аккаунта включена 2FA.
+type LoginChallenge struct {
+	Token     string    `json:"challenge_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
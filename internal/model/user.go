@@ -2,14 +2,29 @@ package model
 
 import "time"
 
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+var Roles = []string{RoleUser, RoleSupport, RoleAdmin}
+
 type User struct {
 	ID           int64
 	Login        string
 	PasswordHash string
+	Role         string
 	CreatedAt    time.Time
 }
 
+// UserBalance — состояние счёта. Current включает зарезервированные баллы (Held);
+// списать можно только Available = Current - Held.
 type UserBalance struct {
-	Current   float64
-	Withdrawn float64
+	Current   Money `json:"current"`
+	Withdrawn Money `json:"withdrawn"`
+	Held      Money `json:"held"`
+	Available Money `json:"available"`
+	// ExpiringSoon — баллы, сгорающие в ближайшее окно, по срокам.
+	ExpiringSoon []*ExpiringPoints `json:"expiring_soon,omitempty"`
 }
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	WebhookEventOrderProcessed     = "order.processed"
+	WebhookEventOrderInvalid       = "order.invalid"
+	WebhookEventWithdrawalCreated  = "withdrawal.created"
+	WebhookEventWithdrawalReversed = "withdrawal.reversed"
+)
+
+var WebhookEvents = []string{
+	WebhookEventOrderProcessed,
+	WebhookEventOrderInvalid,
+	WebhookEventWithdrawalCreated,
+	WebhookEventWithdrawalReversed,
+}
+
+const (
+	WebhookMessagePending   = "PENDING"
+	WebhookMessageDelivered = "DELIVERED"
+	WebhookMessageFailed    = "FAILED"
+)
+
+type Webhook struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookMessage — запись outbox, готовая к отправке на URL подписки.
+type WebhookMessage struct {
+	ID        int64
+	WebhookID int64
+	URL       string
+	Secret    string
+	EventType string
+	Payload   json.RawMessage
+	Attempts  int
+}
+
+type WebhookDelivery struct {
+	ID         int64     `json:"id"`
+	MessageID  int64     `json:"message_id"`
+	EventType  string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
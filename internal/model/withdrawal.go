@@ -2,9 +2,41 @@ package model
 
 import "time"
 
+// Статусы списания. PENDING — баллы списаны, покупка у партнёра ещё не подтверждена;
+// REVERSED — списание возвращено целиком. Частичный возврат статус не меняет.
+const (
+	WithdrawalPending   = "PENDING"
+	WithdrawalCompleted = "COMPLETED"
+	WithdrawalReversed  = "REVERSED"
+)
+
 type Withdrawal struct {
-	Order       string
-	Sum         float64
-	UserID      int64
-	ProcessedAt time.Time
+	ID          int64     `json:"-"`
+	Order       string    `json:"order"`
+	Sum         Money     `json:"sum"`
+	UserID      int64     `json:"-"`
+	Status      string    `json:"status"`
+	ReversedSum Money     `json:"reversed_sum,omitempty"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// Статусы возврата. Возврат больше порога подтверждения ждёт другого администратора в PENDING.
+const (
+	ReversalPending  = "PENDING"
+	ReversalApplied  = "APPLIED"
+	ReversalRejected = "REJECTED"
+)
+
+// WithdrawalReversal — возврат части или всей суммы списания на баланс.
+type WithdrawalReversal struct {
+	ID           int64      `json:"id"`
+	WithdrawalID int64      `json:"-"`
+	Order        string     `json:"order"`
+	Sum          Money      `json:"sum"`
+	Reason       string     `json:"reason"`
+	Status       string     `json:"status"`
+	ActorID      int64      `json:"actor_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ReviewedBy   *int64     `json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
 }
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+)
+
+type AdjustmentRepository interface {
+	Create(ctx context.Context, adjustment *model.BalanceAdjustment) error
+	GetForUpdate(ctx context.Context, id int64) (*model.BalanceAdjustment, error)
+	// Review фиксирует решение по заявке: статус, кто и когда её рассмотрел.
+	Review(ctx context.Context, adjustment *model.BalanceAdjustment) error
+	List(ctx context.Context, status string, userID *int64, limit int) ([]*model.BalanceAdjustment, error)
+}
+
+type adjustmentRepository struct {
+	db *Database
+}
+
+func NewAdjustmentRepository(db *Database) AdjustmentRepository {
+	return &adjustmentRepository{db: db}
+}
+
+const adjustmentColumns = `id, user_id, amount, reason, ticket, status, created_by, created_at, reviewed_by, reviewed_at, applied_at`
+
+func (r *adjustmentRepository) Create(ctx context.Context, adjustment *model.BalanceAdjustment) error {
+	query := `INSERT INTO balance_adjustments (user_id, amount, reason, ticket, status, created_by, applied_at)
+              VALUES ($1, $2::numeric, $3, $4, $5, $6, $7)
+              RETURNING id, created_at`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		adjustment.UserID, adjustment.Amount, adjustment.Reason, adjustment.Ticket,
+		adjustment.Status, adjustment.CreatedBy, adjustment.AppliedAt,
+	).Scan(&adjustment.ID, &adjustment.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create balance adjustment: %w", err)
+	}
+	return nil
+}
+
+func (r *adjustmentRepository) GetForUpdate(ctx context.Context, id int64) (*model.BalanceAdjustment, error) {
+	query := `SELECT ` + adjustmentColumns + ` FROM balance_adjustments WHERE id = $1 FOR UPDATE`
+	adjustment, err := scanAdjustment(r.db.conn(ctx).QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance adjustment: %w", err)
+	}
+	return adjustment, nil
+}
+
+func (r *adjustmentRepository) Review(ctx context.Context, adjustment *model.BalanceAdjustment) error {
+	query := `UPDATE balance_adjustments
+              SET status = $2, reviewed_by = $3, reviewed_at = $4, applied_at = $5
+              WHERE id = $1`
+	_, err := r.db.conn(ctx).ExecContext(ctx, query,
+		adjustment.ID, adjustment.Status, adjustment.ReviewedBy, adjustment.ReviewedAt, adjustment.AppliedAt)
+	if err != nil {
+		return fmt.Errorf("failed to review balance adjustment: %w", err)
+	}
+	return nil
+}
+
+// List возвращает последние заявки, новые первыми. Пустой status и nil userID не ограничивают выборку.
+func (r *adjustmentRepository) List(ctx context.Context, status string, userID *int64, limit int) ([]*model.BalanceAdjustment, error) {
+	query := `SELECT ` + adjustmentColumns + `
+              FROM balance_adjustments
+              WHERE ($1::text = '' OR status = $1)
+                AND ($2::bigint IS NULL OR user_id = $2)
+              ORDER BY id DESC
+              LIMIT $3`
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, status, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var adjustments []*model.BalanceAdjustment
+	for rows.Next() {
+		adjustment, err := scanAdjustment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		adjustments = append(adjustments, adjustment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return adjustments, nil
+}
+
+func scanAdjustment(row interface{ Scan(dest ...any) error }) (*model.BalanceAdjustment, error) {
+	a := &model.BalanceAdjustment{}
+	err := row.Scan(&a.ID, &a.UserID, &a.Amount, &a.Reason, &a.Ticket, &a.Status,
+		&a.CreatedBy, &a.CreatedAt, &a.ReviewedBy, &a.ReviewedAt, &a.AppliedAt)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/lib/pq"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *model.APIKey) error
+	GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+	GetByUserID(ctx context.Context, userID int64) ([]*model.APIKey, error)
+	CountActive(ctx context.Context, userID int64) (int, error)
+	Revoke(ctx context.Context, userID, id int64) (bool, error)
+	TouchLastUsed(ctx context.Context, id int64) error
+}
+
+type apiKeyRepository struct {
+	db *Database
+}
+
+func NewAPIKeyRepository(db *Database) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key *model.APIKey) error {
+	query := `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes)
+              VALUES ($1, $2, $3, $4, $5)
+              RETURNING id, created_at`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		key.UserID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes),
+	).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+	return nil
+}
+
+// GetByHash возвращает только действующий ключ вместе с текущей ролью владельца.
+func (r *apiKeyRepository) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	key := &model.APIKey{}
+	query := `SELECT k.id, k.user_id, k.name, k.prefix, k.scopes, k.created_at, k.last_used_at, u.role
+              FROM api_keys k JOIN users u ON u.id = k.user_id
+              WHERE k.key_hash = $1 AND k.revoked_at IS NULL`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, keyHash).Scan(
+		&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedAt, &key.LastUsedAt, &key.OwnerRole,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	return key, nil
+}
+
+func (r *apiKeyRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.APIKey, error) {
+	query := `SELECT id, user_id, name, prefix, scopes, created_at, last_used_at
+              FROM api_keys
+              WHERE user_id = $1 AND revoked_at IS NULL
+              ORDER BY id`
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*model.APIKey
+	for rows.Next() {
+		var k model.APIKey
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.CreatedAt, &k.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		keys = append(keys, &k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *apiKeyRepository) CountActive(ctx context.Context, userID int64) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL`
+	if err := r.db.conn(ctx).QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count api keys: %w", err)
+	}
+	return count, nil
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, userID, id int64) (bool, error) {
+	query := `UPDATE api_keys SET revoked_at = NOW()
+              WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	res, err := r.db.conn(ctx).ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// TouchLastUsed обновляет отметку не чаще раза в минуту, чтобы частые вызовы
+// скриптов не писали в базу на каждый запрос.
+func (r *apiKeyRepository) TouchLastUsed(ctx context.Context, id int64) error {
+	query := `UPDATE api_keys SET last_used_at = NOW()
+              WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to update api key last use: %w", err)
+	}
+	return nil
+}
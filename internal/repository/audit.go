@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+)
+
+type AuditRepository interface {
+	Record(ctx context.Context, entry *model.AuditEntry) error
+}
+
+type auditRepository struct {
+	db *Database
+}
+
+func NewAuditRepository(db *Database) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Record(ctx context.Context, entry *model.AuditEntry) error {
+	details := entry.Details
+	if len(details) == 0 {
+		details = []byte("{}")
+	}
+
+	query := `INSERT INTO audit_log (action, user_id, actor_id, login, ip, details)
+              VALUES ($1, $2, $3, $4, $5, $6)
+              RETURNING id, created_at`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		entry.Action, entry.UserID, entry.ActorID, entry.Login, entry.IP, []byte(details),
+	).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
@@ -15,7 +15,8 @@ import (
 )
 
 type Database struct {
-	db *sql.DB
+	db  *sql.DB
+	dsn string
 }
 
 type DatabaseConfig struct {
@@ -45,7 +46,7 @@ func NewDatabase(cfg DatabaseConfig) (*Database, error) {
 		return nil, fmt.Errorf("migrations directory does not exist: %s", absPath)
 	}
 
-	database := &Database{db: db}
+	database := &Database{db: db, dsn: cfg.DSN}
 	if err := database.Migrate(absPath); err != nil {
 		return nil, fmt.Errorf("failed to apply migrations: %w", err)
 	}
@@ -79,7 +80,3 @@ func (d *Database) Migrate(migrationsPath string) error {
 func (d *Database) Close() error {
 	return d.db.Close()
 }
-
-func (d *Database) BeginTx(ctx context.Context) (*sql.Tx, error) {
-	return d.db.BeginTx(ctx, nil)
-}
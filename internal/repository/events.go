@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"time"
+)
+
+const orderEventsChannel = "order_events"
+
+type OrderEventRepository interface {
+	GetEventsSince(ctx context.Context, userID, afterID int64, limit int) ([]*model.OrderEvent, error)
+	Listen(ctx context.Context, handler func(*model.OrderEvent)) error
+}
+
+type orderEventRepository struct {
+	db *Database
+}
+
+func NewOrderEventRepository(db *Database) OrderEventRepository {
+	return &orderEventRepository{db: db}
+}
+
+// GetEventsSince возвращает события с commit_seq больше afterID в порядке коммита.
+// commit_seq выдаётся при коммите (миграция 025), так что событие с меньшим номером
+// не может стать видимым позже: всё до afterID клиент уже получил.
+func (r *orderEventRepository) GetEventsSince(ctx context.Context, userID, afterID int64, limit int) ([]*model.OrderEvent, error) {
+	query := `SELECT h.commit_seq, o.user_id, h.order_number, h.status, h.accrual, h.changed_at
+              FROM order_status_history h
+              JOIN orders o ON o.number = h.order_number
+              WHERE o.user_id = $1 AND h.commit_seq > $2
+              ORDER BY h.commit_seq ASC
+              LIMIT $3`
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, userID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*model.OrderEvent
+	for rows.Next() {
+		var e model.OrderEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Number, &e.Status, &e.Accrual, &e.ChangedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		events = append(events, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return events, nil
+}
+
+// Listen подписывается на LISTEN order_events и передаёт handler события всех экземпляров,
+// пока не отменён ctx. Соединение восстанавливается автоматически; уведомления,
+// пришедшие во время обрыва, теряются — клиенты дочитывают их по Last-Event-ID.
+func (r *orderEventRepository) Listen(ctx context.Context, handler func(*model.OrderEvent)) error {
+	listener := pq.NewListener(r.db.dsn, time.Second, time.Minute,
+		func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				zap.L().Warn("Order events listener connection problem", zap.Error(err))
+			}
+		})
+	defer listener.Close()
+
+	if err := listener.Listen(orderEventsChannel); err != nil {
+		return fmt.Errorf("failed to listen %s: %w", orderEventsChannel, err)
+	}
+
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ping.C:
+			if err := listener.Ping(); err != nil {
+				zap.L().Warn("Order events listener ping failed", zap.Error(err))
+			}
+		case n := <-listener.Notify:
+			// nil приходит после переподключения.
+			if n == nil {
+				continue
+			}
+			var event model.OrderEvent
+			if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+				zap.L().Warn("Malformed order event", zap.String("payload", n.Extra), zap.Error(err))
+				continue
+			}
+			handler(&event)
+		}
+	}
+}
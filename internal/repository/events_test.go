@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestOrderEventsFollowCommitOrder: запись, вставленная раньше (меньший id), но
+// закоммиченная позже, получает больший номер события и не теряется при возобновлении.
+func TestOrderEventsFollowCommitOrder(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, db)
+
+	number := fmt.Sprintf("stream-%d", time.Now().UnixNano())
+	if _, err := db.db.ExecContext(ctx,
+		`INSERT INTO orders (number, user_id) VALUES ($1, $2)`, number, user.ID,
+	); err != nil {
+		t.Fatalf("insert order: %v", err)
+	}
+
+	insert := func(status string) (int64, func() error) {
+		t.Helper()
+		tx, err := db.db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("begin: %v", err)
+		}
+		var id int64
+		if err := tx.QueryRowContext(ctx,
+			`INSERT INTO order_status_history (order_number, status) VALUES ($1, $2) RETURNING id`,
+			number, status,
+		).Scan(&id); err != nil {
+			tx.Rollback()
+			t.Fatalf("insert history: %v", err)
+		}
+		return id, tx.Commit
+	}
+
+	slowID, commitSlow := insert("PROCESSING")
+	fastID, commitFast := insert("INVALID")
+	if err := commitFast(); err != nil {
+		t.Fatalf("commit fast: %v", err)
+	}
+
+	repo := NewOrderEventRepository(db)
+	seen, err := repo.GetEventsSince(ctx, user.ID, 0, 100)
+	if err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	var lastSeen int64
+	for _, e := range seen {
+		lastSeen = e.ID
+	}
+
+	if err := commitSlow(); err != nil {
+		t.Fatalf("commit slow: %v", err)
+	}
+
+	resumed, err := repo.GetEventsSince(ctx, user.ID, lastSeen, 100)
+	if err != nil {
+		t.Fatalf("events after %d: %v", lastSeen, err)
+	}
+	if slowID > fastID {
+		t.Fatalf("ids out of insert order: %d, %d", slowID, fastID)
+	}
+	if len(resumed) != 1 || resumed[0].Status != "PROCESSING" {
+		t.Fatalf("events after %d = %+v, want the late-committed PROCESSING", lastSeen, resumed)
+	}
+	if resumed[0].ID <= lastSeen {
+		t.Errorf("late commit got event id %d, not after %d", resumed[0].ID, lastSeen)
+	}
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"database/sql"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/lib/pq"
+	"time"
+)
+
+// limitArg запрашивает на одну строку больше страницы, чтобы понять, есть ли продолжение.
+// NULL в LIMIT означает выборку без ограничения.
+func limitArg(limit int) sql.NullInt64 {
+	if limit <= 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(limit) + 1, Valid: true}
+}
+
+func cursorArgs(c *model.Cursor) (sql.NullTime, string) {
+	if c == nil {
+		return sql.NullTime{}, ""
+	}
+	return sql.NullTime{Time: c.Time, Valid: true}, c.Key
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func statusesArg(statuses []string) any {
+	if len(statuses) == 0 {
+		return nil
+	}
+	return pq.Array(statuses)
+}
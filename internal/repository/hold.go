@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/lib/pq"
+)
+
+var ErrHoldOrderExists = errors.New("active hold for this order already exists")
+
+type HoldRepository interface {
+	Create(ctx context.Context, hold *model.Hold) error
+	GetForUpdate(ctx context.Context, userID, id int64) (*model.Hold, error)
+	GetActive(ctx context.Context, userID int64) ([]*model.Hold, error)
+	// HasActiveForOrder сообщает, есть ли у номера заказа активный резерв любого пользователя.
+	HasActiveForOrder(ctx context.Context, orderNumber string) (bool, error)
+	// Resolve сохраняет итоговый статус резерва.
+	Resolve(ctx context.Context, hold *model.Hold) error
+	// ClaimExpired блокирует до limit просроченных активных резервов, пропуская занятые.
+	ClaimExpired(ctx context.Context, limit int) ([]*model.Hold, error)
+}
+
+type holdRepository struct {
+	db *Database
+}
+
+func NewHoldRepository(db *Database) HoldRepository {
+	return &holdRepository{db: db}
+}
+
+const holdColumns = `id, user_id, order_number, amount, status, expires_at, created_at, resolved_at, withdrawal_id`
+
+func (r *holdRepository) Create(ctx context.Context, hold *model.Hold) error {
+	query := `INSERT INTO balance_holds (user_id, order_number, amount, status, expires_at)
+              VALUES ($1, $2, $3::numeric, $4, $5)
+              RETURNING id, created_at`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		hold.UserID, hold.Order, hold.Amount, hold.Status, hold.ExpiresAt,
+	).Scan(&hold.ID, &hold.CreatedAt)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrHoldOrderExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create hold: %w", err)
+	}
+	return nil
+}
+
+func (r *holdRepository) GetForUpdate(ctx context.Context, userID, id int64) (*model.Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM balance_holds WHERE id = $1 AND user_id = $2 FOR UPDATE`
+	hold, err := scanHold(r.db.conn(ctx).QueryRowContext(ctx, query, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hold: %w", err)
+	}
+	return hold, nil
+}
+
+func (r *holdRepository) GetActive(ctx context.Context, userID int64) ([]*model.Hold, error) {
+	query := `SELECT ` + holdColumns + `
+              FROM balance_holds
+              WHERE user_id = $1 AND status = 'ACTIVE'
+              ORDER BY id DESC`
+	return r.query(ctx, query, userID)
+}
+
+func (r *holdRepository) Resolve(ctx context.Context, hold *model.Hold) error {
+	query := `UPDATE balance_holds SET status = $2, resolved_at = $3, withdrawal_id = $4 WHERE id = $1`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, hold.ID, hold.Status, hold.ResolvedAt, hold.WithdrawalID); err != nil {
+		return fmt.Errorf("failed to resolve hold: %w", err)
+	}
+	return nil
+}
+
+func (r *holdRepository) HasActiveForOrder(ctx context.Context, orderNumber string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM balance_holds WHERE order_number = $1 AND status = 'ACTIVE')`
+	if err := r.db.conn(ctx).QueryRowContext(ctx, query, orderNumber).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check active hold: %w", err)
+	}
+	return exists, nil
+}
+
+func (r *holdRepository) ClaimExpired(ctx context.Context, limit int) ([]*model.Hold, error) {
+	query := `SELECT ` + holdColumns + `
+              FROM balance_holds
+              WHERE status = 'ACTIVE' AND expires_at < NOW()
+              ORDER BY expires_at
+              LIMIT $1
+              FOR UPDATE SKIP LOCKED`
+	return r.query(ctx, query, limit)
+}
+
+func (r *holdRepository) query(ctx context.Context, query string, args ...any) ([]*model.Hold, error) {
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var holds []*model.Hold
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		holds = append(holds, hold)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return holds, nil
+}
+
+func scanHold(row interface{ Scan(dest ...any) error }) (*model.Hold, error) {
+	h := &model.Hold{}
+	err := row.Scan(&h.ID, &h.UserID, &h.Order, &h.Amount, &h.Status,
+		&h.ExpiresAt, &h.CreatedAt, &h.ResolvedAt, &h.WithdrawalID)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
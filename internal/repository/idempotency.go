@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"time"
+)
+
+var ErrIdempotencyLeaseLost = errors.New("idempotency key reservation was taken over")
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, userID int64, key, requestHash string, ttl, lease time.Duration) (*model.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, reservation *model.IdempotencyRecord, statusCode int, body []byte) error
+	Delete(ctx context.Context, reservation *model.IdempotencyRecord) error
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *Database
+}
+
+func NewIdempotencyRepository(db *Database) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+// Reserve занимает ключ за запросом. Второй результат true, если ключ занят этим вызовом;
+// иначе возвращается уже существующая запись. Ключи старше ttl считаются свободными,
+// как и незавершённые ключи старше lease: их владелец, скорее всего, упал посреди запроса.
+func (r *idempotencyRepository) Reserve(
+	ctx context.Context,
+	userID int64,
+	key, requestHash string,
+	ttl, lease time.Duration,
+) (*model.IdempotencyRecord, bool, error) {
+	record := &model.IdempotencyRecord{UserID: userID, Key: key, RequestHash: requestHash}
+
+	query := `INSERT INTO idempotency_keys (user_id, key, request_hash)
+              VALUES ($1, $2, $3)
+              ON CONFLICT (user_id, key) DO UPDATE
+                  SET request_hash = EXCLUDED.request_hash,
+                      status_code = NULL,
+                      response_body = NULL,
+                      created_at = NOW(),
+                      completed_at = NULL
+                  WHERE idempotency_keys.created_at < NOW() - make_interval(secs => $4)
+                     OR (idempotency_keys.completed_at IS NULL
+                         AND idempotency_keys.created_at < NOW() - make_interval(secs => $5))
+              RETURNING created_at`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, userID, key, requestHash, ttl.Seconds(), lease.Seconds()).Scan(&record.CreatedAt)
+	if err == nil {
+		return record, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	var statusCode sql.NullInt64
+	err = r.db.conn(ctx).QueryRowContext(ctx,
+		`SELECT request_hash, status_code, response_body, created_at
+         FROM idempotency_keys WHERE user_id = $1 AND key = $2`,
+		userID, key,
+	).Scan(&record.RequestHash, &statusCode, &record.ResponseBody, &record.CreatedAt)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	record.StatusCode = int(statusCode.Int64)
+
+	return record, false, nil
+}
+
+// Complete сохраняет ответ, только если ключ всё ещё держит эта резервация: created_at
+// меняется при каждом перехвате, так что запрос, переживший свою аренду, не затрёт
+// чужой результат и вернёт ErrIdempotencyLeaseLost.
+func (r *idempotencyRepository) Complete(ctx context.Context, reservation *model.IdempotencyRecord, statusCode int, body []byte) error {
+	query := `UPDATE idempotency_keys
+              SET status_code = $4, response_body = $5, completed_at = NOW()
+              WHERE user_id = $1 AND key = $2 AND created_at = $3 AND completed_at IS NULL`
+	res, err := r.db.conn(ctx).ExecContext(ctx, query,
+		reservation.UserID, reservation.Key, reservation.CreatedAt, statusCode, body)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	if n == 0 {
+		return ErrIdempotencyLeaseLost
+	}
+	return nil
+}
+
+// Delete освобождает ключ той же резервации; перехваченный ключ не трогает.
+func (r *idempotencyRepository) Delete(ctx context.Context, reservation *model.IdempotencyRecord) error {
+	query := `DELETE FROM idempotency_keys
+              WHERE user_id = $1 AND key = $2 AND created_at = $3 AND completed_at IS NULL`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, reservation.UserID, reservation.Key, reservation.CreatedAt); err != nil {
+		return fmt.Errorf("failed to delete idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM idempotency_keys WHERE created_at < $1`
+	res, err := r.db.conn(ctx).ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyLeaseTakeover(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, db)
+	repo := NewIdempotencyRepository(db)
+
+	first, reserved, err := repo.Reserve(ctx, user.ID, "key", "hash", time.Hour, time.Hour)
+	if err != nil || !reserved {
+		t.Fatalf("first reserve: reserved = %v, err = %v", reserved, err)
+	}
+
+	// Нулевая аренда: первый владелец считается упавшим, и ключ перехватывается.
+	second, reserved, err := repo.Reserve(ctx, user.ID, "key", "hash", time.Hour, 0)
+	if err != nil || !reserved {
+		t.Fatalf("takeover: reserved = %v, err = %v", reserved, err)
+	}
+
+	if err := repo.Complete(ctx, first, 200, []byte("stale")); !errors.Is(err, ErrIdempotencyLeaseLost) {
+		t.Errorf("complete by previous owner: err = %v, want ErrIdempotencyLeaseLost", err)
+	}
+	if err := repo.Delete(ctx, first); err != nil {
+		t.Fatalf("delete by previous owner: %v", err)
+	}
+	if err := repo.Complete(ctx, second, 200, []byte("fresh")); err != nil {
+		t.Fatalf("complete by current owner: %v", err)
+	}
+
+	record, reserved, err := repo.Reserve(ctx, user.ID, "key", "hash", time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("reserve after completion: %v", err)
+	}
+	if reserved || !record.Completed() || string(record.ResponseBody) != "fresh" {
+		t.Errorf("reserve after completion: reserved = %v, body = %q; want stored response of the current owner",
+			reserved, record.ResponseBody)
+	}
+}
+
+func TestIdempotencyDeleteExpired(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, db)
+	repo := NewIdempotencyRepository(db)
+
+	if _, _, err := repo.Reserve(ctx, user.ID, "old", "hash", time.Hour, time.Hour); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if _, err := db.db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET created_at = NOW() - INTERVAL '2 days' WHERE user_id = $1`, user.ID,
+	); err != nil {
+		t.Fatalf("age key: %v", err)
+	}
+	if _, _, err := repo.Reserve(ctx, user.ID, "new", "hash", time.Hour, time.Hour); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	if _, err := repo.DeleteExpired(ctx, time.Now().Add(-24*time.Hour)); err != nil {
+		t.Fatalf("delete expired: %v", err)
+	}
+
+	var keys []string
+	rows, err := db.db.QueryContext(ctx, `SELECT key FROM idempotency_keys WHERE user_id = $1`, user.ID)
+	if err != nil {
+		t.Fatalf("query keys: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) != 1 || keys[0] != "new" {
+		t.Errorf("keys left = %v, want only the fresh one", keys)
+	}
+}
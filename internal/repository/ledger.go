@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"strconv"
+)
+
+type LedgerRepository interface {
+	Post(ctx context.Context, posting *model.LedgerPosting) error
+	GetUserEntries(ctx context.Context, userID int64, filter model.ListFilter) (*model.Page[*model.LedgerEntry], error)
+	Reconcile(ctx context.Context) ([]*model.BalanceMismatch, error)
+}
+
+type ledgerRepository struct {
+	db *Database
+}
+
+func NewLedgerRepository(db *Database) LedgerRepository {
+	return &ledgerRepository{db: db}
+}
+
+// Post записывает операцию двумя проводками с общим transaction_id: на счёт пользователя
+// и с обратным знаком на системный счёт. Вызывается в той же транзакции, что и изменение баланса.
+func (r *ledgerRepository) Post(ctx context.Context, posting *model.LedgerPosting) error {
+	var transactionID int64
+	if err := r.db.conn(ctx).QueryRowContext(ctx,
+		`SELECT nextval('ledger_transaction_id_seq')`,
+	).Scan(&transactionID); err != nil {
+		return fmt.Errorf("failed to allocate ledger transaction: %w", err)
+	}
+
+	query := `INSERT INTO ledger_entries
+                  (transaction_id, account, user_id, amount, kind, order_number, withdrawal_id, description)
+              VALUES ($1, $2, $3, $4::numeric, $5, $6, $7, $8),
+                     ($1, $9, $3, -$4::numeric, $5, $6, $7, $8)`
+
+	_, err := r.db.conn(ctx).ExecContext(ctx, query,
+		transactionID,
+		model.LedgerAccountUser,
+		posting.UserID,
+		posting.Amount,
+		posting.Kind,
+		sql.NullString{String: posting.OrderNumber, Valid: posting.OrderNumber != ""},
+		sql.NullInt64{Int64: posting.WithdrawalID, Valid: posting.WithdrawalID != 0},
+		posting.Description,
+		posting.CounterAccount,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to post ledger entries: %w", err)
+	}
+	return nil
+}
+
+// GetUserEntries отдаёт проводки по счёту пользователя страницами с курсором по (created_at, id).
+func (r *ledgerRepository) GetUserEntries(ctx context.Context, userID int64, filter model.ListFilter) (*model.Page[*model.LedgerEntry], error) {
+	direction, cmp := "DESC", "<"
+	if filter.Ascending {
+		direction, cmp = "ASC", ">"
+	}
+
+	query := fmt.Sprintf(`SELECT id, transaction_id, account, user_id, amount, kind,
+                     COALESCE(order_number, ''), COALESCE(withdrawal_id, 0), description, created_at
+              FROM ledger_entries
+              WHERE user_id = $1 AND account = $2
+                AND ($3::timestamptz IS NULL OR created_at >= $3)
+                AND ($4::timestamptz IS NULL OR created_at < $4)
+                AND ($5::timestamptz IS NULL OR (created_at, id) %s ($5, $6::bigint))
+              ORDER BY created_at %s, id %s
+              LIMIT $7`, cmp, direction, direction)
+
+	after, afterKey := cursorArgs(filter.After)
+	var afterID int64
+	if afterKey != "" {
+		id, err := strconv.ParseInt(afterKey, 10, 64)
+		if err != nil {
+			return nil, model.ErrInvalidCursor
+		}
+		afterID = id
+	}
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query,
+		userID,
+		model.LedgerAccountUser,
+		nullTime(filter.From),
+		nullTime(filter.To),
+		after,
+		afterID,
+		limitArg(filter.Limit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	page := &model.Page[*model.LedgerEntry]{}
+	for rows.Next() {
+		var e model.LedgerEntry
+		if err := rows.Scan(
+			&e.ID,
+			&e.TransactionID,
+			&e.Account,
+			&e.UserID,
+			&e.Amount,
+			&e.Kind,
+			&e.OrderNumber,
+			&e.WithdrawalID,
+			&e.Description,
+			&e.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		page.Items = append(page.Items, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	if filter.Limit > 0 && len(page.Items) > filter.Limit {
+		page.Items = page.Items[:filter.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.Next = &model.Cursor{Time: last.CreatedAt, Key: strconv.FormatInt(last.ID, 10)}
+	}
+
+	return page, nil
+}
+
+// Reconcile сверяет users.balance с суммой проводок по счёту пользователя
+// и возвращает пользователей, у которых они расходятся.
+func (r *ledgerRepository) Reconcile(ctx context.Context) ([]*model.BalanceMismatch, error) {
+	query := `SELECT u.id, u.balance, COALESCE(l.total, 0)
+              FROM users u
+              LEFT JOIN (
+                  SELECT user_id, SUM(amount) AS total
+                  FROM ledger_entries
+                  WHERE account = $1
+                  GROUP BY user_id
+              ) l ON l.user_id = u.id
+              WHERE u.balance <> COALESCE(l.total, 0)
+              ORDER BY u.id`
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, model.LedgerAccountUser)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var mismatches []*model.BalanceMismatch
+	for rows.Next() {
+		var m model.BalanceMismatch
+		if err := rows.Scan(&m.UserID, &m.Balance, &m.LedgerBalance); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		mismatches = append(mismatches, &m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return mismatches, nil
+}
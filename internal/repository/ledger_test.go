@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLedgerPostWritesBalancedPair(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, db)
+
+	err := NewLedgerRepository(db).Post(ctx, &model.LedgerPosting{
+		UserID:         user.ID,
+		Amount:         12345,
+		Kind:           model.LedgerKindAccrual,
+		CounterAccount: model.LedgerAccountAccrual,
+		OrderNumber:    "12345678903",
+	})
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+
+	var legs int
+	var total model.Money
+	if err := db.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), SUM(amount) FROM ledger_entries WHERE user_id = $1`, user.ID,
+	).Scan(&legs, &total); err != nil {
+		t.Fatalf("query legs: %v", err)
+	}
+	if legs != 2 || total != 0 {
+		t.Errorf("legs = %d, total = %v; want 2 legs summing to 0", legs, total)
+	}
+}
+
+func TestLedgerEntriesAreImmutable(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, db)
+
+	if err := NewLedgerRepository(db).Post(ctx, &model.LedgerPosting{
+		UserID:         user.ID,
+		Amount:         100,
+		Kind:           model.LedgerKindAdjustment,
+		CounterAccount: model.LedgerAccountAdjustment,
+	}); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+
+	for _, stmt := range []string{
+		`UPDATE ledger_entries SET amount = amount * 2 WHERE user_id = $1`,
+		`DELETE FROM ledger_entries WHERE user_id = $1`,
+	} {
+		_, err := db.db.ExecContext(ctx, stmt, user.ID)
+		if err == nil || !strings.Contains(err.Error(), "immutable") {
+			t.Errorf("%s: err = %v, want immutability error", stmt, err)
+		}
+	}
+}
+
+func TestGetUserEntriesPaginates(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, db)
+	repo := NewLedgerRepository(db)
+
+	for i := 1; i <= 3; i++ {
+		if err := repo.Post(ctx, &model.LedgerPosting{
+			UserID:         user.ID,
+			Amount:         model.Money(i * 100),
+			Kind:           model.LedgerKindAccrual,
+			CounterAccount: model.LedgerAccountAccrual,
+		}); err != nil {
+			t.Fatalf("post %d: %v", i, err)
+		}
+	}
+
+	first, err := repo.GetUserEntries(ctx, user.ID, model.ListFilter{Limit: 2})
+	if err != nil {
+		t.Fatalf("first page: %v", err)
+	}
+	if len(first.Items) != 2 || first.Next == nil {
+		t.Fatalf("first page: %d items, next = %v; want 2 items and a cursor", len(first.Items), first.Next)
+	}
+	if first.Items[0].Amount != 300 || first.Items[1].Amount != 200 {
+		t.Errorf("first page amounts = %v, %v; want newest first", first.Items[0].Amount, first.Items[1].Amount)
+	}
+
+	second, err := repo.GetUserEntries(ctx, user.ID, model.ListFilter{Limit: 2, After: first.Next})
+	if err != nil {
+		t.Fatalf("second page: %v", err)
+	}
+	if len(second.Items) != 1 || second.Next != nil {
+		t.Fatalf("second page: %d items, next = %v; want the last item only", len(second.Items), second.Next)
+	}
+	if second.Items[0].Amount != 100 {
+		t.Errorf("second page amount = %v, want 1.00", second.Items[0].Amount)
+	}
+	for _, e := range append(first.Items, second.Items...) {
+		if e.Account != model.LedgerAccountUser {
+			t.Errorf("entry %d on account %q, want only user-side entries", e.ID, e.Account)
+		}
+	}
+}
+
+// TestLedgerBackfillAdjustsDrift прогоняет перенос истории из миграции 004 для одного
+// пользователя: временные таблицы orders, withdrawals и users закрывают собой настоящие
+// в пределах транзакции, которая в конце откатывается.
+func TestLedgerBackfillAdjustsDrift(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	migration, err := os.ReadFile("../../migrations/004_ledger.up.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	_, backfill, ok := strings.Cut(string(migration), "-- Перенос истории")
+	if !ok {
+		t.Fatal("backfill section not found in migration 004")
+	}
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+
+	suffix := time.Now().UnixNano()
+	var userID int64
+	// Баланс 150.00: 120.00 начислено, 20.00 списано, 50.00 взялись неизвестно откуда.
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO users (login, password_hash, balance) VALUES ($1, 'x', 150) RETURNING id`,
+		fmt.Sprintf("backfill-%d", suffix),
+	).Scan(&userID); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO orders (number, user_id, status, accrual) VALUES ($1, $2, 'PROCESSED', 120)`,
+		fmt.Sprintf("bf-order-%d", suffix), userID,
+	); err != nil {
+		t.Fatalf("insert order: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO withdrawals (order_number, user_id, sum) VALUES ($1, $2, 20)`,
+		fmt.Sprintf("bf-withdrawal-%d", suffix), userID,
+	); err != nil {
+		t.Fatalf("insert withdrawal: %v", err)
+	}
+
+	for _, table := range []string{"orders", "withdrawals"} {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+			`CREATE TEMP TABLE %[1]s ON COMMIT DROP AS SELECT * FROM %[1]s WHERE user_id = $1`, table,
+		), userID); err != nil {
+			t.Fatalf("shadow %s: %v", table, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`CREATE TEMP TABLE users ON COMMIT DROP AS SELECT * FROM users WHERE id = $1`, userID,
+	); err != nil {
+		t.Fatalf("shadow users: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, backfill); err != nil {
+		t.Fatalf("run backfill: %v", err)
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT kind, account, amount FROM ledger_entries WHERE user_id = $1`, userID)
+	if err != nil {
+		t.Fatalf("query entries: %v", err)
+	}
+	defer rows.Close()
+
+	got := map[string]model.Money{}
+	var transactionTotal model.Money
+	for rows.Next() {
+		var kind, account string
+		var amount model.Money
+		if err := rows.Scan(&kind, &account, &amount); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		transactionTotal += amount
+		if account == model.LedgerAccountUser {
+			got[kind] += amount
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("rows: %v", err)
+	}
+
+	want := map[string]model.Money{
+		model.LedgerKindAccrual:    12000,
+		model.LedgerKindWithdrawal: -2000,
+		model.LedgerKindAdjustment: 5000,
+	}
+	for kind, amount := range want {
+		if got[kind] != amount {
+			t.Errorf("%s on user account = %v, want %v", kind, got[kind], amount)
+		}
+	}
+	if transactionTotal != 0 {
+		t.Errorf("entries sum to %v, want balanced postings", transactionTotal)
+	}
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"time"
+)
+
+type LoginAttemptRepository interface {
+	Get(ctx context.Context, scope, key string) (*model.LoginAttempt, error)
+	GetForUpdate(ctx context.Context, scope, key string) (*model.LoginAttempt, error)
+	Save(ctx context.Context, attempt *model.LoginAttempt) error
+	Reset(ctx context.Context, scope, key string) error
+	DeleteStale(ctx context.Context, before time.Time) (int64, error)
+}
+
+type loginAttemptRepository struct {
+	db *Database
+}
+
+func NewLoginAttemptRepository(db *Database) LoginAttemptRepository {
+	return &loginAttemptRepository{db: db}
+}
+
+func (r *loginAttemptRepository) Get(ctx context.Context, scope, key string) (*model.LoginAttempt, error) {
+	attempt := &model.LoginAttempt{Scope: scope, Key: key}
+	query := `SELECT failures, last_failed_at, locked_until
+              FROM login_attempts WHERE scope = $1 AND key = $2`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, scope, key).Scan(
+		&attempt.Failures, &attempt.LastFailedAt, &attempt.LockedUntil,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return attempt, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login attempts: %w", err)
+	}
+	return attempt, nil
+}
+
+// GetForUpdate создаёт счётчик при необходимости и блокирует его до конца транзакции,
+// чтобы параллельные неудачные попытки с разных экземпляров не потеряли друг друга.
+func (r *loginAttemptRepository) GetForUpdate(ctx context.Context, scope, key string) (*model.LoginAttempt, error) {
+	_, err := r.db.conn(ctx).ExecContext(ctx,
+		`INSERT INTO login_attempts (scope, key) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		scope, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create login attempts: %w", err)
+	}
+
+	attempt := &model.LoginAttempt{Scope: scope, Key: key}
+	query := `SELECT failures, last_failed_at, locked_until
+              FROM login_attempts WHERE scope = $1 AND key = $2
+              FOR UPDATE`
+	err = r.db.conn(ctx).QueryRowContext(ctx, query, scope, key).Scan(
+		&attempt.Failures, &attempt.LastFailedAt, &attempt.LockedUntil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock login attempts: %w", err)
+	}
+	return attempt, nil
+}
+
+func (r *loginAttemptRepository) Save(ctx context.Context, attempt *model.LoginAttempt) error {
+	query := `UPDATE login_attempts
+              SET failures = $3, last_failed_at = $4, locked_until = $5
+              WHERE scope = $1 AND key = $2`
+	_, err := r.db.conn(ctx).ExecContext(ctx, query,
+		attempt.Scope, attempt.Key, attempt.Failures, attempt.LastFailedAt, attempt.LockedUntil)
+	if err != nil {
+		return fmt.Errorf("failed to save login attempts: %w", err)
+	}
+	return nil
+}
+
+func (r *loginAttemptRepository) Reset(ctx context.Context, scope, key string) error {
+	query := `DELETE FROM login_attempts WHERE scope = $1 AND key = $2`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, scope, key); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+	return nil
+}
+
+// DeleteStale удаляет счётчики, последняя ошибка в которых была раньше before и
+// блокировка которых уже истекла: такие счётчики всё равно обнулились бы при следующей ошибке.
+func (r *loginAttemptRepository) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM login_attempts
+              WHERE (last_failed_at IS NULL OR last_failed_at < $1)
+                AND (locked_until IS NULL OR locked_until < NOW())`
+	res, err := r.db.conn(ctx).ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stale login attempts: %w", err)
+	}
+	return res.RowsAffected()
+}
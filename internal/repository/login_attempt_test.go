@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"testing"
+	"time"
+)
+
+func TestDeleteStaleLoginAttempts(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewLoginAttemptRepository(db)
+
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	future := now.Add(time.Hour)
+	prefix := fmt.Sprintf("stale-%d-", now.UnixNano())
+	attempts := map[string]*model.LoginAttempt{
+		"old":           {Failures: 2, LastFailedAt: &old},
+		"old-locked":    {Failures: 5, LastFailedAt: &old, LockedUntil: &future},
+		"old-unlocked":  {Failures: 5, LastFailedAt: &old, LockedUntil: &old},
+		"recent":        {Failures: 1, LastFailedAt: &now},
+		"recent-locked": {Failures: 5, LastFailedAt: &now, LockedUntil: &future},
+	}
+	for key, attempt := range attempts {
+		attempt.Scope, attempt.Key = model.LoginScopeLogin, prefix+key
+		if _, err := repo.GetForUpdate(ctx, attempt.Scope, attempt.Key); err != nil {
+			t.Fatalf("create %s: %v", key, err)
+		}
+		if err := repo.Save(ctx, attempt); err != nil {
+			t.Fatalf("save %s: %v", key, err)
+		}
+	}
+
+	if _, err := repo.DeleteStale(ctx, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("delete stale: %v", err)
+	}
+
+	kept := map[string]bool{"old-locked": true, "recent": true, "recent-locked": true}
+	for key := range attempts {
+		attempt, err := repo.Get(ctx, model.LoginScopeLogin, prefix+key)
+		if err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+		if exists := attempt.Failures > 0; exists != kept[key] {
+			t.Errorf("%s kept = %v, want %v", key, exists, kept[key])
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"time"
+)
+
+type AccrualLotRepository interface {
+	Create(ctx context.Context, lot *model.AccrualLot) error
+	// GetOpenForUpdate блокирует непустые лоты пользователя в порядке поступления.
+	GetOpenForUpdate(ctx context.Context, userID int64) ([]*model.AccrualLot, error)
+	// GetDueForUpdate блокирует непустые лоты пользователя, срок которых наступил к now.
+	GetDueForUpdate(ctx context.Context, userID int64, now time.Time) ([]*model.AccrualLot, error)
+	// Update сохраняет remaining и expired лота.
+	Update(ctx context.Context, lot *model.AccrualLot) error
+	// DueUsers возвращает до limit пользователей с id больше after, у которых есть сгоревшие лоты.
+	DueUsers(ctx context.Context, now time.Time, after int64, limit int) ([]int64, error)
+	// Expiring суммирует остатки лотов пользователя, сгорающих до until, по срокам.
+	Expiring(ctx context.Context, userID int64, until time.Time) ([]*model.ExpiringPoints, error)
+	// SetOpeningExpiry назначает лотам OPENING без срока срок created_at + months.
+	SetOpeningExpiry(ctx context.Context, months int) (int64, error)
+	AddConsumption(ctx context.Context, consumption *model.LotConsumption) error
+	// GetConsumptionsForUpdate блокирует невозвращённые расходы лотов списанием, последние первыми.
+	GetConsumptionsForUpdate(ctx context.Context, withdrawalID int64) ([]*model.LotConsumption, error)
+	// Restore возвращает amount в лот расхода и отмечает его возвращённым.
+	Restore(ctx context.Context, consumption *model.LotConsumption, amount model.Money) error
+}
+
+type accrualLotRepository struct {
+	db *Database
+}
+
+func NewAccrualLotRepository(db *Database) AccrualLotRepository {
+	return &accrualLotRepository{db: db}
+}
+
+const lotColumns = `id, user_id, kind, COALESCE(order_number, ''), amount, remaining, expired, created_at, expires_at`
+
+func (r *accrualLotRepository) Create(ctx context.Context, lot *model.AccrualLot) error {
+	query := `INSERT INTO accrual_lots (user_id, kind, order_number, amount, remaining, expires_at)
+              VALUES ($1, $2, NULLIF($3, ''), $4::numeric, $4::numeric, $5)
+              RETURNING id, created_at`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		lot.UserID, lot.Kind, lot.OrderNumber, lot.Amount, lot.ExpiresAt,
+	).Scan(&lot.ID, &lot.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create accrual lot: %w", err)
+	}
+	lot.Remaining = lot.Amount
+	return nil
+}
+
+func (r *accrualLotRepository) GetOpenForUpdate(ctx context.Context, userID int64) ([]*model.AccrualLot, error) {
+	query := `SELECT ` + lotColumns + `
+              FROM accrual_lots
+              WHERE user_id = $1 AND remaining > 0
+              ORDER BY created_at, id
+              FOR UPDATE`
+	return r.query(ctx, query, userID)
+}
+
+func (r *accrualLotRepository) GetDueForUpdate(ctx context.Context, userID int64, now time.Time) ([]*model.AccrualLot, error) {
+	query := `SELECT ` + lotColumns + `
+              FROM accrual_lots
+              WHERE user_id = $1 AND remaining > 0 AND expires_at <= $2
+              ORDER BY expires_at, id
+              FOR UPDATE`
+	return r.query(ctx, query, userID, now)
+}
+
+func (r *accrualLotRepository) Update(ctx context.Context, lot *model.AccrualLot) error {
+	query := `UPDATE accrual_lots SET remaining = $2::numeric, expired = $3::numeric WHERE id = $1`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, lot.ID, lot.Remaining, lot.Expired); err != nil {
+		return fmt.Errorf("failed to update accrual lot: %w", err)
+	}
+	return nil
+}
+
+func (r *accrualLotRepository) DueUsers(ctx context.Context, now time.Time, after int64, limit int) ([]int64, error) {
+	query := `SELECT DISTINCT user_id
+              FROM accrual_lots
+              WHERE remaining > 0 AND expires_at <= $1 AND user_id > $2
+              ORDER BY user_id
+              LIMIT $3`
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, now, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return userIDs, nil
+}
+
+func (r *accrualLotRepository) Expiring(ctx context.Context, userID int64, until time.Time) ([]*model.ExpiringPoints, error) {
+	query := `SELECT SUM(remaining), expires_at
+              FROM accrual_lots
+              WHERE user_id = $1 AND remaining > 0 AND expires_at <= $2
+              GROUP BY expires_at
+              ORDER BY expires_at`
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, userID, until)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var expiring []*model.ExpiringPoints
+	for rows.Next() {
+		points := &model.ExpiringPoints{}
+		if err := rows.Scan(&points.Sum, &points.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		expiring = append(expiring, points)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return expiring, nil
+}
+
+func (r *accrualLotRepository) SetOpeningExpiry(ctx context.Context, months int) (int64, error) {
+	query := `UPDATE accrual_lots SET expires_at = created_at + make_interval(months => $2)
+              WHERE kind = $1 AND expires_at IS NULL`
+	result, err := r.db.conn(ctx).ExecContext(ctx, query, model.LotKindOpening, months)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set opening lots expiry: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *accrualLotRepository) AddConsumption(ctx context.Context, consumption *model.LotConsumption) error {
+	query := `INSERT INTO lot_consumptions (lot_id, withdrawal_id, amount) VALUES ($1, $2, $3::numeric) RETURNING id`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		consumption.LotID, consumption.WithdrawalID, consumption.Amount,
+	).Scan(&consumption.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record lot consumption: %w", err)
+	}
+	return nil
+}
+
+func (r *accrualLotRepository) GetConsumptionsForUpdate(ctx context.Context, withdrawalID int64) ([]*model.LotConsumption, error) {
+	query := `SELECT id, lot_id, withdrawal_id, amount, restored
+              FROM lot_consumptions
+              WHERE withdrawal_id = $1 AND restored < amount
+              ORDER BY id DESC
+              FOR UPDATE`
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, withdrawalID)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var consumptions []*model.LotConsumption
+	for rows.Next() {
+		c := &model.LotConsumption{}
+		if err := rows.Scan(&c.ID, &c.LotID, &c.WithdrawalID, &c.Amount, &c.Restored); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		consumptions = append(consumptions, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return consumptions, nil
+}
+
+func (r *accrualLotRepository) Restore(ctx context.Context, consumption *model.LotConsumption, amount model.Money) error {
+	if _, err := r.db.conn(ctx).ExecContext(ctx,
+		`UPDATE lot_consumptions SET restored = restored + $2::numeric WHERE id = $1`, consumption.ID, amount); err != nil {
+		return fmt.Errorf("failed to restore lot consumption: %w", err)
+	}
+	if _, err := r.db.conn(ctx).ExecContext(ctx,
+		`UPDATE accrual_lots SET remaining = remaining + $2::numeric WHERE id = $1`, consumption.LotID, amount); err != nil {
+		return fmt.Errorf("failed to restore accrual lot: %w", err)
+	}
+	consumption.Restored += amount
+	return nil
+}
+
+func (r *accrualLotRepository) query(ctx context.Context, query string, args ...any) ([]*model.AccrualLot, error) {
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var lots []*model.AccrualLot
+	for rows.Next() {
+		lot := &model.AccrualLot{}
+		if err := rows.Scan(&lot.ID, &lot.UserID, &lot.Kind, &lot.OrderNumber, &lot.Amount,
+			&lot.Remaining, &lot.Expired, &lot.CreatedAt, &lot.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		lots = append(lots, lot)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return lots, nil
+}
@@ -6,15 +6,25 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
-	"go.uber.org/zap"
+	"github.com/lib/pq"
+	"time"
 )
 
 type OrderRepository interface {
 	Create(ctx context.Context, order *model.Order) error
 	GetByNumber(ctx context.Context, number string) (*model.Order, error)
-	GetByUserID(ctx context.Context, userID int64) ([]*model.Order, error)
+	GetByUserID(ctx context.Context, userID int64, filter model.ListFilter) (*model.Page[*model.Order], error)
+	Search(ctx context.Context, search model.OrderSearch, filter model.ListFilter) (*model.Page[*model.Order], error)
+	Requeue(ctx context.Context, number string) (*model.Order, error)
 	Update(ctx context.Context, order *model.Order) error
-	GetUnprocessedOrders(ctx context.Context) ([]*model.Order, error)
+	GetDetails(ctx context.Context, number string) (*model.OrderDetails, error)
+	AddStatusHistory(ctx context.Context, number, status string, accrual model.Money) error
+	MarkPolled(ctx context.Context, number string) error
+	UpdateStatus(ctx context.Context, number, status string) (bool, error)
+	CompleteOrder(ctx context.Context, number string, accrual model.Money) (*model.Order, error)
+	ClaimOrders(ctx context.Context, owner string, limit int, ttl time.Duration) ([]*model.Order, error)
+	RenewLeases(ctx context.Context, owner string, numbers []string, ttl time.Duration) error
+	ReleaseLeases(ctx context.Context, owner string, numbers []string) error
 }
 
 type orderRepository struct {
@@ -29,7 +39,7 @@ func (r *orderRepository) Create(ctx context.Context, order *model.Order) error
 	query := `INSERT INTO orders (number, user_id, status, uploaded_at)
               VALUES ($1, $2, $3, $4)`
 
-	_, err := r.db.db.ExecContext(ctx, query,
+	_, err := r.db.conn(ctx).ExecContext(ctx, query,
 		order.Number,
 		order.UserID,
 		order.Status,
@@ -43,7 +53,7 @@ func (r *orderRepository) GetByNumber(ctx context.Context, number string) (*mode
 	query := `SELECT number, user_id, status, accrual, uploaded_at 
               FROM orders WHERE number = $1`
 
-	err := r.db.db.QueryRowContext(ctx, query, number).Scan(
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, number).Scan(
 		&order.Number,
 		&order.UserID,
 		&order.Status,
@@ -61,70 +71,254 @@ func (r *orderRepository) GetByNumber(ctx context.Context, number string) (*mode
 	return order, nil
 }
 
-func (r *orderRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Order, error) {
+// GetByUserID возвращает заказы пользователя по фильтру. При filter.Limit > 0 выборка
+// постраничная по ключу (uploaded_at, number), и Next указывает на продолжение.
+func (r *orderRepository) GetByUserID(ctx context.Context, userID int64, filter model.ListFilter) (*model.Page[*model.Order], error) {
+	return r.Search(ctx, model.OrderSearch{UserID: &userID}, filter)
+}
+
+// Search — то же, что GetByUserID, но без привязки к пользователю: для /api/admin.
+func (r *orderRepository) Search(ctx context.Context, search model.OrderSearch, filter model.ListFilter) (*model.Page[*model.Order], error) {
 	if r.db == nil || r.db.db == nil {
 		return nil, fmt.Errorf("database connection is not initialized")
 	}
 
-	query := `SELECT number, status, accrual, uploaded_at 
+	direction, cmp := "DESC", "<"
+	if filter.Ascending {
+		direction, cmp = "ASC", ">"
+	}
+
+	query := fmt.Sprintf(`SELECT number, user_id, status, accrual, uploaded_at 
               FROM orders 
-              WHERE user_id = $1
-              ORDER BY uploaded_at DESC`
+              WHERE ($1::bigint IS NULL OR user_id = $1)
+                AND ($2::text[] IS NULL OR status::text = ANY($2))
+                AND ($3::timestamptz IS NULL OR uploaded_at >= $3)
+                AND ($4::timestamptz IS NULL OR uploaded_at < $4)
+                AND ($5::timestamptz IS NULL OR (uploaded_at, number) %s ($5, $6))
+                AND ($8::text = '' OR number LIKE $8::text || '%%')
+              ORDER BY uploaded_at %s, number %s
+              LIMIT $7`, cmp, direction, direction)
 
-	rows, err := r.db.db.QueryContext(ctx, query, userID)
+	after, afterKey := cursorArgs(filter.After)
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query,
+		search.UserID,
+		statusesArg(filter.Statuses),
+		nullTime(filter.From),
+		nullTime(filter.To),
+		after,
+		afterKey,
+		limitArg(filter.Limit),
+		search.Number,
+	)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
 	defer rows.Close()
 
-	var orders []*model.Order
+	page := &model.Page[*model.Order]{}
 	for rows.Next() {
 		var order model.Order
-		var accrual sql.NullFloat64
 
 		if err := rows.Scan(
 			&order.Number,
+			&order.UserID,
 			&order.Status,
-			&accrual,
+			&order.Accrual,
 			&order.UploadedAt,
 		); err != nil {
 			return nil, fmt.Errorf("scan failed: %w", err)
 		}
 
-		if accrual.Valid {
-			order.Accrual = accrual.Float64
-		}
-
-		orders = append(orders, &order)
+		page.Items = append(page.Items, &order)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("rows error: %w", err)
 	}
 
-	return orders, nil
+	if filter.Limit > 0 && len(page.Items) > filter.Limit {
+		page.Items = page.Items[:filter.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.Next = &model.Cursor{Time: last.UploadedAt, Key: last.Number}
+	}
+
+	return page, nil
 }
 
 func (r *orderRepository) Update(ctx context.Context, order *model.Order) error {
 	query := `UPDATE orders SET status = $1, accrual = $2 WHERE number = $3`
-	_, err := r.db.db.ExecContext(ctx, query, order.Status, order.Accrual, order.Number)
+	_, err := r.db.conn(ctx).ExecContext(ctx, query, order.Status, order.Accrual, order.Number)
 	return err
 }
 
-func (r *orderRepository) GetUnprocessedOrders(ctx context.Context) ([]*model.Order, error) {
-	query := `SELECT number, user_id, status, accrual, uploaded_at 
-              FROM orders 
-              WHERE status IN ('NEW', 'PROCESSING')
-              ORDER BY uploaded_at ASC`
-	rows, err := r.db.db.QueryContext(ctx, query)
+// GetDetails возвращает заказ вместе с историей смены статусов или nil, если заказа нет.
+func (r *orderRepository) GetDetails(ctx context.Context, number string) (*model.OrderDetails, error) {
+	order := &model.Order{}
+	var lastPolledAt sql.NullTime
+	query := `SELECT number, user_id, status, accrual, uploaded_at, last_polled_at
+              FROM orders WHERE number = $1`
+
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, number).Scan(
+		&order.Number,
+		&order.UserID,
+		&order.Status,
+		&order.Accrual,
+		&order.UploadedAt,
+		&lastPolledAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to query orders: %w", err)
+		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
-	defer func() {
-		if closeErr := rows.Close(); closeErr != nil {
-			zap.L().Error("failed to close rows", zap.Error(closeErr))
+
+	details := &model.OrderDetails{Order: order, History: []model.OrderStatusChange{}}
+	if lastPolledAt.Valid {
+		details.LastPolledAt = &lastPolledAt.Time
+	}
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx,
+		`SELECT status, accrual, changed_at
+         FROM order_status_history
+         WHERE order_number = $1
+         ORDER BY id ASC`,
+		number,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var change model.OrderStatusChange
+		if err := rows.Scan(&change.Status, &change.Accrual, &change.ChangedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
 		}
-	}()
+		details.History = append(details.History, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return details, nil
+}
+
+func (r *orderRepository) AddStatusHistory(ctx context.Context, number, status string, accrual model.Money) error {
+	query := `INSERT INTO order_status_history (order_number, status, accrual) VALUES ($1, $2, $3)`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, number, status, accrual); err != nil {
+		return fmt.Errorf("failed to add order status history: %w", err)
+	}
+	return nil
+}
+
+func (r *orderRepository) MarkPolled(ctx context.Context, number string) error {
+	query := `UPDATE orders SET last_polled_at = NOW() WHERE number = $1`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, number); err != nil {
+		return fmt.Errorf("failed to mark order polled: %w", err)
+	}
+	return nil
+}
+
+// UpdateStatus переводит ещё не обработанный заказ в промежуточный статус или INVALID.
+// Возвращает false, если заказ уже в итоговом статусе или статус не изменился.
+func (r *orderRepository) UpdateStatus(ctx context.Context, number, status string) (bool, error) {
+	query := `UPDATE orders SET status = $2
+              WHERE number = $1
+                AND status IN ('NEW', 'PROCESSING')
+                AND status <> $2::order_status`
+	res, err := r.db.conn(ctx).ExecContext(ctx, query, number, status)
+	if err != nil {
+		return false, fmt.Errorf("failed to update order status: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// CompleteOrder условно переводит ещё не обработанный заказ в PROCESSED и возвращает его.
+// Если заказ уже получил итоговый статус, возвращает nil — так начисление по заказу
+// происходит не более одного раза. Вызывается в транзакции вместе с начислением на баланс.
+func (r *orderRepository) CompleteOrder(ctx context.Context, number string, accrual model.Money) (*model.Order, error) {
+	order := &model.Order{}
+	query := `UPDATE orders SET status = 'PROCESSED', accrual = $2
+              WHERE number = $1 AND status IN ('NEW', 'PROCESSING')
+              RETURNING number, user_id, status, accrual, uploaded_at`
+
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, number, accrual).Scan(
+		&order.Number,
+		&order.UserID,
+		&order.Status,
+		&order.Accrual,
+		&order.UploadedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete order: %w", err)
+	}
+
+	return order, nil
+}
+
+// Requeue ставит заказ на внеочередной опрос системы расчёта: снимает аренду, а INVALID
+// возвращает в PROCESSING. PROCESSED не трогает, иначе начисление прошло бы дважды.
+// Возвращает заказ со статусом до изменения или nil, если такого необработанного заказа нет.
+func (r *orderRepository) Requeue(ctx context.Context, number string) (*model.Order, error) {
+	order := &model.Order{}
+	query := `UPDATE orders o
+              SET status = CASE WHEN o.status = 'INVALID' THEN 'PROCESSING'::order_status ELSE o.status END,
+                  lease_owner = NULL,
+                  lease_expires_at = NULL
+              FROM (SELECT number, status FROM orders WHERE number = $1 FOR UPDATE) prev
+              WHERE o.number = prev.number AND prev.status <> 'PROCESSED'
+              RETURNING o.number, o.user_id, prev.status, o.accrual, o.uploaded_at`
+
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, number).Scan(
+		&order.Number,
+		&order.UserID,
+		&order.Status,
+		&order.Accrual,
+		&order.UploadedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to requeue order: %w", err)
+	}
+
+	return order, nil
+}
+
+// ClaimOrders захватывает до limit необработанных заказов, на которые нет действующей аренды,
+// и закрепляет их за owner на ttl. Строки, заблокированные другим экземпляром, пропускаются,
+// поэтому один заказ одновременно опрашивает только один экземпляр; аренда упавшего
+// экземпляра освобождается сама по истечении ttl.
+func (r *orderRepository) ClaimOrders(ctx context.Context, owner string, limit int, ttl time.Duration) ([]*model.Order, error) {
+	query := `UPDATE orders
+              SET lease_owner = $1,
+                  lease_expires_at = NOW() + make_interval(secs => $2)
+              WHERE number IN (
+                  SELECT number
+                  FROM orders
+                  WHERE status IN ('NEW', 'PROCESSING')
+                    AND (lease_expires_at IS NULL OR lease_expires_at < NOW())
+                  ORDER BY uploaded_at ASC
+                  LIMIT $3
+                  FOR UPDATE SKIP LOCKED
+              )
+              RETURNING number, user_id, status, accrual, uploaded_at`
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, owner, ttl.Seconds(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim orders: %w", err)
+	}
+	defer rows.Close()
 
 	var orders []*model.Order
 	for rows.Next() {
@@ -147,3 +341,23 @@ func (r *orderRepository) GetUnprocessedOrders(ctx context.Context) ([]*model.Or
 
 	return orders, nil
 }
+
+func (r *orderRepository) RenewLeases(ctx context.Context, owner string, numbers []string, ttl time.Duration) error {
+	query := `UPDATE orders
+              SET lease_expires_at = NOW() + make_interval(secs => $3)
+              WHERE lease_owner = $1 AND number = ANY($2)`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, owner, pq.Array(numbers), ttl.Seconds()); err != nil {
+		return fmt.Errorf("failed to renew leases: %w", err)
+	}
+	return nil
+}
+
+func (r *orderRepository) ReleaseLeases(ctx context.Context, owner string, numbers []string) error {
+	query := `UPDATE orders
+              SET lease_owner = NULL, lease_expires_at = NULL
+              WHERE lease_owner = $1 AND number = ANY($2)`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, owner, pq.Array(numbers)); err != nil {
+		return fmt.Errorf("failed to release leases: %w", err)
+	}
+	return nil
+}
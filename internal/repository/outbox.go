@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/lib/pq"
+	"time"
+)
+
+type OutboxRepository interface {
+	Add(ctx context.Context, event *model.DomainEvent) error
+	ClaimUnpublished(ctx context.Context, limit int) ([]*model.DomainEvent, error)
+	MarkPublished(ctx context.Context, ids []int64) error
+	PurgePublished(ctx context.Context, before time.Time) (int64, error)
+	PurgeRecorded(ctx context.Context, before time.Time) (int64, error)
+}
+
+type outboxRepository struct {
+	db *Database
+}
+
+func NewOutboxRepository(db *Database) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+// Add записывает событие в outbox. Вызывается в транзакции изменения, которое оно описывает.
+func (r *outboxRepository) Add(ctx context.Context, event *model.DomainEvent) error {
+	query := `INSERT INTO outbox (event_type, aggregate_type, aggregate_id, user_id, payload)
+              VALUES ($1, $2, $3, $4, $5)
+              RETURNING id, occurred_at`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		event.Type,
+		event.AggregateType,
+		event.AggregateID,
+		sql.NullInt64{Int64: event.UserID, Valid: event.UserID != 0},
+		string(event.Payload),
+	).Scan(&event.ID, &event.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("failed to add outbox event: %w", err)
+	}
+	return nil
+}
+
+// ClaimUnpublished блокирует до limit неопубликованных доменных событий в порядке записи;
+// строки вебхуков (webhook_id задан) отправляет WebhookRepository.
+// Вызывается внутри UnitOfWork.WithinTx: блокировка держится до отметки о публикации.
+func (r *outboxRepository) ClaimUnpublished(ctx context.Context, limit int) ([]*model.DomainEvent, error) {
+	query := `SELECT id, event_type, aggregate_type, aggregate_id, COALESCE(user_id, 0), payload, occurred_at
+              FROM outbox
+              WHERE published_at IS NULL AND webhook_id IS NULL
+              ORDER BY id
+              LIMIT $1
+              FOR UPDATE SKIP LOCKED`
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*model.DomainEvent
+	for rows.Next() {
+		var e model.DomainEvent
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.Type, &e.AggregateType, &e.AggregateID, &e.UserID, &payload, &e.OccurredAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		e.Payload = payload
+		events = append(events, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return events, nil
+}
+
+func (r *outboxRepository) MarkPublished(ctx context.Context, ids []int64) error {
+	query := `UPDATE outbox SET published_at = NOW() WHERE id = ANY($1)`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to mark outbox events published: %w", err)
+	}
+	return nil
+}
+
+// PurgePublished удаляет доменные события, опубликованные раньше before. Строки вебхуков
+// остаются: на них ссылается журнал доставок.
+func (r *outboxRepository) PurgePublished(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM outbox WHERE webhook_id IS NULL AND published_at < $1`
+	res, err := r.db.conn(ctx).ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge published outbox events: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// PurgeRecorded удаляет доменные события, записанные раньше before, опубликованы они или нет.
+// Нужен при запуске без публикатора: события копятся неопубликованными.
+func (r *outboxRepository) PurgeRecorded(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM outbox WHERE webhook_id IS NULL AND occurred_at < $1`
+	res, err := r.db.conn(ctx).ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge recorded outbox events: %w", err)
+	}
+	return res.RowsAffected()
+}
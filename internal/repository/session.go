@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"time"
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *model.Session) error
+	GetForUpdate(ctx context.Context, id string) (*model.Session, error)
+	Rotate(ctx context.Context, id, refreshTokenHash string, expiresAt time.Time) error
+	WasRotated(ctx context.Context, id, refreshTokenHash string) (bool, error)
+	IsActive(ctx context.Context, id string) (bool, error)
+	Revoke(ctx context.Context, id string) error
+	RevokeAll(ctx context.Context, userID int64, exceptID string) ([]string, error)
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type sessionRepository struct {
+	db *Database
+}
+
+func NewSessionRepository(db *Database) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session *model.Session) error {
+	query := `INSERT INTO sessions (id, user_id, refresh_token_hash, expires_at)
+              VALUES ($1, $2, $3, $4)
+              RETURNING created_at, last_used_at`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		session.ID, session.UserID, session.RefreshTokenHash, session.ExpiresAt,
+	).Scan(&session.CreatedAt, &session.LastUsedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// GetForUpdate блокирует строку сессии до конца транзакции, чтобы два параллельных
+// обновления одним refresh-токеном не прошли оба.
+func (r *sessionRepository) GetForUpdate(ctx context.Context, id string) (*model.Session, error) {
+	session := &model.Session{}
+	query := `SELECT id, user_id, refresh_token_hash, created_at, last_used_at, expires_at, revoked_at
+              FROM sessions WHERE id = $1
+              FOR UPDATE`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, id).Scan(
+		&session.ID, &session.UserID, &session.RefreshTokenHash,
+		&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return session, nil
+}
+
+// Rotate заменяет refresh-секрет сессии, запоминая хэш прежнего для WasRotated.
+func (r *sessionRepository) Rotate(ctx context.Context, id, refreshTokenHash string, expiresAt time.Time) error {
+	query := `WITH previous AS (
+                  INSERT INTO session_rotated_secrets (refresh_token_hash, session_id)
+                  SELECT refresh_token_hash, id FROM sessions WHERE id = $1
+                  ON CONFLICT (refresh_token_hash) DO NOTHING
+              )
+              UPDATE sessions
+              SET refresh_token_hash = $2, expires_at = $3, last_used_at = NOW()
+              WHERE id = $1`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, id, refreshTokenHash, expiresAt); err != nil {
+		return fmt.Errorf("failed to rotate session: %w", err)
+	}
+	return nil
+}
+
+// WasRotated сообщает, был ли refreshTokenHash когда-то секретом этой сессии.
+func (r *sessionRepository) WasRotated(ctx context.Context, id, refreshTokenHash string) (bool, error) {
+	var rotated bool
+	query := `SELECT EXISTS (
+                  SELECT 1 FROM session_rotated_secrets
+                  WHERE refresh_token_hash = $2 AND session_id = $1
+              )`
+	if err := r.db.conn(ctx).QueryRowContext(ctx, query, id, refreshTokenHash).Scan(&rotated); err != nil {
+		return false, fmt.Errorf("failed to check rotated refresh token: %w", err)
+	}
+	return rotated, nil
+}
+
+func (r *sessionRepository) IsActive(ctx context.Context, id string) (bool, error) {
+	var active bool
+	query := `SELECT EXISTS (
+                  SELECT 1 FROM sessions
+                  WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+              )`
+	if err := r.db.conn(ctx).QueryRowContext(ctx, query, id).Scan(&active); err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+	return active, nil
+}
+
+func (r *sessionRepository) Revoke(ctx context.Context, id string) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeAll отзывает все активные сессии пользователя, кроме exceptID, и возвращает
+// идентификаторы отозванных.
+func (r *sessionRepository) RevokeAll(ctx context.Context, userID int64, exceptID string) ([]string, error) {
+	query := `UPDATE sessions SET revoked_at = NOW()
+              WHERE user_id = $1 AND revoked_at IS NULL AND id <> $2
+              RETURNING id`
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, userID, exceptID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *sessionRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM sessions WHERE expires_at < $1`
+	res, err := r.db.conn(ctx).ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	return res.RowsAffected()
+}
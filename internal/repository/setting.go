@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type SettingRepository interface {
+	// Get возвращает значение и false, если настройка ещё не записана.
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key, value string) error
+}
+
+type settingRepository struct {
+	db *Database
+}
+
+func NewSettingRepository(db *Database) SettingRepository {
+	return &settingRepository{db: db}
+}
+
+func (r *settingRepository) Get(ctx context.Context, key string) (string, bool, error) {
+	var value string
+	err := r.db.conn(ctx).QueryRowContext(ctx, `SELECT value FROM settings WHERE key = $1`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get setting %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+func (r *settingRepository) Set(ctx context.Context, key, value string) error {
+	query := `INSERT INTO settings (key, value) VALUES ($1, $2)
+              ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, key, value); err != nil {
+		return fmt.Errorf("failed to set setting %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"time"
+)
+
+type TierRepository interface {
+	GetTier(ctx context.Context, userID int64) (string, error)
+	// GetStats считает начисления пользователя с момента since.
+	GetStats(ctx context.Context, userID int64, since time.Time) (*model.TierStats, error)
+	// ListStats возвращает до limit пользователей с id больше after и их начисления с since.
+	ListStats(ctx context.Context, since time.Time, after int64, limit int) ([]*model.TierStats, error)
+	// UpdateTier меняет уровень, только если он всё ещё равен from.
+	UpdateTier(ctx context.Context, userID int64, from, to string) (bool, error)
+}
+
+type tierRepository struct {
+	db *Database
+}
+
+func NewTierRepository(db *Database) TierRepository {
+	return &tierRepository{db: db}
+}
+
+// Начисления берутся из журнала: проводки ACCRUAL по счёту пользователя, без бонусов уровня.
+// Заказы — различные заказы пользователя, перешедшие в PROCESSED с момента since.
+const tierStatsQuery = `SELECT u.id, u.tier, COALESCE(SUM(l.amount), 0),
+                     (SELECT COUNT(DISTINCT o.number)
+                      FROM orders o JOIN order_status_history h ON h.order_number = o.number
+                      WHERE o.user_id = u.id AND h.status = 'PROCESSED' AND h.changed_at >= $1)
+              FROM users u
+              LEFT JOIN ledger_entries l ON l.user_id = u.id
+                  AND l.account = 'user' AND l.kind = 'ACCRUAL' AND l.amount > 0 AND l.created_at >= $1`
+
+func (r *tierRepository) GetTier(ctx context.Context, userID int64) (string, error) {
+	var tier string
+	err := r.db.conn(ctx).QueryRowContext(ctx, `SELECT tier FROM users WHERE id = $1`, userID).Scan(&tier)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user tier: %w", err)
+	}
+	return tier, nil
+}
+
+func (r *tierRepository) GetStats(ctx context.Context, userID int64, since time.Time) (*model.TierStats, error) {
+	query := tierStatsQuery + `
+              WHERE u.id = $2
+              GROUP BY u.id, u.tier`
+	stats := &model.TierStats{}
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, since, userID).
+		Scan(&stats.UserID, &stats.Tier, &stats.Accrued, &stats.Orders)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tier stats: %w", err)
+	}
+	return stats, nil
+}
+
+func (r *tierRepository) ListStats(ctx context.Context, since time.Time, after int64, limit int) ([]*model.TierStats, error) {
+	query := tierStatsQuery + `
+              WHERE u.id > $2
+              GROUP BY u.id, u.tier
+              ORDER BY u.id
+              LIMIT $3`
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, since, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*model.TierStats
+	for rows.Next() {
+		stats := &model.TierStats{}
+		if err := rows.Scan(&stats.UserID, &stats.Tier, &stats.Accrued, &stats.Orders); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		list = append(list, stats)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return list, nil
+}
+
+func (r *tierRepository) UpdateTier(ctx context.Context, userID int64, from, to string) (bool, error) {
+	query := `UPDATE users SET tier = $3, tier_updated_at = NOW() WHERE id = $1 AND tier = $2`
+	res, err := r.db.conn(ctx).ExecContext(ctx, query, userID, from, to)
+	if err != nil {
+		return false, fmt.Errorf("failed to update user tier: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
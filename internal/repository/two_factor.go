@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/lib/pq"
+)
+
+type TwoFactorRepository interface {
+	GetTOTP(ctx context.Context, userID int64) (*model.TOTP, error)
+	GetTOTPForUpdate(ctx context.Context, userID int64) (*model.TOTP, error)
+	SaveTOTPSecret(ctx context.Context, userID int64, secret string) error
+	ConfirmTOTP(ctx context.Context, userID int64, step int64) error
+	MarkTOTPUsed(ctx context.Context, userID int64, step int64) error
+	DeleteTOTP(ctx context.Context, userID int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+}
+
+type twoFactorRepository struct {
+	db *Database
+}
+
+func NewTwoFactorRepository(db *Database) TwoFactorRepository {
+	return &twoFactorRepository{db: db}
+}
+
+func (r *twoFactorRepository) GetTOTP(ctx context.Context, userID int64) (*model.TOTP, error) {
+	return r.getTOTP(ctx, userID, "")
+}
+
+// GetTOTPForUpdate блокирует запись до конца транзакции, чтобы один код нельзя было
+// предъявить дважды параллельными запросами.
+func (r *twoFactorRepository) GetTOTPForUpdate(ctx context.Context, userID int64) (*model.TOTP, error) {
+	return r.getTOTP(ctx, userID, "FOR UPDATE")
+}
+
+func (r *twoFactorRepository) getTOTP(ctx context.Context, userID int64, lock string) (*model.TOTP, error) {
+	totp := &model.TOTP{}
+	query := `SELECT user_id, secret, confirmed_at, last_used_step, created_at
+              FROM user_totp WHERE user_id = $1 ` + lock
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, userID).Scan(
+		&totp.UserID, &totp.Secret, &totp.ConfirmedAt, &totp.LastUsedStep, &totp.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get totp: %w", err)
+	}
+	return totp, nil
+}
+
+// SaveTOTPSecret начинает настройку заново. Подтверждённый секрет не перезаписывается.
+func (r *twoFactorRepository) SaveTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	query := `INSERT INTO user_totp (user_id, secret)
+              VALUES ($1, $2)
+              ON CONFLICT (user_id) DO UPDATE
+                  SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+                  WHERE user_totp.confirmed_at IS NULL`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, userID, secret); err != nil {
+		return fmt.Errorf("failed to save totp secret: %w", err)
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) ConfirmTOTP(ctx context.Context, userID int64, step int64) error {
+	query := `UPDATE user_totp SET confirmed_at = NOW(), last_used_step = $2 WHERE user_id = $1`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, userID, step); err != nil {
+		return fmt.Errorf("failed to confirm totp: %w", err)
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) MarkTOTPUsed(ctx context.Context, userID int64, step int64) error {
+	query := `UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, userID, step); err != nil {
+		return fmt.Errorf("failed to mark totp used: %w", err)
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) DeleteTOTP(ctx context.Context, userID int64) error {
+	if _, err := r.db.conn(ctx).ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := r.db.conn(ctx).ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete totp: %w", err)
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	if _, err := r.db.conn(ctx).ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	query := `INSERT INTO recovery_codes (user_id, code_hash)
+              SELECT $1, unnest($2::text[])`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, userID, pq.Array(codeHashes)); err != nil {
+		return fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+	return nil
+}
+
+// UseRecoveryCode гасит код восстановления. false — кода нет или он уже использован.
+func (r *twoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	query := `UPDATE recovery_codes SET used_at = NOW()
+              WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	res, err := r.db.conn(ctx).ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// querier — общее подмножество *sql.DB и *sql.Tx, через которое работают репозитории.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type txKey struct{}
+
+// UnitOfWork объединяет вызовы нескольких репозиториев в одну транзакцию:
+// все методы репозиториев, вызванные с контекстом, переданным в fn, выполняются в ней.
+type UnitOfWork interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+func NewUnitOfWork(db *Database) UnitOfWork {
+	return db
+}
+
+// WithinTx выполняет fn в транзакции: коммит при успехе, откат при ошибке.
+// Если контекст уже несёт транзакцию, fn выполняется в ней же.
+func (d *Database) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok && tx != nil {
+		return fn(ctx)
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok && tx != nil {
+		return tx
+	}
+	return d.db
+}
+
+// Detach возвращает контекст без транзакции: записанное через него сохраняется, даже
+// если транзакция из ctx откатится. Нужен для счётчиков неудачных попыток.
+func Detach(ctx context.Context) context.Context {
+	return context.WithValue(ctx, txKey{}, (*sql.Tx)(nil))
+}
@@ -12,9 +12,14 @@ type UserRepository interface {
 	Create(ctx context.Context, user *model.User) error
 	GetByLogin(ctx context.Context, login string) (*model.User, error)
 	GetByID(ctx context.Context, id int64) (*model.User, error)
-	UpdateBalance(ctx context.Context, userID int64, amount float64) error
+	UpdatePassword(ctx context.Context, userID int64, passwordHash string) error
+	UpdateRole(ctx context.Context, userID int64, role string) error
+	UpdateBalance(ctx context.Context, userID int64, amount model.Money) error
+	DebitWithdrawal(ctx context.Context, userID int64, sum model.Money) error
+	CreditReversal(ctx context.Context, userID int64, sum model.Money) error
+	UpdateHeld(ctx context.Context, userID int64, delta model.Money) error
 	GetBalance(ctx context.Context, userID int64) (*model.UserBalance, error)
-	BeginTx(ctx context.Context) (*sql.Tx, error)
+	GetBalanceForUpdate(ctx context.Context, userID int64) (*model.UserBalance, error)
 }
 
 type userRepository struct {
@@ -26,8 +31,8 @@ func NewUserRepository(db *Database) UserRepository {
 }
 
 func (r *userRepository) Create(ctx context.Context, user *model.User) error {
-	query := `INSERT INTO users (login, password_hash) VALUES ($1, $2) RETURNING id, created_at`
-	err := r.db.db.QueryRowContext(ctx, query, user.Login, user.PasswordHash).Scan(&user.ID, &user.CreatedAt)
+	query := `INSERT INTO users (login, password_hash) VALUES ($1, $2) RETURNING id, role, created_at`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, user.Login, user.PasswordHash).Scan(&user.ID, &user.Role, &user.CreatedAt)
 	if err != nil {
 		return err
 	}
@@ -36,8 +41,8 @@ func (r *userRepository) Create(ctx context.Context, user *model.User) error {
 
 func (r *userRepository) GetByLogin(ctx context.Context, login string) (*model.User, error) {
 	user := &model.User{}
-	query := `SELECT id, login, password_hash, created_at FROM users WHERE login = $1`
-	err := r.db.db.QueryRowContext(ctx, query, login).Scan(&user.ID, &user.Login, &user.PasswordHash, &user.CreatedAt)
+	query := `SELECT id, login, password_hash, role, created_at FROM users WHERE login = $1`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, login).Scan(&user.ID, &user.Login, &user.PasswordHash, &user.Role, &user.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -49,8 +54,8 @@ func (r *userRepository) GetByLogin(ctx context.Context, login string) (*model.U
 
 func (r *userRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
 	user := &model.User{}
-	query := `SELECT id, login, password_hash, created_at FROM users WHERE id = $1`
-	err := r.db.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Login, &user.PasswordHash, &user.CreatedAt)
+	query := `SELECT id, login, password_hash, role, created_at FROM users WHERE id = $1`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Login, &user.PasswordHash, &user.Role, &user.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -60,28 +65,90 @@ func (r *userRepository) GetByID(ctx context.Context, id int64) (*model.User, er
 	return user, nil
 }
 
-func (r *userRepository) UpdateBalance(ctx context.Context, userID int64, amount float64) error {
+func (r *userRepository) UpdatePassword(ctx context.Context, userID int64, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $1 WHERE id = $2`
+	_, err := r.db.conn(ctx).ExecContext(ctx, query, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
+
+func (r *userRepository) UpdateRole(ctx context.Context, userID int64, role string) error {
+	query := `UPDATE users SET role = $1 WHERE id = $2`
+	_, err := r.db.conn(ctx).ExecContext(ctx, query, role, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+	return nil
+}
+
+// UpdateBalance меняет только баланс. Списания в счёт заказов проводятся через
+// DebitWithdrawal, чтобы ручные корректировки не попадали в withdrawn.
+func (r *userRepository) UpdateBalance(ctx context.Context, userID int64, amount model.Money) error {
+	query := `UPDATE users SET balance = balance + $1::numeric WHERE id = $2`
+	_, err := r.db.conn(ctx).ExecContext(ctx, query, amount, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update balance: %w", err)
+	}
+	return nil
+}
+
+func (r *userRepository) DebitWithdrawal(ctx context.Context, userID int64, sum model.Money) error {
 	query := `UPDATE users 
-              SET balance = balance + $1, 
-                  withdrawn = withdrawn + CASE WHEN $1 < 0 THEN -$1 ELSE 0 END
+              SET balance = balance - $1::numeric, 
+                  withdrawn = withdrawn + $1::numeric
               WHERE id = $2`
-	_, err := r.db.db.ExecContext(ctx, query, amount, userID)
+	_, err := r.db.conn(ctx).ExecContext(ctx, query, sum, userID)
 	if err != nil {
 		return fmt.Errorf("failed to update balance: %w", err)
 	}
 	return nil
 }
 
+// CreditReversal возвращает на баланс часть списания и уменьшает withdrawn на ту же сумму.
+func (r *userRepository) CreditReversal(ctx context.Context, userID int64, sum model.Money) error {
+	query := `UPDATE users 
+              SET balance = balance + $1::numeric, 
+                  withdrawn = withdrawn - $1::numeric
+              WHERE id = $2`
+	_, err := r.db.conn(ctx).ExecContext(ctx, query, sum, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update balance: %w", err)
+	}
+	return nil
+}
+
+// UpdateHeld меняет сумму резервов; сам баланс не меняется.
+func (r *userRepository) UpdateHeld(ctx context.Context, userID int64, delta model.Money) error {
+	query := `UPDATE users SET held = held + $1::numeric WHERE id = $2`
+	_, err := r.db.conn(ctx).ExecContext(ctx, query, delta, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update held amount: %w", err)
+	}
+	return nil
+}
+
 func (r *userRepository) GetBalance(ctx context.Context, userID int64) (*model.UserBalance, error) {
 	balance := &model.UserBalance{}
-	query := `SELECT balance, withdrawn FROM users WHERE id = $1`
-	err := r.db.db.QueryRowContext(ctx, query, userID).Scan(&balance.Current, &balance.Withdrawn)
+	query := `SELECT balance, withdrawn, held FROM users WHERE id = $1`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, userID).Scan(&balance.Current, &balance.Withdrawn, &balance.Held)
 	if err != nil {
 		return nil, err
 	}
+	balance.Available = balance.Current - balance.Held
 	return balance, nil
 }
 
-func (r *userRepository) BeginTx(ctx context.Context) (*sql.Tx, error) {
-	return r.db.BeginTx(ctx)
+// GetBalanceForUpdate читает баланс, блокируя строку пользователя до конца транзакции,
+// так что параллельные списания выполняются по очереди. Вызывается внутри UnitOfWork.WithinTx.
+func (r *userRepository) GetBalanceForUpdate(ctx context.Context, userID int64) (*model.UserBalance, error) {
+	balance := &model.UserBalance{}
+	query := `SELECT balance, withdrawn, held FROM users WHERE id = $1 FOR UPDATE`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, userID).Scan(&balance.Current, &balance.Withdrawn, &balance.Held)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock balance: %w", err)
+	}
+	balance.Available = balance.Current - balance.Held
+	return balance, nil
 }
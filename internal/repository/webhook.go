@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/lib/pq"
+	"time"
+)
+
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *model.Webhook) error
+	GetByID(ctx context.Context, userID, id int64) (*model.Webhook, error)
+	GetByUserID(ctx context.Context, userID int64) ([]*model.Webhook, error)
+	Deactivate(ctx context.Context, userID, id int64) (bool, error)
+	Enqueue(ctx context.Context, userID int64, eventType string, payload []byte) error
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*model.WebhookMessage, error)
+	MarkDelivered(ctx context.Context, messageID int64) error
+	ScheduleRetry(ctx context.Context, messageID int64, nextAttemptAt time.Time) error
+	MarkFailed(ctx context.Context, messageID int64) error
+	RecordDelivery(ctx context.Context, webhookID int64, delivery *model.WebhookDelivery) error
+	GetDeliveries(ctx context.Context, webhookID int64, limit int) ([]*model.WebhookDelivery, error)
+}
+
+type webhookRepository struct {
+	db *Database
+}
+
+func NewWebhookRepository(db *Database) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) Create(ctx context.Context, webhook *model.Webhook) error {
+	query := `INSERT INTO webhooks (user_id, url, secret, events)
+              VALUES ($1, $2, $3, $4)
+              RETURNING id, created_at`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		webhook.UserID, webhook.URL, webhook.Secret, pq.Array(webhook.Events),
+	).Scan(&webhook.ID, &webhook.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+func (r *webhookRepository) GetByID(ctx context.Context, userID, id int64) (*model.Webhook, error) {
+	webhook := &model.Webhook{}
+	query := `SELECT id, user_id, url, events, created_at
+              FROM webhooks WHERE id = $1 AND user_id = $2`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, id, userID).Scan(
+		&webhook.ID, &webhook.UserID, &webhook.URL, pq.Array(&webhook.Events), &webhook.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+func (r *webhookRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Webhook, error) {
+	query := `SELECT id, user_id, url, events, created_at
+              FROM webhooks
+              WHERE user_id = $1 AND active
+              ORDER BY id`
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []*model.Webhook
+	for rows.Next() {
+		var w model.Webhook
+		if err := rows.Scan(&w.ID, &w.UserID, &w.URL, pq.Array(&w.Events), &w.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		webhooks = append(webhooks, &w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// Deactivate отключает подписку и снимает с отправки её неотправленные сообщения.
+// Журнал доставок сохраняется.
+func (r *webhookRepository) Deactivate(ctx context.Context, userID, id int64) (bool, error) {
+	query := `WITH disabled AS (
+                  UPDATE webhooks SET active = FALSE
+                  WHERE id = $1 AND user_id = $2 AND active
+                  RETURNING id
+              ), dropped AS (
+                  UPDATE outbox SET status = $3
+                  WHERE webhook_id IN (SELECT id FROM disabled) AND status = $4
+              )
+              SELECT COUNT(*) FROM disabled`
+	var count int
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		id, userID, model.WebhookMessageFailed, model.WebhookMessagePending,
+	).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to deactivate webhook: %w", err)
+	}
+	return count > 0, nil
+}
+
+// Enqueue ставит событие в outbox для каждой активной подписки пользователя на этот тип.
+// Вызывается в той же транзакции, что и изменение, о котором сообщает событие.
+func (r *webhookRepository) Enqueue(ctx context.Context, userID int64, eventType string, payload []byte) error {
+	query := `INSERT INTO outbox (event_type, aggregate_type, aggregate_id, user_id, payload,
+                                  webhook_id, status, next_attempt_at)
+              SELECT $2, $4, id::text, user_id, $3, id, $5, NOW()
+              FROM webhooks
+              WHERE user_id = $1 AND active AND $2 = ANY(events)`
+	_, err := r.db.conn(ctx).ExecContext(ctx, query,
+		userID, eventType, string(payload), model.AggregateWebhook, model.WebhookMessagePending)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue webhook event: %w", err)
+	}
+	return nil
+}
+
+// ClaimDue забирает до limit сообщений, время отправки которых наступило, и откладывает
+// их на lease, чтобы другие экземпляры не отправили их одновременно.
+func (r *webhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*model.WebhookMessage, error) {
+	query := `UPDATE outbox o
+              SET next_attempt_at = NOW() + make_interval(secs => $2)
+              FROM webhooks w
+              WHERE w.id = o.webhook_id
+                AND o.id IN (
+                    SELECT id FROM outbox
+                    WHERE status = $3 AND next_attempt_at <= NOW()
+                    ORDER BY next_attempt_at
+                    LIMIT $1
+                    FOR UPDATE SKIP LOCKED
+                )
+              RETURNING o.id, o.webhook_id, w.url, w.secret, o.event_type, o.payload, o.attempts`
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, limit, lease.Seconds(), model.WebhookMessagePending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*model.WebhookMessage
+	for rows.Next() {
+		var m model.WebhookMessage
+		var payload []byte
+		if err := rows.Scan(&m.ID, &m.WebhookID, &m.URL, &m.Secret, &m.EventType, &payload, &m.Attempts); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		m.Payload = payload
+		messages = append(messages, &m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return messages, nil
+}
+
+func (r *webhookRepository) MarkDelivered(ctx context.Context, messageID int64) error {
+	query := `UPDATE outbox
+              SET status = $2, attempts = attempts + 1, published_at = NOW()
+              WHERE id = $1`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, messageID, model.WebhookMessageDelivered); err != nil {
+		return fmt.Errorf("failed to mark webhook message delivered: %w", err)
+	}
+	return nil
+}
+
+func (r *webhookRepository) ScheduleRetry(ctx context.Context, messageID int64, nextAttemptAt time.Time) error {
+	query := `UPDATE outbox
+              SET attempts = attempts + 1, next_attempt_at = $2
+              WHERE id = $1`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, messageID, nextAttemptAt); err != nil {
+		return fmt.Errorf("failed to schedule webhook retry: %w", err)
+	}
+	return nil
+}
+
+func (r *webhookRepository) MarkFailed(ctx context.Context, messageID int64) error {
+	query := `UPDATE outbox SET status = $2, attempts = attempts + 1 WHERE id = $1`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, messageID, model.WebhookMessageFailed); err != nil {
+		return fmt.Errorf("failed to mark webhook message failed: %w", err)
+	}
+	return nil
+}
+
+func (r *webhookRepository) RecordDelivery(ctx context.Context, webhookID int64, delivery *model.WebhookDelivery) error {
+	query := `INSERT INTO webhook_deliveries (outbox_id, webhook_id, attempt, status_code, error, duration_ms)
+              VALUES ($1, $2, $3, $4, $5, $6)
+              RETURNING id, created_at`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		delivery.MessageID,
+		webhookID,
+		delivery.Attempt,
+		sql.NullInt64{Int64: int64(delivery.StatusCode), Valid: delivery.StatusCode != 0},
+		delivery.Error,
+		delivery.DurationMs,
+	).Scan(&delivery.ID, &delivery.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (r *webhookRepository) GetDeliveries(ctx context.Context, webhookID int64, limit int) ([]*model.WebhookDelivery, error) {
+	query := `SELECT d.id, d.outbox_id, o.event_type, d.attempt, COALESCE(d.status_code, 0),
+                     d.error, d.duration_ms, d.created_at
+              FROM webhook_deliveries d
+              JOIN outbox o ON o.id = d.outbox_id
+              WHERE d.webhook_id = $1
+              ORDER BY d.id DESC
+              LIMIT $2`
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*model.WebhookDelivery
+	for rows.Next() {
+		var d model.WebhookDelivery
+		if err := rows.Scan(
+			&d.ID,
+			&d.MessageID,
+			&d.EventType,
+			&d.Attempt,
+			&d.StatusCode,
+			&d.Error,
+			&d.DurationMs,
+			&d.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		deliveries = append(deliveries, &d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return deliveries, nil
+}
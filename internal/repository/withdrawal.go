@@ -2,12 +2,36 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/lib/pq"
+	"strconv"
+	"time"
 )
 
+var ErrWithdrawalOrderExists = errors.New("withdrawal for this order already exists")
+
 type WithdrawalRepository interface {
 	Create(ctx context.Context, withdrawal *model.Withdrawal) error
-	GetByUserID(ctx context.Context, userID int64) ([]*model.Withdrawal, error)
+	GetByUserID(ctx context.Context, userID int64, filter model.ListFilter) (*model.Page[*model.Withdrawal], error)
+	Search(ctx context.Context, userID *int64, filter model.ListFilter) (*model.Page[*model.Withdrawal], error)
+	GetByOrderForUpdate(ctx context.Context, orderNumber string) (*model.Withdrawal, error)
+	// LockOrder сериализует до конца транзакции списания и резервы одного номера заказа,
+	// даже если строк по нему ещё нет.
+	LockOrder(ctx context.Context, orderNumber string) error
+	// UpdateStatus сохраняет статус и возвращённую сумму списания.
+	UpdateStatus(ctx context.Context, withdrawal *model.Withdrawal) error
+	AddReversal(ctx context.Context, reversal *model.WithdrawalReversal) error
+	// PendingReversalSum — сумма возвратов списания, ждущих подтверждения.
+	PendingReversalSum(ctx context.Context, withdrawalID int64) (model.Money, error)
+	GetReversalForUpdate(ctx context.Context, id int64) (*model.WithdrawalReversal, error)
+	// ReviewReversal фиксирует решение по возврату: статус, кто и когда его рассмотрел.
+	ReviewReversal(ctx context.Context, reversal *model.WithdrawalReversal) error
+	// ClaimPendingBefore блокирует до limit списаний в PENDING, сделанных раньше before,
+	// пропуская занятые.
+	ClaimPendingBefore(ctx context.Context, before time.Time, limit int) ([]*model.Withdrawal, error)
 }
 
 type withdrawalRepository struct {
@@ -19,35 +43,194 @@ func NewWithdrawalRepository(db *Database) WithdrawalRepository {
 }
 
 func (r *withdrawalRepository) Create(ctx context.Context, withdrawal *model.Withdrawal) error {
-	query := `INSERT INTO withdrawals (order_number, user_id, sum, processed_at) 
-              VALUES ($1, $2, $3, $4)`
-	_, err := r.db.db.ExecContext(ctx, query, withdrawal.Order, withdrawal.UserID, withdrawal.Sum, withdrawal.ProcessedAt)
+	query := `INSERT INTO withdrawals (order_number, user_id, sum, status, processed_at) 
+              VALUES ($1, $2, $3, $4, $5)
+              RETURNING id`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		withdrawal.Order, withdrawal.UserID, withdrawal.Sum, withdrawal.Status, withdrawal.ProcessedAt,
+	).Scan(&withdrawal.ID)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrWithdrawalOrderExists
+	}
 	return err
 }
 
-func (r *withdrawalRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Withdrawal, error) {
-	query := `SELECT order_number, sum, processed_at 
+// GetByUserID возвращает списания пользователя по фильтру. При filter.Limit > 0 выборка
+// постраничная по ключу (processed_at, id).
+func (r *withdrawalRepository) GetByUserID(ctx context.Context, userID int64, filter model.ListFilter) (*model.Page[*model.Withdrawal], error) {
+	return r.Search(ctx, &userID, filter)
+}
+
+// Search возвращает списания всех пользователей или одного, если задан userID.
+func (r *withdrawalRepository) Search(ctx context.Context, userID *int64, filter model.ListFilter) (*model.Page[*model.Withdrawal], error) {
+	direction, cmp := "DESC", "<"
+	if filter.Ascending {
+		direction, cmp = "ASC", ">"
+	}
+
+	query := fmt.Sprintf(`SELECT id, order_number, user_id, sum, status, reversed_sum, processed_at 
               FROM withdrawals 
-              WHERE user_id = $1
-              ORDER BY processed_at DESC`
-	rows, err := r.db.db.QueryContext(ctx, query, userID)
+              WHERE ($1::bigint IS NULL OR user_id = $1)
+                AND ($2::text[] IS NULL OR status::text = ANY($2))
+                AND ($3::timestamptz IS NULL OR processed_at >= $3)
+                AND ($4::timestamptz IS NULL OR processed_at < $4)
+                AND ($5::timestamptz IS NULL OR (processed_at, id) %s ($5, $6::bigint))
+              ORDER BY processed_at %s, id %s
+              LIMIT $7`, cmp, direction, direction)
+
+	after, afterKey := cursorArgs(filter.After)
+	var afterID int64
+	if afterKey != "" {
+		id, err := strconv.ParseInt(afterKey, 10, 64)
+		if err != nil {
+			return nil, model.ErrInvalidCursor
+		}
+		afterID = id
+	}
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query,
+		userID,
+		statusesArg(filter.Statuses),
+		nullTime(filter.From),
+		nullTime(filter.To),
+		after,
+		afterID,
+		limitArg(filter.Limit),
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var withdrawals []*model.Withdrawal
+	page := &model.Page[*model.Withdrawal]{}
 	for rows.Next() {
 		var w model.Withdrawal
-		if err := rows.Scan(&w.Order, &w.Sum, &w.ProcessedAt); err != nil {
+		if err := rows.Scan(&w.ID, &w.Order, &w.UserID, &w.Sum, &w.Status, &w.ReversedSum, &w.ProcessedAt); err != nil {
 			return nil, err
 		}
-		withdrawals = append(withdrawals, &w)
+		page.Items = append(page.Items, &w)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return withdrawals, nil
+	if filter.Limit > 0 && len(page.Items) > filter.Limit {
+		page.Items = page.Items[:filter.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.Next = &model.Cursor{Time: last.ProcessedAt, Key: strconv.FormatInt(last.ID, 10)}
+	}
+
+	return page, nil
+}
+
+// GetByOrderForUpdate блокирует списание до конца транзакции, чтобы параллельные
+// возвраты не превысили его сумму. Возвращает nil, если списания нет.
+func (r *withdrawalRepository) GetByOrderForUpdate(ctx context.Context, orderNumber string) (*model.Withdrawal, error) {
+	w := &model.Withdrawal{}
+	query := `SELECT id, order_number, user_id, sum, status, reversed_sum, processed_at
+              FROM withdrawals WHERE order_number = $1 AND NOT legacy_duplicate FOR UPDATE`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, orderNumber).Scan(
+		&w.ID, &w.Order, &w.UserID, &w.Sum, &w.Status, &w.ReversedSum, &w.ProcessedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawal: %w", err)
+	}
+	return w, nil
+}
+
+func (r *withdrawalRepository) LockOrder(ctx context.Context, orderNumber string) error {
+	if _, err := r.db.conn(ctx).ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('order:' || $1))`, orderNumber); err != nil {
+		return fmt.Errorf("failed to lock order number: %w", err)
+	}
+	return nil
+}
+
+func (r *withdrawalRepository) UpdateStatus(ctx context.Context, withdrawal *model.Withdrawal) error {
+	query := `UPDATE withdrawals SET status = $2, reversed_sum = $3::numeric, updated_at = NOW() WHERE id = $1`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, withdrawal.ID, withdrawal.Status, withdrawal.ReversedSum); err != nil {
+		return fmt.Errorf("failed to update withdrawal: %w", err)
+	}
+	return nil
+}
+
+func (r *withdrawalRepository) AddReversal(ctx context.Context, reversal *model.WithdrawalReversal) error {
+	query := `INSERT INTO withdrawal_reversals (withdrawal_id, sum, reason, status, actor_id)
+              VALUES ($1, $2::numeric, $3, $4, $5)
+              RETURNING id, created_at`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query,
+		reversal.WithdrawalID, reversal.Sum, reversal.Reason, reversal.Status, reversal.ActorID,
+	).Scan(&reversal.ID, &reversal.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record withdrawal reversal: %w", err)
+	}
+	return nil
+}
+
+func (r *withdrawalRepository) PendingReversalSum(ctx context.Context, withdrawalID int64) (model.Money, error) {
+	var sum model.Money
+	query := `SELECT COALESCE(SUM(sum), 0) FROM withdrawal_reversals WHERE withdrawal_id = $1 AND status = 'PENDING'`
+	if err := r.db.conn(ctx).QueryRowContext(ctx, query, withdrawalID).Scan(&sum); err != nil {
+		return 0, fmt.Errorf("failed to sum pending reversals: %w", err)
+	}
+	return sum, nil
+}
+
+// GetReversalForUpdate блокирует возврат до конца транзакции. Возвращает nil, если его нет.
+func (r *withdrawalRepository) GetReversalForUpdate(ctx context.Context, id int64) (*model.WithdrawalReversal, error) {
+	reversal := &model.WithdrawalReversal{}
+	query := `SELECT rv.id, rv.withdrawal_id, w.order_number, rv.sum, rv.reason, rv.status, rv.actor_id,
+                     rv.created_at, rv.reviewed_by, rv.reviewed_at
+              FROM withdrawal_reversals rv JOIN withdrawals w ON w.id = rv.withdrawal_id
+              WHERE rv.id = $1
+              FOR UPDATE OF rv`
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, id).Scan(
+		&reversal.ID, &reversal.WithdrawalID, &reversal.Order, &reversal.Sum, &reversal.Reason, &reversal.Status,
+		&reversal.ActorID, &reversal.CreatedAt, &reversal.ReviewedBy, &reversal.ReviewedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawal reversal: %w", err)
+	}
+	return reversal, nil
+}
+
+func (r *withdrawalRepository) ReviewReversal(ctx context.Context, reversal *model.WithdrawalReversal) error {
+	query := `UPDATE withdrawal_reversals SET status = $2, reviewed_by = $3, reviewed_at = $4 WHERE id = $1`
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query,
+		reversal.ID, reversal.Status, reversal.ReviewedBy, reversal.ReviewedAt); err != nil {
+		return fmt.Errorf("failed to review withdrawal reversal: %w", err)
+	}
+	return nil
+}
+
+func (r *withdrawalRepository) ClaimPendingBefore(ctx context.Context, before time.Time, limit int) ([]*model.Withdrawal, error) {
+	query := `SELECT id, order_number, user_id, sum, status, reversed_sum, processed_at
+              FROM withdrawals
+              WHERE status = 'PENDING' AND processed_at < $1 AND NOT legacy_duplicate
+              ORDER BY processed_at
+              LIMIT $2
+              FOR UPDATE SKIP LOCKED`
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pending withdrawals: %w", err)
+	}
+	defer rows.Close()
+
+	var withdrawals []*model.Withdrawal
+	for rows.Next() {
+		var w model.Withdrawal
+		if err := rows.Scan(&w.ID, &w.Order, &w.UserID, &w.Sum, &w.Status, &w.ReversedSum, &w.ProcessedAt); err != nil {
+			return nil, err
+		}
+		withdrawals = append(withdrawals, &w)
+	}
+	return withdrawals, rows.Err()
 }
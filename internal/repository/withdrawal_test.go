@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"testing"
+	"time"
+)
+
+func TestWithdrawalSearchFiltersByStatus(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, db)
+	repo := NewWithdrawalRepository(db)
+
+	now := time.Now()
+	for i, status := range []string{model.WithdrawalPending, model.WithdrawalCompleted, model.WithdrawalReversed, model.WithdrawalCompleted} {
+		err := repo.Create(ctx, &model.Withdrawal{
+			Order:       fmt.Sprintf("%d-%d", user.ID, i),
+			UserID:      user.ID,
+			Sum:         100,
+			Status:      status,
+			ProcessedAt: now.Add(time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatalf("create withdrawal %d: %v", i, err)
+		}
+	}
+
+	page, err := repo.Search(ctx, &user.ID, model.ListFilter{
+		Statuses: []string{model.WithdrawalCompleted, model.WithdrawalReversed},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 3 {
+		t.Fatalf("found %d withdrawals, want 3", len(page.Items))
+	}
+	for _, w := range page.Items {
+		if w.Status == model.WithdrawalPending {
+			t.Fatalf("withdrawal %s has filtered out status %s", w.Order, w.Status)
+		}
+	}
+
+	page, err = repo.GetByUserID(ctx, user.ID, model.ListFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 4 {
+		t.Fatalf("without filter found %d withdrawals, want 4", len(page.Items))
+	}
+}
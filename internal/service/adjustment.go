@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	adjustmentListLimit     = 100
+	maxAdjustmentTextLength = 500
+)
+
+var (
+	ErrAdjustmentInvalidAmount     = errors.New("adjustment amount must be non-zero")
+	ErrAdjustmentReasonRequired    = errors.New("adjustment reason is required")
+	ErrAdjustmentTicketRequired    = errors.New("adjustment ticket reference is required")
+	ErrAdjustmentNotFound          = errors.New("adjustment not found")
+	ErrAdjustmentNotPending        = errors.New("adjustment is not pending")
+	ErrAdjustmentSelfApproval      = errors.New("adjustment must be approved by another admin")
+	ErrAdjustmentForbidden         = errors.New("role is not allowed to perform this adjustment action")
+	ErrAdjustmentInsufficientFunds = errors.New("debit exceeds current balance")
+	ErrAdjustmentInvalidStatus     = errors.New("unknown adjustment status")
+)
+
+// AdjustmentService — ручные корректировки баланса сотрудниками. Создавать корректировки
+// может поддержка и администратор; если сумма по модулю больше порога, корректировка ждёт
+// подтверждения другого администратора (принцип четырёх глаз).
+type AdjustmentService interface {
+	Create(ctx context.Context, actor model.AdminActor, userID int64, amount model.Money, reason, ticket string) (*model.BalanceAdjustment, error)
+	Approve(ctx context.Context, actor model.AdminActor, id int64) (*model.BalanceAdjustment, error)
+	Reject(ctx context.Context, actor model.AdminActor, id int64) (*model.BalanceAdjustment, error)
+	List(ctx context.Context, actor model.AdminActor, status string, userID *int64) ([]*model.BalanceAdjustment, error)
+}
+
+type adjustmentService struct {
+	adjustmentRepo    repository.AdjustmentRepository
+	userRepo          repository.UserRepository
+	ledgerRepo        repository.LedgerRepository
+	expiry            ExpiryService
+	auditRepo         repository.AuditRepository
+	uow               repository.UnitOfWork
+	approvalThreshold model.Money
+}
+
+// NewAdjustmentService создаёт сервис. При approvalThreshold 0 подтверждение нужно для любой суммы.
+func NewAdjustmentService(
+	adjustmentRepo repository.AdjustmentRepository,
+	userRepo repository.UserRepository,
+	ledgerRepo repository.LedgerRepository,
+	expiry ExpiryService,
+	auditRepo repository.AuditRepository,
+	uow repository.UnitOfWork,
+	approvalThreshold model.Money,
+) AdjustmentService {
+	return &adjustmentService{
+		adjustmentRepo:    adjustmentRepo,
+		userRepo:          userRepo,
+		ledgerRepo:        ledgerRepo,
+		expiry:            expiry,
+		auditRepo:         auditRepo,
+		uow:               uow,
+		approvalThreshold: approvalThreshold,
+	}
+}
+
+func (s *adjustmentService) Create(ctx context.Context, actor model.AdminActor, userID int64, amount model.Money, reason, ticket string) (*model.BalanceAdjustment, error) {
+	if actor.Role != model.RoleSupport && actor.Role != model.RoleAdmin {
+		return nil, ErrAdjustmentForbidden
+	}
+	if amount == 0 {
+		return nil, ErrAdjustmentInvalidAmount
+	}
+	reason, ticket = strings.TrimSpace(reason), strings.TrimSpace(ticket)
+	if reason == "" || len(reason) > maxAdjustmentTextLength {
+		return nil, ErrAdjustmentReasonRequired
+	}
+	if ticket == "" || len(ticket) > maxAdjustmentTextLength {
+		return nil, ErrAdjustmentTicketRequired
+	}
+
+	adjustment := &model.BalanceAdjustment{
+		UserID:    userID,
+		Amount:    amount,
+		Reason:    reason,
+		Ticket:    ticket,
+		Status:    model.AdjustmentPending,
+		CreatedBy: actor.UserID,
+	}
+	needsApproval := max(amount, -amount) > s.approvalThreshold
+
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := s.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrUserNotFound
+		}
+
+		if !needsApproval {
+			if err := s.apply(ctx, adjustment); err != nil {
+				return err
+			}
+		}
+		if err := s.adjustmentRepo.Create(ctx, adjustment); err != nil {
+			return err
+		}
+
+		action := model.AuditAdjustmentRequested
+		if adjustment.Status == model.AdjustmentApplied {
+			action = model.AuditAdjustmentApplied
+		}
+		return s.audit(ctx, actor, action, adjustment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return adjustment, nil
+}
+
+// Approve проводит ожидающую корректировку. Подтверждает только администратор,
+// и не тот, кто её создал.
+func (s *adjustmentService) Approve(ctx context.Context, actor model.AdminActor, id int64) (*model.BalanceAdjustment, error) {
+	return s.review(ctx, actor, id, func(ctx context.Context, adjustment *model.BalanceAdjustment) error {
+		if err := s.apply(ctx, adjustment); err != nil {
+			return err
+		}
+		return s.audit(ctx, actor, model.AuditAdjustmentApplied, adjustment)
+	})
+}
+
+func (s *adjustmentService) Reject(ctx context.Context, actor model.AdminActor, id int64) (*model.BalanceAdjustment, error) {
+	return s.review(ctx, actor, id, func(ctx context.Context, adjustment *model.BalanceAdjustment) error {
+		adjustment.Status = model.AdjustmentRejected
+		return s.audit(ctx, actor, model.AuditAdjustmentRejected, adjustment)
+	})
+}
+
+func (s *adjustmentService) List(ctx context.Context, actor model.AdminActor, status string, userID *int64) ([]*model.BalanceAdjustment, error) {
+	if actor.Role != model.RoleSupport && actor.Role != model.RoleAdmin {
+		return nil, ErrAdjustmentForbidden
+	}
+	status = strings.ToUpper(status)
+	if status != "" && !slices.Contains(model.AdjustmentStatuses, status) {
+		return nil, ErrAdjustmentInvalidStatus
+	}
+	return s.adjustmentRepo.List(ctx, status, userID, adjustmentListLimit)
+}
+
+func (s *adjustmentService) review(ctx context.Context, actor model.AdminActor, id int64, decide func(ctx context.Context, adjustment *model.BalanceAdjustment) error) (*model.BalanceAdjustment, error) {
+	if actor.Role != model.RoleAdmin {
+		return nil, ErrAdjustmentForbidden
+	}
+
+	var adjustment *model.BalanceAdjustment
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		adjustment, err = s.adjustmentRepo.GetForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		if adjustment == nil {
+			return ErrAdjustmentNotFound
+		}
+		if adjustment.Status != model.AdjustmentPending {
+			return ErrAdjustmentNotPending
+		}
+		if adjustment.CreatedBy == actor.UserID {
+			return ErrAdjustmentSelfApproval
+		}
+
+		now := time.Now()
+		adjustment.ReviewedBy = &actor.UserID
+		adjustment.ReviewedAt = &now
+		if err := decide(ctx, adjustment); err != nil {
+			return err
+		}
+		return s.adjustmentRepo.Review(ctx, adjustment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return adjustment, nil
+}
+
+// apply меняет баланс и пишет проводку ADJUSTMENT. Корректировка не учитывается
+// в withdrawn: это не списание в счёт заказа.
+func (s *adjustmentService) apply(ctx context.Context, adjustment *model.BalanceAdjustment) error {
+	balance, err := s.userRepo.GetBalanceForUpdate(ctx, adjustment.UserID)
+	if err != nil {
+		return err
+	}
+	if balance.Available+adjustment.Amount < 0 {
+		return ErrAdjustmentInsufficientFunds
+	}
+
+	if err := s.userRepo.UpdateBalance(ctx, adjustment.UserID, adjustment.Amount); err != nil {
+		return err
+	}
+	if adjustment.Amount > 0 {
+		err = s.expiry.Credit(ctx, adjustment.UserID, model.LedgerKindAdjustment, "", adjustment.Amount)
+	} else {
+		err = s.expiry.Consume(ctx, adjustment.UserID, -adjustment.Amount)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.ledgerRepo.Post(ctx, &model.LedgerPosting{
+		UserID:         adjustment.UserID,
+		Amount:         adjustment.Amount,
+		Kind:           model.LedgerKindAdjustment,
+		CounterAccount: model.LedgerAccountAdjustment,
+		Description:    fmt.Sprintf("%s (ticket %s)", adjustment.Reason, adjustment.Ticket),
+	}); err != nil {
+		return fmt.Errorf("failed to record adjustment in ledger: %w", err)
+	}
+
+	now := time.Now()
+	adjustment.Status = model.AdjustmentApplied
+	adjustment.AppliedAt = &now
+	return nil
+}
+
+func (s *adjustmentService) audit(ctx context.Context, actor model.AdminActor, action string, adjustment *model.BalanceAdjustment) error {
+	details, err := json.Marshal(map[string]any{
+		"adjustment_id": adjustment.ID,
+		"amount":        adjustment.Amount,
+		"reason":        adjustment.Reason,
+		"ticket":        adjustment.Ticket,
+	})
+	if err != nil {
+		return err
+	}
+	return s.auditRepo.Record(ctx, &model.AuditEntry{
+		Action:  action,
+		UserID:  &adjustment.UserID,
+		ActorID: &actor.UserID,
+		IP:      actor.IP,
+		Details: details,
+	})
+}
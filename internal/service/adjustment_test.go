@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"testing"
+)
+
+type fakeAdjustmentRepo struct {
+	repository.AdjustmentRepository
+	adjustments map[int64]*model.BalanceAdjustment
+}
+
+func (f *fakeAdjustmentRepo) Create(_ context.Context, adjustment *model.BalanceAdjustment) error {
+	adjustment.ID = int64(len(f.adjustments) + 1)
+	copied := *adjustment
+	f.adjustments[adjustment.ID] = &copied
+	return nil
+}
+
+func (f *fakeAdjustmentRepo) GetForUpdate(_ context.Context, id int64) (*model.BalanceAdjustment, error) {
+	adjustment, ok := f.adjustments[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *adjustment
+	return &copied, nil
+}
+
+type fakeUserRepo struct {
+	repository.UserRepository
+}
+
+func (fakeUserRepo) GetByID(_ context.Context, id int64) (*model.User, error) {
+	return &model.User{ID: id, Role: model.RoleUser}, nil
+}
+
+func TestAdjustmentFourEyes(t *testing.T) {
+	repo := &fakeAdjustmentRepo{adjustments: make(map[int64]*model.BalanceAdjustment)}
+	s := NewAdjustmentService(repo, fakeUserRepo{}, nil, nil, fakeAudit{}, fakeUnitOfWork{}, 0)
+	ctx := context.Background()
+	requester := model.AdminActor{UserID: 10, Role: model.RoleAdmin}
+
+	if _, err := s.Create(ctx, model.AdminActor{UserID: 11, Role: model.RoleUser}, 1, 100, "Goodwill", "SUP-1"); !errors.Is(err, ErrAdjustmentForbidden) {
+		t.Fatalf("Create by user: error = %v, want ErrAdjustmentForbidden", err)
+	}
+
+	// При пороге 0 подтверждение нужно для любой суммы, баланс не трогается.
+	adjustment, err := s.Create(ctx, requester, 1, 1, "Goodwill", "SUP-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adjustment.Status != model.AdjustmentPending {
+		t.Fatalf("status = %s, want %s", adjustment.Status, model.AdjustmentPending)
+	}
+
+	tests := []struct {
+		name  string
+		actor model.AdminActor
+		want  error
+	}{
+		{"requester", requester, ErrAdjustmentSelfApproval},
+		{"support", model.AdminActor{UserID: 12, Role: model.RoleSupport}, ErrAdjustmentForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Approve(ctx, tt.actor, adjustment.ID); !errors.Is(err, tt.want) {
+				t.Errorf("Approve error = %v, want %v", err, tt.want)
+			}
+			if _, err := s.Reject(ctx, tt.actor, adjustment.ID); !errors.Is(err, tt.want) {
+				t.Errorf("Reject error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"slices"
+)
+
+var (
+	ErrUserNotFound           = errors.New("user not found")
+	ErrInvalidRole            = errors.New("unknown role")
+	ErrOwnRoleChange          = errors.New("cannot change own role")
+	ErrOrderAlreadyProcessed  = errors.New("order already processed")
+	ErrInvalidOrderNumberPart = errors.New("order number must contain only digits")
+)
+
+// AdminService — операции сотрудников над данными всех пользователей. Каждый вызов,
+// включая чтение, записывается в журнал аудита от имени actor; если запись не удалась,
+// действие не выполняется.
+type AdminService interface {
+	GetUser(ctx context.Context, actor model.AdminActor, userID int64) (*model.AdminUser, error)
+	FindUser(ctx context.Context, actor model.AdminActor, login string) (*model.AdminUser, error)
+	SetRole(ctx context.Context, actor model.AdminActor, userID int64, role string) error
+	SearchOrders(ctx context.Context, actor model.AdminActor, search model.OrderSearch, filter model.ListFilter) (*model.Page[*model.AdminOrder], error)
+	RepollOrder(ctx context.Context, actor model.AdminActor, number string) (*model.AdminOrder, error)
+	ListWithdrawals(ctx context.Context, actor model.AdminActor, userID *int64, filter model.ListFilter) (*model.Page[*model.AdminWithdrawal], error)
+}
+
+type adminService struct {
+	userRepo       repository.UserRepository
+	orderRepo      repository.OrderRepository
+	withdrawalRepo repository.WithdrawalRepository
+	auditRepo      repository.AuditRepository
+	outboxRepo     repository.OutboxRepository
+	uow            repository.UnitOfWork
+	twoFactor      TwoFactorService
+	auth           AuthService
+}
+
+func NewAdminService(
+	userRepo repository.UserRepository,
+	orderRepo repository.OrderRepository,
+	withdrawalRepo repository.WithdrawalRepository,
+	auditRepo repository.AuditRepository,
+	outboxRepo repository.OutboxRepository,
+	uow repository.UnitOfWork,
+	twoFactor TwoFactorService,
+	auth AuthService,
+) AdminService {
+	return &adminService{
+		userRepo:       userRepo,
+		orderRepo:      orderRepo,
+		withdrawalRepo: withdrawalRepo,
+		auditRepo:      auditRepo,
+		outboxRepo:     outboxRepo,
+		uow:            uow,
+		twoFactor:      twoFactor,
+		auth:           auth,
+	}
+}
+
+func (s *adminService) GetUser(ctx context.Context, actor model.AdminActor, userID int64) (*model.AdminUser, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.viewUser(ctx, actor, user)
+}
+
+func (s *adminService) FindUser(ctx context.Context, actor model.AdminActor, login string) (*model.AdminUser, error) {
+	user, err := FindUserByLogin(ctx, s.userRepo, login)
+	if err != nil {
+		return nil, err
+	}
+	return s.viewUser(ctx, actor, user)
+}
+
+func (s *adminService) viewUser(ctx context.Context, actor model.AdminActor, user *model.User) (*model.AdminUser, error) {
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	balance, err := s.userRepo.GetBalance(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := s.twoFactor.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit(ctx, actor, model.AuditAdminUserViewed, &user.ID, user.Login, nil); err != nil {
+		return nil, err
+	}
+
+	return &model.AdminUser{
+		ID:               user.ID,
+		Login:            user.Login,
+		Role:             user.Role,
+		CreatedAt:        user.CreatedAt,
+		Balance:          balance.Current,
+		Withdrawn:        balance.Withdrawn,
+		Held:             balance.Held,
+		TwoFactorEnabled: enabled,
+	}, nil
+}
+
+// SetRole меняет роль пользователя и отзывает его сессии: роль зашита в access-токены,
+// и без отзыва понижение действовало бы до их истечения.
+func (s *adminService) SetRole(ctx context.Context, actor model.AdminActor, userID int64, role string) error {
+	if !slices.Contains(model.Roles, role) {
+		return ErrInvalidRole
+	}
+	if userID == actor.UserID {
+		return ErrOwnRoleChange
+	}
+
+	changed := false
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := s.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrUserNotFound
+		}
+		if user.Role == role {
+			return nil
+		}
+		if err := s.userRepo.UpdateRole(ctx, userID, role); err != nil {
+			return err
+		}
+		changed = true
+		return s.audit(ctx, actor, model.AuditAdminRoleChanged, &user.ID, user.Login,
+			map[string]any{"from": user.Role, "to": role})
+	})
+	if err != nil || !changed {
+		return err
+	}
+	return s.auth.LogoutAll(ctx, userID)
+}
+
+func (s *adminService) SearchOrders(ctx context.Context, actor model.AdminActor, search model.OrderSearch, filter model.ListFilter) (*model.Page[*model.AdminOrder], error) {
+	if !isDigits(search.Number) {
+		return nil, ErrInvalidOrderNumberPart
+	}
+	page, err := s.orderRepo.Search(ctx, search, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit(ctx, actor, model.AuditAdminOrdersSearched, search.UserID, "",
+		map[string]any{"number": search.Number, "statuses": filter.Statuses}); err != nil {
+		return nil, err
+	}
+
+	result := &model.Page[*model.AdminOrder]{Next: page.Next}
+	for _, order := range page.Items {
+		result.Items = append(result.Items, &model.AdminOrder{Order: order, UserID: order.UserID})
+	}
+	return result, nil
+}
+
+// RepollOrder снимает с заказа аренду, чтобы его опросил ближайший проход обработчика,
+// а заказ в INVALID возвращает в PROCESSING. Обработанный заказ повторно не опрашивается.
+func (s *adminService) RepollOrder(ctx context.Context, actor model.AdminActor, number string) (*model.AdminOrder, error) {
+	existing, err := s.orderRepo.GetByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, ErrOrderNotFound
+	}
+
+	var order *model.Order
+	err = s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		previous, err := s.orderRepo.Requeue(ctx, number)
+		if err != nil {
+			return err
+		}
+		if previous == nil {
+			return ErrOrderAlreadyProcessed
+		}
+
+		order = &model.Order{
+			Number:     previous.Number,
+			UserID:     previous.UserID,
+			Status:     previous.Status,
+			Accrual:    previous.Accrual,
+			UploadedAt: previous.UploadedAt,
+		}
+		if previous.Status == "INVALID" {
+			order.Status = "PROCESSING"
+			if err := s.orderRepo.AddStatusHistory(ctx, order.Number, order.Status, 0); err != nil {
+				return err
+			}
+			if err := recordEvent(ctx, s.outboxRepo, model.EventOrderStatusChanged, model.AggregateOrder, order.Number, order.UserID,
+				model.OrderStatusChangedPayload{Number: order.Number, PreviousStatus: previous.Status, Status: order.Status}); err != nil {
+				return err
+			}
+		}
+		return s.audit(ctx, actor, model.AuditAdminOrderRepolled, &order.UserID, "",
+			map[string]any{"number": order.Number, "previous_status": previous.Status})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &model.AdminOrder{Order: order, UserID: order.UserID}, nil
+}
+
+func (s *adminService) ListWithdrawals(ctx context.Context, actor model.AdminActor, userID *int64, filter model.ListFilter) (*model.Page[*model.AdminWithdrawal], error) {
+	page, err := s.withdrawalRepo.Search(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit(ctx, actor, model.AuditAdminWithdrawalsRead, userID, "", nil); err != nil {
+		return nil, err
+	}
+
+	result := &model.Page[*model.AdminWithdrawal]{Next: page.Next}
+	for _, w := range page.Items {
+		result.Items = append(result.Items, &model.AdminWithdrawal{Withdrawal: w, UserID: w.UserID})
+	}
+	return result, nil
+}
+
+func (s *adminService) audit(ctx context.Context, actor model.AdminActor, action string, userID *int64, login string, details map[string]any) error {
+	entry := &model.AuditEntry{
+		Action:  action,
+		UserID:  userID,
+		ActorID: &actor.UserID,
+		Login:   login,
+		IP:      actor.IP,
+	}
+	if details != nil {
+		raw, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		entry.Details = raw
+	}
+	return s.auditRepo.Record(ctx, entry)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
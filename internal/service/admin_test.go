@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"testing"
+)
+
+type fakeAdminUsers struct {
+	repository.UserRepository
+
+	users map[int64]*model.User
+}
+
+func (u *fakeAdminUsers) GetByID(_ context.Context, id int64) (*model.User, error) {
+	return u.users[id], nil
+}
+
+func (u *fakeAdminUsers) GetByLogin(_ context.Context, login string) (*model.User, error) {
+	for _, user := range u.users {
+		if user.Login == login {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (u *fakeAdminUsers) GetBalance(context.Context, int64) (*model.UserBalance, error) {
+	return &model.UserBalance{Current: 500}, nil
+}
+
+func (u *fakeAdminUsers) UpdateRole(_ context.Context, userID int64, role string) error {
+	u.users[userID].Role = role
+	return nil
+}
+
+type fakeAdminOrders struct {
+	repository.OrderRepository
+}
+
+func (fakeAdminOrders) GetByNumber(_ context.Context, number string) (*model.Order, error) {
+	return &model.Order{Number: number, UserID: 2, Status: "INVALID"}, nil
+}
+
+func (fakeAdminOrders) Requeue(_ context.Context, number string) (*model.Order, error) {
+	return &model.Order{Number: number, UserID: 2, Status: "INVALID"}, nil
+}
+
+func (fakeAdminOrders) AddStatusHistory(context.Context, string, string, model.Money) error {
+	return nil
+}
+
+func (fakeAdminOrders) Search(context.Context, model.OrderSearch, model.ListFilter) (*model.Page[*model.Order], error) {
+	return &model.Page[*model.Order]{Items: []*model.Order{{Number: "79927398713", UserID: 2}}}, nil
+}
+
+type fakeAdminWithdrawals struct {
+	repository.WithdrawalRepository
+}
+
+func (fakeAdminWithdrawals) Search(context.Context, *int64, model.ListFilter) (*model.Page[*model.Withdrawal], error) {
+	return &model.Page[*model.Withdrawal]{Items: []*model.Withdrawal{{Order: "2377225624", UserID: 2}}}, nil
+}
+
+type fakeTwoFactorStatus struct {
+	TwoFactorService
+}
+
+func (fakeTwoFactorStatus) Enabled(context.Context, int64) (bool, error) {
+	return false, nil
+}
+
+type fakeLogoutAuth struct {
+	AuthService
+
+	loggedOut []int64
+}
+
+func (a *fakeLogoutAuth) LogoutAll(_ context.Context, userID int64) error {
+	a.loggedOut = append(a.loggedOut, userID)
+	return nil
+}
+
+type failingAudit struct {
+	repository.AuditRepository
+}
+
+func (failingAudit) Record(context.Context, *model.AuditEntry) error {
+	return errors.New("audit unavailable")
+}
+
+func newAdminTestService(audit repository.AuditRepository) (AdminService, *fakeAdminUsers, *fakeLogoutAuth) {
+	users := &fakeAdminUsers{users: map[int64]*model.User{
+		1: {ID: 1, Login: "admin", Role: model.RoleAdmin},
+		2: {ID: 2, Login: "alice", Role: model.RoleUser},
+	}}
+	auth := &fakeLogoutAuth{}
+	s := NewAdminService(users, fakeAdminOrders{}, fakeAdminWithdrawals{}, audit, &fakeOutbox{},
+		fakeUnitOfWork{}, fakeTwoFactorStatus{}, auth)
+	return s, users, auth
+}
+
+var testAdmin = model.AdminActor{UserID: 1, Role: model.RoleAdmin, IP: "10.0.0.1"}
+
+func TestAdminSetRole(t *testing.T) {
+	audit := &recordingAudit{}
+	s, users, auth := newAdminTestService(audit)
+	ctx := context.Background()
+
+	if err := s.SetRole(ctx, testAdmin, 2, "root"); !errors.Is(err, ErrInvalidRole) {
+		t.Fatalf("unknown role: error = %v, want ErrInvalidRole", err)
+	}
+	if err := s.SetRole(ctx, testAdmin, testAdmin.UserID, model.RoleUser); !errors.Is(err, ErrOwnRoleChange) {
+		t.Fatalf("own role: error = %v, want ErrOwnRoleChange", err)
+	}
+	if users.users[1].Role != model.RoleAdmin {
+		t.Fatalf("own role changed to %q", users.users[1].Role)
+	}
+	if err := s.SetRole(ctx, testAdmin, 9, model.RoleSupport); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("unknown user: error = %v, want ErrUserNotFound", err)
+	}
+	if len(auth.loggedOut) != 0 {
+		t.Fatalf("sessions revoked after rejected changes: %v", auth.loggedOut)
+	}
+
+	if err := s.SetRole(ctx, testAdmin, 2, model.RoleSupport); err != nil {
+		t.Fatal(err)
+	}
+	if users.users[2].Role != model.RoleSupport {
+		t.Fatalf("role = %q, want %q", users.users[2].Role, model.RoleSupport)
+	}
+	if len(auth.loggedOut) != 1 || auth.loggedOut[0] != 2 {
+		t.Fatalf("revoked sessions of %v, want [2]", auth.loggedOut)
+	}
+	entries := audit.actions(model.AuditAdminRoleChanged)
+	if len(entries) != 1 || *entries[0].UserID != 2 || *entries[0].ActorID != testAdmin.UserID {
+		t.Fatalf("role change audit = %+v", entries)
+	}
+
+	// Та же роль — ничего не меняется, сессии не отзываются.
+	if err := s.SetRole(ctx, testAdmin, 2, model.RoleSupport); err != nil {
+		t.Fatal(err)
+	}
+	if len(auth.loggedOut) != 1 || len(audit.actions(model.AuditAdminRoleChanged)) != 1 {
+		t.Fatal("unchanged role revoked sessions or was audited")
+	}
+}
+
+// adminCalls — все операции AdminService; тесты ниже проверяют, что каждая пишет аудит.
+var adminCalls = []struct {
+	action string
+	call   func(ctx context.Context, s AdminService) error
+}{
+	{model.AuditAdminUserViewed, func(ctx context.Context, s AdminService) error {
+		_, err := s.GetUser(ctx, testAdmin, 2)
+		return err
+	}},
+	{model.AuditAdminUserViewed, func(ctx context.Context, s AdminService) error {
+		_, err := s.FindUser(ctx, testAdmin, "alice")
+		return err
+	}},
+	{model.AuditAdminRoleChanged, func(ctx context.Context, s AdminService) error {
+		return s.SetRole(ctx, testAdmin, 2, model.RoleSupport)
+	}},
+	{model.AuditAdminOrdersSearched, func(ctx context.Context, s AdminService) error {
+		_, err := s.SearchOrders(ctx, testAdmin, model.OrderSearch{Number: "7992"}, model.ListFilter{})
+		return err
+	}},
+	{model.AuditAdminOrderRepolled, func(ctx context.Context, s AdminService) error {
+		_, err := s.RepollOrder(ctx, testAdmin, "79927398713")
+		return err
+	}},
+	{model.AuditAdminWithdrawalsRead, func(ctx context.Context, s AdminService) error {
+		_, err := s.ListWithdrawals(ctx, testAdmin, nil, model.ListFilter{})
+		return err
+	}},
+}
+
+func TestAdminAuditsEveryAction(t *testing.T) {
+	for _, tt := range adminCalls {
+		t.Run(tt.action, func(t *testing.T) {
+			audit := &recordingAudit{}
+			s, _, _ := newAdminTestService(audit)
+
+			if err := tt.call(context.Background(), s); err != nil {
+				t.Fatal(err)
+			}
+			entries := audit.actions(tt.action)
+			if len(entries) != 1 {
+				t.Fatalf("audit entries = %d, want 1", len(entries))
+			}
+			if *entries[0].ActorID != testAdmin.UserID || entries[0].IP != testAdmin.IP {
+				t.Fatalf("audit actor = %d from %q, want %d from %q",
+					*entries[0].ActorID, entries[0].IP, testAdmin.UserID, testAdmin.IP)
+			}
+		})
+	}
+}
+
+func TestAdminFailsWithoutAudit(t *testing.T) {
+	for _, tt := range adminCalls {
+		t.Run(tt.action, func(t *testing.T) {
+			s, _, auth := newAdminTestService(failingAudit{})
+
+			if err := tt.call(context.Background(), s); err == nil {
+				t.Fatal("action succeeded without an audit record")
+			}
+			if len(auth.loggedOut) != 0 {
+				t.Fatal("sessions revoked without an audit record")
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	apiKeyPrefix       = "gm_"
+	apiKeyPrefixLength = 10
+	apiKeyNameMaxLen   = 100
+	maxAPIKeysPerUser  = 20
+	// apiKeyTouchInterval — не чаще этого обновляем last_used_at, чтобы не писать
+	// в базу на каждый запрос.
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	ErrAPIKeyInvalidName   = errors.New("api key name must be 1 to 100 characters")
+	ErrAPIKeyInvalidScopes = errors.New("invalid api key scopes")
+	ErrAPIKeyStaffScope    = errors.New("api key scope is available to staff only")
+	ErrAPIKeyLimitReached  = errors.New("too many api keys")
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrInvalidAPIKey       = errors.New("invalid api key")
+)
+
+type APIKeyService interface {
+	Create(ctx context.Context, userID int64, name string, scopes []string) (*model.APIKey, error)
+	List(ctx context.Context, userID int64) ([]*model.APIKey, error)
+	Revoke(ctx context.Context, userID, id int64) error
+	Authenticate(ctx context.Context, key string) (*model.APIKey, error)
+}
+
+type apiKeyService struct {
+	repo     repository.APIKeyRepository
+	userRepo repository.UserRepository
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository, userRepo repository.UserRepository) APIKeyService {
+	return &apiKeyService{repo: repo, userRepo: userRepo}
+}
+
+func (s *apiKeyService) Create(ctx context.Context, userID int64, name string, scopes []string) (*model.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > apiKeyNameMaxLen {
+		return nil, ErrAPIKeyInvalidName
+	}
+	if len(scopes) == 0 {
+		return nil, ErrAPIKeyInvalidScopes
+	}
+	staffOnly := false
+	for _, scope := range scopes {
+		if !slices.Contains(model.APIKeyScopes, scope) {
+			return nil, ErrAPIKeyInvalidScopes
+		}
+		staffOnly = staffOnly || slices.Contains(model.StaffAPIKeyScopes, scope)
+	}
+	if staffOnly {
+		user, err := s.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil || (user.Role != model.RoleSupport && user.Role != model.RoleAdmin) {
+			return nil, ErrAPIKeyStaffScope
+		}
+	}
+
+	count, err := s.repo.CountActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxAPIKeysPerUser {
+		return nil, ErrAPIKeyLimitReached
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	raw := apiKeyPrefix + secret
+
+	key := &model.APIKey{
+		UserID:  userID,
+		Name:    name,
+		Prefix:  raw[:apiKeyPrefixLength],
+		Key:     raw,
+		KeyHash: hashAPIKey(raw),
+		Scopes:  slices.Compact(slices.Sorted(slices.Values(scopes))),
+	}
+	if err := s.repo.Create(ctx, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *apiKeyService) List(ctx context.Context, userID int64) ([]*model.APIKey, error) {
+	return s.repo.GetByUserID(ctx, userID)
+}
+
+func (s *apiKeyService) Revoke(ctx context.Context, userID, id int64) error {
+	revoked, err := s.repo.Revoke(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate находит действующий ключ и отмечает его использование не чаще
+// раза в apiKeyTouchInterval.
+func (s *apiKeyService) Authenticate(ctx context.Context, key string) (*model.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	apiKey, err := s.repo.GetByHash(ctx, hashAPIKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if apiKey.LastUsedAt == nil || time.Since(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.repo.TouchLastUsed(ctx, apiKey.ID); err != nil {
+			return nil, err
+		}
+	}
+	return apiKey, nil
+}
+
+// hashAPIKey — ключ случайный и длинный, поэтому медленный хеш не нужен.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeAPIKeyRepo struct {
+	repository.APIKeyRepository
+
+	active  int
+	created []*model.APIKey
+	byHash  map[string]*model.APIKey
+	touched []int64
+}
+
+func (r *fakeAPIKeyRepo) Create(_ context.Context, key *model.APIKey) error {
+	key.ID = int64(len(r.created) + 1)
+	r.created = append(r.created, key)
+	r.active++
+	return nil
+}
+
+func (r *fakeAPIKeyRepo) CountActive(context.Context, int64) (int, error) {
+	return r.active, nil
+}
+
+func (r *fakeAPIKeyRepo) GetByHash(_ context.Context, keyHash string) (*model.APIKey, error) {
+	return r.byHash[keyHash], nil
+}
+
+func (r *fakeAPIKeyRepo) TouchLastUsed(_ context.Context, id int64) error {
+	r.touched = append(r.touched, id)
+	return nil
+}
+
+type fakeRoleUsers struct {
+	repository.UserRepository
+
+	roles map[int64]string
+}
+
+func (u fakeRoleUsers) GetByID(_ context.Context, id int64) (*model.User, error) {
+	role, ok := u.roles[id]
+	if !ok {
+		return nil, nil
+	}
+	return &model.User{ID: id, Role: role}, nil
+}
+
+func TestAPIKeyCreateValidation(t *testing.T) {
+	users := fakeRoleUsers{roles: map[int64]string{
+		1: model.RoleUser,
+		2: model.RoleSupport,
+		3: model.RoleAdmin,
+	}}
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		userID  int64
+		keyName string
+		scopes  []string
+		wantErr error
+	}{
+		{"empty name", 1, "  ", []string{model.ScopeOrdersRead}, ErrAPIKeyInvalidName},
+		{"long name", 1, strings.Repeat("я", apiKeyNameMaxLen+1), []string{model.ScopeOrdersRead}, ErrAPIKeyInvalidName},
+		{"no scopes", 1, "ci", nil, ErrAPIKeyInvalidScopes},
+		{"unknown scope", 1, "ci", []string{model.ScopeOrdersRead, "orders:delete"}, ErrAPIKeyInvalidScopes},
+		{"user scopes", 1, "ci", []string{model.ScopeOrdersRead, model.ScopeBalanceRead}, nil},
+		{"reverse by user", 1, "ci", []string{model.ScopeWithdrawalsReverse}, ErrAPIKeyStaffScope},
+		{"reverse mixed by user", 1, "ci", []string{model.ScopeOrdersRead, model.ScopeWithdrawalsReverse}, ErrAPIKeyStaffScope},
+		{"reverse by unknown user", 9, "ci", []string{model.ScopeWithdrawalsReverse}, ErrAPIKeyStaffScope},
+		{"reverse by support", 2, "partner", []string{model.ScopeWithdrawalsReverse}, nil},
+		{"reverse by admin", 3, "partner", []string{model.ScopeWithdrawalsReverse}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAPIKeyRepo{}
+			s := NewAPIKeyService(repo, users)
+
+			key, err := s.Create(ctx, tt.userID, tt.keyName, tt.scopes)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Create() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(repo.created) != 0 {
+					t.Fatal("rejected key was stored")
+				}
+				return
+			}
+			if !strings.HasPrefix(key.Key, apiKeyPrefix) || key.Prefix != key.Key[:apiKeyPrefixLength] {
+				t.Fatalf("key = %q, prefix = %q", key.Key, key.Prefix)
+			}
+			if key.KeyHash != hashAPIKey(key.Key) {
+				t.Fatal("stored hash does not match the key")
+			}
+		})
+	}
+}
+
+func TestAPIKeyCreateDeduplicatesScopes(t *testing.T) {
+	s := NewAPIKeyService(&fakeAPIKeyRepo{}, fakeRoleUsers{})
+
+	key, err := s.Create(context.Background(), 1, "ci",
+		[]string{model.ScopeOrdersWrite, model.ScopeOrdersRead, model.ScopeOrdersWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{model.ScopeOrdersRead, model.ScopeOrdersWrite}
+	if strings.Join(key.Scopes, ",") != strings.Join(want, ",") {
+		t.Fatalf("Scopes = %v, want %v", key.Scopes, want)
+	}
+}
+
+func TestAPIKeyLimit(t *testing.T) {
+	repo := &fakeAPIKeyRepo{}
+	s := NewAPIKeyService(repo, fakeRoleUsers{})
+	ctx := context.Background()
+
+	for i := 0; i < maxAPIKeysPerUser; i++ {
+		if _, err := s.Create(ctx, 1, "ci", []string{model.ScopeOrdersRead}); err != nil {
+			t.Fatalf("key %d: %v", i+1, err)
+		}
+	}
+	if _, err := s.Create(ctx, 1, "ci", []string{model.ScopeOrdersRead}); !errors.Is(err, ErrAPIKeyLimitReached) {
+		t.Fatalf("key over limit: error = %v, want ErrAPIKeyLimitReached", err)
+	}
+	if len(repo.created) != maxAPIKeysPerUser {
+		t.Fatalf("stored %d keys, want %d", len(repo.created), maxAPIKeysPerUser)
+	}
+
+	// Отозванный ключ освобождает место.
+	repo.active--
+	if _, err := s.Create(ctx, 1, "ci", []string{model.ScopeOrdersRead}); err != nil {
+		t.Fatalf("key after revoke: %v", err)
+	}
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	const raw = apiKeyPrefix + "secret"
+	recent := time.Now().Add(-10 * time.Second)
+	stale := time.Now().Add(-2 * apiKeyTouchInterval)
+
+	tests := []struct {
+		name      string
+		key       string
+		lastUsed  *time.Time
+		wantErr   error
+		wantTouch bool
+	}{
+		{"never used", raw, nil, nil, true},
+		{"used long ago", raw, &stale, nil, true},
+		{"used recently", raw, &recent, nil, false},
+		{"wrong prefix", "xx_secret", nil, ErrInvalidAPIKey, false},
+		{"unknown key", apiKeyPrefix + "other", nil, ErrInvalidAPIKey, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAPIKeyRepo{byHash: map[string]*model.APIKey{
+				hashAPIKey(raw): {ID: 7, UserID: 1, Scopes: []string{model.ScopeOrdersRead}, LastUsedAt: tt.lastUsed},
+			}}
+			s := NewAPIKeyService(repo, fakeRoleUsers{})
+
+			key, err := s.Authenticate(context.Background(), tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && key.ID != 7 {
+				t.Fatalf("Authenticate() id = %d, want 7", key.ID)
+			}
+			if touched := len(repo.touched) > 0; touched != tt.wantTouch {
+				t.Fatalf("touched = %v, want %v", touched, tt.wantTouch)
+			}
+		})
+	}
+}
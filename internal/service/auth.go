@@ -2,9 +2,17 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -12,41 +20,134 @@ import (
 )
 
 var (
-	ErrUserAlreadyExists  = errors.New("user already exists")
-	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUserAlreadyExists    = errors.New("user already exists")
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrInvalidToken         = errors.New("invalid token")
+	ErrSessionRevoked       = errors.New("session revoked")
+	ErrInvalidRefreshToken  = errors.New("invalid refresh token")
+	ErrRefreshTokenReused   = errors.New("refresh token reused, session revoked")
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	errMalformedTokenClaims = errors.New("malformed token claims")
 )
 
+// TokenKeys подписывает access-токены и находит ключ для их проверки по kid.
+type TokenKeys interface {
+	Sign(claims jwt.Claims) (string, error)
+	Keyfunc(token *jwt.Token) (interface{}, error)
+}
+
+// ErrSecondFactorRequired возвращается из Login вместо токенов, если у аккаунта включена 2FA.
+// Challenge нужно обменять на токены через CompleteLogin вместе с кодом.
+type ErrSecondFactorRequired struct {
+	Challenge *model.LoginChallenge
+}
+
+func (e *ErrSecondFactorRequired) Error() string {
+	return "two-factor code required"
+}
+
+const (
+	challengeTokenType = "2fa_challenge"
+	challengeTokenTTL  = 5 * time.Minute
+)
+
+type AuthConfig struct {
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// SessionCacheTTL — как долго экземпляр доверяет последней проверке сессии в базе.
+	SessionCacheTTL time.Duration
+	// BcryptCost — стоимость хеширования новых паролей. Хеши с меньшей стоимостью
+	// пересчитываются при следующем успешном входе.
+	BcryptCost int
+}
+
 type AuthService interface {
-	Register(ctx context.Context, login, password string) (*model.User, string, error)
-	Login(ctx context.Context, login, password string) (*model.User, string, error)
-	ValidateToken(tokenString string) (int64, error)
+	Register(ctx context.Context, login, password string) (*model.User, *model.TokenPair, error)
+	Login(ctx context.Context, login, password, ip string) (*model.User, *model.TokenPair, error)
+	CompleteLogin(ctx context.Context, challengeToken, code, ip string) (*model.User, *model.TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string) (*model.TokenPair, error)
+	Logout(ctx context.Context, sessionID, refreshToken string) error
+	LogoutAll(ctx context.Context, userID int64) error
+	ChangePassword(ctx context.Context, userID int64, sessionID, currentPassword, newPassword, ip string) error
+	ValidateToken(ctx context.Context, tokenString string) (*model.TokenClaims, error)
+	PurgeExpiredSessions(ctx context.Context) (int64, error)
 }
 
 type authService struct {
-	userRepo     repository.UserRepository
-	jwtSecretKey string
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	outboxRepo  repository.OutboxRepository
+	uow         repository.UnitOfWork
+	limiter     LoginLimiter
+	passwords   *PasswordPolicy
+	auditRepo   repository.AuditRepository
+	twoFactor   TwoFactorService
+	keys        TokenKeys
+	cfg         AuthConfig
+	sessions    *sessionCache
 }
 
-func NewAuthService(userRepo repository.UserRepository, jwtSecret string) AuthService {
+func NewAuthService(
+	userRepo repository.UserRepository,
+	sessionRepo repository.SessionRepository,
+	outboxRepo repository.OutboxRepository,
+	uow repository.UnitOfWork,
+	limiter LoginLimiter,
+	passwords *PasswordPolicy,
+	auditRepo repository.AuditRepository,
+	twoFactor TwoFactorService,
+	keys TokenKeys,
+	cfg AuthConfig,
+) AuthService {
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = 15 * time.Minute
+	}
+	if cfg.RefreshTokenTTL <= 0 {
+		cfg.RefreshTokenTTL = 30 * 24 * time.Hour
+	}
+	if cfg.SessionCacheTTL <= 0 {
+		cfg.SessionCacheTTL = 30 * time.Second
+	}
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = bcrypt.DefaultCost
+	}
 
 	return &authService{
-		userRepo:     userRepo,
-		jwtSecretKey: jwtSecret,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		outboxRepo:  outboxRepo,
+		uow:         uow,
+		limiter:     limiter,
+		passwords:   passwords,
+		auditRepo:   auditRepo,
+		twoFactor:   twoFactor,
+		keys:        keys,
+		cfg:         cfg,
+		sessions:    newSessionCache(cfg.SessionCacheTTL),
 	}
 }
 
-func (s *authService) Register(ctx context.Context, login, password string) (*model.User, string, error) {
-	existingUser, err := s.userRepo.GetByLogin(ctx, login)
+func (s *authService) Register(ctx context.Context, login, password string) (*model.User, *model.TokenPair, error) {
+	requested := login
+	login = NormalizeLogin(login)
+	if err := ValidateLogin(login); err != nil {
+		return nil, nil, err
+	}
+	if err := s.passwords.Validate(login, password); err != nil {
+		return nil, nil, err
+	}
+
+	existingUser, err := FindUserByLogin(ctx, s.userRepo, requested)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 	if existingUser != nil {
-		return nil, "", ErrUserAlreadyExists
+		return nil, nil, ErrUserAlreadyExists
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), s.cfg.BcryptCost)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	user := &model.User{
@@ -54,64 +155,465 @@ func (s *authService) Register(ctx context.Context, login, password string) (*mo
 		PasswordHash: string(hashedPassword),
 	}
 
-	if err := s.userRepo.Create(ctx, user); err != nil {
-		return nil, "", err
+	var tokens *model.TokenPair
+	err = s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return err
+		}
+		if err := recordEvent(ctx, s.outboxRepo, model.EventUserRegistered, model.AggregateUser,
+			strconv.FormatInt(user.ID, 10), user.ID,
+			model.UserRegisteredPayload{Login: user.Login, CreatedAt: user.CreatedAt}); err != nil {
+			return err
+		}
+		tokens, err = s.startSession(ctx, user)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, tokens, nil
+}
+
+// Login проверяет пароль. Неудачные попытки учитываются по логину и по адресу клиента;
+// пока любой из них заблокирован, возвращается *ErrLoginLocked. Если у аккаунта
+// включена 2FA, вместо токенов возвращается *ErrSecondFactorRequired.
+func (s *authService) Login(ctx context.Context, login, password, ip string) (*model.User, *model.TokenPair, error) {
+	requested := login
+	login = NormalizeLogin(login)
+	if err := s.limiter.Check(ctx, login, ip); err != nil {
+		return nil, nil, err
+	}
+
+	user, err := FindUserByLogin(ctx, s.userRepo, requested)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		if err := s.limiter.RecordFailure(ctx, login, ip, nil); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		if err := s.limiter.RecordFailure(ctx, login, ip, &user.ID); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	if err := s.limiter.RecordSuccess(ctx, login); err != nil {
+		return nil, nil, err
+	}
+	s.upgradePasswordHash(ctx, user, password)
+
+	enabled, err := s.twoFactor.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if enabled {
+		challenge, err := s.issueChallenge(user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, &ErrSecondFactorRequired{Challenge: challenge}
 	}
 
-	token, err := s.generateToken(user.ID)
+	tokens, err := s.startSession(ctx, user)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
-	return user, token, nil
+	return user, tokens, nil
 }
 
-func (s *authService) Login(ctx context.Context, login, password string) (*model.User, string, error) {
-	user, err := s.userRepo.GetByLogin(ctx, login)
+// CompleteLogin завершает вход с 2FA: проверяет challenge-токен из Login и код
+// из приложения (или код восстановления). Неверный код считается неудачным входом.
+func (s *authService) CompleteLogin(ctx context.Context, challengeToken, code, ip string) (*model.User, *model.TokenPair, error) {
+	userID, err := s.parseChallenge(challengeToken)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
 	}
 	if user == nil {
-		return nil, "", ErrInvalidCredentials
+		return nil, nil, ErrInvalidToken
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, "", ErrInvalidCredentials
+	if err := s.limiter.Check(ctx, user.Login, ip); err != nil {
+		return nil, nil, err
+	}
+	if err := s.twoFactor.Verify(ctx, user.ID, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			if err := s.limiter.RecordFailure(ctx, user.Login, ip, &user.ID); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, nil, err
 	}
 
-	token, err := s.generateToken(user.ID)
+	tokens, err := s.startSession(ctx, user)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// Refresh обменивает refresh-токен на новую пару токенов. Старый refresh-токен после
+// этого недействителен; повторное предъявление уже заменённого токена считается
+// утечкой, и сессия отзывается целиком. Секрет, который сессии никогда не выдавался,
+// просто отклоняется: sid виден в access-токене, и по нему одному сессию не отозвать.
+func (s *authService) Refresh(ctx context.Context, refreshToken string) (*model.TokenPair, error) {
+	sessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return nil, ErrInvalidRefreshToken
 	}
 
-	return user, token, nil
+	var tokens *model.TokenPair
+	reused := false
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		session, err := s.sessionRepo.GetForUpdate(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+		if session == nil || session.RevokedAt != nil {
+			return ErrInvalidRefreshToken
+		}
+		if !time.Now().Before(session.ExpiresAt) {
+			return ErrRefreshTokenExpired
+		}
+
+		secretHash := hashRefreshSecret(secret)
+		if subtle.ConstantTimeCompare([]byte(session.RefreshTokenHash), []byte(secretHash)) != 1 {
+			rotated, err := s.sessionRepo.WasRotated(ctx, session.ID, secretHash)
+			if err != nil {
+				return err
+			}
+			if !rotated {
+				return ErrInvalidRefreshToken
+			}
+			// Отзыв должен сохраниться, поэтому транзакция завершается без ошибки.
+			reused = true
+			return s.sessionRepo.Revoke(ctx, session.ID)
+		}
+
+		newSecret, err := randomToken(32)
+		if err != nil {
+			return err
+		}
+		expiresAt := time.Now().Add(s.cfg.RefreshTokenTTL)
+		if err := s.sessionRepo.Rotate(ctx, session.ID, hashRefreshSecret(newSecret), expiresAt); err != nil {
+			return err
+		}
+
+		// Роль берётся из базы, а не из старого токена: изменение роли действует с ближайшего обновления.
+		user, err := s.userRepo.GetByID(ctx, session.UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrInvalidRefreshToken
+		}
+
+		tokens, err = s.issueTokens(user, session.ID, newSecret, expiresAt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		s.sessions.revoke(sessionID)
+		return nil, ErrRefreshTokenReused
+	}
+	return tokens, nil
 }
 
-func (s *authService) ValidateToken(tokenString string) (int64, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
+// Logout отзывает сессию sessionID, только если refreshToken — её действующий токен.
+func (s *authService) Logout(ctx context.Context, sessionID, refreshToken string) error {
+	tokenSessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || tokenSessionID != sessionID || secret == "" {
+		return ErrInvalidRefreshToken
+	}
+
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		session, err := s.sessionRepo.GetForUpdate(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+		if session == nil {
+			return ErrInvalidRefreshToken
+		}
+		if subtle.ConstantTimeCompare([]byte(session.RefreshTokenHash), []byte(hashRefreshSecret(secret))) != 1 {
+			return ErrInvalidRefreshToken
 		}
-		return []byte(s.jwtSecretKey), nil
+		return s.sessionRepo.Revoke(ctx, sessionID)
 	})
 	if err != nil {
-		return 0, err
+		return err
 	}
+	s.sessions.revoke(sessionID)
+	return nil
+}
+
+func (s *authService) LogoutAll(ctx context.Context, userID int64) error {
+	ids, err := s.sessionRepo.RevokeAll(ctx, userID, "")
+	if err != nil {
+		return err
+	}
+	s.sessions.revoke(ids...)
+	return nil
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID := int64(claims["user_id"].(float64))
-		return userID, nil
+// ChangePassword меняет пароль после проверки текущего и отзывает все сессии пользователя,
+// кроме той, из которой пришёл запрос. Неверный текущий пароль учитывается так же,
+// как неудачный вход.
+func (s *authService) ChangePassword(ctx context.Context, userID int64, sessionID, currentPassword, newPassword, ip string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrInvalidCredentials
 	}
 
-	return 0, jwt.ErrSignatureInvalid
+	if err := s.limiter.Check(ctx, user.Login, ip); err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+		if err := s.limiter.RecordFailure(ctx, user.Login, ip, &user.ID); err != nil {
+			return err
+		}
+		return ErrWrongPassword
+	}
+	if newPassword == currentPassword {
+		return ErrSamePassword
+	}
+	if err := s.passwords.Validate(user.Login, newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), s.cfg.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	var revoked []string
+	err = s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.UpdatePassword(ctx, user.ID, string(hashedPassword)); err != nil {
+			return err
+		}
+		revoked, err = s.sessionRepo.RevokeAll(ctx, user.ID, sessionID)
+		if err != nil {
+			return err
+		}
+		return s.auditRepo.Record(ctx, &model.AuditEntry{
+			Action: model.AuditPasswordChanged,
+			UserID: &user.ID,
+			Login:  user.Login,
+			IP:     ip,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	s.sessions.revoke(revoked...)
+	return nil
+}
+
+// ValidateToken проверяет подпись (ключом из заголовка kid) и срок access-токена,
+// а затем — что его сессия не отозвана.
+func (s *authService) ValidateToken(ctx context.Context, tokenString string) (*model.TokenClaims, error) {
+	token, err := jwt.Parse(tokenString, s.keys.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+
+	mapClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	claims, err := parseTokenClaims(mapClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	active, ok := s.sessions.get(claims.SessionID)
+	if !ok {
+		active, err = s.sessionRepo.IsActive(ctx, claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		s.sessions.set(claims.SessionID, active)
+	}
+	if !active {
+		return nil, ErrSessionRevoked
+	}
+
+	return claims, nil
+}
+
+// PurgeExpiredSessions удаляет сессии, refresh-токены которых истекли больше суток назад.
+func (s *authService) PurgeExpiredSessions(ctx context.Context) (int64, error) {
+	return s.sessionRepo.DeleteExpired(ctx, time.Now().Add(-24*time.Hour))
+}
+
+// upgradePasswordHash пересчитывает хеш, созданный с меньшей стоимостью, чем настроена сейчас.
+// Ошибка не мешает входу: хеш обновится при следующем.
+func (s *authService) upgradePasswordHash(ctx context.Context, user *model.User, password string) {
+	cost, err := bcrypt.Cost([]byte(user.PasswordHash))
+	if err != nil || cost >= s.cfg.BcryptCost {
+		return
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), s.cfg.BcryptCost)
+	if err != nil {
+		return
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, string(hashedPassword)); err == nil {
+		user.PasswordHash = string(hashedPassword)
+	}
 }
 
-func (s *authService) generateToken(userID int64) (string, error) {
+func (s *authService) startSession(ctx context.Context, user *model.User) (*model.TokenPair, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &model.Session{
+		ID:               sessionID,
+		UserID:           user.ID,
+		RefreshTokenHash: hashRefreshSecret(secret),
+		ExpiresAt:        time.Now().Add(s.cfg.RefreshTokenTTL),
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	s.sessions.set(session.ID, true)
+
+	return s.issueTokens(user, session.ID, secret, session.ExpiresAt)
+}
+
+func (s *authService) issueTokens(user *model.User, sessionID, refreshSecret string, refreshExpiresAt time.Time) (*model.TokenPair, error) {
+	accessToken, accessExpiresAt, err := s.generateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     sessionID + "." + refreshSecret,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+func (s *authService) generateToken(user *model.User, sessionID string) (string, time.Time, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.cfg.AccessTokenTTL)
 	claims := jwt.MapClaims{
+		"user_id": user.ID,
+		"sid":     sessionID,
+		"role":    user.Role,
+		"jti":     jti,
+		"iat":     now.Unix(),
+		"exp":     expiresAt.Unix(),
+	}
+
+	signed, err := s.keys.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+func (s *authService) issueChallenge(userID int64) (*model.LoginChallenge, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(challengeTokenTTL)
+	token, err := s.keys.Sign(jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"typ":     challengeTokenType,
+		"jti":     jti,
+		"iat":     now.Unix(),
+		"exp":     expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &model.LoginChallenge{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+func (s *authService) parseChallenge(tokenString string) (int64, error) {
+	token, err := jwt.Parse(tokenString, s.keys.Keyfunc)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["typ"] != challengeTokenType {
+		return 0, ErrInvalidToken
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, ErrInvalidToken
 	}
+	return int64(userID), nil
+}
+
+func parseTokenClaims(claims jwt.MapClaims) (*model.TokenClaims, error) {
+	// Challenge-токен 2FA подписан тем же ключом, но доступа к API не даёт.
+	if _, ok := claims["typ"]; ok {
+		return nil, ErrInvalidToken
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, errMalformedTokenClaims
+	}
+	sessionID, ok := claims["sid"].(string)
+	if !ok || sessionID == "" {
+		return nil, errMalformedTokenClaims
+	}
+	// В токенах, выданных до появления ролей, claim role нет.
+	role, _ := claims["role"].(string)
+	if role == "" {
+		role = model.RoleUser
+	}
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+
+	return &model.TokenClaims{
+		UserID:    int64(userID),
+		SessionID: sessionID,
+		Role:      role,
+		TokenID:   jti,
+		ExpiresAt: time.Unix(int64(exp), 0),
+	}, nil
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.jwtSecretKey))
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"testing"
+	"time"
+)
+
+// fakeSessionRepo держит одну сессию и историю её заменённых секретов.
+type fakeSessionRepo struct {
+	repository.SessionRepository
+
+	session *model.Session
+	rotated map[string]bool
+}
+
+func (f *fakeSessionRepo) GetForUpdate(_ context.Context, id string) (*model.Session, error) {
+	if f.session == nil || f.session.ID != id {
+		return nil, nil
+	}
+	return f.session, nil
+}
+
+func (f *fakeSessionRepo) WasRotated(_ context.Context, id, hash string) (bool, error) {
+	return f.session.ID == id && f.rotated[hash], nil
+}
+
+func (f *fakeSessionRepo) Revoke(_ context.Context, id string) error {
+	if f.session.ID == id {
+		now := time.Now()
+		f.session.RevokedAt = &now
+	}
+	return nil
+}
+
+func TestRefreshRevokesOnlyOnRotatedSecret(t *testing.T) {
+	tests := []struct {
+		name        string
+		secret      string
+		wantErr     error
+		wantRevoked bool
+	}{
+		{"unknown secret is rejected", "guessed", ErrInvalidRefreshToken, false},
+		{"rotated secret revokes session", "previous", ErrRefreshTokenReused, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := &fakeSessionRepo{
+				session: &model.Session{
+					ID:               "sid",
+					UserID:           1,
+					RefreshTokenHash: hashRefreshSecret("current"),
+					ExpiresAt:        time.Now().Add(time.Hour),
+				},
+				rotated: map[string]bool{hashRefreshSecret("previous"): true},
+			}
+			s := &authService{sessionRepo: sessions, uow: fakeUnitOfWork{}, sessions: newSessionCache(time.Minute)}
+
+			_, err := s.Refresh(context.Background(), "sid."+tt.secret)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Refresh error = %v, want %v", err, tt.wantErr)
+			}
+			if revoked := sessions.session.RevokedAt != nil; revoked != tt.wantRevoked {
+				t.Errorf("revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestLogoutRequiresCurrentRefreshSecret(t *testing.T) {
+	tests := []struct {
+		name        string
+		token       string
+		wantErr     error
+		wantRevoked bool
+	}{
+		{"current secret", "sid.current", nil, true},
+		{"other session", "other.current", ErrInvalidRefreshToken, false},
+		{"rotated secret", "sid.previous", ErrInvalidRefreshToken, false},
+		{"malformed", "sid", ErrInvalidRefreshToken, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := &fakeSessionRepo{
+				session: &model.Session{
+					ID:               "sid",
+					RefreshTokenHash: hashRefreshSecret("current"),
+					ExpiresAt:        time.Now().Add(time.Hour),
+				},
+				rotated: map[string]bool{hashRefreshSecret("previous"): true},
+			}
+			s := &authService{sessionRepo: sessions, uow: fakeUnitOfWork{}, sessions: newSessionCache(time.Minute)}
+
+			err := s.Logout(context.Background(), "sid", tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Logout error = %v, want %v", err, tt.wantErr)
+			}
+			if revoked := sessions.session.RevokedAt != nil; revoked != tt.wantRevoked {
+				t.Errorf("revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+}
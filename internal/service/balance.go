@@ -8,26 +8,50 @@ import (
 
 type BalanceService interface {
 	GetBalance(ctx context.Context, userID int64) (*model.UserBalance, error)
+	GetHistory(ctx context.Context, userID int64, filter model.ListFilter) (*model.Page[*model.LedgerEntry], error)
+	Reconcile(ctx context.Context) ([]*model.BalanceMismatch, error)
 }
 
 type balanceService struct {
 	userRepo     repository.UserRepository
 	orderRepo    repository.OrderRepository
 	withdrawRepo repository.WithdrawalRepository
+	ledgerRepo   repository.LedgerRepository
+	expiry       ExpiryService
 }
 
 func NewBalanceService(
 	userRepo repository.UserRepository,
 	orderRepo repository.OrderRepository,
 	withdrawRepo repository.WithdrawalRepository,
+	ledgerRepo repository.LedgerRepository,
+	expiry ExpiryService,
 ) BalanceService {
 	return &balanceService{
 		userRepo:     userRepo,
 		orderRepo:    orderRepo,
 		withdrawRepo: withdrawRepo,
+		ledgerRepo:   ledgerRepo,
+		expiry:       expiry,
 	}
 }
 
 func (s *balanceService) GetBalance(ctx context.Context, userID int64) (*model.UserBalance, error) {
-	return s.userRepo.GetBalance(ctx, userID)
+	balance, err := s.userRepo.GetBalance(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	balance.ExpiringSoon, err = s.expiry.ExpiringSoon(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return balance, nil
+}
+
+func (s *balanceService) GetHistory(ctx context.Context, userID int64, filter model.ListFilter) (*model.Page[*model.LedgerEntry], error) {
+	return s.ledgerRepo.GetUserEntries(ctx, userID, filter)
+}
+
+func (s *balanceService) Reconcile(ctx context.Context) ([]*model.BalanceMismatch, error) {
+	return s.ledgerRepo.Reconcile(ctx)
 }
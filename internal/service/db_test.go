@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"os"
+	"testing"
+	"time"
+)
+
+// openTestDB подключается к PostgreSQL из TEST_DATABASE_URI и применяет миграции.
+// Без переменной тесты, которым нужна настоящая база, пропускаются.
+func openTestDB(t *testing.T) *repository.Database {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+	db, err := repository.NewDatabase(repository.DatabaseConfig{DSN: dsn, MigrationsPath: "../../migrations"})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createTestUser заводит пользователя с уникальным логином, чтобы тесты не мешали друг другу.
+func createTestUser(t *testing.T, db *repository.Database) *model.User {
+	t.Helper()
+	user := &model.User{Login: fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano()), PasswordHash: "x"}
+	if err := repository.NewUserRepository(db).Create(context.Background(), user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/events"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"time"
+)
+
+const eventRelayBatchSize = 500
+
+type EventRelay interface {
+	// Relay публикует очередную пачку событий outbox и возвращает их число.
+	Relay(ctx context.Context) (int, error)
+	// Purge удаляет опубликованные события старше срока хранения и возвращает их число.
+	Purge(ctx context.Context) (int64, error)
+}
+
+type eventRelay struct {
+	outboxRepo repository.OutboxRepository
+	uow        repository.UnitOfWork
+	publisher  events.Publisher
+	retention  time.Duration
+}
+
+// NewEventRelay создаёт ретранслятор. Без публикатора (publisher == nil) события
+// остаются в outbox неопубликованными и удаляются по истечении срока хранения.
+func NewEventRelay(
+	outboxRepo repository.OutboxRepository,
+	uow repository.UnitOfWork,
+	publisher events.Publisher,
+	retention time.Duration,
+) EventRelay {
+	return &eventRelay{
+		outboxRepo: outboxRepo,
+		uow:        uow,
+		publisher:  publisher,
+		retention:  retention,
+	}
+}
+
+// Relay держит строки пачки заблокированными, пока публикатор их не примет, поэтому
+// экземпляры не публикуют одно событие одновременно. Если отметка о публикации не
+// сохранится, пачка уйдёт повторно — доставка «как минимум один раз».
+func (r *eventRelay) Relay(ctx context.Context) (int, error) {
+	if r.publisher == nil {
+		return 0, nil
+	}
+
+	published := 0
+	err := r.uow.WithinTx(ctx, func(ctx context.Context) error {
+		batch, err := r.outboxRepo.ClaimUnpublished(ctx, eventRelayBatchSize)
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+
+		if err := r.publisher.Publish(ctx, batch); err != nil {
+			return fmt.Errorf("failed to publish events: %w", err)
+		}
+
+		ids := make([]int64, len(batch))
+		for i, event := range batch {
+			ids[i] = event.ID
+		}
+		if err := r.outboxRepo.MarkPublished(ctx, ids); err != nil {
+			return err
+		}
+
+		published = len(batch)
+		return nil
+	})
+	return published, err
+}
+
+func (r *eventRelay) Purge(ctx context.Context) (int64, error) {
+	before := time.Now().Add(-r.retention)
+	if r.publisher == nil {
+		return r.outboxRepo.PurgeRecorded(ctx, before)
+	}
+	return r.outboxRepo.PurgePublished(ctx, before)
+}
+
+// recordEvent пишет доменное событие в outbox в транзакции, которую несёт ctx.
+func recordEvent(
+	ctx context.Context,
+	outboxRepo repository.OutboxRepository,
+	eventType, aggregateType, aggregateID string,
+	userID int64,
+	payload any,
+) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	return outboxRepo.Add(ctx, &model.DomainEvent{
+		Type:          eventType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		UserID:        userID,
+		Payload:       data,
+	})
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeRelayOutbox отдаёт неопубликованные события по порядку и запоминает, какие
+// отмечены опубликованными и какой вызов очистки пришёл.
+type fakeRelayOutbox struct {
+	repository.OutboxRepository
+	pending   []*model.DomainEvent
+	published []int64
+	purged    string
+	before    time.Time
+}
+
+func (f *fakeRelayOutbox) ClaimUnpublished(_ context.Context, limit int) ([]*model.DomainEvent, error) {
+	var batch []*model.DomainEvent
+	for _, event := range f.pending {
+		if !slices.Contains(f.published, event.ID) && len(batch) < limit {
+			batch = append(batch, event)
+		}
+	}
+	return batch, nil
+}
+
+func (f *fakeRelayOutbox) MarkPublished(_ context.Context, ids []int64) error {
+	f.published = append(f.published, ids...)
+	return nil
+}
+
+func (f *fakeRelayOutbox) PurgePublished(_ context.Context, before time.Time) (int64, error) {
+	f.purged, f.before = "published", before
+	return 0, nil
+}
+
+func (f *fakeRelayOutbox) PurgeRecorded(_ context.Context, before time.Time) (int64, error) {
+	f.purged, f.before = "recorded", before
+	return 0, nil
+}
+
+type fakePublisher struct {
+	batches [][]*model.DomainEvent
+	err     error
+}
+
+func (p *fakePublisher) Publish(_ context.Context, events []*model.DomainEvent) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.batches = append(p.batches, events)
+	return nil
+}
+
+func (p *fakePublisher) Close() error {
+	return nil
+}
+
+func domainEvents(n int) []*model.DomainEvent {
+	events := make([]*model.DomainEvent, n)
+	for i := range events {
+		events[i] = &model.DomainEvent{ID: int64(i + 1), Type: model.EventOrderUploaded}
+	}
+	return events
+}
+
+func TestRelayPublishesInBatchesAndMarksPublished(t *testing.T) {
+	outbox := &fakeRelayOutbox{pending: domainEvents(eventRelayBatchSize + 1)}
+	publisher := &fakePublisher{}
+	relay := NewEventRelay(outbox, fakeUnitOfWork{}, publisher, time.Hour)
+	ctx := context.Background()
+
+	for _, want := range []int{eventRelayBatchSize, 1, 0} {
+		n, err := relay.Relay(ctx)
+		if err != nil {
+			t.Fatalf("relay: %v", err)
+		}
+		if n != want {
+			t.Fatalf("relayed %d events, want %d", n, want)
+		}
+	}
+
+	if len(publisher.batches) != 2 {
+		t.Fatalf("published %d batches, want 2", len(publisher.batches))
+	}
+	if len(outbox.published) != eventRelayBatchSize+1 {
+		t.Errorf("marked %d events published, want %d", len(outbox.published), eventRelayBatchSize+1)
+	}
+	if first := publisher.batches[0][0].ID; first != 1 {
+		t.Errorf("first published event %d, want 1", first)
+	}
+}
+
+func TestRelayLeavesBatchUnpublishedOnPublisherError(t *testing.T) {
+	outbox := &fakeRelayOutbox{pending: domainEvents(3)}
+	relay := NewEventRelay(outbox, fakeUnitOfWork{}, &fakePublisher{err: errors.New("sink is down")}, time.Hour)
+
+	if _, err := relay.Relay(context.Background()); err == nil {
+		t.Fatal("relay succeeded with a failing publisher")
+	}
+	if len(outbox.published) != 0 {
+		t.Errorf("marked %v published after a failed publish", outbox.published)
+	}
+}
+
+func TestRelayWithoutPublisherKeepsEventsAndPurgesByAge(t *testing.T) {
+	outbox := &fakeRelayOutbox{pending: domainEvents(3)}
+	relay := NewEventRelay(outbox, fakeUnitOfWork{}, nil, 24*time.Hour)
+	ctx := context.Background()
+
+	n, err := relay.Relay(ctx)
+	if err != nil || n != 0 {
+		t.Fatalf("relay without publisher = %d, %v; want 0, nil", n, err)
+	}
+	if len(outbox.published) != 0 {
+		t.Errorf("events marked published without a publisher: %v", outbox.published)
+	}
+
+	if _, err := relay.Purge(ctx); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if outbox.purged != "recorded" {
+		t.Errorf("purge without publisher used %q, want recorded", outbox.purged)
+	}
+	if age := time.Since(outbox.before); age < 24*time.Hour || age > 25*time.Hour {
+		t.Errorf("purge cutoff %v ago, want the retention", age)
+	}
+}
+
+func TestRelayPurgesOnlyPublishedWithPublisher(t *testing.T) {
+	outbox := &fakeRelayOutbox{}
+	relay := NewEventRelay(outbox, fakeUnitOfWork{}, &fakePublisher{}, time.Hour)
+
+	if _, err := relay.Purge(context.Background()); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if outbox.purged != "published" {
+		t.Errorf("purge with publisher used %q, want published", outbox.purged)
+	}
+}
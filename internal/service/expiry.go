@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"strconv"
+	"time"
+)
+
+const expiryBatchSize = 100
+
+type PointsExpiryConfig struct {
+	// Months — через сколько месяцев после зачисления баллы сгорают; 0 — не сгорают.
+	Months int
+	// Window — горизонт, за который GET /api/user/balance предупреждает о сгорании.
+	Window time.Duration
+}
+
+// ExpiryService ведёт лоты начислений. Credit и Consume вызываются в транзакции,
+// меняющей баланс, после блокировки строки пользователя, и держат сумму лотов
+// равной users.balance.
+type ExpiryService interface {
+	// Credit заводит лот на зачисленную сумму; kind — вид проводки журнала.
+	Credit(ctx context.Context, userID int64, kind, orderNumber string, amount model.Money) error
+	// Consume расходует amount с самых старых лотов.
+	Consume(ctx context.Context, userID int64, amount model.Money) error
+	// ConsumeWithdrawal расходует лоты, как Consume, и запоминает их за списанием.
+	ConsumeWithdrawal(ctx context.Context, userID, withdrawalID int64, amount model.Money) error
+	// Restore возвращает amount по списанию в израсходованные им лоты с их прежними сроками.
+	// Часть, для которой расходы не записаны (списания до учёта расходов), зачисляется новым лотом.
+	Restore(ctx context.Context, userID, withdrawalID int64, orderNumber string, amount model.Money) error
+	// ApplyOpeningExpiry назначает перенесённым остаткам (лотам OPENING) срок по текущей политике.
+	ApplyOpeningExpiry(ctx context.Context) (int64, error)
+	ExpiringSoon(ctx context.Context, userID int64) ([]*model.ExpiringPoints, error)
+	// ExpireDue списывает сгоревшие баллы и возвращает число затронутых пользователей.
+	ExpireDue(ctx context.Context) (int, error)
+}
+
+type expiryService struct {
+	lotRepo    repository.AccrualLotRepository
+	userRepo   repository.UserRepository
+	ledgerRepo repository.LedgerRepository
+	outboxRepo repository.OutboxRepository
+	uow        repository.UnitOfWork
+	cfg        PointsExpiryConfig
+}
+
+func NewExpiryService(
+	lotRepo repository.AccrualLotRepository,
+	userRepo repository.UserRepository,
+	ledgerRepo repository.LedgerRepository,
+	outboxRepo repository.OutboxRepository,
+	uow repository.UnitOfWork,
+	cfg PointsExpiryConfig,
+) ExpiryService {
+	if cfg.Window <= 0 {
+		cfg.Window = 30 * 24 * time.Hour
+	}
+	return &expiryService{
+		lotRepo:    lotRepo,
+		userRepo:   userRepo,
+		ledgerRepo: ledgerRepo,
+		outboxRepo: outboxRepo,
+		uow:        uow,
+		cfg:        cfg,
+	}
+}
+
+func (s *expiryService) Credit(ctx context.Context, userID int64, kind, orderNumber string, amount model.Money) error {
+	if amount <= 0 {
+		return nil
+	}
+	lot := &model.AccrualLot{
+		UserID:      userID,
+		Kind:        kind,
+		OrderNumber: orderNumber,
+		Amount:      amount,
+	}
+	if s.cfg.Months > 0 {
+		expiresAt := time.Now().AddDate(0, s.cfg.Months, 0)
+		lot.ExpiresAt = &expiresAt
+	}
+	return s.lotRepo.Create(ctx, lot)
+}
+
+// Consume не отказывает, если лотов не хватает: баланс уже проверен вызывающим,
+// а расхождение лотов с балансом не должно блокировать списание.
+func (s *expiryService) Consume(ctx context.Context, userID int64, amount model.Money) error {
+	return s.consume(ctx, userID, 0, amount)
+}
+
+func (s *expiryService) ConsumeWithdrawal(ctx context.Context, userID, withdrawalID int64, amount model.Money) error {
+	return s.consume(ctx, userID, withdrawalID, amount)
+}
+
+func (s *expiryService) consume(ctx context.Context, userID, withdrawalID int64, amount model.Money) error {
+	lots, err := s.lotRepo.GetOpenForUpdate(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, lot := range lots {
+		if amount <= 0 {
+			break
+		}
+		taken := min(lot.Remaining, amount)
+		lot.Remaining -= taken
+		amount -= taken
+		if err := s.lotRepo.Update(ctx, lot); err != nil {
+			return err
+		}
+		if withdrawalID != 0 {
+			if err := s.lotRepo.AddConsumption(ctx, &model.LotConsumption{
+				LotID:        lot.ID,
+				WithdrawalID: withdrawalID,
+				Amount:       taken,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Restore заполняет сначала лоты, израсходованные последними. Если срок лота уже прошёл,
+// возвращённые баллы сгорят при следующем проходе ExpireDue.
+func (s *expiryService) Restore(ctx context.Context, userID, withdrawalID int64, orderNumber string, amount model.Money) error {
+	consumptions, err := s.lotRepo.GetConsumptionsForUpdate(ctx, withdrawalID)
+	if err != nil {
+		return err
+	}
+	for _, consumption := range consumptions {
+		if amount <= 0 {
+			return nil
+		}
+		restored := min(consumption.Amount-consumption.Restored, amount)
+		if err := s.lotRepo.Restore(ctx, consumption, restored); err != nil {
+			return err
+		}
+		amount -= restored
+	}
+	return s.Credit(ctx, userID, model.LedgerKindReversal, orderNumber, amount)
+}
+
+func (s *expiryService) ApplyOpeningExpiry(ctx context.Context) (int64, error) {
+	if s.cfg.Months <= 0 {
+		return 0, nil
+	}
+	return s.lotRepo.SetOpeningExpiry(ctx, s.cfg.Months)
+}
+
+func (s *expiryService) ExpiringSoon(ctx context.Context, userID int64) ([]*model.ExpiringPoints, error) {
+	return s.lotRepo.Expiring(ctx, userID, time.Now().Add(s.cfg.Window))
+}
+
+func (s *expiryService) ExpireDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	expired := 0
+	var after int64
+	for {
+		userIDs, err := s.lotRepo.DueUsers(ctx, now, after, expiryBatchSize)
+		if err != nil {
+			return expired, err
+		}
+		for _, userID := range userIDs {
+			sum, err := s.expireUser(ctx, userID, now)
+			if err != nil {
+				return expired, fmt.Errorf("failed to expire points of user %d: %w", userID, err)
+			}
+			if sum > 0 {
+				expired++
+			}
+			after = userID
+		}
+		if len(userIDs) < expiryBatchSize {
+			return expired, nil
+		}
+	}
+}
+
+// expireUser списывает сгоревшие лоты пользователя одной проводкой EXPIRY. Зарезервированные
+// баллы не сгорают, пока резерв активен: списывается не больше доступного остатка,
+// а недогоревшая часть лота сгорит при следующем проходе.
+func (s *expiryService) expireUser(ctx context.Context, userID int64, now time.Time) (model.Money, error) {
+	var total model.Money
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		balance, err := s.userRepo.GetBalanceForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+		lots, err := s.lotRepo.GetDueForUpdate(ctx, userID, now)
+		if err != nil {
+			return err
+		}
+
+		for _, lot := range lots {
+			amount := min(lot.Remaining, balance.Available-total)
+			if amount <= 0 {
+				break
+			}
+			lot.Remaining -= amount
+			lot.Expired += amount
+			total += amount
+			if err := s.lotRepo.Update(ctx, lot); err != nil {
+				return err
+			}
+		}
+		if total == 0 {
+			return nil
+		}
+
+		if err := s.userRepo.UpdateBalance(ctx, userID, -total); err != nil {
+			return err
+		}
+		if err := s.ledgerRepo.Post(ctx, &model.LedgerPosting{
+			UserID:         userID,
+			Amount:         -total,
+			Kind:           model.LedgerKindExpiry,
+			CounterAccount: model.LedgerAccountExpiry,
+			Description:    "points expired",
+		}); err != nil {
+			return fmt.Errorf("failed to record expiry in ledger: %w", err)
+		}
+		return recordEvent(ctx, s.outboxRepo, model.EventPointsExpired, model.AggregateUser,
+			strconv.FormatInt(userID, 10), userID, model.PointsExpiredPayload{Sum: total, ExpiredAt: now})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestApplyOpeningExpiry(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	lotRepo := repository.NewAccrualLotRepository(db)
+	opening := &model.AccrualLot{UserID: user.ID, Kind: model.LotKindOpening, Amount: 10000}
+	if err := lotRepo.Create(ctx, opening); err != nil {
+		t.Fatal(err)
+	}
+
+	expiry := NewExpiryService(lotRepo, nil, nil, nil, nil, PointsExpiryConfig{Months: 12})
+	if _, err := expiry.ApplyOpeningExpiry(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	lots, err := lotRepo.GetOpenForUpdate(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lots) != 1 || lots[0].ExpiresAt == nil {
+		t.Fatalf("opening lot has no expiry: %+v", lots)
+	}
+	// Месяцы в Postgres и Go считаются в разных часовых поясах, поэтому сверяем с точностью до суток.
+	want := opening.CreatedAt.AddDate(0, 12, 0)
+	if diff := lots[0].ExpiresAt.Sub(want); diff < -24*time.Hour || diff > 24*time.Hour {
+		t.Errorf("expires_at = %v, want about %v", lots[0].ExpiresAt, want)
+	}
+}
+
+func TestReversalRestoresOriginalLots(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+	staff := createTestUser(t, db)
+	ctx := context.Background()
+
+	credit := newCreditTestService(db, repository.NewLedgerRepository(db))
+	credit.completeOrder(ctx, createTestOrder(t, db, user.ID), 10000)
+
+	lotRepo := repository.NewAccrualLotRepository(db)
+	before, err := lotRepo.GetOpenForUpdate(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newWithdrawalTestService(db, WithdrawalConfig{ReversalApprovalThreshold: 100000})
+	order := luhnNumber(fmt.Sprint(time.Now().UnixNano()))
+	if err := s.Withdraw(ctx, user.ID, order, 6000, ""); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	actor := model.AdminActor{UserID: staff.ID, Role: model.RoleSupport}
+	if _, err := s.Reverse(ctx, actor, order, 0, "Cancelled"); err != nil {
+		t.Fatalf("reverse: %v", err)
+	}
+
+	after, err := lotRepo.GetOpenForUpdate(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("lots after reversal = %d, want %d: reversal created a new lot", len(after), len(before))
+	}
+	for i := range after {
+		if after[i].ID != before[i].ID || after[i].Remaining != before[i].Remaining {
+			t.Errorf("lot %d = %s remaining, want %s", after[i].ID, after[i].Remaining, before[i].Remaining)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"sync"
+	"time"
+)
+
+// Подделки для тестов без базы. Встроенный интерфейс оставлен nil: вызов метода,
+// который тест не подменил, паникует и этим показывает лишнее обращение к хранилищу.
+
+type fakeUnitOfWork struct{}
+
+func (fakeUnitOfWork) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+type fakeOutbox struct {
+	repository.OutboxRepository
+
+	mu     sync.Mutex
+	events []*model.DomainEvent
+}
+
+func (f *fakeOutbox) Add(_ context.Context, event *model.DomainEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return nil
+}
+
+type fakeWebhooks struct {
+	WebhookService
+}
+
+func (fakeWebhooks) Notify(context.Context, int64, string, any) error {
+	return nil
+}
+
+type fakeOrderRepo struct {
+	repository.OrderRepository
+
+	mu       sync.Mutex
+	statuses map[string]string
+	polled   map[string]int
+	// queue — заказы, которые отдаст следующий ClaimOrders.
+	queue []*model.Order
+}
+
+func newFakeOrderRepo() *fakeOrderRepo {
+	return &fakeOrderRepo{statuses: make(map[string]string), polled: make(map[string]int)}
+}
+
+func (f *fakeOrderRepo) MarkPolled(_ context.Context, number string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.polled[number]++
+	return nil
+}
+
+func (f *fakeOrderRepo) UpdateStatus(_ context.Context, number, status string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.statuses[number] == status {
+		return false, nil
+	}
+	f.statuses[number] = status
+	return true, nil
+}
+
+func (f *fakeOrderRepo) AddStatusHistory(context.Context, string, string, model.Money) error {
+	return nil
+}
+
+func (f *fakeOrderRepo) ClaimOrders(_ context.Context, _ string, limit int, _ time.Duration) ([]*model.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := min(limit, len(f.queue))
+	claimed := f.queue[:n]
+	f.queue = f.queue[n:]
+	return claimed, nil
+}
+
+func (f *fakeOrderRepo) RenewLeases(context.Context, string, []string, time.Duration) error {
+	return nil
+}
+
+func (f *fakeOrderRepo) ReleaseLeases(context.Context, string, []string) error {
+	return nil
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/util/luhn"
+	"time"
+)
+
+const (
+	minHoldTTL     = time.Minute
+	maxHoldTTL     = 24 * time.Hour
+	holdSweepBatch = 100
+)
+
+var (
+	ErrHoldNotFound        = errors.New("hold not found")
+	ErrHoldNotActive       = errors.New("hold is not active")
+	ErrHoldExpired         = errors.New("hold expired")
+	ErrHoldOrderExists     = errors.New("order already has an active hold")
+	ErrHoldInvalidTTL      = errors.New("hold ttl must be between 1 minute and 24 hours")
+	ErrHoldCaptureTooLarge = errors.New("capture exceeds the held sum")
+)
+
+// Hold резервирует баллы: баланс не меняется, но зарезервированная сумма недоступна
+// для других списаний и резервов. Код 2FA для крупных сумм проверяется здесь, а не при capture.
+func (s *withdrawalService) Hold(ctx context.Context, userID int64, orderNumber string, sum model.Money, ttl time.Duration, code string) (*model.Hold, error) {
+	if !luhn.Validate(orderNumber) {
+		return nil, ErrWithdrawalInvalidOrderNumber
+	}
+	if sum <= 0 {
+		return nil, ErrWithdrawalInvalidSum
+	}
+	if ttl == 0 {
+		ttl = s.cfg.HoldTTL
+	}
+	if ttl < minHoldTTL || ttl > maxHoldTTL {
+		return nil, ErrHoldInvalidTTL
+	}
+
+	hold := &model.Hold{
+		UserID:    userID,
+		Order:     orderNumber,
+		Amount:    sum,
+		Status:    model.HoldActive,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.verifySecondFactor(ctx, userID, sum, code); err != nil {
+			return err
+		}
+
+		balance, err := s.userRepo.GetBalanceForUpdate(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get balance: %w", err)
+		}
+		if balance.Available < sum {
+			return ErrWithdrawalInsufficientFunds
+		}
+
+		if err := s.withdrawalRepo.LockOrder(ctx, orderNumber); err != nil {
+			return err
+		}
+		existing, err := s.withdrawalRepo.GetByOrderForUpdate(ctx, orderNumber)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return ErrWithdrawalOrderAlreadyUsed
+		}
+
+		if err := s.holdRepo.Create(ctx, hold); err != nil {
+			if errors.Is(err, repository.ErrHoldOrderExists) {
+				return ErrHoldOrderExists
+			}
+			return err
+		}
+		return s.userRepo.UpdateHeld(ctx, userID, sum)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+func (s *withdrawalService) GetHolds(ctx context.Context, userID int64) ([]*model.Hold, error) {
+	return s.holdRepo.GetActive(ctx, userID)
+}
+
+// Capture списывает зарезервированные баллы. Списание сразу COMPLETED: оплата
+// у партнёра уже подтверждена, раз он пришёл за резервом.
+func (s *withdrawalService) Capture(ctx context.Context, userID, holdID int64, sum model.Money) (*model.Withdrawal, error) {
+	if sum < 0 {
+		return nil, ErrWithdrawalInvalidSum
+	}
+
+	var withdrawal *model.Withdrawal
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		hold, err := s.lockActiveHold(ctx, userID, holdID)
+		if err != nil {
+			return err
+		}
+		if !time.Now().Before(hold.ExpiresAt) {
+			return ErrHoldExpired
+		}
+		if sum == 0 {
+			sum = hold.Amount
+		}
+		if sum > hold.Amount {
+			return ErrHoldCaptureTooLarge
+		}
+
+		if _, err := s.userRepo.GetBalanceForUpdate(ctx, userID); err != nil {
+			return fmt.Errorf("failed to get balance: %w", err)
+		}
+		if err := s.userRepo.UpdateHeld(ctx, userID, -hold.Amount); err != nil {
+			return err
+		}
+		withdrawal, err = s.debit(ctx, userID, hold.Order, sum, model.WithdrawalCompleted)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		hold.Status = model.HoldCaptured
+		hold.ResolvedAt = &now
+		hold.WithdrawalID = &withdrawal.ID
+		return s.holdRepo.Resolve(ctx, hold)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return withdrawal, nil
+}
+
+func (s *withdrawalService) Release(ctx context.Context, userID, holdID int64) error {
+	return s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		hold, err := s.lockActiveHold(ctx, userID, holdID)
+		if err != nil {
+			return err
+		}
+		return s.releaseHold(ctx, hold, model.HoldReleased)
+	})
+}
+
+func (s *withdrawalService) ReleaseExpiredHolds(ctx context.Context) (int, error) {
+	released := 0
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		holds, err := s.holdRepo.ClaimExpired(ctx, holdSweepBatch)
+		if err != nil {
+			return err
+		}
+		for _, hold := range holds {
+			if err := s.releaseHold(ctx, hold, model.HoldExpired); err != nil {
+				return err
+			}
+		}
+		released = len(holds)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return released, nil
+}
+
+func (s *withdrawalService) lockActiveHold(ctx context.Context, userID, holdID int64) (*model.Hold, error) {
+	hold, err := s.holdRepo.GetForUpdate(ctx, userID, holdID)
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, ErrHoldNotFound
+	}
+	if hold.Status != model.HoldActive {
+		return nil, ErrHoldNotActive
+	}
+	return hold, nil
+}
+
+func (s *withdrawalService) releaseHold(ctx context.Context, hold *model.Hold, status string) error {
+	if err := s.userRepo.UpdateHeld(ctx, hold.UserID, -hold.Amount); err != nil {
+		return err
+	}
+	now := time.Now()
+	hold.Status = status
+	hold.ResolvedAt = &now
+	return s.holdRepo.Resolve(ctx, hold)
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"time"
+)
+
+const (
+	idempotencyKeyTTL = 24 * time.Hour
+	// idempotencyKeyLease — сколько ключ может оставаться «в работе». Запрос не длится
+	// дольше минуты, так что незавершённый ключ старше этого остался от упавшего процесса;
+	// повтор всё равно защищён уникальностью номера заказа в списаниях.
+	idempotencyKeyLease = time.Minute
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is still in progress")
+)
+
+type IdempotencyService interface {
+	// Begin возвращает сохранённый ответ (record.Completed()), если запрос с этим ключом
+	// уже выполнен, или резервацию ключа: запрос нужно выполнить и передать её в Complete либо Abort.
+	Begin(ctx context.Context, userID int64, key, requestHash string) (*model.IdempotencyRecord, error)
+	Complete(ctx context.Context, reservation *model.IdempotencyRecord, statusCode int, body []byte) error
+	Abort(ctx context.Context, reservation *model.IdempotencyRecord) error
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type idempotencyService struct {
+	repo repository.IdempotencyRepository
+}
+
+func NewIdempotencyService(repo repository.IdempotencyRepository) IdempotencyService {
+	return &idempotencyService{repo: repo}
+}
+
+func (s *idempotencyService) Begin(ctx context.Context, userID int64, key, requestHash string) (*model.IdempotencyRecord, error) {
+	record, reserved, err := s.repo.Reserve(ctx, userID, key, requestHash, idempotencyKeyTTL, idempotencyKeyLease)
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return record, nil
+	}
+
+	if record.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !record.Completed() {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return record, nil
+}
+
+func (s *idempotencyService) Complete(ctx context.Context, reservation *model.IdempotencyRecord, statusCode int, body []byte) error {
+	return s.repo.Complete(ctx, reservation, statusCode, body)
+}
+
+func (s *idempotencyService) Abort(ctx context.Context, reservation *model.IdempotencyRecord) error {
+	return s.repo.Delete(ctx, reservation)
+}
+
+// PurgeExpired удаляет ключи старше idempotencyKeyTTL: после этого Reserve всё равно
+// считает их свободными.
+func (s *idempotencyService) PurgeExpired(ctx context.Context) (int64, error) {
+	return s.repo.DeleteExpired(ctx, time.Now().Add(-idempotencyKeyTTL))
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"testing"
+	"time"
+)
+
+// fakeIdempotencyRepo хранит ключи в памяти; аренда и срок жизни в нём не истекают.
+type fakeIdempotencyRepo struct {
+	repository.IdempotencyRepository
+	records map[string]*model.IdempotencyRecord
+}
+
+func newFakeIdempotencyRepo() *fakeIdempotencyRepo {
+	return &fakeIdempotencyRepo{records: map[string]*model.IdempotencyRecord{}}
+}
+
+func (f *fakeIdempotencyRepo) Reserve(_ context.Context, userID int64, key, requestHash string, _, _ time.Duration) (*model.IdempotencyRecord, bool, error) {
+	if existing, ok := f.records[key]; ok {
+		copied := *existing
+		return &copied, false, nil
+	}
+	record := &model.IdempotencyRecord{UserID: userID, Key: key, RequestHash: requestHash, CreatedAt: time.Now()}
+	f.records[key] = record
+	copied := *record
+	return &copied, true, nil
+}
+
+func (f *fakeIdempotencyRepo) Complete(_ context.Context, reservation *model.IdempotencyRecord, statusCode int, body []byte) error {
+	record, ok := f.records[reservation.Key]
+	if !ok || !record.CreatedAt.Equal(reservation.CreatedAt) {
+		return repository.ErrIdempotencyLeaseLost
+	}
+	record.StatusCode, record.ResponseBody = statusCode, body
+	return nil
+}
+
+func (f *fakeIdempotencyRepo) Delete(_ context.Context, reservation *model.IdempotencyRecord) error {
+	if record, ok := f.records[reservation.Key]; ok && record.CreatedAt.Equal(reservation.CreatedAt) {
+		delete(f.records, reservation.Key)
+	}
+	return nil
+}
+
+func TestIdempotencyReplaysCompletedRequest(t *testing.T) {
+	svc := NewIdempotencyService(newFakeIdempotencyRepo())
+	ctx := context.Background()
+
+	reservation, err := svc.Begin(ctx, 1, "key", "hash")
+	if err != nil || reservation.Completed() {
+		t.Fatalf("first begin: record = %+v, err = %v; want a fresh reservation", reservation, err)
+	}
+
+	if _, err := svc.Begin(ctx, 1, "key", "hash"); !errors.Is(err, ErrIdempotencyKeyInProgress) {
+		t.Errorf("begin while in progress: err = %v, want ErrIdempotencyKeyInProgress", err)
+	}
+
+	if err := svc.Complete(ctx, reservation, 200, []byte("ok")); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	replay, err := svc.Begin(ctx, 1, "key", "hash")
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if !replay.Completed() || replay.StatusCode != 200 || string(replay.ResponseBody) != "ok" {
+		t.Errorf("replay = %d %q, want stored 200 ok", replay.StatusCode, replay.ResponseBody)
+	}
+}
+
+func TestIdempotencyRejectsKeyReuseWithDifferentBody(t *testing.T) {
+	svc := NewIdempotencyService(newFakeIdempotencyRepo())
+	ctx := context.Background()
+
+	reservation, err := svc.Begin(ctx, 1, "key", "hash")
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := svc.Complete(ctx, reservation, 200, []byte("ok")); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	if _, err := svc.Begin(ctx, 1, "key", "other-hash"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("begin with different body: err = %v, want ErrIdempotencyKeyReused", err)
+	}
+}
+
+func TestIdempotencyAbortFreesKey(t *testing.T) {
+	svc := NewIdempotencyService(newFakeIdempotencyRepo())
+	ctx := context.Background()
+
+	reservation, err := svc.Begin(ctx, 1, "key", "hash")
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := svc.Abort(ctx, reservation); err != nil {
+		t.Fatalf("abort: %v", err)
+	}
+
+	again, err := svc.Begin(ctx, 1, "key", "hash")
+	if err != nil || again.Completed() {
+		t.Errorf("begin after abort: record = %+v, err = %v; want a new reservation", again, err)
+	}
+}
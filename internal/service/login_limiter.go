@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"strconv"
+	"time"
+)
+
+const (
+	// loginFreeFailures — сколько неудачных попыток по логину проходят без задержки.
+	loginFreeFailures = 3
+	loginBaseDelay    = time.Second
+)
+
+// ErrLoginLocked возвращается, пока логин или IP-адрес заблокированы после неудачных попыток входа.
+type ErrLoginLocked struct {
+	RetryAfter time.Duration
+}
+
+func (e *ErrLoginLocked) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter)
+}
+
+// ErrTwoFactorLocked возвращается, пока проверка кодов 2FA пользователя заблокирована.
+type ErrTwoFactorLocked struct {
+	RetryAfter time.Duration
+}
+
+func (e *ErrTwoFactorLocked) Error() string {
+	return fmt.Sprintf("too many failed two-factor attempts, retry after %s", e.RetryAfter)
+}
+
+type LoginLimitConfig struct {
+	MaxLoginFailures int
+	MaxIPFailures    int
+	LockoutDuration  time.Duration
+}
+
+// LoginLimiter ограничивает подбор паролей. Счётчики хранятся в базе, поэтому
+// переживают перезапуск и общие для всех экземпляров.
+type LoginLimiter interface {
+	Check(ctx context.Context, login, ip string) error
+	RecordFailure(ctx context.Context, login, ip string, userID *int64) error
+	RecordSuccess(ctx context.Context, login string) error
+	// CheckTwoFactor, RecordTwoFactorFailure и RecordTwoFactorSuccess ведут такой же счётчик
+	// для кодов 2FA пользователя: шестизначный код иначе подбирается перебором.
+	CheckTwoFactor(ctx context.Context, userID int64) error
+	RecordTwoFactorFailure(ctx context.Context, userID int64) error
+	RecordTwoFactorSuccess(ctx context.Context, userID int64) error
+	// Purge удаляет счётчики, которые уже ни на что не влияют, и возвращает их число.
+	Purge(ctx context.Context) (int64, error)
+}
+
+type loginLimiter struct {
+	attemptRepo repository.LoginAttemptRepository
+	auditRepo   repository.AuditRepository
+	uow         repository.UnitOfWork
+	cfg         LoginLimitConfig
+}
+
+type loginKey struct {
+	scope string
+	key   string
+}
+
+type loginLimit struct {
+	free int
+	max  int
+}
+
+func NewLoginLimiter(
+	attemptRepo repository.LoginAttemptRepository,
+	auditRepo repository.AuditRepository,
+	uow repository.UnitOfWork,
+	cfg LoginLimitConfig,
+) LoginLimiter {
+	if cfg.MaxLoginFailures < 1 {
+		cfg.MaxLoginFailures = 5
+	}
+	if cfg.MaxIPFailures < 1 {
+		cfg.MaxIPFailures = 50
+	}
+	if cfg.LockoutDuration <= 0 {
+		cfg.LockoutDuration = 15 * time.Minute
+	}
+	return &loginLimiter{
+		attemptRepo: attemptRepo,
+		auditRepo:   auditRepo,
+		uow:         uow,
+		cfg:         cfg,
+	}
+}
+
+// Check проверяет блокировки до сравнения пароля, чтобы заблокированный перебор
+// не тратил время на bcrypt.
+func (l *loginLimiter) Check(ctx context.Context, login, ip string) error {
+	var retryAfter time.Duration
+	for _, k := range l.keys(login, ip) {
+		attempt, err := l.attemptRepo.Get(ctx, k.scope, k.key)
+		if err != nil {
+			return err
+		}
+		if attempt.LockedUntil != nil {
+			retryAfter = max(retryAfter, time.Until(*attempt.LockedUntil))
+		}
+	}
+	if retryAfter > 0 {
+		return &ErrLoginLocked{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// RecordFailure учитывает неудачную попытку. Первые попытки по логину проходят без
+// задержки, затем каждая следующая удваивает паузу, а по достижении лимита логин
+// (или адрес) блокируется на LockoutDuration и блокировка пишется в журнал аудита.
+// Счётчик обнуляется, если с последней ошибки прошло больше LockoutDuration.
+func (l *loginLimiter) RecordFailure(ctx context.Context, login, ip string, userID *int64) error {
+	return l.recordFailures(ctx, l.keys(login, ip), login, ip, userID)
+}
+
+func (l *loginLimiter) recordFailures(ctx context.Context, keys []loginKey, login, ip string, userID *int64) error {
+	return l.uow.WithinTx(ctx, func(ctx context.Context) error {
+		now := time.Now()
+		for _, k := range keys {
+			attempt, err := l.attemptRepo.GetForUpdate(ctx, k.scope, k.key)
+			if err != nil {
+				return err
+			}
+			if attempt.LastFailedAt != nil && now.Sub(*attempt.LastFailedAt) > l.cfg.LockoutDuration {
+				attempt.Failures = 0
+			}
+			attempt.Failures++
+			attempt.LastFailedAt = &now
+
+			limit := l.limit(k.scope)
+			delay := l.delay(limit, attempt.Failures)
+			if delay > 0 {
+				lockedUntil := now.Add(delay)
+				attempt.LockedUntil = &lockedUntil
+			}
+			if err := l.attemptRepo.Save(ctx, attempt); err != nil {
+				return err
+			}
+
+			if attempt.Failures == limit.max {
+				if err := l.auditLockout(ctx, attempt, login, ip, userID); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// RecordSuccess снимает счётчик логина. Счётчик адреса остаётся: удачный вход в один
+// аккаунт не должен давать перебирать остальные.
+func (l *loginLimiter) RecordSuccess(ctx context.Context, login string) error {
+	return l.attemptRepo.Reset(ctx, model.LoginScopeLogin, login)
+}
+
+func (l *loginLimiter) CheckTwoFactor(ctx context.Context, userID int64) error {
+	k := twoFactorKey(userID)
+	attempt, err := l.attemptRepo.Get(ctx, k.scope, k.key)
+	if err != nil {
+		return err
+	}
+	if attempt.LockedUntil != nil {
+		if retryAfter := time.Until(*attempt.LockedUntil); retryAfter > 0 {
+			return &ErrTwoFactorLocked{RetryAfter: retryAfter}
+		}
+	}
+	return nil
+}
+
+// RecordTwoFactorFailure вызывается с контекстом без транзакции (repository.Detach):
+// проверка кода обычно идёт в транзакции списания, которая при неверном коде откатывается.
+func (l *loginLimiter) RecordTwoFactorFailure(ctx context.Context, userID int64) error {
+	return l.recordFailures(ctx, []loginKey{twoFactorKey(userID)}, "", "", &userID)
+}
+
+func (l *loginLimiter) RecordTwoFactorSuccess(ctx context.Context, userID int64) error {
+	k := twoFactorKey(userID)
+	return l.attemptRepo.Reset(ctx, k.scope, k.key)
+}
+
+func (l *loginLimiter) Purge(ctx context.Context) (int64, error) {
+	return l.attemptRepo.DeleteStale(ctx, time.Now().Add(-l.cfg.LockoutDuration))
+}
+
+func twoFactorKey(userID int64) loginKey {
+	return loginKey{scope: model.LoginScopeTwoFactor, key: strconv.FormatInt(userID, 10)}
+}
+
+// keys всегда перечисляет счётчики в одном порядке, чтобы параллельные транзакции
+// блокировали строки одинаково и не взаимоблокировались.
+func (l *loginLimiter) keys(login, ip string) []loginKey {
+	keys := []loginKey{{scope: model.LoginScopeLogin, key: login}}
+	if ip != "" {
+		keys = append(keys, loginKey{scope: model.LoginScopeIP, key: ip})
+	}
+	return keys
+}
+
+func (l *loginLimiter) limit(scope string) loginLimit {
+	if scope == model.LoginScopeIP {
+		// С одного адреса могут входить многие пользователи (NAT), поэтому задержки
+		// начинаются только со второй половины лимита.
+		return loginLimit{free: l.cfg.MaxIPFailures / 2, max: l.cfg.MaxIPFailures}
+	}
+	return loginLimit{free: min(loginFreeFailures, l.cfg.MaxLoginFailures-1), max: l.cfg.MaxLoginFailures}
+}
+
+func (l *loginLimiter) delay(limit loginLimit, failures int) time.Duration {
+	if failures >= limit.max {
+		return l.cfg.LockoutDuration
+	}
+	if failures <= limit.free {
+		return 0
+	}
+	delay := loginBaseDelay << min(failures-limit.free-1, 30)
+	return min(delay, l.cfg.LockoutDuration)
+}
+
+func (l *loginLimiter) auditLockout(ctx context.Context, attempt *model.LoginAttempt, login, ip string, userID *int64) error {
+	details, err := json.Marshal(map[string]any{
+		"scope":        attempt.Scope,
+		"failures":     attempt.Failures,
+		"locked_until": attempt.LockedUntil,
+	})
+	if err != nil {
+		return err
+	}
+	return l.auditRepo.Record(ctx, &model.AuditEntry{
+		Action:  model.AuditLoginLockout,
+		UserID:  userID,
+		Login:   login,
+		IP:      ip,
+		Details: details,
+	})
+}
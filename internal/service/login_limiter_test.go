@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingAudit struct {
+	repository.AuditRepository
+
+	mu      sync.Mutex
+	entries []*model.AuditEntry
+}
+
+func (a *recordingAudit) Record(_ context.Context, entry *model.AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, entry)
+	return nil
+}
+
+func (a *recordingAudit) actions(action string) []*model.AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var found []*model.AuditEntry
+	for _, e := range a.entries {
+		if e.Action == action {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func lockedFor(t *testing.T, repo *fakeAttemptRepo, scope, key string) time.Duration {
+	t.Helper()
+	attempt, _ := repo.Get(context.Background(), scope, key)
+	if attempt.LockedUntil == nil || attempt.LastFailedAt == nil {
+		return 0
+	}
+	// Истёкшая блокировка остаётся в записи, но ни на что не влияет.
+	return max(attempt.LockedUntil.Sub(*attempt.LastFailedAt), 0)
+}
+
+func TestLoginDelayGrowsThenLocks(t *testing.T) {
+	repo := newFakeAttemptRepo()
+	audit := &recordingAudit{}
+	limiter := NewLoginLimiter(repo, audit, fakeUnitOfWork{}, LoginLimitConfig{
+		MaxLoginFailures: 6,
+		LockoutDuration:  time.Hour,
+	})
+	ctx := context.Background()
+	userID := int64(7)
+
+	// Три ошибки бесплатно, затем 1s, 2s, и на шестой — блокировка на LockoutDuration.
+	want := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, time.Hour}
+	for i, delay := range want {
+		if err := limiter.RecordFailure(ctx, "alice", "", &userID); err != nil {
+			t.Fatalf("failure %d: %v", i+1, err)
+		}
+		if got := lockedFor(t, repo, model.LoginScopeLogin, "alice"); got != delay {
+			t.Errorf("after failure %d delay = %v, want %v", i+1, got, delay)
+		}
+	}
+
+	var locked *ErrLoginLocked
+	if err := limiter.Check(ctx, "alice", ""); !errors.As(err, &locked) || locked.RetryAfter <= 0 {
+		t.Errorf("check after lockout: err = %v, want ErrLoginLocked", err)
+	}
+
+	lockouts := audit.actions(model.AuditLoginLockout)
+	if len(lockouts) != 1 {
+		t.Fatalf("lockout audit entries = %d, want 1", len(lockouts))
+	}
+	if entry := lockouts[0]; entry.Login != "alice" || entry.UserID == nil || *entry.UserID != userID {
+		t.Errorf("lockout audit = %+v, want login alice and user %d", entry, userID)
+	}
+}
+
+func TestLoginCounterResetsAfterQuietWindow(t *testing.T) {
+	repo := newFakeAttemptRepo()
+	limiter := NewLoginLimiter(repo, &recordingAudit{}, fakeUnitOfWork{}, LoginLimitConfig{
+		MaxLoginFailures: 5,
+		LockoutDuration:  time.Minute,
+	})
+	ctx := context.Background()
+
+	for range 4 {
+		if err := limiter.RecordFailure(ctx, "bob", "", nil); err != nil {
+			t.Fatalf("record failure: %v", err)
+		}
+	}
+
+	// Последняя ошибка была раньше, чем LockoutDuration назад, а блокировка истекла.
+	attempt, _ := repo.Get(ctx, model.LoginScopeLogin, "bob")
+	old := time.Now().Add(-2 * time.Minute)
+	attempt.LastFailedAt, attempt.LockedUntil = &old, &old
+	if err := repo.Save(ctx, attempt); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := limiter.Check(ctx, "bob", ""); err != nil {
+		t.Errorf("check after expired delay: %v", err)
+	}
+
+	if err := limiter.RecordFailure(ctx, "bob", "", nil); err != nil {
+		t.Fatalf("record failure: %v", err)
+	}
+	attempt, _ = repo.Get(ctx, model.LoginScopeLogin, "bob")
+	if attempt.Failures != 1 {
+		t.Errorf("failures after quiet window = %d, want counter restarted at 1", attempt.Failures)
+	}
+	if got := lockedFor(t, repo, model.LoginScopeLogin, "bob"); got != 0 {
+		t.Errorf("delay after quiet window = %v, want none", got)
+	}
+}
+
+func TestIPLimitAndSuccessReset(t *testing.T) {
+	repo := newFakeAttemptRepo()
+	audit := &recordingAudit{}
+	limiter := NewLoginLimiter(repo, audit, fakeUnitOfWork{}, LoginLimitConfig{
+		MaxLoginFailures: 100,
+		MaxIPFailures:    4,
+		LockoutDuration:  time.Hour,
+	})
+	ctx := context.Background()
+
+	// Каждая ошибка по новому логину: лимит логина не достигается, а адреса — да.
+	logins := []string{"a", "b", "c", "d"}
+	for _, login := range logins {
+		if err := limiter.RecordFailure(ctx, login, "10.0.0.1", nil); err != nil {
+			t.Fatalf("record failure: %v", err)
+		}
+	}
+	if got := lockedFor(t, repo, model.LoginScopeIP, "10.0.0.1"); got != time.Hour {
+		t.Errorf("ip lock = %v, want %v", got, time.Hour)
+	}
+	if lockouts := audit.actions(model.AuditLoginLockout); len(lockouts) != 1 || lockouts[0].IP != "10.0.0.1" {
+		t.Errorf("lockout audit entries = %+v, want one for the address", lockouts)
+	}
+
+	// Удачный вход снимает счётчик логина, но не адреса.
+	if err := limiter.RecordSuccess(ctx, "d"); err != nil {
+		t.Fatalf("record success: %v", err)
+	}
+	if attempt, _ := repo.Get(ctx, model.LoginScopeLogin, "d"); attempt.Failures != 0 {
+		t.Errorf("login failures after success = %d, want 0", attempt.Failures)
+	}
+	var locked *ErrLoginLocked
+	if err := limiter.Check(ctx, "d", "10.0.0.1"); !errors.As(err, &locked) {
+		t.Errorf("check from locked address after success: err = %v, want ErrLoginLocked", err)
+	}
+}
+
+type staleAttemptRepo struct {
+	*fakeAttemptRepo
+	before time.Time
+}
+
+func (r *staleAttemptRepo) DeleteStale(_ context.Context, before time.Time) (int64, error) {
+	r.before = before
+	return 0, nil
+}
+
+func TestPurgeUsesLockoutWindow(t *testing.T) {
+	repo := &staleAttemptRepo{fakeAttemptRepo: newFakeAttemptRepo()}
+	limiter := NewLoginLimiter(repo, &recordingAudit{}, fakeUnitOfWork{}, LoginLimitConfig{LockoutDuration: time.Hour})
+
+	if _, err := limiter.Purge(context.Background()); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if age := time.Since(repo.before); age < time.Hour || age > time.Hour+time.Minute {
+		t.Errorf("purge cutoff %v ago, want the lockout duration", age)
+	}
+}
@@ -2,15 +2,16 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/accrual"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/core"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/util/luhn"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/worker"
 	"go.uber.org/zap"
-	"net/http"
+	"sync"
 	"time"
 )
 
@@ -18,28 +19,71 @@ var (
 	ErrOrderAlreadyUploaded     = errors.New("order already uploaded by this user")
 	ErrOrderUploadedByOtherUser = errors.New("order already uploaded by another user")
 	ErrInvalidOrderNumber       = errors.New("invalid order number")
+	ErrOrderNotFound            = errors.New("order not found")
+	ErrOrderAccessDenied        = errors.New("order belongs to another user")
 )
 
+type OrderProcessingConfig struct {
+	Workers    int
+	QueueSize  int
+	PageSize   int
+	InstanceID string
+	LeaseTTL   time.Duration
+}
+
 type orderService struct {
-	orderRepo          repository.OrderRepository
-	userRepo           repository.UserRepository
-	accrualSystemAddr  string
-	processingInterval time.Duration
-	logger             *zap.Logger
+	orderRepo     repository.OrderRepository
+	userRepo      repository.UserRepository
+	ledgerRepo    repository.LedgerRepository
+	expiry        ExpiryService
+	tiers         TierService
+	webhooks      WebhookService
+	outboxRepo    repository.OutboxRepository
+	uow           repository.UnitOfWork
+	accrualClient core.AccrualClient
+	cfg           OrderProcessingConfig
+	logger        *zap.Logger
+
+	// pool живёт всё время работы сервиса, чтобы сужение после 429 сохранялось между проходами.
+	pool      *worker.Pool
+	startPool sync.Once
 }
 
 func NewOrderService(
 	repo repository.OrderRepository,
-	accrualAddr string,
+	accrualClient core.AccrualClient,
 	userRepo repository.UserRepository,
+	ledgerRepo repository.LedgerRepository,
+	expiry ExpiryService,
+	tiers TierService,
+	webhooks WebhookService,
+	outboxRepo repository.OutboxRepository,
+	uow repository.UnitOfWork,
+	cfg OrderProcessingConfig,
 	logger *zap.Logger,
 ) core.OrderProcessor {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.PageSize < 1 {
+		cfg.PageSize = 100
+	}
+	if cfg.LeaseTTL <= 0 {
+		cfg.LeaseTTL = time.Minute
+	}
 	return &orderService{
-		orderRepo:          repo,
-		userRepo:           userRepo,
-		accrualSystemAddr:  accrualAddr,
-		processingInterval: 5 * time.Second,
-		logger:             logger,
+		orderRepo:     repo,
+		userRepo:      userRepo,
+		ledgerRepo:    ledgerRepo,
+		expiry:        expiry,
+		tiers:         tiers,
+		webhooks:      webhooks,
+		outboxRepo:    outboxRepo,
+		uow:           uow,
+		accrualClient: accrualClient,
+		cfg:           cfg,
+		logger:        logger,
+		pool:          worker.NewPool(cfg.Workers, cfg.QueueSize),
 	}
 }
 
@@ -67,149 +111,337 @@ func (s *orderService) UploadOrder(ctx context.Context, userID int64, orderNumbe
 		UploadedAt: time.Now(),
 	}
 
-	if err := s.orderRepo.Create(ctx, order); err != nil {
-		return fmt.Errorf("failed to create order: %w", err)
-	}
+	return s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.orderRepo.Create(ctx, order); err != nil {
+			return fmt.Errorf("failed to create order: %w", err)
+		}
+		if err := s.orderRepo.AddStatusHistory(ctx, order.Number, order.Status, 0); err != nil {
+			return err
+		}
+		return recordEvent(ctx, s.outboxRepo, model.EventOrderUploaded, model.AggregateOrder, order.Number, userID,
+			model.OrderUploadedPayload{Number: order.Number, UploadedAt: order.UploadedAt})
+	})
+}
 
-	return nil
+func (s *orderService) GetOrder(ctx context.Context, userID int64, orderNumber string) (*model.OrderDetails, error) {
+	details, err := s.orderRepo.GetDetails(ctx, orderNumber)
+	if err != nil {
+		return nil, err
+	}
+	if details == nil {
+		return nil, ErrOrderNotFound
+	}
+	if details.UserID != userID {
+		return nil, ErrOrderAccessDenied
+	}
+	return details, nil
 }
 
-func (s *orderService) GetOrders(ctx context.Context, userID int64) ([]*model.Order, error) {
-	return s.orderRepo.GetByUserID(ctx, userID)
+func (s *orderService) GetOrders(ctx context.Context, userID int64, filter model.ListFilter) (*model.Page[*model.Order], error) {
+	return s.orderRepo.GetByUserID(ctx, userID, filter)
 }
 
+// ProcessOrders захватывает в аренду пачки необработанных заказов и раздаёт их пулу воркеров.
+// Пока идёт обработка, аренда продлевается; по завершении прохода она снимается, чтобы заказы
+// могли взять на следующем тике этот или другой экземпляр.
+// При ответе 429 пул сужается, после успешных опросов постепенно возвращается к исходному размеру.
+// Пул общий для всех проходов и запускается с контекстом первого из них.
 func (s *orderService) ProcessOrders(ctx context.Context) error {
-	orders, err := s.orderRepo.GetUnprocessedOrders(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get unprocessed orders: %w", err)
-	}
+	pool := s.pool
+	s.startPool.Do(func() { pool.Start(ctx) })
+
+	var pending sync.WaitGroup
 
-	for _, order := range orders {
-		if order.Status == "NEW" {
-			order.Status = "PROCESSING"
-			if err := s.orderRepo.Update(ctx, order); err != nil {
-				s.logger.Error("Failed to update order status",
-					zap.String("order", order.Number),
-					zap.Error(err))
-				continue
+	var claimed []string
+	renewCtx, stopRenew := context.WithCancel(ctx)
+	renewDone := make(chan struct{})
+	var mu sync.Mutex
+
+	go func() {
+		defer close(renewDone)
+		ticker := time.NewTicker(s.cfg.LeaseTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-ticker.C:
+				mu.Lock()
+				numbers := append([]string(nil), claimed...)
+				mu.Unlock()
+				if len(numbers) == 0 {
+					continue
+				}
+				if err := s.orderRepo.RenewLeases(renewCtx, s.cfg.InstanceID, numbers, s.cfg.LeaseTTL); err != nil && renewCtx.Err() == nil {
+					s.logger.Warn("Failed to renew order leases", zap.Error(err))
+				}
 			}
 		}
+	}()
+
+	defer func() {
+		s.waitPass(ctx, &pending)
+		stopRenew()
+		<-renewDone
+		s.releaseLeases(claimed)
+	}()
 
-		status, accrual, err := s.getOrderStatusFromAccrual(ctx, order.Number)
+	for {
+		orders, err := s.orderRepo.ClaimOrders(ctx, s.cfg.InstanceID, s.cfg.PageSize, s.cfg.LeaseTTL)
 		if err != nil {
-			s.logger.Warn("Failed to get order status from accrual",
-				zap.String("order", order.Number),
-				zap.Error(err))
-			continue
-		}
-
-		if status != order.Status || (status == "PROCESSED" && accrual != order.Accrual) {
-			order.Status = status
-			if status == "PROCESSED" {
-				order.Accrual = accrual
-				if err := s.userRepo.UpdateBalance(ctx, order.UserID, accrual); err != nil {
-					s.logger.Error("Failed to update user balance",
-						zap.Int64("user_id", order.UserID),
-						zap.String("order", order.Number),
-						zap.Error(err))
-					continue
-				}
+			if ctx.Err() != nil {
+				return nil
 			}
+			return fmt.Errorf("failed to claim orders: %w", err)
+		}
 
-			if err := s.orderRepo.Update(ctx, order); err != nil {
-				s.logger.Error("Failed to update order",
-					zap.String("order", order.Number),
-					zap.Error(err))
+		mu.Lock()
+		for _, order := range orders {
+			claimed = append(claimed, order.Number)
+		}
+		mu.Unlock()
+
+		for _, order := range orders {
+			pending.Add(1)
+			err := pool.Submit(ctx, func(ctx context.Context) {
+				defer pending.Done()
+				s.processOrder(ctx, pool, order)
+			})
+			if err != nil {
+				pending.Done()
+				return nil
 			}
 		}
+
+		if len(orders) < s.cfg.PageSize {
+			return nil
+		}
 	}
-	return nil
 }
 
-func (s *orderService) getOrderStatusFromAccrual(ctx context.Context, orderNumber string) (string, float64, error) {
-	url := fmt.Sprintf("%s/api/orders/%s", s.accrualSystemAddr, orderNumber)
+// waitPass ждёт задачи прохода. При остановке задачи, оставшиеся в очереди, не выполняются,
+// поэтому ожидание прерывается отменой контекста.
+func (s *orderService) waitPass(ctx context.Context, pending *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return "", 0, err
+	select {
+	case <-done:
+	case <-ctx.Done():
 	}
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", 0, err
+func (s *orderService) releaseLeases(numbers []string) {
+	if len(numbers) == 0 {
+		return
 	}
-	defer resp.Body.Close()
-
-	switch resp.StatusCode {
-	case http.StatusOK:
-		var result struct {
-			Order   string  `json:"order"`
-			Status  string  `json:"status"`
-			Accrual float64 `json:"accrual,omitempty"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-			return "", 0, err
-		}
-		return result.Status, result.Accrual, nil
-
-	case http.StatusNoContent:
-		return "PROCESSING", 0, nil
 
-	case http.StatusTooManyRequests:
-		time.Sleep(time.Second * 5)
-		return "PROCESSING", 0, nil
+	// Контекст прохода к этому моменту может быть уже отменён при остановке сервиса.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	default:
-		return "INVALID", 0, nil
+	if err := s.orderRepo.ReleaseLeases(ctx, s.cfg.InstanceID, numbers); err != nil {
+		s.logger.Warn("Failed to release order leases",
+			zap.Int("count", len(numbers)),
+			zap.Error(err))
 	}
 }
 
-func (s *orderService) processOrder(ctx context.Context, order *model.Order) error {
-	ctx, cancel := context.WithTimeout(ctx, 90*time.Second)
-	defer cancel()
-
-	url := fmt.Sprintf("%s/api/orders/%s", s.accrualSystemAddr, order.Number)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+func (s *orderService) processOrder(ctx context.Context, pool *worker.Pool, order *model.Order) {
+	resp, err := s.accrualClient.GetOrder(ctx, order.Number)
+	// Время опроса отмечается при любом ответе, включая 204 и ошибки, чтобы
+	// last_polled_at показывал, что заказ опрашивается, а не только что опрос удался.
+	if ctx.Err() == nil {
+		if err := s.orderRepo.MarkPolled(ctx, order.Number); err != nil {
+			s.logger.Warn("Failed to mark order polled",
+				zap.String("order", order.Number),
+				zap.Error(err))
+		}
+	}
 	if err != nil {
-		return err
+		var rateLimited *accrual.ErrRateLimited
+		switch {
+		case errors.Is(err, accrual.ErrNotRegistered):
+			s.logger.Debug("Order is not registered in accrual system yet",
+				zap.String("order", order.Number))
+		case errors.As(err, &rateLimited):
+			s.logger.Warn("Accrual system rate limit reached, shrinking worker pool",
+				zap.Duration("retry_after", rateLimited.RetryAfter),
+				zap.Int("workers", pool.Shrink()))
+		case ctx.Err() != nil:
+		default:
+			s.logger.Warn("Failed to get order status from accrual",
+				zap.String("order", order.Number),
+				zap.Error(err))
+		}
+		return
 	}
+	pool.Grow()
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	status := orderStatusFromAccrual(resp.Status)
+	if status == "PROCESSED" {
+		s.completeOrder(ctx, order, resp.Accrual)
+		return
 	}
-	defer resp.Body.Close()
 
-	switch resp.StatusCode {
-	case http.StatusNoContent:
-		return nil
-	case http.StatusTooManyRequests:
-		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
-			duration, _ := time.ParseDuration(retryAfter + "s")
-			time.Sleep(duration)
+	if status == order.Status {
+		return
+	}
+	err = s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		changed, err := s.orderRepo.UpdateStatus(ctx, order.Number, status)
+		if err != nil || !changed {
+			return err
 		}
-		return nil
-	case http.StatusOK:
-		var result struct {
-			Order   string  `json:"order"`
-			Status  string  `json:"status"`
-			Accrual float64 `json:"accrual,omitempty"`
+		if err := s.orderRepo.AddStatusHistory(ctx, order.Number, status, 0); err != nil {
+			return err
 		}
-
-		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		if err := recordEvent(ctx, s.outboxRepo, model.EventOrderStatusChanged, model.AggregateOrder, order.Number, order.UserID,
+			model.OrderStatusChangedPayload{Number: order.Number, PreviousStatus: order.Status, Status: status}); err != nil {
 			return err
 		}
+		if status != "INVALID" {
+			return nil
+		}
+		return s.webhooks.Notify(ctx, order.UserID, model.WebhookEventOrderInvalid, &model.Order{
+			Number:     order.Number,
+			Status:     status,
+			UploadedAt: order.UploadedAt,
+		})
+	})
+	if err != nil {
+		s.logger.Error("Failed to update order status",
+			zap.String("order", order.Number),
+			zap.Error(err))
+	}
+}
 
-		order.Status = result.Status
-		if result.Accrual > 0 {
-			order.Accrual = result.Accrual
-			if err := s.userRepo.UpdateBalance(ctx, order.UserID, result.Accrual); err != nil {
-				return err
-			}
+// completeOrder проводит начисление по заказу и публикует его события в одной транзакции.
+func (s *orderService) completeOrder(ctx context.Context, order *model.Order, accrual model.Money) {
+	var (
+		completed *model.Order
+		bonus     model.Money
+	)
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		completed, bonus, err = s.creditAccrual(ctx, order.Number, accrual)
+		if err != nil || completed == nil {
+			return err
 		}
+		if err := recordEvent(ctx, s.outboxRepo, model.EventOrderStatusChanged, model.AggregateOrder, completed.Number, completed.UserID,
+			model.OrderStatusChangedPayload{Number: completed.Number, PreviousStatus: order.Status, Status: completed.Status}); err != nil {
+			return err
+		}
+		if err := recordEvent(ctx, s.outboxRepo, model.EventAccrualCredited, model.AggregateOrder, completed.Number, completed.UserID,
+			model.AccrualCreditedPayload{Number: completed.Number, Accrual: completed.Accrual, Bonus: bonus}); err != nil {
+			return err
+		}
+		return s.webhooks.Notify(ctx, completed.UserID, model.WebhookEventOrderProcessed, completed)
+	})
+	if err != nil {
+		s.logger.Error("Failed to complete order",
+			zap.Int64("user_id", order.UserID),
+			zap.String("order", order.Number),
+			zap.Error(err))
+		return
+	}
+	if completed != nil {
+		s.logger.Info("Accrual credited",
+			zap.Int64("user_id", order.UserID),
+			zap.String("order", order.Number),
+			zap.Stringer("accrual", accrual),
+			zap.Stringer("bonus", bonus))
+	}
+}
+
+// creditAccrual — единственное место, где начисление по заказу попадает на баланс.
+// Зачисление происходит ровно один раз за счёт условного перехода в PROCESSED: его выполняет
+// только первая транзакция, застающая заказ в NEW или PROCESSING, а все движения по балансу,
+// лотам и журналу идут в той же транзакции после него. Повторный опрос получает nil и ничего
+// не зачисляет; сбой до коммита откатывает и переход, и зачисление, и заказ будет опрошен снова.
+// Вызывается внутри UnitOfWork.WithinTx.
+func (s *orderService) creditAccrual(ctx context.Context, number string, accrual model.Money) (*model.Order, model.Money, error) {
+	completed, err := s.orderRepo.CompleteOrder(ctx, number, accrual)
+	if err != nil || completed == nil {
+		return nil, 0, err
+	}
+	if err := s.orderRepo.AddStatusHistory(ctx, completed.Number, completed.Status, completed.Accrual); err != nil {
+		return nil, 0, err
+	}
+	if err := s.userRepo.UpdateBalance(ctx, completed.UserID, completed.Accrual); err != nil {
+		return nil, 0, err
+	}
+	if err := s.expiry.Credit(ctx, completed.UserID, model.LedgerKindAccrual, completed.Number, completed.Accrual); err != nil {
+		return nil, 0, err
+	}
+	if err := s.ledgerRepo.Post(ctx, &model.LedgerPosting{
+		UserID:         completed.UserID,
+		Amount:         completed.Accrual,
+		Kind:           model.LedgerKindAccrual,
+		CounterAccount: model.LedgerAccountAccrual,
+		OrderNumber:    completed.Number,
+	}); err != nil {
+		return nil, 0, err
+	}
+	bonus, err := s.creditTierBonus(ctx, completed)
+	if err != nil {
+		return nil, 0, err
+	}
+	return completed, bonus, nil
+}
+
+// creditTierBonus начисляет надбавку уровня лояльности отдельной проводкой BONUS,
+// чтобы начисление системы расчёта в журнале осталось без изменений.
+func (s *orderService) creditTierBonus(ctx context.Context, order *model.Order) (model.Money, error) {
+	percent, err := s.tiers.BonusPercent(ctx, order.UserID)
+	if err != nil {
+		return 0, err
+	}
+	bonus := tierBonus(order.Accrual, percent)
+	if bonus <= 0 {
+		return 0, nil
+	}
+
+	if err := s.userRepo.UpdateBalance(ctx, order.UserID, bonus); err != nil {
+		return 0, err
+	}
+	if err := s.expiry.Credit(ctx, order.UserID, model.LedgerKindBonus, order.Number, bonus); err != nil {
+		return 0, err
+	}
+	if err := s.ledgerRepo.Post(ctx, &model.LedgerPosting{
+		UserID:         order.UserID,
+		Amount:         bonus,
+		Kind:           model.LedgerKindBonus,
+		CounterAccount: model.LedgerAccountBonus,
+		OrderNumber:    order.Number,
+		Description:    fmt.Sprintf("tier bonus %d%%", percent),
+	}); err != nil {
+		return 0, err
+	}
+	return bonus, nil
+}
+
+// tierBonus — percent процентов от accrual с округлением до копейки, половина — от нуля.
+func tierBonus(accrual model.Money, percent int) model.Money {
+	scaled := accrual * model.Money(percent)
+	if scaled < 0 {
+		return (scaled - 50) / 100
+	}
+	return (scaled + 50) / 100
+}
 
-		return s.orderRepo.Update(ctx, order)
+// orderStatusFromAccrual переводит статус системы расчёта в статус заказа.
+// REGISTERED означает, что заказ принят, но расчёт ещё не начат, — для пользователя это PROCESSING.
+func orderStatusFromAccrual(status string) string {
+	switch status {
+	case accrual.StatusProcessed:
+		return "PROCESSED"
+	case accrual.StatusInvalid:
+		return "INVALID"
 	default:
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return "PROCESSING"
 	}
 }
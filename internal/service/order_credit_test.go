@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// failingLedger отказывает в первой проводке, имитируя сбой посреди зачисления.
+type failingLedger struct {
+	repository.LedgerRepository
+	fail bool
+}
+
+func (l *failingLedger) Post(ctx context.Context, posting *model.LedgerPosting) error {
+	if l.fail {
+		l.fail = false
+		return errors.New("injected ledger failure")
+	}
+	return l.LedgerRepository.Post(ctx, posting)
+}
+
+func newCreditTestService(db *repository.Database, ledger repository.LedgerRepository) *orderService {
+	uow := repository.NewUnitOfWork(db)
+	userRepo := repository.NewUserRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	return &orderService{
+		orderRepo:  repository.NewOrderRepository(db),
+		userRepo:   userRepo,
+		ledgerRepo: ledger,
+		expiry:     NewExpiryService(repository.NewAccrualLotRepository(db), userRepo, ledger, outboxRepo, uow, PointsExpiryConfig{}),
+		tiers:      NewTierService(repository.NewTierRepository(db), userRepo, outboxRepo, uow, TierConfig{}),
+		webhooks:   fakeWebhooks{},
+		outboxRepo: outboxRepo,
+		uow:        uow,
+		logger:     zap.NewNop(),
+	}
+}
+
+func createTestOrder(t *testing.T, db *repository.Database, userID int64) *model.Order {
+	t.Helper()
+	order := &model.Order{Number: fmt.Sprint(time.Now().UnixNano()), UserID: userID, Status: "PROCESSING", UploadedAt: time.Now()}
+	if err := repository.NewOrderRepository(db).Create(context.Background(), order); err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	return order
+}
+
+func assertCreditedOnce(t *testing.T, db *repository.Database, userID int64, accrual model.Money) {
+	t.Helper()
+	ctx := context.Background()
+	balance, err := repository.NewUserRepository(db).GetBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("get balance: %v", err)
+	}
+	if balance.Current != accrual {
+		t.Errorf("balance = %v, want %v", balance.Current, accrual)
+	}
+	entries, err := repository.NewLedgerRepository(db).GetUserEntries(ctx, userID, model.ListFilter{})
+	if err != nil {
+		t.Fatalf("get ledger entries: %v", err)
+	}
+	var credits int
+	for _, e := range entries.Items {
+		if e.Kind == model.LedgerKindAccrual {
+			credits++
+		}
+	}
+	if credits != 1 {
+		t.Errorf("accrual ledger entries = %d, want 1", credits)
+	}
+}
+
+func TestCompleteOrderCreditsOnce(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+	order := createTestOrder(t, db, user.ID)
+	s := newCreditTestService(db, repository.NewLedgerRepository(db))
+	accrual := model.Money(72998)
+
+	s.completeOrder(context.Background(), order, accrual)
+	s.completeOrder(context.Background(), order, accrual)
+
+	assertCreditedOnce(t, db, user.ID, accrual)
+	got, err := s.orderRepo.GetByNumber(context.Background(), order.Number)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if got.Status != "PROCESSED" {
+		t.Errorf("status = %s, want PROCESSED", got.Status)
+	}
+}
+
+func TestCompleteOrderRollsBackOnFailure(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+	order := createTestOrder(t, db, user.ID)
+	ledger := &failingLedger{LedgerRepository: repository.NewLedgerRepository(db), fail: true}
+	s := newCreditTestService(db, ledger)
+	accrual := model.Money(50000)
+
+	s.completeOrder(context.Background(), order, accrual)
+
+	got, err := s.orderRepo.GetByNumber(context.Background(), order.Number)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if got.Status != "PROCESSING" {
+		t.Fatalf("status after failure = %s, want PROCESSING", got.Status)
+	}
+	balance, err := s.userRepo.GetBalance(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("get balance: %v", err)
+	}
+	if balance.Current != 0 {
+		t.Fatalf("balance after failure = %v, want 0", balance.Current)
+	}
+
+	// Повторный опрос после сбоя зачисляет ровно один раз.
+	s.completeOrder(context.Background(), order, accrual)
+	s.completeOrder(context.Background(), order, accrual)
+
+	assertCreditedOnce(t, db, user.ID, accrual)
+}
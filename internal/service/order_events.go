@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/broker"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+)
+
+// MaxReplayEvents — сколько пропущенных событий EventsSince отдаёт за раз.
+const MaxReplayEvents = 1000
+
+type OrderEventService interface {
+	Subscribe(userID int64) (<-chan *model.OrderEvent, func())
+	// EventsSince возвращает не больше MaxReplayEvents событий после lastEventID по порядку ID.
+	EventsSince(ctx context.Context, userID, lastEventID int64) ([]*model.OrderEvent, error)
+	Run(ctx context.Context) error
+}
+
+type orderEventService struct {
+	repo   repository.OrderEventRepository
+	broker *broker.Broker
+}
+
+func NewOrderEventService(repo repository.OrderEventRepository, b *broker.Broker) OrderEventService {
+	return &orderEventService{repo: repo, broker: b}
+}
+
+func (s *orderEventService) Subscribe(userID int64) (<-chan *model.OrderEvent, func()) {
+	return s.broker.Subscribe(userID)
+}
+
+func (s *orderEventService) EventsSince(ctx context.Context, userID, lastEventID int64) ([]*model.OrderEvent, error) {
+	return s.repo.GetEventsSince(ctx, userID, lastEventID, MaxReplayEvents)
+}
+
+// Run пересылает события из Postgres LISTEN/NOTIFY в брокер до отмены ctx.
+func (s *orderEventService) Run(ctx context.Context) error {
+	return s.repo.Listen(ctx, s.broker.Publish)
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/accrual"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/accrual/accrualtest"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/worker"
+	"go.uber.org/zap"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newPollTestService(srv *accrualtest.Server, orders *fakeOrderRepo) *orderService {
+	return &orderService{
+		orderRepo:     orders,
+		webhooks:      fakeWebhooks{},
+		outboxRepo:    &fakeOutbox{},
+		uow:           fakeUnitOfWork{},
+		accrualClient: accrual.NewClient(srv.URL),
+		cfg:           OrderProcessingConfig{Workers: 4, PageSize: 10, InstanceID: "test", LeaseTTL: time.Minute},
+		logger:        zap.NewNop(),
+		pool:          worker.NewPool(4, 0),
+	}
+}
+
+func TestProcessOrderStatusTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		response accrualtest.Response
+		want     string
+	}{
+		{"registered is processing", accrualtest.Status("1001", accrual.StatusRegistered, 0), "PROCESSING"},
+		{"processing", accrualtest.Status("1001", accrual.StatusProcessing, 0), "PROCESSING"},
+		{"invalid", accrualtest.Status("1001", accrual.StatusInvalid, 0), "INVALID"},
+		{"server error keeps status", accrualtest.Response{StatusCode: http.StatusInternalServerError}, "NEW"},
+		{"unavailable keeps status", accrualtest.Response{StatusCode: http.StatusServiceUnavailable}, "NEW"},
+		{"not registered keeps status", accrualtest.Response{StatusCode: http.StatusNoContent}, "NEW"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := accrualtest.NewServer()
+			defer srv.Close()
+			srv.Enqueue("1001", tt.response)
+
+			orders := newFakeOrderRepo()
+			orders.statuses["1001"] = "NEW"
+			s := newPollTestService(srv, orders)
+			pool := worker.NewPool(2, 0)
+
+			s.processOrder(context.Background(), pool, &model.Order{Number: "1001", UserID: 1, Status: "NEW"})
+
+			if got := orders.statuses["1001"]; got != tt.want {
+				t.Errorf("status = %s, want %s", got, tt.want)
+			}
+			if got := orders.polled["1001"]; got != 1 {
+				t.Errorf("polled = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestProcessOrderRateLimitShrinksPool(t *testing.T) {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+	srv.Enqueue("1001", accrualtest.Response{StatusCode: http.StatusTooManyRequests, RetryAfter: "0"})
+
+	orders := newFakeOrderRepo()
+	orders.statuses["1001"] = "NEW"
+	s := newPollTestService(srv, orders)
+	pool := worker.NewPool(4, 0)
+
+	s.processOrder(context.Background(), pool, &model.Order{Number: "1001", UserID: 1, Status: "NEW"})
+
+	if got := pool.Limit(); got != 2 {
+		t.Errorf("pool limit = %d, want 2 after 429", got)
+	}
+	if got := orders.statuses["1001"]; got != "NEW" {
+		t.Errorf("status = %s, want NEW after 429", got)
+	}
+	if got := orders.polled["1001"]; got != 1 {
+		t.Errorf("polled = %d, want 1 after 429", got)
+	}
+}
+
+func TestProcessOrdersKeepsShrunkPoolBetweenPasses(t *testing.T) {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+	srv.Enqueue("1001", accrualtest.Response{StatusCode: http.StatusTooManyRequests, RetryAfter: "0"})
+	srv.Enqueue("1002", accrualtest.Response{StatusCode: http.StatusTooManyRequests, RetryAfter: "0"})
+
+	orders := newFakeOrderRepo()
+	s := newPollTestService(srv, orders)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	orders.queue = []*model.Order{{Number: "1001", UserID: 1, Status: "NEW"}}
+	if err := s.ProcessOrders(ctx); err != nil {
+		t.Fatalf("first pass: %v", err)
+	}
+	if got := s.pool.Limit(); got != 2 {
+		t.Fatalf("limit after first 429 = %d, want 2", got)
+	}
+
+	orders.queue = []*model.Order{{Number: "1002", UserID: 1, Status: "NEW"}}
+	if err := s.ProcessOrders(ctx); err != nil {
+		t.Fatalf("second pass: %v", err)
+	}
+	if got := s.pool.Limit(); got != 1 {
+		t.Fatalf("limit after second 429 = %d, want 1: shrink was lost between passes", got)
+	}
+}
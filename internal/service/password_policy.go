@@ -0,0 +1,122 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	loginMinLength = 3
+	loginMaxLength = 64
+	// bcrypt учитывает только первые 72 байта пароля.
+	passwordMaxBytes = 72
+)
+
+var (
+	ErrInvalidLogin  = errors.New("invalid login")
+	ErrWeakPassword  = errors.New("password does not meet policy")
+	ErrSamePassword  = errors.New("new password must differ from the current one")
+	ErrWrongPassword = errors.New("current password is incorrect")
+)
+
+// PasswordPolicy — требования к новым паролям: длина, отсутствие в списке утёкших
+// паролей и несовпадение с логином.
+type PasswordPolicy struct {
+	minLength int
+	breached  map[string]struct{}
+}
+
+// NewPasswordPolicy загружает список утёкших паролей из файла (по одному на строку,
+// регистр не учитывается). Пустой путь отключает проверку по списку.
+func NewPasswordPolicy(minLength int, breachedFile string) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		minLength: minLength,
+		breached:  make(map[string]struct{}),
+	}
+	if breachedFile == "" {
+		return policy, nil
+	}
+
+	f, err := os.Open(breachedFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached passwords file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			policy.breached[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached passwords file: %w", err)
+	}
+	return policy, nil
+}
+
+func (p *PasswordPolicy) Validate(login, password string) error {
+	if utf8.RuneCountInString(password) < p.minLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, p.minLength)
+	}
+	if len(password) > passwordMaxBytes {
+		return fmt.Errorf("%w: must be at most %d bytes", ErrWeakPassword, passwordMaxBytes)
+	}
+	lower := strings.ToLower(password)
+	if login != "" && strings.Contains(lower, strings.ToLower(login)) {
+		return fmt.Errorf("%w: must not contain the login", ErrWeakPassword)
+	}
+	if _, ok := p.breached[lower]; ok {
+		return fmt.Errorf("%w: found in a list of breached passwords", ErrWeakPassword)
+	}
+	return nil
+}
+
+// NormalizeLogin убирает пробелы по краям, приводит логин к NFC и складывает регистр
+// по правилам Unicode: «Alice», «ALICE» и «alice» — один логин, как и разные записи
+// одной буквы с диакритикой. Caser хранит состояние, поэтому создаётся на каждый вызов.
+func NormalizeLogin(login string) string {
+	return norm.NFC.String(cases.Fold().String(norm.NFC.String(strings.TrimSpace(login))))
+}
+
+// FindUserByLogin ищет пользователя по нормализованному логину, а если не нашёл — по
+// точному написанию: логины, которые миграция 026 не привела к новому виду (совпадения
+// или буквы, которые база не переводит в нижний регистр), хранятся как были.
+func FindUserByLogin(ctx context.Context, users repository.UserRepository, login string) (*model.User, error) {
+	normalized := NormalizeLogin(login)
+	user, err := users.GetByLogin(ctx, normalized)
+	if err != nil || user != nil {
+		return user, err
+	}
+	if exact := strings.TrimSpace(login); exact != normalized {
+		return users.GetByLogin(ctx, exact)
+	}
+	return nil, nil
+}
+
+// ValidateLogin проверяет логин нового пользователя: 3–64 символа, буквы, цифры и ._-@.
+// Для входа правило не применяется, чтобы не закрыть доступ старым аккаунтам.
+func ValidateLogin(login string) error {
+	n := utf8.RuneCountInString(login)
+	if n < loginMinLength || n > loginMaxLength {
+		return fmt.Errorf("%w: must be %d to %d characters", ErrInvalidLogin, loginMinLength, loginMaxLength)
+	}
+	for _, r := range login {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-@", r) {
+			continue
+		}
+		return fmt.Errorf("%w: unexpected character %q", ErrInvalidLogin, r)
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNormalizeLogin(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"alice", "alice"},
+		{"  Alice\t", "alice"},
+		{"ALICE", "alice"},
+		{"ÉMILE", "émile"},
+		// «é» из двух кодовых точек и из одной — один логин.
+		{"E\u0301mile", "émile"},
+		{"Straße", "strasse"},
+		{"Иван.Петров", "иван.петров"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := NormalizeLogin(tt.in); got != tt.want {
+				t.Errorf("NormalizeLogin(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLogin(t *testing.T) {
+	tests := []struct {
+		login string
+		ok    bool
+	}{
+		{"bob", true},
+		{"user.name-1_x@example.com", true},
+		{"иван", true},
+		{strings.Repeat("a", loginMaxLength), true},
+		{"ab", false},
+		{strings.Repeat("a", loginMaxLength+1), false},
+		{"with space", false},
+		{"semi;colon", false},
+		{"tab\tlogin", false},
+		{"<script>", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.login, func(t *testing.T) {
+			err := ValidateLogin(tt.login)
+			if tt.ok && err != nil {
+				t.Errorf("ValidateLogin(%q) = %v, want nil", tt.login, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidLogin) {
+				t.Errorf("ValidateLogin(%q) = %v, want ErrInvalidLogin", tt.login, err)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	breached := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(breached, []byte("Password123\n\n  qwertyuiop  \n"), 0o600); err != nil {
+		t.Fatalf("write breached list: %v", err)
+	}
+	policy, err := NewPasswordPolicy(10, breached)
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		ok       bool
+	}{
+		{"good", "correct-horse-battery", true},
+		{"too short", "short", false},
+		{"too long for bcrypt", strings.Repeat("x", passwordMaxBytes+1), false},
+		{"contains login", "my-Alice-password", false},
+		{"breached", "password123", false},
+		{"breached with spaces in list", "QWERTYUIOP", false},
+		// Длина считается в символах, а не байтах.
+		{"multibyte length", "пароль-длинный", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate("alice", tt.password)
+			if tt.ok && err != nil {
+				t.Errorf("Validate(%q) = %v, want nil", tt.password, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrWeakPassword) {
+				t.Errorf("Validate(%q) = %v, want ErrWeakPassword", tt.password, err)
+			}
+		})
+	}
+
+	if _, err := NewPasswordPolicy(10, filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("NewPasswordPolicy with a missing file succeeded")
+	}
+}
+
+// fakeLoginUsers хранит пользователей по логину и запоминает новые хеши паролей.
+type fakeLoginUsers struct {
+	repository.UserRepository
+	byLogin map[string]*model.User
+	hashes  map[int64]string
+}
+
+func (f *fakeLoginUsers) GetByLogin(_ context.Context, login string) (*model.User, error) {
+	return f.byLogin[login], nil
+}
+
+func (f *fakeLoginUsers) GetByID(_ context.Context, id int64) (*model.User, error) {
+	for _, u := range f.byLogin {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeLoginUsers) UpdatePassword(_ context.Context, userID int64, hash string) error {
+	f.hashes[userID] = hash
+	return nil
+}
+
+func TestFindUserByLoginFallsBackToExactSpelling(t *testing.T) {
+	users := &fakeLoginUsers{byLogin: map[string]*model.User{
+		"alice": {ID: 1, Login: "alice"},
+		// Не нормализован миграцией из-за совпадения с alice.
+		"Alice": {ID: 2, Login: "Alice"},
+	}}
+	ctx := context.Background()
+
+	for login, wantID := range map[string]int64{"ALICE": 1, " alice ": 1, "Alice": 1} {
+		user, err := FindUserByLogin(ctx, users, login)
+		if err != nil || user == nil || user.ID != wantID {
+			t.Errorf("FindUserByLogin(%q) = %+v, %v; want user %d", login, user, err, wantID)
+		}
+	}
+
+	delete(users.byLogin, "alice")
+	if user, err := FindUserByLogin(ctx, users, "Alice"); err != nil || user == nil || user.ID != 2 {
+		t.Errorf("FindUserByLogin(Alice) = %+v, %v; want legacy user 2", user, err)
+	}
+	if user, err := FindUserByLogin(ctx, users, "nobody"); err != nil || user != nil {
+		t.Errorf("FindUserByLogin(nobody) = %+v, %v; want nil", user, err)
+	}
+}
+
+type fakeRevokingSessions struct {
+	repository.SessionRepository
+	revokedExcept string
+}
+
+func (f *fakeRevokingSessions) RevokeAll(_ context.Context, _ int64, exceptID string) ([]string, error) {
+	f.revokedExcept = exceptID
+	return []string{"other-session"}, nil
+}
+
+func newPasswordTestService(t *testing.T, password string, cost int) (*authService, *fakeLoginUsers, *recordingAudit, *fakeAttemptRepo) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	users := &fakeLoginUsers{
+		byLogin: map[string]*model.User{"alice": {ID: 1, Login: "alice", PasswordHash: string(hash)}},
+		hashes:  map[int64]string{},
+	}
+	policy, err := NewPasswordPolicy(10, "")
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+	audit := &recordingAudit{}
+	attempts := newFakeAttemptRepo()
+	s := &authService{
+		userRepo:    users,
+		sessionRepo: &fakeRevokingSessions{},
+		uow:         fakeUnitOfWork{},
+		limiter:     NewLoginLimiter(attempts, audit, fakeUnitOfWork{}, LoginLimitConfig{}),
+		passwords:   policy,
+		auditRepo:   audit,
+		cfg:         AuthConfig{BcryptCost: bcrypt.MinCost},
+		sessions:    newSessionCache(time.Minute),
+	}
+	return s, users, audit, attempts
+}
+
+func TestChangePassword(t *testing.T) {
+	const current = "old-password-1"
+	ctx := context.Background()
+
+	t.Run("wrong current password", func(t *testing.T) {
+		s, users, _, attempts := newPasswordTestService(t, current, bcrypt.MinCost)
+		err := s.ChangePassword(ctx, 1, "sid", "guess", "new-password-1", "10.0.0.1")
+		if !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("err = %v, want ErrWrongPassword", err)
+		}
+		if attempt, _ := attempts.Get(ctx, model.LoginScopeLogin, "alice"); attempt.Failures != 1 {
+			t.Errorf("login failures = %d, want the guess counted", attempt.Failures)
+		}
+		if len(users.hashes) != 0 {
+			t.Error("password updated after a wrong current password")
+		}
+	})
+
+	t.Run("same password", func(t *testing.T) {
+		s, _, _, _ := newPasswordTestService(t, current, bcrypt.MinCost)
+		if err := s.ChangePassword(ctx, 1, "sid", current, current, ""); !errors.Is(err, ErrSamePassword) {
+			t.Errorf("err = %v, want ErrSamePassword", err)
+		}
+	})
+
+	t.Run("weak new password", func(t *testing.T) {
+		s, _, _, _ := newPasswordTestService(t, current, bcrypt.MinCost)
+		if err := s.ChangePassword(ctx, 1, "sid", current, "alice-12345", ""); !errors.Is(err, ErrWeakPassword) {
+			t.Errorf("err = %v, want ErrWeakPassword", err)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		s, users, audit, _ := newPasswordTestService(t, current, bcrypt.MinCost)
+		if err := s.ChangePassword(ctx, 1, "sid", current, "new-password-1", "10.0.0.1"); err != nil {
+			t.Fatalf("change password: %v", err)
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(users.hashes[1]), []byte("new-password-1")); err != nil {
+			t.Errorf("stored hash does not match the new password: %v", err)
+		}
+		if except := s.sessionRepo.(*fakeRevokingSessions).revokedExcept; except != "sid" {
+			t.Errorf("sessions revoked except %q, want the current one", except)
+		}
+		if entries := audit.actions(model.AuditPasswordChanged); len(entries) != 1 || entries[0].IP != "10.0.0.1" {
+			t.Errorf("audit = %+v, want one password change", entries)
+		}
+	})
+}
+
+func TestUpgradePasswordHash(t *testing.T) {
+	const password = "old-password-1"
+	ctx := context.Background()
+
+	s, users, _, _ := newPasswordTestService(t, password, bcrypt.MinCost)
+	s.cfg.BcryptCost = bcrypt.MinCost + 1
+	user := users.byLogin["alice"]
+
+	s.upgradePasswordHash(ctx, user, password)
+	cost, err := bcrypt.Cost([]byte(users.hashes[1]))
+	if err != nil || cost != bcrypt.MinCost+1 {
+		t.Fatalf("upgraded hash cost = %d, %v; want %d", cost, err, bcrypt.MinCost+1)
+	}
+	if user.PasswordHash != users.hashes[1] {
+		t.Error("user keeps the old hash after upgrade")
+	}
+
+	// Хеш с достаточной стоимостью не пересчитывается.
+	delete(users.hashes, 1)
+	s.upgradePasswordHash(ctx, user, password)
+	if _, ok := users.hashes[1]; ok {
+		t.Error("hash with the configured cost was recomputed")
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+const sessionCacheMaxEntries = 100000
+
+// sessionCache запоминает результат проверки сессии на короткое время, чтобы не ходить
+// в базу на каждый запрос. Отзыв на этом экземпляре виден сразу, на остальных —
+// не позже чем через ttl.
+type sessionCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]sessionCacheEntry
+}
+
+type sessionCacheEntry struct {
+	active    bool
+	checkedAt time.Time
+}
+
+func newSessionCache(ttl time.Duration) *sessionCache {
+	return &sessionCache{
+		ttl:     ttl,
+		entries: make(map[string]sessionCacheEntry),
+	}
+}
+
+func (c *sessionCache) get(id string) (active, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok || time.Since(entry.checkedAt) > c.ttl {
+		return false, false
+	}
+	return entry.active, true
+}
+
+func (c *sessionCache) set(id string, active bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= sessionCacheMaxEntries {
+		c.evictLocked()
+	}
+	c.entries[id] = sessionCacheEntry{active: active, checkedAt: time.Now()}
+}
+
+func (c *sessionCache) revoke(ids ...string) {
+	for _, id := range ids {
+		c.set(id, false)
+	}
+}
+
+func (c *sessionCache) evictLocked() {
+	for id, entry := range c.entries {
+		if time.Since(entry.checkedAt) > c.ttl {
+			delete(c.entries, id)
+		}
+	}
+	// Если всё ещё свежее, кеш просто начинается заново: это лишь лишние запросы к базе.
+	if len(c.entries) >= sessionCacheMaxEntries {
+		c.entries = make(map[string]sessionCacheEntry)
+	}
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const tierBatchSize = 500
+
+type TierConfig struct {
+	// Basis — model.TierBasisAccrual или model.TierBasisOrders.
+	Basis string
+	// Window — скользящее окно, за которое считаются начисления.
+	Window time.Duration
+	// Tiers — уровни выше базового по возрастанию порога.
+	Tiers []model.Tier
+}
+
+// ParseTiers разбирает описание уровней вида "SILVER:1000:5,GOLD:5000:10":
+// имя, порог (сумма начислений или число заказов, в зависимости от basis) и надбавка в процентах.
+func ParseTiers(spec, basis string) ([]model.Tier, error) {
+	if basis != model.TierBasisAccrual && basis != model.TierBasisOrders {
+		return nil, fmt.Errorf("unknown tier basis %q", basis)
+	}
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	var tiers []model.Tier
+	seen := map[string]bool{model.TierBronze: true}
+	for _, part := range strings.Split(spec, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("tier %q must be NAME:THRESHOLD:PERCENT", part)
+		}
+		tier := model.Tier{Name: strings.ToUpper(strings.TrimSpace(fields[0]))}
+		if tier.Name == "" || seen[tier.Name] {
+			return nil, fmt.Errorf("tier name %q is empty or repeated", fields[0])
+		}
+		seen[tier.Name] = true
+
+		if basis == model.TierBasisAccrual {
+			threshold, err := model.ParseMoney(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("tier %s: %w", tier.Name, err)
+			}
+			tier.Threshold = int64(threshold)
+		} else {
+			threshold, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("tier %s: invalid order count: %w", tier.Name, err)
+			}
+			tier.Threshold = threshold
+		}
+		if tier.Threshold <= 0 || (len(tiers) > 0 && tier.Threshold <= tiers[len(tiers)-1].Threshold) {
+			return nil, fmt.Errorf("tier %s: thresholds must be positive and increasing", tier.Name)
+		}
+
+		percent, err := strconv.Atoi(fields[2])
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("tier %s: bonus percent must be between 0 and 100", tier.Name)
+		}
+		tier.BonusPercent = percent
+		tiers = append(tiers, tier)
+	}
+	return tiers, nil
+}
+
+// TierService — уровни лояльности. Уровень хранится у пользователя и меняется только
+// ночным пересчётом, поэтому надбавка к начислению не зависит от порядка обработки заказов.
+type TierService interface {
+	// BonusPercent — надбавка текущего уровня пользователя к начислению.
+	BonusPercent(ctx context.Context, userID int64) (int, error)
+	Profile(ctx context.Context, userID int64) (*model.Profile, error)
+	// Recalculate пересчитывает уровни всех пользователей и возвращает число изменившихся.
+	Recalculate(ctx context.Context) (int, error)
+}
+
+type tierService struct {
+	tierRepo   repository.TierRepository
+	userRepo   repository.UserRepository
+	outboxRepo repository.OutboxRepository
+	uow        repository.UnitOfWork
+	cfg        TierConfig
+}
+
+func NewTierService(
+	tierRepo repository.TierRepository,
+	userRepo repository.UserRepository,
+	outboxRepo repository.OutboxRepository,
+	uow repository.UnitOfWork,
+	cfg TierConfig,
+) TierService {
+	if cfg.Basis == "" {
+		cfg.Basis = model.TierBasisAccrual
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 365 * 24 * time.Hour
+	}
+	return &tierService{
+		tierRepo:   tierRepo,
+		userRepo:   userRepo,
+		outboxRepo: outboxRepo,
+		uow:        uow,
+		cfg:        cfg,
+	}
+}
+
+func (s *tierService) BonusPercent(ctx context.Context, userID int64) (int, error) {
+	name, err := s.tierRepo.GetTier(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	// Уровень, убранный из конфигурации, надбавки не даёт до ближайшего пересчёта.
+	for _, tier := range s.cfg.Tiers {
+		if tier.Name == name {
+			return tier.BonusPercent, nil
+		}
+	}
+	return 0, nil
+}
+
+func (s *tierService) Profile(ctx context.Context, userID int64) (*model.Profile, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	since := time.Now().Add(-s.cfg.Window)
+	stats, err := s.tierRepo.GetStats(ctx, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		return nil, ErrUserNotFound
+	}
+
+	status := &model.TierStatus{
+		Name:        stats.Tier,
+		Basis:       s.cfg.Basis,
+		WindowStart: since,
+		Accrued:     stats.Accrued,
+		Orders:      stats.Orders,
+	}
+	for _, tier := range s.cfg.Tiers {
+		if tier.Name == stats.Tier {
+			status.BonusPercent = tier.BonusPercent
+		}
+	}
+	// Следующий уровень — первый, порог которого ещё не достигнут по текущим начислениям.
+	metric := s.metric(stats)
+	for _, tier := range s.cfg.Tiers {
+		if tier.Threshold <= metric {
+			continue
+		}
+		status.Next = &model.TierTarget{Name: tier.Name, BonusPercent: tier.BonusPercent}
+		if s.cfg.Basis == model.TierBasisAccrual {
+			status.Next.Accrued = model.Money(tier.Threshold)
+		} else {
+			status.Next.Orders = int(tier.Threshold)
+		}
+		break
+	}
+
+	return &model.Profile{
+		Login:     user.Login,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+		Tier:      status,
+	}, nil
+}
+
+func (s *tierService) Recalculate(ctx context.Context) (int, error) {
+	since := time.Now().Add(-s.cfg.Window)
+	changed := 0
+	var after int64
+	for {
+		list, err := s.tierRepo.ListStats(ctx, since, after, tierBatchSize)
+		if err != nil {
+			return changed, err
+		}
+		for _, stats := range list {
+			after = stats.UserID
+			tier := s.tierFor(s.metric(stats))
+			if tier == stats.Tier {
+				continue
+			}
+			ok, err := s.changeTier(ctx, stats, tier)
+			if err != nil {
+				return changed, fmt.Errorf("failed to change tier of user %d: %w", stats.UserID, err)
+			}
+			if ok {
+				changed++
+			}
+		}
+		if len(list) < tierBatchSize {
+			return changed, nil
+		}
+	}
+}
+
+// changeTier меняет уровень и пишет событие TierChanged. Если уровень успел поменять
+// параллельный пересчёт на другом экземпляре, ничего не делает.
+func (s *tierService) changeTier(ctx context.Context, stats *model.TierStats, tier string) (bool, error) {
+	changed := false
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		changed, err = s.tierRepo.UpdateTier(ctx, stats.UserID, stats.Tier, tier)
+		if err != nil || !changed {
+			return err
+		}
+		return recordEvent(ctx, s.outboxRepo, model.EventTierChanged, model.AggregateUser,
+			strconv.FormatInt(stats.UserID, 10), stats.UserID, model.TierChangedPayload{
+				PreviousTier: stats.Tier,
+				Tier:         tier,
+				Accrued:      stats.Accrued,
+				Orders:       stats.Orders,
+			})
+	})
+	if err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+func (s *tierService) metric(stats *model.TierStats) int64 {
+	if s.cfg.Basis == model.TierBasisOrders {
+		return int64(stats.Orders)
+	}
+	return int64(stats.Accrued)
+}
+
+func (s *tierService) tierFor(metric int64) string {
+	name := model.TierBronze
+	for _, tier := range s.cfg.Tiers {
+		if metric >= tier.Threshold {
+			name = tier.Name
+		}
+	}
+	return name
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTierStatsCountProcessedOrders(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	credit := newCreditTestService(db, repository.NewLedgerRepository(db))
+	credit.completeOrder(ctx, createTestOrder(t, db, user.ID), 10000)
+	credit.completeOrder(ctx, createTestOrder(t, db, user.ID), 5000)
+
+	// Ручная корректировка — не заказ и в счётчик не попадает.
+	staff := createTestUser(t, db)
+	userRepo := repository.NewUserRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	uow := repository.NewUnitOfWork(db)
+	adjustments := NewAdjustmentService(repository.NewAdjustmentRepository(db), userRepo, ledgerRepo,
+		NewExpiryService(repository.NewAccrualLotRepository(db), userRepo, ledgerRepo, repository.NewOutboxRepository(db), uow, PointsExpiryConfig{}),
+		repository.NewAuditRepository(db), uow, 100000)
+	if _, err := adjustments.Create(ctx, model.AdminActor{UserID: staff.ID, Role: model.RoleSupport}, user.ID, 2500, "Goodwill", "SUP-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := repository.NewTierRepository(db).GetStats(ctx, user.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Orders != 2 {
+		t.Errorf("orders = %d, want 2", stats.Orders)
+	}
+	if stats.Accrued != 15000 {
+		t.Errorf("accrued = %s, want 150.00", stats.Accrued)
+	}
+}
+
+func TestTierBonus(t *testing.T) {
+	tests := []struct {
+		accrual model.Money
+		percent int
+		want    model.Money
+	}{
+		{accrual: 10000, percent: 5, want: 500},
+		{accrual: 0, percent: 10, want: 0},
+		{accrual: 12345, percent: 0, want: 0},
+		// 1.50 * 5% = 0.075 — половина копейки округляется вверх.
+		{accrual: 150, percent: 5, want: 8},
+		// 1.49 * 5% = 0.0745.
+		{accrual: 149, percent: 5, want: 7},
+		// 0.09 * 5% = 0.0045 — меньше половины копейки, надбавки нет.
+		{accrual: 9, percent: 5, want: 0},
+		{accrual: 10, percent: 5, want: 1},
+		{accrual: 99999, percent: 10, want: 10000},
+		{accrual: 12345, percent: 100, want: 12345},
+		{accrual: -150, percent: 5, want: -8},
+	}
+	for _, tt := range tests {
+		if got := tierBonus(tt.accrual, tt.percent); got != tt.want {
+			t.Errorf("tierBonus(%d, %d) = %d, want %d", tt.accrual, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestParseTiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		basis   string
+		want    []model.Tier
+		wantErr bool
+	}{
+		{name: "empty", spec: "  ", basis: model.TierBasisAccrual},
+		{
+			name:  "accrual",
+			spec:  " silver:1000:5, GOLD:5000.50:10 ",
+			basis: model.TierBasisAccrual,
+			want: []model.Tier{
+				{Name: "SILVER", Threshold: 100000, BonusPercent: 5},
+				{Name: "GOLD", Threshold: 500050, BonusPercent: 10},
+			},
+		},
+		{
+			name:  "orders",
+			spec:  "SILVER:10:3,GOLD:50:7",
+			basis: model.TierBasisOrders,
+			want: []model.Tier{
+				{Name: "SILVER", Threshold: 10, BonusPercent: 3},
+				{Name: "GOLD", Threshold: 50, BonusPercent: 7},
+			},
+		},
+		{name: "unknown basis", spec: "SILVER:10:3", basis: "visits", wantErr: true},
+		{name: "missing field", spec: "SILVER:1000", basis: model.TierBasisAccrual, wantErr: true},
+		{name: "empty name", spec: ":1000:5", basis: model.TierBasisAccrual, wantErr: true},
+		{name: "bronze", spec: "BRONZE:1000:5", basis: model.TierBasisAccrual, wantErr: true},
+		{name: "repeated", spec: "SILVER:1000:5,silver:2000:6", basis: model.TierBasisAccrual, wantErr: true},
+		{name: "bad amount", spec: "SILVER:lots:5", basis: model.TierBasisAccrual, wantErr: true},
+		{name: "fractional order count", spec: "SILVER:1.5:5", basis: model.TierBasisOrders, wantErr: true},
+		{name: "zero threshold", spec: "SILVER:0:5", basis: model.TierBasisAccrual, wantErr: true},
+		{name: "not increasing", spec: "SILVER:5000:5,GOLD:1000:10", basis: model.TierBasisAccrual, wantErr: true},
+		{name: "percent too high", spec: "SILVER:1000:101", basis: model.TierBasisAccrual, wantErr: true},
+		{name: "negative percent", spec: "SILVER:1000:-1", basis: model.TierBasisAccrual, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTiers(tt.spec, tt.basis)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTiers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("ParseTiers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/util/totp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer = "Gophermart"
+	// totpSkew — сколько соседних шагов принимается из-за расхождения часов.
+	totpSkew           = 1
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotSetUp       = errors.New("two-factor setup has not been started")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+)
+
+type TwoFactorService interface {
+	Setup(ctx context.Context, userID int64) (*model.TOTPSetup, error)
+	Confirm(ctx context.Context, userID int64, code string) ([]string, error)
+	Disable(ctx context.Context, userID int64, password, code string) error
+	Enabled(ctx context.Context, userID int64) (bool, error)
+	Verify(ctx context.Context, userID int64, code string) error
+}
+
+type twoFactorService struct {
+	twoFactorRepo repository.TwoFactorRepository
+	userRepo      repository.UserRepository
+	auditRepo     repository.AuditRepository
+	uow           repository.UnitOfWork
+	limiter       LoginLimiter
+}
+
+func NewTwoFactorService(
+	twoFactorRepo repository.TwoFactorRepository,
+	userRepo repository.UserRepository,
+	auditRepo repository.AuditRepository,
+	uow repository.UnitOfWork,
+	limiter LoginLimiter,
+) TwoFactorService {
+	return &twoFactorService{
+		twoFactorRepo: twoFactorRepo,
+		userRepo:      userRepo,
+		auditRepo:     auditRepo,
+		uow:           uow,
+		limiter:       limiter,
+	}
+}
+
+// Setup выдаёт новый секрет. До подтверждения кодом 2FA не действует, и Setup
+// можно вызывать повторно.
+func (s *twoFactorService) Setup(ctx context.Context, userID int64) (*model.TOTPSetup, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	existing, err := s.twoFactorRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Enabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.twoFactorRepo.SaveTOTPSecret(ctx, userID, secret); err != nil {
+		return nil, err
+	}
+
+	return &model.TOTPSetup{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, user.Login, secret),
+	}, nil
+}
+
+// Confirm включает 2FA по первому верному коду и возвращает коды восстановления.
+// Они показываются только здесь, в базе хранятся их хеши.
+func (s *twoFactorService) Confirm(ctx context.Context, userID int64, code string) ([]string, error) {
+	if err := s.limiter.CheckTwoFactor(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		secret, err := s.twoFactorRepo.GetTOTPForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if secret == nil {
+			return ErrTwoFactorNotSetUp
+		}
+		if secret.Enabled() {
+			return ErrTwoFactorAlreadyEnabled
+		}
+
+		step, ok := totp.Validate(secret.Secret, code, time.Now(), totpSkew)
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		if err := s.twoFactorRepo.ConfirmTOTP(ctx, userID, step); err != nil {
+			return err
+		}
+
+		var hashes []string
+		codes, hashes, err = generateRecoveryCodes()
+		if err != nil {
+			return err
+		}
+		if err := s.twoFactorRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+			return err
+		}
+		if err := s.limiter.RecordTwoFactorSuccess(ctx, userID); err != nil {
+			return err
+		}
+		return s.auditRepo.Record(ctx, &model.AuditEntry{Action: model.AuditTwoFactorEnabled, UserID: &userID})
+	})
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		if recErr := s.limiter.RecordTwoFactorFailure(repository.Detach(ctx), userID); recErr != nil {
+			return nil, recErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable выключает 2FA. Нужны и пароль, и код: одной украденной сессии недостаточно.
+func (s *twoFactorService) Disable(ctx context.Context, userID int64, password, code string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrWrongPassword
+	}
+
+	return s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.Verify(ctx, userID, code); err != nil {
+			return err
+		}
+		if err := s.twoFactorRepo.DeleteTOTP(ctx, userID); err != nil {
+			return err
+		}
+		return s.auditRepo.Record(ctx, &model.AuditEntry{Action: model.AuditTwoFactorDisabled, UserID: &userID})
+	})
+}
+
+func (s *twoFactorService) Enabled(ctx context.Context, userID int64) (bool, error) {
+	secret, err := s.twoFactorRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return secret.Enabled(), nil
+}
+
+// Verify принимает код из приложения или код восстановления. Каждый код действует
+// один раз: для TOTP запоминается последний принятый шаг. Через Verify идут все проверки
+// кода — вход, списания, резервы, отключение 2FA, — и все они считаются одним счётчиком
+// неудачных попыток: после лимита проверка блокируется с ErrTwoFactorLocked.
+func (s *twoFactorService) Verify(ctx context.Context, userID int64, code string) error {
+	if err := s.limiter.CheckTwoFactor(ctx, userID); err != nil {
+		return err
+	}
+
+	err := s.verify(ctx, userID, code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		if recErr := s.limiter.RecordTwoFactorFailure(repository.Detach(ctx), userID); recErr != nil {
+			return recErr
+		}
+	}
+	return err
+}
+
+// verify проверяет код и при успехе в той же транзакции сбрасывает счётчик неудач.
+func (s *twoFactorService) verify(ctx context.Context, userID int64, code string) error {
+	return s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		secret, err := s.twoFactorRepo.GetTOTPForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !secret.Enabled() {
+			return ErrTwoFactorNotEnabled
+		}
+
+		if step, ok := totp.Validate(secret.Secret, code, time.Now(), totpSkew); ok {
+			if step <= secret.LastUsedStep {
+				return ErrInvalidTwoFactorCode
+			}
+			if err := s.twoFactorRepo.MarkTOTPUsed(ctx, userID, step); err != nil {
+				return err
+			}
+			return s.limiter.RecordTwoFactorSuccess(ctx, userID)
+		}
+
+		used, err := s.twoFactorRepo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+		if err := s.limiter.RecordTwoFactorSuccess(ctx, userID); err != nil {
+			return err
+		}
+		return s.auditRepo.Record(ctx, &model.AuditEntry{Action: model.AuditRecoveryCodeUsed, UserID: &userID})
+	})
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for i := range codes {
+		buf := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		raw := strings.ToLower(encoding.EncodeToString(buf)[:recoveryCodeLength])
+		codes[i] = raw[:recoveryCodeLength/2] + "-" + raw[recoveryCodeLength/2:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode не учитывает регистр, дефисы и пробелы, которые пользователь может ввести.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
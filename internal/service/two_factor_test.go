@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/util/totp"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeAttemptRepo struct {
+	repository.LoginAttemptRepository
+
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempt
+}
+
+func newFakeAttemptRepo() *fakeAttemptRepo {
+	return &fakeAttemptRepo{attempts: make(map[string]model.LoginAttempt)}
+}
+
+func (f *fakeAttemptRepo) Get(_ context.Context, scope, key string) (*model.LoginAttempt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	attempt, ok := f.attempts[scope+"/"+key]
+	if !ok {
+		attempt = model.LoginAttempt{Scope: scope, Key: key}
+	}
+	return &attempt, nil
+}
+
+func (f *fakeAttemptRepo) GetForUpdate(ctx context.Context, scope, key string) (*model.LoginAttempt, error) {
+	return f.Get(ctx, scope, key)
+}
+
+func (f *fakeAttemptRepo) Save(_ context.Context, attempt *model.LoginAttempt) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts[attempt.Scope+"/"+attempt.Key] = *attempt
+	return nil
+}
+
+func (f *fakeAttemptRepo) Reset(_ context.Context, scope, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.attempts, scope+"/"+key)
+	return nil
+}
+
+type fakeAudit struct{}
+
+func (fakeAudit) Record(context.Context, *model.AuditEntry) error { return nil }
+
+type fakeTwoFactorRepo struct {
+	repository.TwoFactorRepository
+	totp *model.TOTP
+}
+
+func (f *fakeTwoFactorRepo) GetTOTPForUpdate(context.Context, int64) (*model.TOTP, error) {
+	return f.totp, nil
+}
+
+func (f *fakeTwoFactorRepo) MarkTOTPUsed(_ context.Context, _ int64, step int64) error {
+	f.totp.LastUsedStep = step
+	return nil
+}
+
+func (f *fakeTwoFactorRepo) UseRecoveryCode(context.Context, int64, string) (bool, error) {
+	return false, nil
+}
+
+func TestVerifyLocksAfterFailedCodes(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed := time.Now()
+	limiter := NewLoginLimiter(newFakeAttemptRepo(), fakeAudit{}, fakeUnitOfWork{},
+		LoginLimitConfig{MaxLoginFailures: 5, LockoutDuration: time.Minute})
+	s := NewTwoFactorService(&fakeTwoFactorRepo{totp: &model.TOTP{Secret: secret, ConfirmedAt: &confirmed}},
+		nil, fakeAudit{}, fakeUnitOfWork{}, limiter)
+
+	var locked *ErrTwoFactorLocked
+	for i := 0; i < 5; i++ {
+		err := s.Verify(context.Background(), 1, "000000")
+		if errors.As(err, &locked) {
+			// Задержки начинаются раньше полной блокировки — это тоже отказ без проверки кода.
+			break
+		}
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("attempt %d: error = %v, want ErrInvalidTwoFactorCode", i+1, err)
+		}
+	}
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Verify(context.Background(), 1, code)
+	if !errors.As(err, &locked) {
+		t.Fatalf("correct code after failures: error = %v, want ErrTwoFactorLocked", err)
+	}
+	if locked.RetryAfter <= 0 {
+		t.Errorf("RetryAfter = %v, want positive", locked.RetryAfter)
+	}
+}
+
+func TestTwoFactorFailureSurvivesRollback(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	uow := repository.NewUnitOfWork(db)
+	limiter := NewLoginLimiter(repository.NewLoginAttemptRepository(db), repository.NewAuditRepository(db), uow,
+		LoginLimitConfig{MaxLoginFailures: 1, LockoutDuration: time.Minute})
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	s := NewTwoFactorService(twoFactorRepo, repository.NewUserRepository(db), repository.NewAuditRepository(db), uow, limiter)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := twoFactorRepo.SaveTOTPSecret(ctx, user.ID, secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := twoFactorRepo.ConfirmTOTP(ctx, user.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Как в списании: неверный код откатывает всю транзакцию, но попытка учтена.
+	_ = uow.WithinTx(ctx, func(ctx context.Context) error {
+		return s.Verify(ctx, user.ID, "000000")
+	})
+
+	var locked *ErrTwoFactorLocked
+	if err := limiter.CheckTwoFactor(ctx, user.ID); !errors.As(err, &locked) {
+		t.Fatalf("CheckTwoFactor error = %v, want ErrTwoFactorLocked", err)
+	}
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/worker"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	WebhookSignatureHeader = "X-Gophermart-Signature"
+	WebhookTimestampHeader = "X-Gophermart-Timestamp"
+	WebhookEventHeader     = "X-Gophermart-Event"
+	WebhookDeliveryHeader  = "X-Gophermart-Delivery"
+
+	webhookBatchSize     = 50
+	webhookWorkers       = 8
+	webhookLease         = 5 * time.Minute
+	webhookTimeout       = 10 * time.Second
+	webhookMaxAttempts   = 8
+	webhookBaseBackoff   = 10 * time.Second
+	webhookMaxBackoff    = time.Hour
+	webhookDeliveryLimit = 100
+)
+
+var (
+	ErrWebhookNotFound      = errors.New("webhook not found")
+	ErrWebhookInvalidURL    = errors.New("webhook url must be an absolute http(s) url")
+	ErrWebhookInvalidEvents = errors.New("unknown or empty webhook events")
+	ErrWebhookForbiddenHost = errors.New("webhook url must point to a public address")
+)
+
+// webhookBlockedPrefixes — непубличные сети, которых нет среди проверок netip.Addr.
+var webhookBlockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	// CGNAT; здесь же метаданные Alibaba Cloud 100.100.100.200.
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	// NAT64 может вести во внутреннюю IPv4-сеть.
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+type WebhookService interface {
+	Register(ctx context.Context, userID int64, rawURL string, events []string) (*model.Webhook, error)
+	List(ctx context.Context, userID int64) ([]*model.Webhook, error)
+	Delete(ctx context.Context, userID, id int64) error
+	Deliveries(ctx context.Context, userID, id int64) ([]*model.WebhookDelivery, error)
+	// Notify ставит событие в outbox подписок пользователя. Вызывается внутри
+	// транзакции изменения, чтобы событие записалось вместе с ним.
+	Notify(ctx context.Context, userID int64, eventType string, data any) error
+	// Dispatch отправляет накопившиеся сообщения, которым подошло время.
+	Dispatch(ctx context.Context) error
+}
+
+type webhookService struct {
+	repo       repository.WebhookRepository
+	httpClient *http.Client
+	resolver   *net.Resolver
+	// allowAddr решает, можно ли ходить на адрес; в тестах разрешает loopback.
+	allowAddr func(netip.Addr) bool
+	logger    *zap.Logger
+}
+
+func NewWebhookService(repo repository.WebhookRepository, logger *zap.Logger) WebhookService {
+	return newWebhookService(repo, webhookAddrAllowed, logger)
+}
+
+func newWebhookService(repo repository.WebhookRepository, allowAddr func(netip.Addr) bool, logger *zap.Logger) *webhookService {
+	return &webhookService{
+		repo:       repo,
+		httpClient: newWebhookHTTPClient(allowAddr),
+		resolver:   net.DefaultResolver,
+		allowAddr:  allowAddr,
+		logger:     logger,
+	}
+}
+
+// newWebhookHTTPClient проверяет адрес уже после резолва, в момент соединения: DNS подписки
+// мог смениться после регистрации, а редирект — увести на другой хост. Прокси не используется,
+// иначе проверялся бы адрес прокси, а не получателя.
+func newWebhookHTTPClient(allowAddr func(netip.Addr) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !allowAddr(addr) {
+				return fmt.Errorf("%w: %s", ErrWebhookForbiddenHost, addr)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
+
+// webhookAddrAllowed пропускает только публичные адреса: loopback, частные сети RFC 1918
+// и fc00::/7, link-local (в том числе метаданные облаков 169.254.169.254) и прочие
+// служебные диапазоны запрещены.
+func webhookAddrAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range webhookBlockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHost резолвит хост подписки и отказывает, если хотя бы один из адресов непубличный.
+func (s *webhookService) checkHost(ctx context.Context, host string) error {
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = append(addrs, addr)
+	} else {
+		addrs, err = s.resolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return fmt.Errorf("%w: cannot resolve %s", ErrWebhookInvalidURL, host)
+		}
+	}
+	for _, addr := range addrs {
+		if !s.allowAddr(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrWebhookForbiddenHost, host, addr.Unmap())
+		}
+	}
+	return nil
+}
+
+func (s *webhookService) Register(ctx context.Context, userID int64, rawURL string, events []string) (*model.Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrWebhookInvalidURL
+	}
+	if err := s.checkHost(ctx, u.Hostname()); err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 {
+		return nil, ErrWebhookInvalidEvents
+	}
+	for _, event := range events {
+		if !slices.Contains(model.WebhookEvents, event) {
+			return nil, ErrWebhookInvalidEvents
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	webhook := &model.Webhook{
+		UserID: userID,
+		URL:    u.String(),
+		Secret: "whsec_" + hex.EncodeToString(secret),
+		Events: slices.Compact(slices.Sorted(slices.Values(events))),
+	}
+	if err := s.repo.Create(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *webhookService) List(ctx context.Context, userID int64) ([]*model.Webhook, error) {
+	return s.repo.GetByUserID(ctx, userID)
+}
+
+func (s *webhookService) Delete(ctx context.Context, userID, id int64) error {
+	deleted, err := s.repo.Deactivate(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (s *webhookService) Deliveries(ctx context.Context, userID, id int64) ([]*model.WebhookDelivery, error) {
+	webhook, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if webhook == nil {
+		return nil, ErrWebhookNotFound
+	}
+	return s.repo.GetDeliveries(ctx, id, webhookDeliveryLimit)
+}
+
+func (s *webhookService) Notify(ctx context.Context, userID int64, eventType string, data any) error {
+	payload, err := json.Marshal(struct {
+		Type      string    `json:"type"`
+		CreatedAt time.Time `json:"created_at"`
+		Data      any       `json:"data"`
+	}{eventType, time.Now(), data})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	return s.repo.Enqueue(ctx, userID, eventType, payload)
+}
+
+func (s *webhookService) Dispatch(ctx context.Context) error {
+	messages, err := s.repo.ClaimDue(ctx, webhookBatchSize, webhookLease)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	pool := worker.NewPool(webhookWorkers, len(messages))
+	pool.Start(ctx)
+	for _, message := range messages {
+		if err := pool.Submit(ctx, func(ctx context.Context) { s.deliver(ctx, message) }); err != nil {
+			break
+		}
+	}
+	pool.Close()
+
+	return nil
+}
+
+func (s *webhookService) deliver(ctx context.Context, message *model.WebhookMessage) {
+	attempt := message.Attempts + 1
+	started := time.Now()
+	statusCode, err := s.send(ctx, message)
+
+	delivery := &model.WebhookDelivery{
+		MessageID:  message.ID,
+		Attempt:    attempt,
+		StatusCode: statusCode,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	if recErr := s.repo.RecordDelivery(ctx, message.WebhookID, delivery); recErr != nil {
+		s.logger.Warn("Failed to record webhook delivery",
+			zap.Int64("message_id", message.ID),
+			zap.Error(recErr))
+	}
+
+	switch {
+	case err == nil:
+		err = s.repo.MarkDelivered(ctx, message.ID)
+	case attempt >= webhookMaxAttempts:
+		s.logger.Warn("Webhook delivery failed permanently",
+			zap.Int64("message_id", message.ID),
+			zap.String("url", message.URL),
+			zap.Int("attempts", attempt))
+		err = s.repo.MarkFailed(ctx, message.ID)
+	default:
+		err = s.repo.ScheduleRetry(ctx, message.ID, time.Now().Add(webhookBackoff(attempt)))
+	}
+	if err != nil {
+		s.logger.Error("Failed to update webhook message",
+			zap.Int64("message_id", message.ID),
+			zap.Error(err))
+	}
+}
+
+func (s *webhookService) send(ctx context.Context, message *model.WebhookMessage) (int, error) {
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, message.URL, bytes.NewReader(message.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, message.EventType)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(message.ID, 10))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(message.Secret, timestamp, message.Payload))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload вычисляет подпись "sha256=<hex>" как HMAC-SHA256 секрета подписки
+// от строки "<timestamp>.<тело запроса>". Получатель проверяет её тем же способом.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookBackoff(attempt int) time.Duration {
+	backoff := webhookBaseBackoff << (attempt - 1)
+	if backoff <= 0 || backoff > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	return backoff
+}
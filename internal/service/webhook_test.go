@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeWebhookRepo хранит подписки и результаты доставок в памяти.
+type fakeWebhookRepo struct {
+	repository.WebhookRepository
+
+	mu         sync.Mutex
+	created    []*model.Webhook
+	due        []*model.WebhookMessage
+	deliveries []*model.WebhookDelivery
+	delivered  []int64
+	retries    []int64
+	failed     []int64
+}
+
+func (f *fakeWebhookRepo) Create(_ context.Context, webhook *model.Webhook) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	webhook.ID = int64(len(f.created) + 1)
+	f.created = append(f.created, webhook)
+	return nil
+}
+
+func (f *fakeWebhookRepo) ClaimDue(context.Context, int, time.Duration) ([]*model.WebhookMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	due := f.due
+	f.due = nil
+	return due, nil
+}
+
+func (f *fakeWebhookRepo) RecordDelivery(_ context.Context, _ int64, delivery *model.WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deliveries = append(f.deliveries, delivery)
+	return nil
+}
+
+func (f *fakeWebhookRepo) MarkDelivered(_ context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.delivered = append(f.delivered, id)
+	return nil
+}
+
+func (f *fakeWebhookRepo) ScheduleRetry(_ context.Context, id int64, _ time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.retries = append(f.retries, id)
+	return nil
+}
+
+func (f *fakeWebhookRepo) MarkFailed(_ context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failed = append(f.failed, id)
+	return nil
+}
+
+func allowAnyAddr(netip.Addr) bool { return true }
+
+func TestWebhookAddrAllowed(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.0.10", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := webhookAddrAllowed(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("webhookAddrAllowed(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookRegisterRejectsInternalHosts(t *testing.T) {
+	s := NewWebhookService(&fakeWebhookRepo{}, zap.NewNop())
+	for _, rawURL := range []string{
+		"http://127.0.0.1/hook",
+		"http://localhost:8080/hook",
+		"http://[::1]/hook",
+		"http://10.0.0.5/hook",
+		"https://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::ffff:169.254.169.254]/",
+	} {
+		_, err := s.Register(context.Background(), 1, rawURL, []string{model.WebhookEventOrderProcessed})
+		if !errors.Is(err, ErrWebhookForbiddenHost) {
+			t.Errorf("Register(%s) error = %v, want ErrWebhookForbiddenHost", rawURL, err)
+		}
+	}
+
+	repo := &fakeWebhookRepo{}
+	s = NewWebhookService(repo, zap.NewNop())
+	if _, err := s.Register(context.Background(), 1, "https://93.184.216.34/hook", []string{model.WebhookEventOrderProcessed}); err != nil {
+		t.Fatalf("Register(public) error = %v", err)
+	}
+	if len(repo.created) != 1 {
+		t.Errorf("created = %d, want 1", len(repo.created))
+	}
+}
+
+func TestWebhookDeliveryRefusesInternalAddressAtDial(t *testing.T) {
+	var hits int
+	receiver := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { hits++ }))
+	defer receiver.Close()
+
+	repo := &fakeWebhookRepo{}
+	s := newWebhookService(repo, webhookAddrAllowed, zap.NewNop())
+	s.deliver(context.Background(), &model.WebhookMessage{ID: 1, WebhookID: 1, URL: receiver.URL, Secret: "s", Payload: []byte(`{}`)})
+
+	if hits != 0 {
+		t.Errorf("receiver hits = %d, want 0", hits)
+	}
+	if len(repo.deliveries) != 1 || repo.deliveries[0].Error == "" {
+		t.Fatalf("deliveries = %+v, want one failed delivery", repo.deliveries)
+	}
+	if len(repo.retries) != 1 {
+		t.Errorf("retries = %d, want 1", len(repo.retries))
+	}
+}
+
+func TestWebhookDispatchSignsRetriesAndRecords(t *testing.T) {
+	const secret = "whsec_test"
+	payload := []byte(`{"type":"order.processed","data":{"number":"1001"}}`)
+
+	var (
+		mu       sync.Mutex
+		statuses = []int{http.StatusInternalServerError, http.StatusOK}
+		requests int
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+		if err != nil {
+			t.Errorf("bad timestamp header: %v", err)
+		}
+		if got, want := r.Header.Get(WebhookSignatureHeader), SignWebhookPayload(secret, timestamp, body); got != want {
+			t.Errorf("signature = %s, want %s", got, want)
+		}
+		if got := r.Header.Get(WebhookEventHeader); got != model.WebhookEventOrderProcessed {
+			t.Errorf("event header = %s", got)
+		}
+		if got := r.Header.Get(WebhookDeliveryHeader); got != "7" {
+			t.Errorf("delivery header = %s, want 7", got)
+		}
+		if string(body) != string(payload) {
+			t.Errorf("body = %s, want %s", body, payload)
+		}
+
+		mu.Lock()
+		status := statuses[requests]
+		requests++
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	repo := &fakeWebhookRepo{}
+	s := newWebhookService(repo, allowAnyAddr, zap.NewNop())
+	message := &model.WebhookMessage{
+		ID:        7,
+		WebhookID: 3,
+		URL:       receiver.URL,
+		Secret:    secret,
+		EventType: model.WebhookEventOrderProcessed,
+		Payload:   payload,
+	}
+
+	repo.due = []*model.WebhookMessage{message}
+	if err := s.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch error = %v", err)
+	}
+	if len(repo.retries) != 1 || len(repo.delivered) != 0 {
+		t.Fatalf("after 500: retries = %v, delivered = %v", repo.retries, repo.delivered)
+	}
+
+	message.Attempts = 1
+	repo.due = []*model.WebhookMessage{message}
+	if err := s.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch error = %v", err)
+	}
+	if len(repo.delivered) != 1 || repo.delivered[0] != 7 {
+		t.Fatalf("after 200: delivered = %v", repo.delivered)
+	}
+
+	if len(repo.deliveries) != 2 {
+		t.Fatalf("deliveries = %d, want 2", len(repo.deliveries))
+	}
+	first, second := repo.deliveries[0], repo.deliveries[1]
+	if first.Attempt != 1 || first.StatusCode != http.StatusInternalServerError || first.Error == "" {
+		t.Errorf("first delivery = %+v", first)
+	}
+	if second.Attempt != 2 || second.StatusCode != http.StatusOK || second.Error != "" {
+		t.Errorf("second delivery = %+v", second)
+	}
+}
+
+func TestWebhookDeliveryGivesUpAfterMaxAttempts(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	repo := &fakeWebhookRepo{}
+	s := newWebhookService(repo, allowAnyAddr, zap.NewNop())
+	s.deliver(context.Background(), &model.WebhookMessage{
+		ID:       9,
+		URL:      receiver.URL,
+		Secret:   "s",
+		Payload:  []byte(`{}`),
+		Attempts: webhookMaxAttempts - 1,
+	})
+
+	if len(repo.failed) != 1 || len(repo.retries) != 0 {
+		t.Errorf("failed = %v, retries = %v, want one permanent failure", repo.failed, repo.retries)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, webhookBaseBackoff},
+		{2, 2 * webhookBaseBackoff},
+		{4, 8 * webhookBaseBackoff},
+		{20, webhookMaxBackoff},
+		{70, webhookMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempt); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
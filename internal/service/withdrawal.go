@@ -2,80 +2,495 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
 	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/util/luhn"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var (
 	ErrWithdrawalInsufficientFunds  = errors.New("insufficient funds")
 	ErrWithdrawalInvalidOrderNumber = errors.New("invalid order number")
+	ErrWithdrawalInvalidSum         = errors.New("withdrawal sum must be positive")
+	ErrWithdrawalOrderAlreadyUsed   = errors.New("order number already used for withdrawal")
+	ErrWithdrawalTwoFactorRequired  = errors.New("two-factor code required for this withdrawal")
+	ErrWithdrawalNotFound           = errors.New("withdrawal not found")
+	ErrWithdrawalNotPending         = errors.New("withdrawal is not pending")
+	ErrWithdrawalAlreadyReversed    = errors.New("withdrawal already reversed")
+	ErrWithdrawalReversalTooLarge   = errors.New("reversal exceeds the remaining withdrawal sum")
+	ErrWithdrawalReasonRequired     = errors.New("reversal reason is required")
+	ErrWithdrawalForbidden          = errors.New("role is not allowed to review withdrawals")
+	ErrReversalNotFound             = errors.New("reversal not found")
+	ErrReversalNotPending           = errors.New("reversal is not pending")
+	ErrReversalSelfApproval         = errors.New("reversal must be approved by another admin")
 )
 
+// withdrawalCompleteBatch — сколько списаний подтверждается автоматически за одну транзакцию.
+const withdrawalCompleteBatch = 100
+
+type WithdrawalConfig struct {
+	// TwoFactorThreshold — списания больше этой суммы требуют кода 2FA; 0 — не требуют.
+	TwoFactorThreshold model.Money
+	// ReversalApprovalThreshold — возвраты больше этой суммы ждут подтверждения другого
+	// администратора; 0 — подтверждение нужно для любой суммы.
+	ReversalApprovalThreshold model.Money
+	HoldTTL                   time.Duration
+	// AutoComplete — через сколько списание в PENDING подтверждается без ответа партнёра.
+	AutoComplete time.Duration
+}
+
 type WithdrawalService interface {
-	Withdraw(ctx context.Context, userID int64, orderNumber string, sum float64) error
-	GetWithdrawals(ctx context.Context, userID int64) ([]*model.Withdrawal, error)
+	Withdraw(ctx context.Context, userID int64, orderNumber string, sum model.Money, code string) error
+	GetWithdrawals(ctx context.Context, userID int64, filter model.ListFilter) (*model.Page[*model.Withdrawal], error)
+	// Complete подтверждает списание после покупки у партнёра. Вызывают поддержка, администратор
+	// или партнёрская система по API-ключу; без ответа списание подтверждает CompleteOverdue.
+	Complete(ctx context.Context, actor model.AdminActor, orderNumber string) (*model.Withdrawal, error)
+	// CompleteOverdue подтверждает списания, ждущие дольше AutoComplete, и возвращает их число.
+	CompleteOverdue(ctx context.Context) (int, error)
+	// Reverse возвращает на баланс sum из списания (0 — весь остаток), например при отмене покупки.
+	// Возврат больше порога подтверждения остаётся в PENDING до ApproveReversal.
+	Reverse(ctx context.Context, actor model.AdminActor, orderNumber string, sum model.Money, reason string) (*model.WithdrawalReversal, error)
+	ApproveReversal(ctx context.Context, actor model.AdminActor, id int64) (*model.WithdrawalReversal, error)
+	RejectReversal(ctx context.Context, actor model.AdminActor, id int64) (*model.WithdrawalReversal, error)
+
+	// Hold резервирует sum под заказ на ttl (0 — срок по умолчанию).
+	Hold(ctx context.Context, userID int64, orderNumber string, sum model.Money, ttl time.Duration, code string) (*model.Hold, error)
+	GetHolds(ctx context.Context, userID int64) ([]*model.Hold, error)
+	// Capture превращает резерв в списание на sum (0 — вся сумма); остаток резерва снимается.
+	Capture(ctx context.Context, userID, holdID int64, sum model.Money) (*model.Withdrawal, error)
+	Release(ctx context.Context, userID, holdID int64) error
+	// ReleaseExpiredHolds снимает просроченные резервы и возвращает их число.
+	ReleaseExpiredHolds(ctx context.Context) (int, error)
 }
 
 type withdrawalService struct {
 	withdrawalRepo repository.WithdrawalRepository
+	holdRepo       repository.HoldRepository
 	userRepo       repository.UserRepository
+	ledgerRepo     repository.LedgerRepository
+	expiry         ExpiryService
+	webhooks       WebhookService
+	outboxRepo     repository.OutboxRepository
+	auditRepo      repository.AuditRepository
+	uow            repository.UnitOfWork
+	twoFactor      TwoFactorService
+	cfg            WithdrawalConfig
 }
 
 func NewWithdrawalService(
 	withdrawalRepo repository.WithdrawalRepository,
+	holdRepo repository.HoldRepository,
 	userRepo repository.UserRepository,
+	ledgerRepo repository.LedgerRepository,
+	expiry ExpiryService,
+	webhooks WebhookService,
+	outboxRepo repository.OutboxRepository,
+	auditRepo repository.AuditRepository,
+	uow repository.UnitOfWork,
+	twoFactor TwoFactorService,
+	cfg WithdrawalConfig,
 ) WithdrawalService {
+	if cfg.HoldTTL <= 0 {
+		cfg.HoldTTL = 15 * time.Minute
+	}
+	if cfg.AutoComplete <= 0 {
+		cfg.AutoComplete = 72 * time.Hour
+	}
 	return &withdrawalService{
 		withdrawalRepo: withdrawalRepo,
+		holdRepo:       holdRepo,
 		userRepo:       userRepo,
+		ledgerRepo:     ledgerRepo,
+		expiry:         expiry,
+		webhooks:       webhooks,
+		outboxRepo:     outboxRepo,
+		auditRepo:      auditRepo,
+		uow:            uow,
+		twoFactor:      twoFactor,
+		cfg:            cfg,
 	}
 }
 
-func (s *withdrawalService) Withdraw(ctx context.Context, userID int64, orderNumber string, sum float64) error {
+// Withdraw списывает баллы. Списание больше порога требует включённой 2FA и кода;
+// код проверяется в той же транзакции, поэтому при отказе в списании он не сгорает.
+func (s *withdrawalService) Withdraw(ctx context.Context, userID int64, orderNumber string, sum model.Money, code string) error {
 	if !luhn.Validate(orderNumber) {
 		return ErrWithdrawalInvalidOrderNumber
 	}
-
-	// Проверяем баланс в транзакции
-	tx, err := s.userRepo.BeginTx(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+	if sum <= 0 {
+		return ErrWithdrawalInvalidSum
 	}
-	defer tx.Rollback()
 
-	//balance, err := s.userRepo.GetBalance(ctx, userID)
-	//if err != nil {
-	//	return fmt.Errorf("failed to get balance: %w", err)
-	//}
+	return s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.verifySecondFactor(ctx, userID, sum, code); err != nil {
+			return err
+		}
+
+		// Строка пользователя остаётся заблокированной до коммита,
+		// поэтому параллельные списания не могут увести баланс в минус.
+		balance, err := s.userRepo.GetBalanceForUpdate(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get balance: %w", err)
+		}
+
+		if balance.Available < sum {
+			return ErrWithdrawalInsufficientFunds
+		}
 
-	//if balance.Current < sum {
-	//	return ErrWithdrawalInsufficientFunds
-	//}
+		// Номер под активным резервом занят: иначе последующий Capture упрётся в уникальный индекс.
+		if err := s.withdrawalRepo.LockOrder(ctx, orderNumber); err != nil {
+			return err
+		}
+		held, err := s.holdRepo.HasActiveForOrder(ctx, orderNumber)
+		if err != nil {
+			return err
+		}
+		if held {
+			return ErrHoldOrderExists
+		}
 
-	// Создаем запись о выводе
+		_, err = s.debit(ctx, userID, orderNumber, sum, model.WithdrawalPending)
+		return err
+	})
+}
+
+// verifySecondFactor требует код 2FA для сумм больше порога. Вызывается внутри транзакции
+// списания или резерва, чтобы код не сгорал при отказе.
+func (s *withdrawalService) verifySecondFactor(ctx context.Context, userID int64, sum model.Money, code string) error {
+	if s.cfg.TwoFactorThreshold <= 0 || sum <= s.cfg.TwoFactorThreshold {
+		return nil
+	}
+	if code == "" {
+		return ErrWithdrawalTwoFactorRequired
+	}
+	if err := s.twoFactor.Verify(ctx, userID, code); err != nil {
+		if errors.Is(err, ErrTwoFactorNotEnabled) {
+			return ErrWithdrawalTwoFactorRequired
+		}
+		return err
+	}
+	return nil
+}
+
+// debit создаёт списание и проводит его по балансу, журналу, outbox и вебхукам.
+// Баланс пользователя к этому моменту должен быть заблокирован и проверен.
+func (s *withdrawalService) debit(ctx context.Context, userID int64, orderNumber string, sum model.Money, status string) (*model.Withdrawal, error) {
 	withdrawal := &model.Withdrawal{
 		Order:       orderNumber,
 		UserID:      userID,
 		Sum:         sum,
+		Status:      status,
 		ProcessedAt: time.Now(),
 	}
 
 	if err := s.withdrawalRepo.Create(ctx, withdrawal); err != nil {
-		return fmt.Errorf("failed to create withdrawal: %w", err)
+		if errors.Is(err, repository.ErrWithdrawalOrderExists) {
+			return nil, ErrWithdrawalOrderAlreadyUsed
+		}
+		return nil, fmt.Errorf("failed to create withdrawal: %w", err)
+	}
+
+	if err := s.userRepo.DebitWithdrawal(ctx, userID, sum); err != nil {
+		return nil, fmt.Errorf("failed to update balance: %w", err)
+	}
+	if err := s.expiry.ConsumeWithdrawal(ctx, userID, withdrawal.ID, sum); err != nil {
+		return nil, err
 	}
 
-	// Обновляем баланс
-	if err := s.userRepo.UpdateBalance(ctx, userID, -sum); err != nil {
-		return fmt.Errorf("failed to update balance: %w", err)
+	if err := s.ledgerRepo.Post(ctx, &model.LedgerPosting{
+		UserID:         userID,
+		Amount:         -sum,
+		Kind:           model.LedgerKindWithdrawal,
+		CounterAccount: model.LedgerAccountRedemption,
+		OrderNumber:    orderNumber,
+		WithdrawalID:   withdrawal.ID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record withdrawal in ledger: %w", err)
 	}
 
-	return tx.Commit()
+	if err := recordEvent(ctx, s.outboxRepo, model.EventWithdrawalCreated, model.AggregateWithdrawal,
+		strconv.FormatInt(withdrawal.ID, 10), userID,
+		model.WithdrawalCreatedPayload{Order: orderNumber, Sum: sum, ProcessedAt: withdrawal.ProcessedAt}); err != nil {
+		return nil, err
+	}
+
+	if err := s.webhooks.Notify(ctx, userID, model.WebhookEventWithdrawalCreated, withdrawal); err != nil {
+		return nil, fmt.Errorf("failed to enqueue withdrawal webhook: %w", err)
+	}
+
+	return withdrawal, nil
+}
+
+func (s *withdrawalService) GetWithdrawals(ctx context.Context, userID int64, filter model.ListFilter) (*model.Page[*model.Withdrawal], error) {
+	return s.withdrawalRepo.GetByUserID(ctx, userID, filter)
+}
+
+func (s *withdrawalService) Complete(ctx context.Context, actor model.AdminActor, orderNumber string) (*model.Withdrawal, error) {
+	if !isStaff(actor) {
+		return nil, ErrWithdrawalForbidden
+	}
+
+	var withdrawal *model.Withdrawal
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		withdrawal, err = s.withdrawalRepo.GetByOrderForUpdate(ctx, orderNumber)
+		if err != nil {
+			return err
+		}
+		if withdrawal == nil {
+			return ErrWithdrawalNotFound
+		}
+		if withdrawal.Status != model.WithdrawalPending {
+			return ErrWithdrawalNotPending
+		}
+		return s.complete(ctx, actor, withdrawal)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return withdrawal, nil
+}
+
+// CompleteOverdue подтверждает списания от имени системы: в журнале аудита у них нет actor_id.
+func (s *withdrawalService) CompleteOverdue(ctx context.Context) (int, error) {
+	completed := 0
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		withdrawals, err := s.withdrawalRepo.ClaimPendingBefore(ctx, time.Now().Add(-s.cfg.AutoComplete), withdrawalCompleteBatch)
+		if err != nil {
+			return err
+		}
+		for _, withdrawal := range withdrawals {
+			if err := s.complete(ctx, model.AdminActor{IP: "system"}, withdrawal); err != nil {
+				return err
+			}
+		}
+		completed = len(withdrawals)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return completed, nil
 }
 
-func (s *withdrawalService) GetWithdrawals(ctx context.Context, userID int64) ([]*model.Withdrawal, error) {
-	return s.withdrawalRepo.GetByUserID(ctx, userID)
+func (s *withdrawalService) complete(ctx context.Context, actor model.AdminActor, withdrawal *model.Withdrawal) error {
+	withdrawal.Status = model.WithdrawalCompleted
+	if err := s.withdrawalRepo.UpdateStatus(ctx, withdrawal); err != nil {
+		return err
+	}
+	return s.audit(ctx, actor, model.AuditWithdrawalCompleted, withdrawal, map[string]any{"order": withdrawal.Order})
+}
+
+// Reverse возвращает баллы и уменьшает withdrawn. Возвраты копятся в reversed_sum;
+// когда возвращена вся сумма, списание переходит в REVERSED. Возвраты, ждущие
+// подтверждения, уже занимают часть остатка.
+func (s *withdrawalService) Reverse(ctx context.Context, actor model.AdminActor, orderNumber string, sum model.Money, reason string) (*model.WithdrawalReversal, error) {
+	if !isStaff(actor) {
+		return nil, ErrWithdrawalForbidden
+	}
+	if sum < 0 {
+		return nil, ErrWithdrawalInvalidSum
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrWithdrawalReasonRequired
+	}
+
+	var reversal *model.WithdrawalReversal
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		withdrawal, err := s.withdrawalRepo.GetByOrderForUpdate(ctx, orderNumber)
+		if err != nil {
+			return err
+		}
+		if withdrawal == nil {
+			return ErrWithdrawalNotFound
+		}
+		if withdrawal.Status == model.WithdrawalReversed {
+			return ErrWithdrawalAlreadyReversed
+		}
+
+		pending, err := s.withdrawalRepo.PendingReversalSum(ctx, withdrawal.ID)
+		if err != nil {
+			return err
+		}
+		remaining := withdrawal.Sum - withdrawal.ReversedSum - pending
+		if sum == 0 {
+			sum = remaining
+		}
+		if sum <= 0 || sum > remaining {
+			return ErrWithdrawalReversalTooLarge
+		}
+
+		reversal = &model.WithdrawalReversal{
+			WithdrawalID: withdrawal.ID,
+			Order:        withdrawal.Order,
+			Sum:          sum,
+			Reason:       reason,
+			Status:       model.ReversalPending,
+			ActorID:      actor.UserID,
+		}
+		if sum > s.cfg.ReversalApprovalThreshold {
+			if err := s.withdrawalRepo.AddReversal(ctx, reversal); err != nil {
+				return err
+			}
+			return s.audit(ctx, actor, model.AuditReversalRequested, withdrawal,
+				map[string]any{"order": withdrawal.Order, "reversal_id": reversal.ID, "sum": sum, "reason": reason})
+		}
+
+		reversal.Status = model.ReversalApplied
+		if err := s.withdrawalRepo.AddReversal(ctx, reversal); err != nil {
+			return err
+		}
+		return s.applyReversal(ctx, actor, withdrawal, reversal)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// ApproveReversal проводит ожидающий возврат. Подтверждает только администратор,
+// и не тот, кто возврат запросил.
+func (s *withdrawalService) ApproveReversal(ctx context.Context, actor model.AdminActor, id int64) (*model.WithdrawalReversal, error) {
+	return s.reviewReversal(ctx, actor, id, func(ctx context.Context, reversal *model.WithdrawalReversal) error {
+		withdrawal, err := s.withdrawalRepo.GetByOrderForUpdate(ctx, reversal.Order)
+		if err != nil {
+			return err
+		}
+		if withdrawal == nil {
+			return ErrWithdrawalNotFound
+		}
+		if reversal.Sum > withdrawal.Sum-withdrawal.ReversedSum {
+			return ErrWithdrawalReversalTooLarge
+		}
+		reversal.Status = model.ReversalApplied
+		return s.applyReversal(ctx, actor, withdrawal, reversal)
+	})
+}
+
+func (s *withdrawalService) RejectReversal(ctx context.Context, actor model.AdminActor, id int64) (*model.WithdrawalReversal, error) {
+	return s.reviewReversal(ctx, actor, id, func(ctx context.Context, reversal *model.WithdrawalReversal) error {
+		reversal.Status = model.ReversalRejected
+		details, err := json.Marshal(map[string]any{"order": reversal.Order, "reversal_id": reversal.ID, "sum": reversal.Sum})
+		if err != nil {
+			return err
+		}
+		return s.auditRepo.Record(ctx, &model.AuditEntry{
+			Action:  model.AuditReversalRejected,
+			ActorID: &actor.UserID,
+			IP:      actor.IP,
+			Details: details,
+		})
+	})
+}
+
+func (s *withdrawalService) reviewReversal(ctx context.Context, actor model.AdminActor, id int64, decide func(ctx context.Context, reversal *model.WithdrawalReversal) error) (*model.WithdrawalReversal, error) {
+	if actor.Role != model.RoleAdmin {
+		return nil, ErrWithdrawalForbidden
+	}
+
+	var reversal *model.WithdrawalReversal
+	err := s.uow.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		reversal, err = s.withdrawalRepo.GetReversalForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		if reversal == nil {
+			return ErrReversalNotFound
+		}
+		if reversal.Status != model.ReversalPending {
+			return ErrReversalNotPending
+		}
+		if reversal.ActorID == actor.UserID {
+			return ErrReversalSelfApproval
+		}
+
+		now := time.Now()
+		reversal.ReviewedBy = &actor.UserID
+		reversal.ReviewedAt = &now
+		if err := decide(ctx, reversal); err != nil {
+			return err
+		}
+		return s.withdrawalRepo.ReviewReversal(ctx, reversal)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// applyReversal возвращает sum возврата на баланс. Списание должно быть заблокировано.
+func (s *withdrawalService) applyReversal(ctx context.Context, actor model.AdminActor, withdrawal *model.Withdrawal, reversal *model.WithdrawalReversal) error {
+	sum := reversal.Sum
+	withdrawal.ReversedSum += sum
+	if withdrawal.ReversedSum == withdrawal.Sum {
+		withdrawal.Status = model.WithdrawalReversed
+	}
+	if err := s.withdrawalRepo.UpdateStatus(ctx, withdrawal); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.CreditReversal(ctx, withdrawal.UserID, sum); err != nil {
+		return err
+	}
+	if err := s.expiry.Restore(ctx, withdrawal.UserID, withdrawal.ID, withdrawal.Order, sum); err != nil {
+		return err
+	}
+	if err := s.ledgerRepo.Post(ctx, &model.LedgerPosting{
+		UserID:         withdrawal.UserID,
+		Amount:         sum,
+		Kind:           model.LedgerKindReversal,
+		CounterAccount: model.LedgerAccountRedemption,
+		OrderNumber:    withdrawal.Order,
+		WithdrawalID:   withdrawal.ID,
+		Description:    reversal.Reason,
+	}); err != nil {
+		return fmt.Errorf("failed to record reversal in ledger: %w", err)
+	}
+
+	payload := model.WithdrawalReversedPayload{
+		Order:       withdrawal.Order,
+		Sum:         sum,
+		ReversedSum: withdrawal.ReversedSum,
+		Status:      withdrawal.Status,
+		Reason:      reversal.Reason,
+	}
+	if err := recordEvent(ctx, s.outboxRepo, model.EventWithdrawalReversed, model.AggregateWithdrawal,
+		strconv.FormatInt(withdrawal.ID, 10), withdrawal.UserID, payload); err != nil {
+		return err
+	}
+	if err := s.webhooks.Notify(ctx, withdrawal.UserID, model.WebhookEventWithdrawalReversed, payload); err != nil {
+		return fmt.Errorf("failed to enqueue reversal webhook: %w", err)
+	}
+	return s.audit(ctx, actor, model.AuditWithdrawalReversed, withdrawal,
+		map[string]any{"order": withdrawal.Order, "reversal_id": reversal.ID, "sum": sum, "reason": reversal.Reason})
+}
+
+func isStaff(actor model.AdminActor) bool {
+	return actor.Role == model.RoleSupport || actor.Role == model.RoleAdmin
+}
+
+// audit пишет действие над списанием; у системных действий нет actor_id.
+func (s *withdrawalService) audit(ctx context.Context, actor model.AdminActor, action string, withdrawal *model.Withdrawal, details map[string]any) error {
+	raw, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	var actorID *int64
+	if actor.UserID != 0 {
+		actorID = &actor.UserID
+	}
+	return s.auditRepo.Record(ctx, &model.AuditEntry{
+		Action:  action,
+		UserID:  &withdrawal.UserID,
+		ActorID: actorID,
+		IP:      actor.IP,
+		Details: raw,
+	})
 }
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"sync"
+	"testing"
+	"time"
+)
+
+// luhnNumber дописывает к префиксу контрольную цифру по алгоритму Луна.
+func luhnNumber(prefix string) string {
+	sum := 0
+	for i := len(prefix) - 1; i >= 0; i-- {
+		d := int(prefix[i] - '0')
+		if (len(prefix)-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return fmt.Sprintf("%s%d", prefix, (10-sum%10)%10)
+}
+
+func newWithdrawalTestService(db *repository.Database, cfg WithdrawalConfig) WithdrawalService {
+	uow := repository.NewUnitOfWork(db)
+	userRepo := repository.NewUserRepository(db)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	return NewWithdrawalService(
+		repository.NewWithdrawalRepository(db),
+		repository.NewHoldRepository(db),
+		userRepo,
+		ledgerRepo,
+		NewExpiryService(repository.NewAccrualLotRepository(db), userRepo, ledgerRepo, outboxRepo, uow, PointsExpiryConfig{}),
+		fakeWebhooks{},
+		outboxRepo,
+		repository.NewAuditRepository(db),
+		uow,
+		nil,
+		cfg,
+	)
+}
+
+func TestWithdrawConcurrentSingleBalance(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	// Баланс пополняется обычным путём начисления, чтобы лоты и журнал сходились.
+	const (
+		funds      = model.Money(100000)
+		sum        = model.Money(30000)
+		goroutines = 10
+	)
+	credit := newCreditTestService(db, repository.NewLedgerRepository(db))
+	credit.completeOrder(ctx, createTestOrder(t, db, user.ID), funds)
+
+	s := newWithdrawalTestService(db, WithdrawalConfig{})
+	userRepo := repository.NewUserRepository(db)
+
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		succeeded    int
+		insufficient int
+	)
+	base := time.Now().UnixNano()
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := s.Withdraw(ctx, user.ID, luhnNumber(fmt.Sprint(base+int64(i))), sum, "")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, ErrWithdrawalInsufficientFunds):
+				insufficient++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	want := int(funds / sum)
+	if succeeded != want {
+		t.Errorf("succeeded = %d, want %d", succeeded, want)
+	}
+	if insufficient != goroutines-want {
+		t.Errorf("insufficient funds = %d, want %d", insufficient, goroutines-want)
+	}
+	balance, err := userRepo.GetBalance(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get balance: %v", err)
+	}
+	if balance.Current < 0 {
+		t.Errorf("balance = %v, want >= 0", balance.Current)
+	}
+	if left := funds - model.Money(want)*sum; balance.Current != left {
+		t.Errorf("balance = %v, want %v", balance.Current, left)
+	}
+}
+
+func TestWithdrawRejectsHeldOrder(t *testing.T) {
+	db := openTestDB(t)
+	holder := createTestUser(t, db)
+	other := createTestUser(t, db)
+	ctx := context.Background()
+
+	credit := newCreditTestService(db, repository.NewLedgerRepository(db))
+	credit.completeOrder(ctx, createTestOrder(t, db, holder.ID), 10000)
+	credit.completeOrder(ctx, createTestOrder(t, db, other.ID), 10000)
+
+	s := newWithdrawalTestService(db, WithdrawalConfig{})
+	order := luhnNumber(fmt.Sprint(time.Now().UnixNano()))
+	hold, err := s.Hold(ctx, holder.ID, order, 5000, 0, "")
+	if err != nil {
+		t.Fatalf("hold: %v", err)
+	}
+
+	for _, userID := range []int64{holder.ID, other.ID} {
+		if err := s.Withdraw(ctx, userID, order, 1000, ""); !errors.Is(err, ErrHoldOrderExists) {
+			t.Errorf("withdraw by user %d: error = %v, want ErrHoldOrderExists", userID, err)
+		}
+	}
+	if _, err := s.Capture(ctx, holder.ID, hold.ID, 0); err != nil {
+		t.Errorf("capture after rejected withdrawals: %v", err)
+	}
+}
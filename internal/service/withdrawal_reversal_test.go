@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/model"
+	"github.com/Evgen-Mutagen/go-musthave-diploma-tpl/internal/repository"
+	"testing"
+)
+
+type fakeWithdrawalRepo struct {
+	repository.WithdrawalRepository
+	withdrawal *model.Withdrawal
+	reversals  map[int64]*model.WithdrawalReversal
+}
+
+func (f *fakeWithdrawalRepo) GetByOrderForUpdate(_ context.Context, orderNumber string) (*model.Withdrawal, error) {
+	if f.withdrawal.Order != orderNumber {
+		return nil, nil
+	}
+	copied := *f.withdrawal
+	return &copied, nil
+}
+
+func (f *fakeWithdrawalRepo) AddReversal(_ context.Context, reversal *model.WithdrawalReversal) error {
+	reversal.ID = int64(len(f.reversals) + 1)
+	copied := *reversal
+	f.reversals[reversal.ID] = &copied
+	return nil
+}
+
+func (f *fakeWithdrawalRepo) PendingReversalSum(_ context.Context, withdrawalID int64) (model.Money, error) {
+	var sum model.Money
+	for _, reversal := range f.reversals {
+		if reversal.WithdrawalID == withdrawalID && reversal.Status == model.ReversalPending {
+			sum += reversal.Sum
+		}
+	}
+	return sum, nil
+}
+
+func (f *fakeWithdrawalRepo) GetReversalForUpdate(_ context.Context, id int64) (*model.WithdrawalReversal, error) {
+	reversal, ok := f.reversals[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *reversal
+	return &copied, nil
+}
+
+func (f *fakeWithdrawalRepo) ReviewReversal(_ context.Context, reversal *model.WithdrawalReversal) error {
+	copied := *reversal
+	f.reversals[reversal.ID] = &copied
+	return nil
+}
+
+func TestReverseAboveThresholdNeedsAnotherAdmin(t *testing.T) {
+	repo := &fakeWithdrawalRepo{
+		withdrawal: &model.Withdrawal{ID: 1, Order: "2377225624", UserID: 5, Sum: 50000, Status: model.WithdrawalPending},
+		reversals:  make(map[int64]*model.WithdrawalReversal),
+	}
+	s := NewWithdrawalService(repo, nil, nil, nil, nil, fakeWebhooks{}, &fakeOutbox{}, fakeAudit{}, fakeUnitOfWork{}, nil,
+		WithdrawalConfig{ReversalApprovalThreshold: 10000})
+	ctx := context.Background()
+	support := model.AdminActor{UserID: 10, Role: model.RoleSupport}
+
+	if _, err := s.Reverse(ctx, model.AdminActor{UserID: 5, Role: model.RoleUser}, "2377225624", 0, "Cancelled"); !errors.Is(err, ErrWithdrawalForbidden) {
+		t.Fatalf("Reverse by user: error = %v, want ErrWithdrawalForbidden", err)
+	}
+
+	reversal, err := s.Reverse(ctx, support, "2377225624", 0, "Cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reversal.Status != model.ReversalPending || reversal.Sum != 50000 {
+		t.Fatalf("reversal = %s %s, want PENDING 500.00", reversal.Status, reversal.Sum)
+	}
+	// Ожидающий возврат уже занимает остаток списания.
+	if _, err := s.Reverse(ctx, support, "2377225624", 100, "Cancelled"); !errors.Is(err, ErrWithdrawalReversalTooLarge) {
+		t.Fatalf("second Reverse: error = %v, want ErrWithdrawalReversalTooLarge", err)
+	}
+
+	tests := []struct {
+		name  string
+		actor model.AdminActor
+		want  error
+	}{
+		{"requester", model.AdminActor{UserID: 10, Role: model.RoleAdmin}, ErrReversalSelfApproval},
+		{"support", model.AdminActor{UserID: 11, Role: model.RoleSupport}, ErrWithdrawalForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.ApproveReversal(ctx, tt.actor, reversal.ID); !errors.Is(err, tt.want) {
+				t.Errorf("ApproveReversal error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	rejected, err := s.RejectReversal(ctx, model.AdminActor{UserID: 12, Role: model.RoleAdmin}, reversal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Status != model.ReversalRejected {
+		t.Errorf("status = %s, want %s", rejected.Status, model.ReversalRejected)
+	}
+	if _, err := s.ApproveReversal(ctx, model.AdminActor{UserID: 12, Role: model.RoleAdmin}, reversal.ID); !errors.Is(err, ErrReversalNotPending) {
+		t.Errorf("ApproveReversal after reject: error = %v, want ErrReversalNotPending", err)
+	}
+}
@@ -3,5 +3,10 @@ package types
 type contextKey string
 
 const (
-	UserIDKey contextKey = "user_id"
+	UserIDKey    contextKey = "user_id"
+	SessionIDKey contextKey = "session_id"
+	// RoleKey есть только у запросов с access-токеном: API-ключи ролей не наследуют.
+	RoleKey contextKey = "role"
+	// ScopesKey есть в контексте только у запросов с API-ключом: права сессии не ограничены.
+	ScopesKey contextKey = "scopes"
 )
@@ -0,0 +1,79 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// Векторы RFC 6238, приложение B, для SHA-1 и секрета "12345678901234567890".
+// В RFC коды восьмизначные; здесь сравниваются их последние шесть цифр.
+func TestCodeRFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		step := Step(time.Unix(tt.unix, 0))
+		got, err := Code(secret, step)
+		if err != nil {
+			t.Fatalf("Code(%d) error = %v", tt.unix, err)
+		}
+		if want := tt.want[len(tt.want)-Digits:]; got != want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code, _ := Code(secret, current)
+	previous, _ := Code(secret, current-1)
+	old, _ := Code(secret, current-2)
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", code, current, true},
+		{"with spaces", code[:3] + " " + code[3:], current, true},
+		{"previous step within skew", previous, current - 1, true},
+		{"outside skew", old, 0, false},
+		{"wrong length", code[:5], 0, false},
+		{"wrong code", "000000", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(secret, tt.code, now, 1)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate = (%d, %v), want (%d, %v)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSecretRoundTrip(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret error = %v", err)
+	}
+	code, err := Code(secret, Step(time.Now()))
+	if err != nil {
+		t.Fatalf("Code error = %v", err)
+	}
+	if _, ok := Validate(secret, code, time.Now(), 1); !ok {
+		t.Errorf("Validate rejected a freshly generated code")
+	}
+}
@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrPoolClosed = errors.New("worker pool is closed")
+
+type Job func(ctx context.Context)
+
+// Pool — ограниченный пул воркеров с очередью фиксированной глубины.
+// Число одновременно работающих воркеров можно уменьшать (Shrink) и возвращать (Grow)
+// на лету: лишние воркеры не берут новые задачи, пока лимит снова не вырастет.
+type Pool struct {
+	jobs chan Job
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	size    int
+	limit   int
+	resized chan struct{}
+	closing chan struct{}
+	closed  bool
+}
+
+func NewPool(workers, queueSize int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	return &Pool{
+		jobs:    make(chan Job, queueSize),
+		size:    workers,
+		limit:   workers,
+		resized: make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+}
+
+func (p *Pool) Start(ctx context.Context) {
+	for i := 0; i < p.size; i++ {
+		p.wg.Add(1)
+		go p.run(ctx, i)
+	}
+}
+
+// Submit ставит задачу в очередь, блокируясь, пока в ней нет места.
+// Submit и Close вызываются из одной горутины-продюсера.
+func (p *Pool) Submit(ctx context.Context, job Job) error {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return ErrPoolClosed
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case p.jobs <- job:
+		return nil
+	}
+}
+
+// Close закрывает очередь и ждёт, пока воркеры доработают. Если контекст,
+// переданный в Start, отменён, оставшиеся в очереди задачи отбрасываются.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+		close(p.closing)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// Shrink вдвое уменьшает число активных воркеров, но не ниже одного.
+func (p *Pool) Shrink() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if limit := p.limit / 2; limit >= 1 && limit != p.limit {
+		p.setLimit(limit)
+	}
+	return p.limit
+}
+
+// Grow возвращает в работу одного воркера.
+func (p *Pool) Grow() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.limit < p.size {
+		p.setLimit(p.limit + 1)
+	}
+	return p.limit
+}
+
+func (p *Pool) Limit() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.limit
+}
+
+func (p *Pool) setLimit(limit int) {
+	p.limit = limit
+	close(p.resized)
+	p.resized = make(chan struct{})
+}
+
+func (p *Pool) run(ctx context.Context, id int) {
+	defer p.wg.Done()
+
+	for {
+		p.mu.Lock()
+		active := id < p.limit
+		resized := p.resized
+		p.mu.Unlock()
+
+		if !active {
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.closing:
+				return
+			case <-resized:
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-resized:
+			continue
+		case job, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			job(ctx)
+		}
+	}
+}
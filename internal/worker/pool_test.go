@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolShrinkAndGrowBounds(t *testing.T) {
+	p := NewPool(5, 0)
+
+	for _, want := range []int{2, 1, 1} {
+		if got := p.Shrink(); got != want {
+			t.Fatalf("Shrink() = %d, want %d", got, want)
+		}
+	}
+	for _, want := range []int{2, 3, 4, 5, 5} {
+		if got := p.Grow(); got != want {
+			t.Fatalf("Grow() = %d, want %d", got, want)
+		}
+	}
+}
+
+func TestPoolRespectsShrunkLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := NewPool(4, 16)
+	p.Shrink()
+	p.Start(ctx)
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		if err := p.Submit(ctx, func(context.Context) {
+			defer wg.Done()
+			n := running.Add(1)
+			for {
+				old := peak.Load()
+				if n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+		}); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > 2 {
+		t.Errorf("peak concurrency = %d, want at most 2", got)
+	}
+}
+
+func TestPoolSubmitAfterClose(t *testing.T) {
+	p := NewPool(1, 0)
+	p.Start(context.Background())
+	p.Close()
+
+	if err := p.Submit(context.Background(), func(context.Context) {}); err != ErrPoolClosed {
+		t.Fatalf("Submit after Close = %v, want ErrPoolClosed", err)
+	}
+}
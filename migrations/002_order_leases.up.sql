@@ -0,0 +1,7 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS lease_owner TEXT,
+    ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS orders_unprocessed_lease_idx
+    ON orders(uploaded_at, lease_expires_at)
+    WHERE status IN ('NEW', 'PROCESSING');
@@ -0,0 +1,9 @@
+ALTER TABLE users
+    ALTER COLUMN balance TYPE NUMERIC(18, 2) USING round(balance::numeric, 2),
+    ALTER COLUMN withdrawn TYPE NUMERIC(18, 2) USING round(withdrawn::numeric, 2);
+
+ALTER TABLE orders
+    ALTER COLUMN accrual TYPE NUMERIC(18, 2) USING round(accrual::numeric, 2);
+
+ALTER TABLE withdrawals
+    ALTER COLUMN sum TYPE NUMERIC(18, 2) USING round(sum::numeric, 2);
@@ -0,0 +1,64 @@
+CREATE SEQUENCE IF NOT EXISTS ledger_transaction_id_seq;
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+                                              id BIGSERIAL PRIMARY KEY,
+                                              transaction_id BIGINT NOT NULL,
+                                              account TEXT NOT NULL,
+                                              user_id BIGINT NOT NULL REFERENCES users(id),
+                                              amount NUMERIC(18, 2) NOT NULL,
+                                              kind TEXT NOT NULL,
+                                              order_number TEXT,
+                                              withdrawal_id BIGINT REFERENCES withdrawals(id),
+                                              description TEXT NOT NULL DEFAULT '',
+                                              created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_user_account_idx ON ledger_entries(user_id, account, id);
+CREATE INDEX IF NOT EXISTS ledger_entries_transaction_id_idx ON ledger_entries(transaction_id);
+
+CREATE OR REPLACE FUNCTION ledger_entries_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger entries are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_entries_immutable ON ledger_entries;
+CREATE TRIGGER ledger_entries_immutable
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_entries_immutable();
+
+-- Перенос истории: каждое начисление и списание становится парой проводок.
+WITH accruals AS MATERIALIZED (
+    SELECT number, user_id, accrual, uploaded_at, nextval('ledger_transaction_id_seq') AS transaction_id
+    FROM orders
+    WHERE status = 'PROCESSED' AND accrual > 0
+)
+INSERT INTO ledger_entries (transaction_id, account, user_id, amount, kind, order_number, created_at)
+SELECT a.transaction_id, legs.account, a.user_id, legs.sign * a.accrual, 'ACCRUAL', a.number, a.uploaded_at
+FROM accruals a
+         CROSS JOIN (VALUES ('user', 1), ('accrual', -1)) AS legs(account, sign);
+
+WITH debits AS MATERIALIZED (
+    SELECT id, order_number, user_id, sum, processed_at, nextval('ledger_transaction_id_seq') AS transaction_id
+    FROM withdrawals
+)
+INSERT INTO ledger_entries (transaction_id, account, user_id, amount, kind, order_number, withdrawal_id, created_at)
+SELECT d.transaction_id, legs.account, d.user_id, legs.sign * d.sum, 'WITHDRAWAL', d.order_number, d.id, d.processed_at
+FROM debits d
+         CROSS JOIN (VALUES ('user', -1), ('redemption', 1)) AS legs(account, sign);
+
+-- Расхождения, накопленные до появления журнала, фиксируются корректировкой,
+-- чтобы журнал сходился с текущими балансами.
+WITH drift AS MATERIALIZED (
+    SELECT u.id AS user_id,
+           u.balance - COALESCE(SUM(l.amount), 0) AS delta,
+           nextval('ledger_transaction_id_seq') AS transaction_id
+    FROM users u
+             LEFT JOIN ledger_entries l ON l.user_id = u.id AND l.account = 'user'
+    GROUP BY u.id, u.balance
+    HAVING u.balance <> COALESCE(SUM(l.amount), 0)
+)
+INSERT INTO ledger_entries (transaction_id, account, user_id, amount, kind, description)
+SELECT d.transaction_id, legs.account, d.user_id, legs.sign * d.delta, 'ADJUSTMENT', 'opening balance reconciliation'
+FROM drift d
+         CROSS JOIN (VALUES ('user', 1), ('adjustment', -1)) AS legs(account, sign);
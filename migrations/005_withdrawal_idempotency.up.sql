@@ -0,0 +1,27 @@
+-- До этой миграции один номер заказа мог быть списан несколько раз. Такие строки уже
+-- проведены по балансу и журналу, поэтому не удаляются: все, кроме самой ранней,
+-- помечаются legacy_duplicate и в уникальность не входят.
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS legacy_duplicate BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE withdrawals w
+SET legacy_duplicate = TRUE
+WHERE EXISTS (
+    SELECT 1 FROM withdrawals earlier
+    WHERE earlier.order_number = w.order_number
+      AND earlier.id < w.id
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS withdrawals_order_number_uniq ON withdrawals(order_number) WHERE NOT legacy_duplicate;
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+                                                user_id BIGINT NOT NULL REFERENCES users(id),
+                                                key TEXT NOT NULL,
+                                                request_hash TEXT NOT NULL,
+                                                status_code INTEGER,
+                                                response_body BYTEA,
+                                                created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                                completed_at TIMESTAMP WITH TIME ZONE,
+                                                PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys(created_at);
@@ -0,0 +1,18 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS last_polled_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+                                                    id BIGSERIAL PRIMARY KEY,
+                                                    order_number TEXT NOT NULL REFERENCES orders(number),
+                                                    status order_status NOT NULL,
+                                                    accrual NUMERIC(18, 2) NOT NULL DEFAULT 0,
+                                                    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS order_status_history_order_idx ON order_status_history(order_number, id);
+
+-- Для уже загруженных заказов известны только момент загрузки и текущий статус.
+INSERT INTO order_status_history (order_number, status, changed_at)
+SELECT number, 'NEW', uploaded_at FROM orders;
+
+INSERT INTO order_status_history (order_number, status, accrual)
+SELECT number, status, accrual FROM orders WHERE status <> 'NEW';
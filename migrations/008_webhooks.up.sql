@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+                                        id BIGSERIAL PRIMARY KEY,
+                                        user_id BIGINT NOT NULL REFERENCES users(id),
+                                        url TEXT NOT NULL,
+                                        secret TEXT NOT NULL,
+                                        events TEXT[] NOT NULL,
+                                        active BOOLEAN NOT NULL DEFAULT TRUE,
+                                        created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_user_id_idx ON webhooks(user_id) WHERE active;
+
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+                                              id BIGSERIAL PRIMARY KEY,
+                                              webhook_id BIGINT NOT NULL REFERENCES webhooks(id),
+                                              event_type TEXT NOT NULL,
+                                              payload JSONB NOT NULL,
+                                              status TEXT NOT NULL DEFAULT 'PENDING',
+                                              attempts INTEGER NOT NULL DEFAULT 0,
+                                              next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                              created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                              delivered_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS webhook_outbox_due_idx ON webhook_outbox(next_attempt_at) WHERE status = 'PENDING';
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+                                                  id BIGSERIAL PRIMARY KEY,
+                                                  outbox_id BIGINT NOT NULL REFERENCES webhook_outbox(id),
+                                                  webhook_id BIGINT NOT NULL REFERENCES webhooks(id),
+                                                  attempt INTEGER NOT NULL,
+                                                  status_code INTEGER,
+                                                  error TEXT NOT NULL DEFAULT '',
+                                                  duration_ms INTEGER NOT NULL,
+                                                  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries(webhook_id, id);
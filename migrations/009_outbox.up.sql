@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS outbox (
+                                      id BIGSERIAL PRIMARY KEY,
+                                      event_type TEXT NOT NULL,
+                                      aggregate_type TEXT NOT NULL,
+                                      aggregate_id TEXT NOT NULL,
+                                      user_id BIGINT,
+                                      payload JSONB NOT NULL,
+                                      occurred_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                      published_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox(id) WHERE published_at IS NULL;
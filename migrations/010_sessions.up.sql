@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS sessions (
+                                        id TEXT PRIMARY KEY,
+                                        user_id BIGINT NOT NULL REFERENCES users(id),
+                                        refresh_token_hash TEXT NOT NULL,
+                                        created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                        last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                        expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                        revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions(user_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions(expires_at);
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+                                              scope TEXT NOT NULL,
+                                              key TEXT NOT NULL,
+                                              failures INTEGER NOT NULL DEFAULT 0,
+                                              last_failed_at TIMESTAMP WITH TIME ZONE,
+                                              locked_until TIMESTAMP WITH TIME ZONE,
+                                              PRIMARY KEY (scope, key)
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+                                         id BIGSERIAL PRIMARY KEY,
+                                         action TEXT NOT NULL,
+                                         user_id BIGINT REFERENCES users(id),
+                                         login TEXT NOT NULL DEFAULT '',
+                                         ip TEXT NOT NULL DEFAULT '',
+                                         details JSONB NOT NULL DEFAULT '{}',
+                                         created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log(user_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_action_idx ON audit_log(action, created_at);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+                                         user_id BIGINT PRIMARY KEY REFERENCES users(id),
+                                         secret TEXT NOT NULL,
+                                         confirmed_at TIMESTAMP WITH TIME ZONE,
+                                         last_used_step BIGINT NOT NULL DEFAULT 0,
+                                         created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+                                              id BIGSERIAL PRIMARY KEY,
+                                              user_id BIGINT NOT NULL REFERENCES users(id),
+                                              code_hash TEXT NOT NULL,
+                                              used_at TIMESTAMP WITH TIME ZONE,
+                                              created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS recovery_codes_user_code_idx ON recovery_codes(user_id, code_hash);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+                                        id BIGSERIAL PRIMARY KEY,
+                                        user_id BIGINT NOT NULL REFERENCES users(id),
+                                        name TEXT NOT NULL,
+                                        prefix TEXT NOT NULL,
+                                        key_hash TEXT NOT NULL UNIQUE,
+                                        scopes TEXT[] NOT NULL,
+                                        created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                        last_used_at TIMESTAMP WITH TIME ZONE,
+                                        revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys(user_id) WHERE revoked_at IS NULL;
@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user';
+
+DO $$
+    BEGIN
+        IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_role_check') THEN
+            ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'support', 'admin'));
+        END IF;
+    END $$;
+
+-- Кто выполнил действие, если это не сам пользователь (например, сотрудник через /api/admin).
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS actor_id BIGINT REFERENCES users(id);
+
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log(actor_id, id) WHERE actor_id IS NOT NULL;
+
+-- Первого администратора назначают вручную:
+-- UPDATE users SET role = 'admin' WHERE login = '...';
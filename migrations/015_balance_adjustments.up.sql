@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS balance_adjustments (
+                                                   id BIGSERIAL PRIMARY KEY,
+                                                   user_id BIGINT NOT NULL REFERENCES users(id),
+                                                   amount NUMERIC(18, 2) NOT NULL CHECK (amount <> 0),
+                                                   reason TEXT NOT NULL,
+                                                   ticket TEXT NOT NULL,
+                                                   status TEXT NOT NULL CHECK (status IN ('PENDING', 'APPLIED', 'REJECTED')),
+                                                   created_by BIGINT NOT NULL REFERENCES users(id),
+                                                   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                                   reviewed_by BIGINT REFERENCES users(id),
+                                                   reviewed_at TIMESTAMP WITH TIME ZONE,
+                                                   applied_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS balance_adjustments_user_id_idx ON balance_adjustments(user_id, id);
+CREATE INDEX IF NOT EXISTS balance_adjustments_pending_idx ON balance_adjustments(id) WHERE status = 'PENDING';
@@ -0,0 +1,28 @@
+-- Существующие списания уже проведены, поэтому по умолчанию COMPLETED; новые создаются в PENDING.
+ALTER TABLE withdrawals
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'COMPLETED',
+    ADD COLUMN IF NOT EXISTS reversed_sum NUMERIC(18, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE;
+
+DO $$
+    BEGIN
+        IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'withdrawals_status_check') THEN
+            ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_status_check
+                CHECK (status IN ('PENDING', 'COMPLETED', 'REVERSED'));
+        END IF;
+        IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'withdrawals_reversed_sum_check') THEN
+            ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_reversed_sum_check
+                CHECK (reversed_sum >= 0 AND reversed_sum <= sum);
+        END IF;
+    END $$;
+
+CREATE TABLE IF NOT EXISTS withdrawal_reversals (
+                                                    id BIGSERIAL PRIMARY KEY,
+                                                    withdrawal_id BIGINT NOT NULL REFERENCES withdrawals(id),
+                                                    sum NUMERIC(18, 2) NOT NULL CHECK (sum > 0),
+                                                    reason TEXT NOT NULL,
+                                                    actor_id BIGINT NOT NULL REFERENCES users(id),
+                                                    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS withdrawal_reversals_withdrawal_id_idx ON withdrawal_reversals(withdrawal_id);
@@ -0,0 +1,26 @@
+-- held — сумма активных резервов. Доступно к списанию balance - held.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS held NUMERIC(18, 2) NOT NULL DEFAULT 0;
+
+DO $$
+    BEGIN
+        IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_held_check') THEN
+            ALTER TABLE users ADD CONSTRAINT users_held_check CHECK (held >= 0);
+        END IF;
+    END $$;
+
+CREATE TABLE IF NOT EXISTS balance_holds (
+                                             id BIGSERIAL PRIMARY KEY,
+                                             user_id BIGINT NOT NULL REFERENCES users(id),
+                                             order_number TEXT NOT NULL,
+                                             amount NUMERIC(18, 2) NOT NULL CHECK (amount > 0),
+                                             status TEXT NOT NULL CHECK (status IN ('ACTIVE', 'CAPTURED', 'RELEASED', 'EXPIRED')),
+                                             expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                             created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                             resolved_at TIMESTAMP WITH TIME ZONE,
+                                             withdrawal_id BIGINT REFERENCES withdrawals(id)
+);
+
+-- На один заказ — не больше одного активного резерва.
+CREATE UNIQUE INDEX IF NOT EXISTS balance_holds_active_order_uniq ON balance_holds(order_number) WHERE status = 'ACTIVE';
+CREATE INDEX IF NOT EXISTS balance_holds_user_id_idx ON balance_holds(user_id, id);
+CREATE INDEX IF NOT EXISTS balance_holds_expires_at_idx ON balance_holds(expires_at) WHERE status = 'ACTIVE';
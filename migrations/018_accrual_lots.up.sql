@@ -0,0 +1,25 @@
+-- Лоты начислений: каждое зачисление баллов — отдельный лот со своим сроком сгорания.
+-- Списания расходуют лоты по порядку поступления (FIFO), сумма remaining по
+-- пользователю равна users.balance. expires_at NULL — лот не сгорает.
+CREATE TABLE IF NOT EXISTS accrual_lots (
+                                            id BIGSERIAL PRIMARY KEY,
+                                            user_id BIGINT NOT NULL REFERENCES users(id),
+                                            kind TEXT NOT NULL,
+                                            order_number TEXT,
+                                            amount NUMERIC(18, 2) NOT NULL CHECK (amount > 0),
+                                            remaining NUMERIC(18, 2) NOT NULL CHECK (remaining >= 0 AND remaining <= amount),
+                                            expired NUMERIC(18, 2) NOT NULL DEFAULT 0,
+                                            created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                            expires_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS accrual_lots_open_idx ON accrual_lots(user_id, created_at, id) WHERE remaining > 0;
+CREATE INDEX IF NOT EXISTS accrual_lots_expires_at_idx ON accrual_lots(expires_at, user_id) WHERE remaining > 0;
+
+-- Текущие балансы переносятся одним лотом OPENING. Срок ему назначает сервер при старте
+-- (ExpiryService.ApplyOpeningExpiry), когда задан -points-expiry-months.
+INSERT INTO accrual_lots (user_id, kind, amount, remaining)
+SELECT u.id, 'OPENING', u.balance, u.balance
+FROM users u
+WHERE u.balance > 0
+  AND NOT EXISTS (SELECT 1 FROM accrual_lots l WHERE l.user_id = u.id);
@@ -0,0 +1,6 @@
+-- Уровень лояльности пересчитывается ночной задачей по начислениям за скользящее окно.
+-- Набор уровней задаётся конфигурацией, поэтому в схеме нет ограничения на значения.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier TEXT NOT NULL DEFAULT 'BRONZE';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier_updated_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS ledger_entries_user_kind_created_idx ON ledger_entries(user_id, kind, created_at) WHERE account = 'user';
@@ -0,0 +1,42 @@
+-- Сообщения вебхуков переезжают в общий outbox. Строка с webhook_id — доставка подписке
+-- со своим статусом и повторами, без него — доменное событие для публикатора.
+ALTER TABLE outbox
+    ADD COLUMN IF NOT EXISTS webhook_id BIGINT REFERENCES webhooks(id),
+    ADD COLUMN IF NOT EXISTS status TEXT,
+    ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS legacy_webhook_outbox_id BIGINT;
+
+DO $$
+    BEGIN
+        IF EXISTS (SELECT 1 FROM pg_tables WHERE tablename = 'webhook_outbox') THEN
+            INSERT INTO outbox (event_type, aggregate_type, aggregate_id, user_id, payload, occurred_at, published_at,
+                                webhook_id, status, attempts, next_attempt_at, legacy_webhook_outbox_id)
+            SELECT m.event_type, 'webhook', m.webhook_id::text, w.user_id, m.payload, m.created_at, m.delivered_at,
+                   m.webhook_id, m.status, m.attempts, m.next_attempt_at, m.id
+            FROM webhook_outbox m
+            JOIN webhooks w ON w.id = m.webhook_id
+            ORDER BY m.id;
+
+            ALTER TABLE webhook_deliveries DROP CONSTRAINT IF EXISTS webhook_deliveries_outbox_id_fkey;
+            UPDATE webhook_deliveries d
+            SET outbox_id = o.id
+            FROM outbox o
+            WHERE o.legacy_webhook_outbox_id = d.outbox_id;
+            ALTER TABLE webhook_deliveries ADD CONSTRAINT webhook_deliveries_outbox_id_fkey
+                FOREIGN KEY (outbox_id) REFERENCES outbox(id);
+
+            DROP TABLE webhook_outbox;
+        END IF;
+        IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'outbox_webhook_status_check') THEN
+            ALTER TABLE outbox ADD CONSTRAINT outbox_webhook_status_check
+                CHECK ((webhook_id IS NULL) = (status IS NULL));
+        END IF;
+    END $$;
+
+ALTER TABLE outbox DROP COLUMN IF EXISTS legacy_webhook_outbox_id;
+
+DROP INDEX IF EXISTS outbox_unpublished_idx;
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox(id) WHERE published_at IS NULL AND webhook_id IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_published_at_idx ON outbox(published_at) WHERE webhook_id IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_webhook_due_idx ON outbox(next_attempt_at) WHERE status = 'PENDING';
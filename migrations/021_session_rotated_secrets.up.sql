@@ -0,0 +1,9 @@
+-- Хэши уже заменённых refresh-секретов. Повтор одного из них — признак утечки, и сессия
+-- отзывается; произвольный секрет при известном sid отзыва не вызывает.
+CREATE TABLE IF NOT EXISTS session_rotated_secrets (
+                                                       refresh_token_hash TEXT PRIMARY KEY,
+                                                       session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+                                                       rotated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS session_rotated_secrets_session_idx ON session_rotated_secrets(session_id);
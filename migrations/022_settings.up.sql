@@ -0,0 +1,7 @@
+-- Настройки сервера, которые нужны и другим процессам (gmadmin). Сервер записывает их
+-- при старте, поэтому консольная утилита не может подставить свой порог подтверждения.
+CREATE TABLE IF NOT EXISTS settings (
+                                        key TEXT PRIMARY KEY,
+                                        value TEXT NOT NULL,
+                                        updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,18 @@
+-- Возвраты больше порога подтверждения ждут другого администратора. Прежние возвраты уже проведены.
+ALTER TABLE withdrawal_reversals
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'APPLIED',
+    ADD COLUMN IF NOT EXISTS reviewed_by BIGINT REFERENCES users(id),
+    ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMP WITH TIME ZONE;
+
+DO $$
+    BEGIN
+        IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'withdrawal_reversals_status_check') THEN
+            ALTER TABLE withdrawal_reversals ADD CONSTRAINT withdrawal_reversals_status_check
+                CHECK (status IN ('PENDING', 'APPLIED', 'REJECTED'));
+        END IF;
+    END $$;
+
+CREATE INDEX IF NOT EXISTS withdrawal_reversals_pending_idx ON withdrawal_reversals(withdrawal_id) WHERE status = 'PENDING';
+
+-- Для автоматического подтверждения списаний, по которым партнёр не ответил.
+CREATE INDEX IF NOT EXISTS withdrawals_pending_idx ON withdrawals(processed_at) WHERE status = 'PENDING';
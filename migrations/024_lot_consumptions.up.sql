@@ -0,0 +1,11 @@
+-- Какие лоты израсходовало списание. Возврат кладёт баллы обратно в эти же лоты,
+-- чтобы срок сгорания не начинался заново.
+CREATE TABLE IF NOT EXISTS lot_consumptions (
+                                                id BIGSERIAL PRIMARY KEY,
+                                                lot_id BIGINT NOT NULL REFERENCES accrual_lots(id),
+                                                withdrawal_id BIGINT NOT NULL REFERENCES withdrawals(id),
+                                                amount NUMERIC(18, 2) NOT NULL CHECK (amount > 0),
+                                                restored NUMERIC(18, 2) NOT NULL DEFAULT 0 CHECK (restored >= 0 AND restored <= amount)
+);
+
+CREATE INDEX IF NOT EXISTS lot_consumptions_withdrawal_id_idx ON lot_consumptions(withdrawal_id);
@@ -0,0 +1,42 @@
+-- id записи истории выдаётся при вставке, а видна запись после коммита, поэтому по id
+-- нельзя возобновить поток без пропусков. commit_seq выдаётся в момент коммита под
+-- общей блокировкой: транзакции, пишущие историю, коммитятся по очереди, и порядок
+-- commit_seq совпадает с порядком, в котором записи становятся видны.
+CREATE SEQUENCE IF NOT EXISTS order_event_commit_seq;
+
+ALTER TABLE order_status_history ADD COLUMN IF NOT EXISTS commit_seq BIGINT;
+
+-- Уже записанные события сохраняют свои номера: Last-Event-ID прежних клиентов остаётся верным.
+UPDATE order_status_history SET commit_seq = id WHERE commit_seq IS NULL;
+SELECT setval('order_event_commit_seq', GREATEST((SELECT MAX(id) FROM order_status_history), 1));
+
+CREATE UNIQUE INDEX IF NOT EXISTS order_status_history_commit_seq_idx ON order_status_history(commit_seq);
+
+CREATE OR REPLACE FUNCTION assign_order_event_commit_seq() RETURNS trigger AS $$
+DECLARE
+    seq BIGINT;
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('order_event_commit_seq'));
+    seq := nextval('order_event_commit_seq');
+    UPDATE order_status_history SET commit_seq = seq WHERE id = NEW.id;
+
+    PERFORM pg_notify('order_events', json_build_object(
+            'id', seq,
+            'user_id', (SELECT user_id FROM orders WHERE number = NEW.order_number),
+            'number', NEW.order_number,
+            'status', NEW.status,
+            'accrual', NEW.accrual,
+            'changed_at', NEW.changed_at
+        )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Уведомление теперь отправляет отложенный триггер: в нём уже известен commit_seq.
+DROP TRIGGER IF EXISTS order_status_history_notify ON order_status_history;
+
+DROP TRIGGER IF EXISTS order_status_history_commit_seq ON order_status_history;
+CREATE CONSTRAINT TRIGGER order_status_history_commit_seq
+    AFTER INSERT ON order_status_history
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION assign_order_event_commit_seq();
@@ -0,0 +1,31 @@
+-- Логины сравниваются без учёта регистра и в NFC (service.NormalizeLogin). Существующие
+-- логины приводятся к этому виду, если это не сводит два аккаунта к одному логину.
+-- Совпавшие остаются как были и находятся при входе по точному написанию
+-- (service.FindUserByLogin); список пишется в лог миграции, чтобы их развели вручную.
+CREATE TEMP TABLE login_normalization AS
+SELECT id,
+       login,
+       lower(normalize(btrim(login), NFC)) AS normalized,
+       COUNT(*) OVER (PARTITION BY lower(normalize(btrim(login), NFC))) AS same
+FROM users;
+
+UPDATE users u
+SET login = n.normalized
+FROM login_normalization n
+WHERE u.id = n.id AND n.same = 1 AND u.login <> n.normalized;
+
+DO $$
+    DECLARE
+        collision RECORD;
+    BEGIN
+        FOR collision IN
+            SELECT normalized, string_agg(id::text, ', ' ORDER BY id) AS ids
+            FROM login_normalization
+            WHERE same > 1
+            GROUP BY normalized
+        LOOP
+            RAISE WARNING 'logins of users % collide as %; left unchanged', collision.ids, collision.normalized;
+        END LOOP;
+    END $$;
+
+DROP TABLE login_normalization;